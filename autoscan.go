@@ -1,25 +1,80 @@
 package autoscan
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"regexp"
+	"regexp/syntax"
+	"strings"
 	"time"
+
+	"github.com/rs/zerolog/hlog"
 )
 
 // A Scan is at the core of Autoscan.
 // It defines which path to scan and with which (trigger-given) priority.
+// Removed is set when the trigger reported the files within Folder as deleted.
+// ID correlates the log lines of the Scan, from the Trigger to the Targets.
+// ItemID is set when the trigger knows the media server item of Folder,
+// Targets supporting it refresh the item without matching Folder.
+// Event tells what happened to the files within Folder, such as EventUpgrade,
+// it is empty when the trigger does not know.
+// File is the path of the changed file within Folder,
+// it is empty when the trigger does not know or when several files changed.
+// CollectionName names a media server collection to refresh instead of Folder,
+// Targets without collections scan Folder as usual.
+// ItemIDs lists several media server items of Folder for bulk operations,
+// Targets supporting it refresh all of them, together with ItemID, without matching Folder.
+// LibraryHint names the media server library of Folder when the trigger knows it better than the path,
+// Targets supporting it fall back to matching Folder when the library does not exist.
 //
 // The Scan is used across Triggers, Targets and the Processor.
 type Scan struct {
-	Folder   string
-	Priority int
-	Time     time.Time
+	Folder         string
+	Priority       int
+	Time           time.Time
+	Removed        bool
+	ID             string
+	ItemID         string
+	ItemIDs        []string
+	Event          string
+	File           string
+	CollectionName string
+	LibraryHint    string
 }
 
+// Events of a Scan, set by the triggers.
+const (
+	EventAdd      = "add"
+	EventUpgrade  = "upgrade"
+	EventRename   = "rename"
+	EventDelete   = "delete"
+	EventMetadata = "metadata"
+)
+
+// A ProcessorFunc enqueues scans.
+// Scans without an ID are assigned one in place,
+// so the caller can log the IDs of the scans it passed on.
 type ProcessorFunc func(...Scan) error
 
+// NewScanID returns a short random ID for a Scan.
+func NewScanID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%08x", time.Now().UnixNano()&0xffffffff)
+	}
+
+	return hex.EncodeToString(b)
+}
+
 type Trigger func(ProcessorFunc)
 
 // A HTTPTrigger is a Trigger which does not run in the background,
@@ -30,11 +85,83 @@ type HTTPTrigger func(ProcessorFunc) http.Handler
 
 // A Target receives a Scan from the Processor and translates the Scan
 // into a format understood by the target.
+//
+// The given context is cancelled when autoscan shuts down
+// or when the scan exceeds its timeout.
 type Target interface {
-	Scan(Scan) error
+	Scan(context.Context, Scan) error
 	Available() error
 }
 
+// A Library is a library of a Target as reported by its media server.
+type Library struct {
+	Name  string
+	Type  string
+	Paths []string
+}
+
+// A LibraryLister is a Target which can list its libraries.
+type LibraryLister interface {
+	Libraries(context.Context) ([]Library, error)
+}
+
+// A LibraryRefresher is a Target which can refresh a whole library on demand,
+// regardless of how it refreshes the folders of a Scan.
+// All libraries are refreshed when the name is empty, the names of the refreshed libraries are returned.
+// Unknown libraries return ErrUnknownLibrary.
+type LibraryRefresher interface {
+	RefreshLibrary(ctx context.Context, name string) ([]string, error)
+}
+
+// An Inspection describes how a Target will handle a pending Scan.
+// ItemID is empty when the Target did not match the folder to an item yet.
+type Inspection struct {
+	Library string
+	ItemID  string
+	Precise bool
+}
+
+// A ScanInspector is a Target which can describe how it will handle a Scan,
+// without contacting its media server.
+// Inspect returns false when the Target cannot tell, for example when the Scan is outside of its libraries.
+type ScanInspector interface {
+	Inspect(Scan) (Inspection, bool)
+}
+
+// A TokenRotator is a Target whose token can be replaced at runtime, for example after a config reload.
+// In-flight requests finish with the previous token.
+type TokenRotator interface {
+	SetToken(string)
+}
+
+// A ScanTimeouter is a Target which limits the time it may spend on a single Scan.
+// Scans exceeding the timeout are cancelled and retried for this Target only.
+type ScanTimeouter interface {
+	ScanTimeout() time.Duration
+}
+
+// A SettleDelayer is a Target which receives a Scan only after the settle delay
+// has passed since the Scan became eligible, so related changes can still coalesce.
+type SettleDelayer interface {
+	SettleDelay() time.Duration
+}
+
+// A RetryPolicy controls the retries of the scans held for a Target which is not ready
+// or exceeded its scan timeout. The delay before the next retry starts at Backoff
+// and doubles with every failed retry, up to MaxBackoff.
+// A held scan is dropped after MaxRetries failed retries, it is retried until it succeeds when zero.
+type RetryPolicy struct {
+	MaxRetries int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// A RetryPolicer is a Target with a retry policy of its own,
+// its non-zero fields override the retry policy of the Processor for this Target.
+type RetryPolicer interface {
+	RetryPolicy() RetryPolicy
+}
+
 var (
 	// ErrTargetUnavailable may occur when a Target goes offline
 	// or suffers from fatal errors. In this case, the processor
@@ -52,6 +179,21 @@ var (
 	// not available on the file system. Processing should halt
 	// until all anchors are available.
 	ErrAnchorUnavailable = errors.New("anchor file is unavailable")
+
+	// ErrTargetNotReady indicates that a Target cannot receive scans yet,
+	// for example when its ready path is not available on the file system
+	// or while media is being played. Scans for this Target are held
+	// until it is ready, other Targets are unaffected.
+	ErrTargetNotReady = errors.New("target not ready")
+
+	// ErrUnknownLibrary indicates that a Target has no library of the given name.
+	ErrUnknownLibrary = errors.New("unknown library")
+
+	// ErrScanRefused indicates that a Target refuses to scan a scan,
+	// for example when a misconfigured rewrite turned its folder into
+	// the root. The scan is dropped for this Target, other Targets
+	// are unaffected.
+	ErrScanRefused = errors.New("scan refused")
 )
 
 type Rewrite struct {
@@ -61,28 +203,119 @@ type Rewrite struct {
 
 type Rewriter func(string) string
 
+// NewRewriter applies the most specific rule matching a path,
+// which is the rule whose from pattern has the most literal characters.
+// Rules which are equally specific are tried in the given order,
+// so several local roots may map to the same root regardless of the order of the rules.
 func NewRewriter(rewriteRules []Rewrite) (Rewriter, error) {
-	var rewrites []regexp.Regexp
+	rewrites, err := compileRewrites(rewriteRules)
+	if err != nil {
+		return nil, err
+	}
+
+	rewriter := func(input string) string {
+		if i := matchRewrite(rewrites, input); i >= 0 {
+			return rewrites[i].ReplaceAllString(input, rewriteRules[i].To)
+		}
+
+		return input
+	}
+
+	return rewriter, nil
+}
+
+// MatchRewrite rewrites the input like NewRewriter does and
+// returns the index of the rule which matched, or -1 if none did.
+func MatchRewrite(rewriteRules []Rewrite, input string) (string, int, error) {
+	rewrites, err := compileRewrites(rewriteRules)
+	if err != nil {
+		return "", -1, err
+	}
+
+	i := matchRewrite(rewrites, input)
+	if i < 0 {
+		return input, -1, nil
+	}
+
+	return rewrites[i].ReplaceAllString(input, rewriteRules[i].To), i, nil
+}
+
+func compileRewrites(rewriteRules []Rewrite) ([]*regexp.Regexp, error) {
+	rewrites := make([]*regexp.Regexp, 0, len(rewriteRules))
+	seen := make(map[string]string, len(rewriteRules))
+
 	for _, rule := range rewriteRules {
+		// the same pattern rewritten in two ways would depend on the order of the rules.
+		if to, ok := seen[rule.From]; ok && to != rule.To {
+			return nil, fmt.Errorf("rewrite %q: rewritten to both %q and %q", rule.From, to, rule.To)
+		}
+		seen[rule.From] = rule.To
+
 		re, err := regexp.Compile(rule.From)
 		if err != nil {
 			return nil, err
 		}
 
-		rewrites = append(rewrites, *re)
+		rewrites = append(rewrites, re)
 	}
 
-	rewriter := func(input string) string {
-		for i, r := range rewrites {
-			if r.MatchString(input) {
-				return r.ReplaceAllString(input, rewriteRules[i].To)
-			}
+	return rewrites, nil
+}
+
+// matchRewrite returns the index of the most specific rewrite matching the input, or -1 if none does.
+func matchRewrite(rewrites []*regexp.Regexp, input string) int {
+	match, specificity := -1, -1
+	for i, re := range rewrites {
+		if !re.MatchString(input) {
+			continue
 		}
 
-		return input
+		if n := literalLength(re); n > specificity {
+			match, specificity = i, n
+		}
 	}
 
-	return rewriter, nil
+	return match
+}
+
+// literalLength counts the characters every match of the pattern has to contain literally,
+// for example 11 for "^/mnt/disk1/" and 5 for "^/mnt/(.*)".
+func literalLength(re *regexp.Regexp) int {
+	// the pattern compiled already.
+	tree, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return 0
+	}
+
+	return literals(tree.Simplify())
+}
+
+func literals(re *syntax.Regexp) int {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return len(re.Rune)
+	case syntax.OpCapture, syntax.OpPlus:
+		return literals(re.Sub[0])
+	case syntax.OpRepeat:
+		return re.Min * literals(re.Sub[0])
+	case syntax.OpConcat:
+		n := 0
+		for _, sub := range re.Sub {
+			n += literals(sub)
+		}
+		return n
+	case syntax.OpAlternate:
+		// only the shortest alternative is certain to match.
+		n := -1
+		for _, sub := range re.Sub {
+			if l := literals(sub); n < 0 || l < n {
+				n = l
+			}
+		}
+		return n
+	default:
+		return 0
+	}
 }
 
 type Filterer func(string) bool
@@ -142,3 +375,173 @@ func NewFilterer(includes []string, excludes []string) (Filterer, error) {
 
 	return fn, nil
 }
+
+// An EventFilter reports whether a Trigger handles events of the given type.
+type EventFilter func(string) bool
+
+// NewEventFilter creates an EventFilter allowing the given event types, compared case-insensitively.
+// All event types are allowed when none are given.
+func NewEventFilter(events []string) EventFilter {
+	if len(events) == 0 {
+		return func(string) bool { return true }
+	}
+
+	return func(event string) bool {
+		for _, e := range events {
+			if strings.EqualFold(e, event) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// An Allowlist restricts a http.Handler to the clients within the allowed networks.
+type Allowlist func(http.Handler) http.Handler
+
+// NewAllowlist creates an Allowlist for the given CIDRs, all clients are allowed when none are given.
+//
+// The X-Forwarded-For header is only used when trustProxy is set, as any client can set it.
+// In that case the last address of the header, which was added by the proxy, identifies the client.
+func NewAllowlist(cidrs []string, trustProxy bool) (Allowlist, error) {
+	networks := make([]*net.IPNet, 0)
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("parsing allowed cidr: %v: %w", cidr, err)
+		}
+
+		networks = append(networks, network)
+	}
+
+	if len(networks) == 0 {
+		return func(next http.Handler) http.Handler { return next }, nil
+	}
+
+	allowed := func(r *http.Request) bool {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+
+		if forwarded := r.Header.Values("X-Forwarded-For"); trustProxy && len(forwarded) > 0 {
+			hosts := strings.Split(forwarded[len(forwarded)-1], ",")
+			host = strings.TrimSpace(hosts[len(hosts)-1])
+		}
+
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return false
+		}
+
+		for _, network := range networks {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	allowlist := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if !allowed(r) {
+				hlog.FromRequest(r).Warn().
+					Str("remote", r.RemoteAddr).
+					Strs("forwarded", r.Header.Values("X-Forwarded-For")).
+					Msg("Client is not allowed")
+				rw.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(rw, r)
+		})
+	}
+
+	return allowlist, nil
+}
+
+// ErrBodyTooLarge indicates that a decompressed request body exceeds its limit.
+var ErrBodyTooLarge = errors.New("request body too large")
+
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		// a body of exactly the limit is allowed
+		n, err := b.ReadCloser.Read(make([]byte, 1))
+		if n == 0 && err != nil {
+			return 0, err
+		}
+
+		return 0, ErrBodyTooLarge
+	}
+
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+// DecompressBody transparently decompresses gzip-encoded request bodies.
+// Decompressed bodies larger than limit fail to read with ErrBodyTooLarge,
+// which guards the handlers against decompression bombs.
+func DecompressBody(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if !strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+				next.ServeHTTP(rw, r)
+				return
+			}
+
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				hlog.FromRequest(r).Error().Err(err).Msg("Failed decompressing request")
+				rw.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			defer gz.Close()
+
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+			r.Body = &limitedBody{ReadCloser: gz, remaining: limit}
+
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// LimitBody reads request bodies of at most limit bytes before passing the request on,
+// larger bodies are rejected with 413 Request Entity Too Large.
+// Mounted after DecompressBody, the limit applies to the decompressed body.
+func LimitBody(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(http.MaxBytesReader(rw, r.Body, limit))
+
+			var maxBytesErr *http.MaxBytesError
+			switch {
+			case errors.As(err, &maxBytesErr) || errors.Is(err, ErrBodyTooLarge):
+				hlog.FromRequest(r).Error().Int64("limit", limit).Msg("Request body too large")
+				rw.WriteHeader(http.StatusRequestEntityTooLarge)
+				return
+			case err != nil:
+				hlog.FromRequest(r).Error().Err(err).Msg("Failed reading request")
+				rw.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
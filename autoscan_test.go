@@ -1,6 +1,12 @@
 package autoscan
 
 import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -81,6 +87,53 @@ func TestRewriter(t *testing.T) {
 				{From: "^/movies4k/", To: "/mnt/unionfs/movies4k/"},
 			},
 		},
+		{
+			Name:     "Maps several local roots to one server root",
+			Input:    "/mnt/disk2/Movies/example.mp4",
+			Expected: "/data/Movies/example.mp4",
+			Rewrites: []Rewrite{
+				{From: "^/mnt/disk1/", To: "/data/"},
+				{From: "^/mnt/disk2/", To: "/data/"},
+				{From: "^/mnt/remote/", To: "/data/"},
+			},
+		},
+		{
+			Name:     "Most specific rule wins over an earlier one",
+			Input:    "/mnt/disk1/Movies/example.mp4",
+			Expected: "/data/Movies/example.mp4",
+			Rewrites: []Rewrite{
+				{From: "^/mnt/(.*)", To: "/other/$1"},
+				{From: "^/mnt/disk1/", To: "/data/"},
+			},
+		},
+		{
+			Name:     "Most specific rule wins over a later one",
+			Input:    "/mnt/disk1/Movies/example.mp4",
+			Expected: "/data/Movies/example.mp4",
+			Rewrites: []Rewrite{
+				{From: "^/mnt/disk1/", To: "/data/"},
+				{From: "^/mnt/(.*)", To: "/other/$1"},
+			},
+		},
+		{
+			Name:     "Overlapping prefixes",
+			Input:    "/mnt/unionfs/Media/TV/Westworld",
+			Expected: "/data/TV/Westworld",
+			Rewrites: []Rewrite{
+				{From: "^/mnt/unionfs/", To: "/data/Other/"},
+				{From: "^/mnt/unionfs/Media/(TV|TV 4K)/", To: "/data/$1/"},
+				{From: "^/mnt/local/Media/(TV|TV 4K)/", To: "/data/$1/"},
+			},
+		},
+		{
+			Name:     "Equally specific rules are tried in order",
+			Input:    "/mnt/disk1/example.mp4",
+			Expected: "/first/example.mp4",
+			Rewrites: []Rewrite{
+				{From: "^/mnt/disk1/", To: "/first/"},
+				{From: "/mnt/disk1/", To: "/second/"},
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -98,4 +151,262 @@ func TestRewriter(t *testing.T) {
 		})
 	}
 
+	t.Run("Rejects a pattern rewritten in two ways", func(t *testing.T) {
+		_, err := NewRewriter([]Rewrite{
+			{From: "^/mnt/disk1/", To: "/data/"},
+			{From: "^/mnt/disk1/", To: "/other/"},
+		})
+
+		if err == nil {
+			t.Error("Expected an error")
+		}
+	})
+}
+
+func TestAllowlist(t *testing.T) {
+	type Test struct {
+		Name       string
+		CIDRs      []string
+		TrustProxy bool
+		RemoteAddr string
+		Forwarded  []string
+		StatusCode int
+	}
+
+	var testCases = []Test{
+		{
+			Name:       "Allows all clients by default",
+			RemoteAddr: "203.0.113.7:51234",
+			StatusCode: 200,
+		},
+		{
+			Name:       "Allows clients within the networks",
+			CIDRs:      []string{"10.0.0.0/8", "192.168.1.0/24"},
+			RemoteAddr: "192.168.1.20:51234",
+			StatusCode: 200,
+		},
+		{
+			Name:       "Blocks clients outside the networks",
+			CIDRs:      []string{"10.0.0.0/8", "192.168.1.0/24"},
+			RemoteAddr: "203.0.113.7:51234",
+			StatusCode: 403,
+		},
+		{
+			Name:       "Supports IPv6",
+			CIDRs:      []string{"fd00::/8"},
+			RemoteAddr: "[fd12:3456::1]:51234",
+			StatusCode: 200,
+		},
+		{
+			Name:       "Ignores the forwarded header without a trusted proxy",
+			CIDRs:      []string{"10.0.0.0/8"},
+			RemoteAddr: "203.0.113.7:51234",
+			Forwarded:  []string{"10.0.0.5"},
+			StatusCode: 403,
+		},
+		{
+			Name:       "Uses the forwarded header with a trusted proxy",
+			CIDRs:      []string{"10.0.0.0/8"},
+			TrustProxy: true,
+			RemoteAddr: "172.17.0.2:51234",
+			Forwarded:  []string{"10.0.0.5"},
+			StatusCode: 200,
+		},
+		{
+			Name:       "Uses the address added by the trusted proxy",
+			CIDRs:      []string{"10.0.0.0/8"},
+			TrustProxy: true,
+			RemoteAddr: "172.17.0.2:51234",
+			Forwarded:  []string{"10.0.0.5, 203.0.113.7"},
+			StatusCode: 403,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			allowlist, err := NewAllowlist(tc.CIDRs, tc.TrustProxy)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			handler := allowlist(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				rw.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest("POST", "/triggers/manual", nil)
+			req.RemoteAddr = tc.RemoteAddr
+			for _, value := range tc.Forwarded {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.StatusCode {
+				t.Errorf("Status codes do not match: %d vs %d", rec.Code, tc.StatusCode)
+			}
+		})
+	}
+
+	if _, err := NewAllowlist([]string{"10.0.0.0"}, false); err == nil {
+		t.Errorf("Invalid CIDR was accepted")
+	}
+}
+
+func gzipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+	w := gzip.NewWriter(buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestDecompressBody(t *testing.T) {
+	type Test struct {
+		Name       string
+		Encoding   string
+		Body       []byte
+		StatusCode int
+		WantBody   []byte
+		WantErr    error
+	}
+
+	payload := []byte(`{"eventType": "Download", "series": {"path": "/TV/Westworld"}}`)
+
+	var testCases = []Test{
+		{
+			Name:       "Decompresses gzip payloads",
+			Encoding:   "gzip",
+			Body:       gzipped(t, payload),
+			StatusCode: 200,
+			WantBody:   payload,
+		},
+		{
+			Name:       "Passes uncompressed payloads",
+			Body:       payload,
+			StatusCode: 200,
+			WantBody:   payload,
+		},
+		{
+			Name:       "Rejects malformed gzip",
+			Encoding:   "gzip",
+			Body:       payload,
+			StatusCode: 400,
+		},
+		{
+			Name:       "Limits the decompressed size",
+			Encoding:   "gzip",
+			Body:       gzipped(t, bytes.Repeat([]byte(" "), 2048)),
+			StatusCode: 400,
+			WantErr:    ErrBodyTooLarge,
+		},
+		{
+			Name:       "Allows payloads of exactly the limit",
+			Encoding:   "gzip",
+			Body:       gzipped(t, bytes.Repeat([]byte(" "), 1024)),
+			StatusCode: 200,
+			WantBody:   bytes.Repeat([]byte(" "), 1024),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			handler := DecompressBody(1024)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				if !errors.Is(err, tc.WantErr) {
+					t.Errorf("Errors do not match: %v vs %v", err, tc.WantErr)
+				}
+
+				if err != nil {
+					rw.WriteHeader(http.StatusBadRequest)
+					return
+				}
+
+				if !bytes.Equal(body, tc.WantBody) {
+					t.Errorf("Bodies do not match: %q vs %q", body, tc.WantBody)
+				}
+
+				rw.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest("POST", "/triggers/sonarr", bytes.NewReader(tc.Body))
+			req.Header.Set("Content-Type", "application/json")
+			if tc.Encoding != "" {
+				req.Header.Set("Content-Encoding", tc.Encoding)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.StatusCode {
+				t.Errorf("Status codes do not match: %d vs %d", rec.Code, tc.StatusCode)
+			}
+		})
+	}
+}
+
+func TestLimitBody(t *testing.T) {
+	type Test struct {
+		Name       string
+		Encoding   string
+		Body       []byte
+		StatusCode int
+	}
+
+	var testCases = []Test{
+		{
+			Name:       "Passes payloads of exactly the limit",
+			Body:       bytes.Repeat([]byte(" "), 1024),
+			StatusCode: http.StatusOK,
+		},
+		{
+			Name:       "Rejects oversized payloads",
+			Body:       bytes.Repeat([]byte(" "), 1025),
+			StatusCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			Name:       "Rejects oversized decompressed payloads",
+			Encoding:   "gzip",
+			Body:       gzipped(t, bytes.Repeat([]byte(" "), 2048)),
+			StatusCode: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			called := false
+			handler := DecompressBody(1024)(LimitBody(1024)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				called = true
+				if _, err := io.ReadAll(r.Body); err != nil {
+					t.Errorf("Reading the body failed: %v", err)
+				}
+
+				rw.WriteHeader(http.StatusOK)
+			})))
+
+			req := httptest.NewRequest("POST", "/triggers/sonarr", bytes.NewReader(tc.Body))
+			if tc.Encoding != "" {
+				req.Header.Set("Content-Encoding", tc.Encoding)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.StatusCode {
+				t.Errorf("Status codes do not match: %d vs %d", rec.Code, tc.StatusCode)
+			}
+
+			if called != (tc.StatusCode == http.StatusOK) {
+				t.Errorf("Handler calls do not match: %v", called)
+			}
+		})
+	}
 }
@@ -1,11 +1,170 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/kri100f86/autoscan"
 )
 
+// loadConfig reads and decodes the config file.
+func loadConfig(path string) (config, error) {
+	b, err := readConfig(path)
+	if err != nil {
+		return config{}, err
+	}
+
+	return decodeConfig(bytes.NewReader(b))
+}
+
+// readConfig reads the config file and merges the files it includes.
+// Without includes the file is returned as is, so decoding errors refer to its lines.
+func readConfig(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening config: %w", err)
+	}
+
+	// any decoding errors are reported by the strict decoder instead.
+	var top struct {
+		Include []string `yaml:"include"`
+	}
+	if err := yaml.Unmarshal(b, &top); err != nil || len(top.Include) == 0 {
+		return b, nil
+	}
+
+	merged, err := includeConfig(path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(merged)
+}
+
+// includeConfig decodes the file on top of the files it includes, relative to its directory.
+// The stack holds the files currently being included, to detect cycles.
+func includeConfig(path string, stack []string) (map[interface{}]interface{}, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("include %s: %w", path, err)
+	}
+
+	for _, p := range stack {
+		if p == abs {
+			return nil, fmt.Errorf("include %s: include cycle", path)
+		}
+	}
+	stack = append(stack, abs)
+
+	b, err := os.ReadFile(abs)
+	if err != nil {
+		return nil, fmt.Errorf("include %s: %w", path, err)
+	}
+
+	m := make(map[interface{}]interface{})
+	if err := yaml.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("include %s: %w", path, err)
+	}
+
+	var includes []string
+	if v, ok := m["include"]; ok {
+		list, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("include %s: include must be a list of files", path)
+		}
+
+		for _, inc := range list {
+			s, ok := inc.(string)
+			if !ok {
+				return nil, fmt.Errorf("include %s: invalid include: %v", path, inc)
+			}
+
+			includes = append(includes, s)
+		}
+
+		delete(m, "include")
+	}
+
+	merged := make(map[interface{}]interface{})
+	for _, inc := range includes {
+		if !filepath.IsAbs(inc) {
+			inc = filepath.Join(filepath.Dir(abs), inc)
+		}
+
+		fragment, err := includeConfig(inc, stack)
+		if err != nil {
+			return nil, err
+		}
+
+		mergeConfig(merged, fragment)
+	}
+
+	mergeConfig(merged, m)
+	return merged, nil
+}
+
+// mergeConfig merges src into dst.
+// Maps are merged recursively and lists are appended, other values of src replace those of dst.
+func mergeConfig(dst map[interface{}]interface{}, src map[interface{}]interface{}) {
+	for k, v := range src {
+		switch cur := dst[k].(type) {
+		case map[interface{}]interface{}:
+			if m, ok := v.(map[interface{}]interface{}); ok {
+				mergeConfig(cur, m)
+				continue
+			}
+		case []interface{}:
+			if l, ok := v.([]interface{}); ok {
+				dst[k] = append(cur, l...)
+				continue
+			}
+		}
+
+		dst[k] = v
+	}
+}
+
+// decodeConfig decodes the config on top of the default values.
+func decodeConfig(r io.Reader) (config, error) {
+	c := defaultConfig()
+
+	decoder := yaml.NewDecoder(r)
+	decoder.SetStrict(true)
+	if err := decoder.Decode(&c); err != nil {
+		return config{}, fmt.Errorf("decoding config: %w", err)
+	}
+
+	if errs := expandEnv("", reflect.ValueOf(&c)); len(errs) > 0 {
+		return config{}, errs[0]
+	}
+
+	return c, nil
+}
+
+func defaultConfig() config {
+	return config{
+		MinimumAge:  10 * time.Minute,
+		ScanDelay:   5 * time.Second,
+		ScanStats:   1 * time.Hour,
+		BatchWindow: 5 * time.Second,
+		Host:        []string{""},
+		Port:        3030,
+		Log: autoscan.LogConfig{
+			MaxSize:    5,
+			MaxAge:     14,
+			MaxBackups: 5,
+			Console:    true,
+		},
+	}
+}
+
 func defaultConfigDirectory(app string, filename string) string {
 	// binary path
 	bcd := getBinaryPath()
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kri100f86/autoscan"
+)
+
+func TestLoadConfig(t *testing.T) {
+	type Expected struct {
+		MinimumAge time.Duration
+		Triggers   []string
+		Targets    map[string][]autoscan.Rewrite
+		Err        string
+	}
+
+	type Test struct {
+		Name     string
+		Files    map[string]string
+		Expected Expected
+	}
+
+	media := []autoscan.Rewrite{{From: "^/mnt/unionfs/Media/", To: "/data/"}}
+
+	var testCases = []Test{
+		{
+			"Shares rewrite rules through anchors",
+			map[string]string{
+				"config.yml": `
+targets:
+  plex:
+    - url: http://plex:32400
+      token: secret
+      rewrite: &media
+        - from: ^/mnt/unionfs/Media/
+          to: /data/
+  emby:
+    - url: http://emby:8096
+      token: secret
+      rewrite: *media
+`,
+			},
+			Expected{
+				MinimumAge: 10 * time.Minute,
+				Targets:    map[string][]autoscan.Rewrite{"plex": media, "emby": media},
+			},
+		},
+		{
+			"Merges included fragments",
+			map[string]string{
+				"config.yml": `
+include:
+  - conf.d/targets.yml
+minimum-age: 2m
+triggers:
+  sonarr:
+    - name: sonarr
+`,
+				"conf.d/targets.yml": `
+include:
+  - triggers.yml
+minimum-age: 5m
+targets:
+  plex:
+    - url: http://plex:32400
+      token: secret
+      rewrite: &media
+        - from: ^/mnt/unionfs/Media/
+          to: /data/
+  emby:
+    - url: http://emby:8096
+      token: secret
+      rewrite: *media
+`,
+				"conf.d/triggers.yml": `
+triggers:
+  sonarr:
+    - name: sonarr-4k
+`,
+			},
+			Expected{
+				MinimumAge: 2 * time.Minute,
+				Triggers:   []string{"sonarr-4k", "sonarr"},
+				Targets:    map[string][]autoscan.Rewrite{"plex": media, "emby": media},
+			},
+		},
+		{
+			"Rejects recursive includes",
+			map[string]string{
+				"config.yml": "include: [other.yml]\n",
+				"other.yml":  "include: [config.yml]\n",
+			},
+			Expected{
+				Err: "include cycle",
+			},
+		},
+		{
+			"Rejects unknown fields of included fragments",
+			map[string]string{
+				"config.yml":  "include: [targets.yml]\n",
+				"targets.yml": "targets:\n  plex:\n    - tokne: secret\n",
+			},
+			Expected{
+				Err: "field tokne not found",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tc.Files {
+				path := filepath.Join(dir, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			c, err := loadConfig(filepath.Join(dir, "config.yml"))
+			if tc.Expected.Err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.Expected.Err) {
+					t.Fatalf("Errors do not match: %v vs %s", err, tc.Expected.Err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Could not load the config: %v", err)
+			}
+
+			if c.MinimumAge != tc.Expected.MinimumAge {
+				t.Errorf("Minimum ages do not match: %v vs %v", c.MinimumAge, tc.Expected.MinimumAge)
+			}
+
+			var triggers []string
+			for _, s := range c.Triggers.Sonarr {
+				triggers = append(triggers, s.Name)
+			}
+
+			if !reflect.DeepEqual(triggers, tc.Expected.Triggers) {
+				t.Errorf("Triggers do not match: %v vs %v", triggers, tc.Expected.Triggers)
+			}
+
+			targets := map[string][]autoscan.Rewrite{
+				"plex": c.Targets.Plex[0].Rewrite,
+				"emby": c.Targets.Emby[0].Rewrite,
+			}
+
+			if !reflect.DeepEqual(targets, tc.Expected.Targets) {
+				t.Errorf("Targets do not match: %v vs %v", targets, tc.Expected.Targets)
+			}
+		})
+	}
+}
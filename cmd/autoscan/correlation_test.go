@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/kri100f86/autoscan"
+	"github.com/kri100f86/autoscan/migrate"
+	"github.com/kri100f86/autoscan/processor"
+	"github.com/kri100f86/autoscan/targets/jellyfin"
+	"github.com/kri100f86/autoscan/triggers/manual"
+
+	// sqlite3 driver
+	_ "modernc.org/sqlite"
+)
+
+func TestScanCorrelationID(t *testing.T) {
+	var logs bytes.Buffer
+	logger := log.Logger
+	log.Logger = zerolog.New(&logs)
+	defer func() {
+		log.Logger = logger
+	}()
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	mg, err := migrate.New(db, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proc, err := processor.New(processor.Config{Db: db, Mg: mg})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// trigger
+	trigger, err := manual.New(manual.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(hlog.NewHandler(log.Logger)(trigger(proc.Add)))
+	defer ts.Close()
+
+	res, err := http.Post(ts.URL+"?dir="+url.QueryEscape("/data/Movies/Parasite (2019)"), "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Unexpected status code: %d", res.StatusCode)
+	}
+
+	// target
+	js := httptest.NewServer(&jellyfinServer{items: `{"Items": []}`})
+	defer js.Close()
+
+	target, err := jellyfin.New(jellyfin.Config{URL: js.URL, Token: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := proc.Process(context.Background(), []autoscan.Target{target}); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make(map[string]string)
+	decoder := json.NewDecoder(&logs)
+	for decoder.More() {
+		var line struct {
+			Message string `json:"message"`
+			ID      string `json:"id"`
+		}
+
+		if err := decoder.Decode(&line); err != nil {
+			t.Fatal(err)
+		}
+
+		if line.ID != "" {
+			ids[line.Message] = line.ID
+		}
+	}
+
+	received, sent := ids["Scan moved to processor"], ids["Scan moved to target"]
+	if received == "" || received != sent {
+		t.Errorf("IDs do not match: %q vs %q", received, sent)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// envPattern matches ${VAR} and ${VAR:-default}, $${VAR} escapes the substitution.
+// Regexp replacements such as ${1} do not match, as variable names cannot start with a digit.
+var envPattern = regexp.MustCompile(`\$(\$?)\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandString substitutes the environment variables within s.
+// Like the shell, the default value is used when the variable is unset or empty.
+func expandString(s string) (string, error) {
+	var err error
+	expanded := envPattern.ReplaceAllStringFunc(s, func(match string) string {
+		sub := envPattern.FindStringSubmatch(match)
+		if sub[1] != "" {
+			return match[1:]
+		}
+
+		value, ok := os.LookupEnv(sub[2])
+		switch {
+		case sub[3] != "" && value == "":
+			return sub[4]
+		case ok:
+			return value
+		}
+
+		if err == nil {
+			err = fmt.Errorf("environment variable %s is not set", sub[2])
+		}
+
+		return match
+	})
+
+	return expanded, err
+}
+
+// expandEnv substitutes the environment variables within every string of the decoded config.
+// The returned errors are prefixed with the yaml path of the value.
+func expandEnv(path string, v reflect.Value) []error {
+	var errs []error
+
+	switch v.Kind() {
+	case reflect.String:
+		if !v.CanSet() {
+			break
+		}
+
+		expanded, err := expandString(v.String())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+			break
+		}
+
+		v.SetString(expanded)
+	case reflect.Ptr:
+		if !v.IsNil() {
+			errs = append(errs, expandEnv(path, v.Elem())...)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+
+			name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if name == "" {
+				name = strings.ToLower(field.Name)
+			}
+
+			errs = append(errs, expandEnv(joinPath(path, name), v.Field(i))...)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			errs = append(errs, expandEnv(fmt.Sprintf("%s[%d]", path, i), v.Index(i))...)
+		}
+	case reflect.Map:
+		// map values cannot be set in place, so expand a copy.
+		for _, key := range v.MapKeys() {
+			value := reflect.New(v.Type().Elem()).Elem()
+			value.Set(v.MapIndex(key))
+
+			errs = append(errs, expandEnv(joinPath(path, fmt.Sprint(key)), value)...)
+			v.SetMapIndex(key, value)
+		}
+	}
+
+	return errs
+}
+
+func joinPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandEnv(t *testing.T) {
+	type Expected struct {
+		Token  string
+		Header string
+		To     string
+		Err    string
+	}
+
+	type Test struct {
+		Name     string
+		Given    string
+		Expected Expected
+	}
+
+	t.Setenv("PLEX_TOKEN", "secret")
+	t.Setenv("EMPTY", "")
+
+	var testCases = []Test{
+		{
+			"Substitutes set variables",
+			`
+targets:
+  plex:
+    - url: http://plex:32400
+      token: ${PLEX_TOKEN}
+  webhook:
+    - url: http://hooks:8080
+      headers:
+        Authorization: Bearer ${PLEX_TOKEN}
+`,
+			Expected{
+				Token:  "secret",
+				Header: "Bearer secret",
+			},
+		},
+		{
+			"Fails on unset variables",
+			`
+targets:
+  plex:
+    - url: http://plex:32400
+      token: ${UNSET_PLEX_TOKEN}
+`,
+			Expected{
+				Err: "targets.plex[0].token: environment variable UNSET_PLEX_TOKEN is not set",
+			},
+		},
+		{
+			"Uses the default of unset and empty variables",
+			`
+targets:
+  plex:
+    - url: http://plex:32400
+      token: ${UNSET_PLEX_TOKEN:-default}
+  webhook:
+    - url: http://hooks:8080
+      headers:
+        Authorization: Bearer ${EMPTY:-anonymous}
+`,
+			Expected{
+				Token:  "default",
+				Header: "Bearer anonymous",
+			},
+		},
+		{
+			"Leaves regexp replacements and escaped variables alone",
+			`
+targets:
+  plex:
+    - url: http://plex:32400
+      token: $${PLEX_TOKEN}
+      rewrite:
+        - from: ^/mnt/(Movies|TV)/
+          to: /data/${1}/
+`,
+			Expected{
+				Token: "${PLEX_TOKEN}",
+				To:    "/data/${1}/",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			c, err := decodeConfig(strings.NewReader(tc.Given))
+			if tc.Expected.Err != "" {
+				if err == nil || err.Error() != tc.Expected.Err {
+					t.Fatalf("Errors do not match: %v vs %s", err, tc.Expected.Err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Could not decode the config: %v", err)
+			}
+
+			if token := c.Targets.Plex[0].Token; token != tc.Expected.Token {
+				t.Errorf("Tokens do not match: %q vs %q", token, tc.Expected.Token)
+			}
+
+			if len(c.Targets.Webhook) > 0 {
+				if header := c.Targets.Webhook[0].Headers["Authorization"]; header != tc.Expected.Header {
+					t.Errorf("Headers do not match: %q vs %q", header, tc.Expected.Header)
+				}
+			}
+
+			if len(c.Targets.Plex[0].Rewrite) > 0 {
+				if to := c.Targets.Plex[0].Rewrite[0].To; to != tc.Expected.To {
+					t.Errorf("Rewrites do not match: %q vs %q", to, tc.Expected.To)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/kri100f86/autoscan/processor"
+)
+
+// health is the status of autoscan and of its targets.
+type health struct {
+	Status  string         `json:"status"`
+	Targets []targetHealth `json:"targets"`
+}
+
+// targetHealth describes the last scans of a target, the times are null until the first scan.
+// A target stays available while its failed availability checks are within the grace.
+type targetHealth struct {
+	Target        string     `json:"target"`
+	LastSuccess   *time.Time `json:"last_success"`
+	LastFailure   *time.Time `json:"last_failure"`
+	LastError     string     `json:"last_error,omitempty"`
+	Paused        bool       `json:"paused"`
+	Available     bool       `json:"available"`
+	ProbeFailures int        `json:"probe_failures"`
+}
+
+// healthHandler reports whether autoscan is running, and when each target last succeeded or failed.
+func healthHandler(proc *processor.Processor) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		status := health{Status: "ok", Targets: make([]targetHealth, 0)}
+		for _, th := range proc.Health() {
+			status.Targets = append(status.Targets, targetHealth{
+				Target:        th.Target,
+				LastSuccess:   timeOrNil(th.LastSuccess),
+				LastFailure:   timeOrNil(th.LastFailure),
+				LastError:     th.LastError,
+				Paused:        th.Paused,
+				Available:     !th.Unavailable,
+				ProbeFailures: th.ProbeFailures,
+			})
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(rw).Encode(status)
+	}
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kri100f86/autoscan"
+	"github.com/kri100f86/autoscan/migrate"
+	"github.com/kri100f86/autoscan/processor"
+
+	// sqlite3 driver
+	_ "modernc.org/sqlite"
+)
+
+type healthTarget struct {
+	err error
+}
+
+func (t *healthTarget) Scan(context.Context, autoscan.Scan) error {
+	return t.err
+}
+
+func (t *healthTarget) Available() error {
+	return nil
+}
+
+func (t *healthTarget) String() string {
+	return "jellyfin"
+}
+
+func TestHealthHandler(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	mg, err := migrate.New(db, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proc, err := processor.New(processor.Config{Db: db, Mg: mg})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := getRouter(config{}, proc, new(inspectors), new(refreshers))
+	target := &healthTarget{}
+	targets := []autoscan.Target{target}
+
+	get := func() targetHealth {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", "/health", nil))
+
+		status := health{}
+		if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+			t.Fatal(err)
+		}
+
+		if status.Status != "ok" || len(status.Targets) != 1 {
+			t.Fatalf("Health does not list the target: %+v", status)
+		}
+
+		return status.Targets[0]
+	}
+
+	process := func(folder string) error {
+		if err := proc.Add(autoscan.Scan{Folder: folder}); err != nil {
+			t.Fatal(err)
+		}
+
+		return proc.Process(context.Background(), targets)
+	}
+
+	// a configured target is listed before it receives any scans
+	if err := proc.Process(context.Background(), targets); !errors.Is(err, autoscan.ErrNoScans) {
+		t.Fatal(err)
+	}
+
+	th := get()
+	if th.Target != "jellyfin" || th.LastSuccess != nil || th.LastFailure != nil || th.LastError != "" || !th.Available {
+		t.Errorf("Target without scans is not empty: %+v", th)
+	}
+
+	if err := process("/data/Movies/Parasite (2019)"); err != nil {
+		t.Fatal(err)
+	}
+
+	th = get()
+	if th.LastSuccess == nil || th.LastFailure != nil || th.LastError != "" {
+		t.Errorf("Successful scan is not reported: %+v", th)
+	}
+
+	target.err = errors.New("503 Service Unavailable")
+	if err := process("/data/Movies/Interstellar (2014)"); err == nil {
+		t.Fatal("Failed scan did not return an error")
+	}
+
+	th = get()
+	if th.LastSuccess == nil || th.LastFailure == nil || th.LastError != "503 Service Unavailable" {
+		t.Errorf("Failed scan is not reported: %+v", th)
+	}
+}
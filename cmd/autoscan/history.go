@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/hlog"
+
+	"github.com/kri100f86/autoscan/processor"
+)
+
+// historyEntry describes a scan which was processed by a target.
+type historyEntry struct {
+	Target   string    `json:"target"`
+	ID       string    `json:"id"`
+	Folder   string    `json:"folder"`
+	Outcome  string    `json:"outcome"`
+	Refresh  string    `json:"refresh,omitempty"`
+	ItemID   string    `json:"item_id,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Duration float64   `json:"duration"`
+	Time     time.Time `json:"time"`
+}
+
+// historyHandler lists the recently processed scans as JSON, most recent first.
+// The optional target query parameter limits the history to a single target.
+func historyHandler(proc *processor.Processor) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		history, err := proc.History(r.URL.Query().Get("target"))
+		if err != nil {
+			hlog.FromRequest(r).Error().Err(err).Msg("Failed retrieving the scan history")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		entries := make([]historyEntry, 0, len(history))
+		for _, entry := range history {
+			entries = append(entries, historyEntry{
+				Target:   entry.Target,
+				ID:       entry.ID,
+				Folder:   entry.Folder,
+				Outcome:  entry.Outcome,
+				Refresh:  entry.Refresh,
+				ItemID:   entry.ItemID,
+				Error:    entry.Error,
+				Duration: entry.Duration.Seconds(),
+				Time:     entry.Time,
+			})
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(rw).Encode(entries)
+	}
+}
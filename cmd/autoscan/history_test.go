@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kri100f86/autoscan"
+	"github.com/kri100f86/autoscan/migrate"
+	"github.com/kri100f86/autoscan/processor"
+
+	// sqlite3 driver
+	_ "modernc.org/sqlite"
+)
+
+func TestHistoryHandler(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	mg, err := migrate.New(db, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proc, err := processor.New(processor.Config{Db: db, Mg: mg})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := proc.Add(autoscan.Scan{Folder: "/data/Movies/Parasite (2019)"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := proc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	failure := errors.New("refresh failed")
+	targets := []autoscan.Target{&healthTarget{err: failure}}
+	if err := proc.Process(context.Background(), targets); !errors.Is(err, failure) {
+		t.Fatal(err)
+	}
+
+	var c config
+	c.Auth.Username = "admin"
+	c.Auth.Password = "secret"
+	router := getRouter(c, proc, new(inspectors), new(refreshers))
+
+	get := func(path string) []historyEntry {
+		req := httptest.NewRequest("GET", path, nil)
+		req.SetBasicAuth("admin", "secret")
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Status codes do not match: %d vs %d", rec.Code, http.StatusOK)
+		}
+
+		var entries []historyEntry
+		if err := json.NewDecoder(rec.Body).Decode(&entries); err != nil {
+			t.Fatal(err)
+		}
+
+		return entries
+	}
+
+	entries := get("/history")
+	if len(entries) != 1 {
+		t.Fatalf("History does not match: %+v", entries)
+	}
+
+	e := entries[0]
+	if e.Target != "jellyfin" || e.Folder != "/data/Movies/Parasite (2019)" || e.Outcome != autoscan.OutcomeFailed || e.Error != failure.Error() {
+		t.Errorf("History entry does not match: %+v", e)
+	}
+
+	if entries := get("/history?target=plex"); len(entries) != 0 {
+		t.Errorf("History of another target does not match: %+v", entries)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/kri100f86/autoscan"
+)
+
+// librariesCmd prints the libraries of each target of a type as reported by its media server.
+type librariesCmd struct {
+	Target string `required:"" help:"Target type, e.g. plex or jellyfin"`
+}
+
+func (cmd librariesCmd) run(c config, w io.Writer) error {
+	targets, err := newTargets(c, cmd.Target)
+	if err != nil {
+		return err
+	}
+
+	for i, target := range targets {
+		lister, ok := target.(autoscan.LibraryLister)
+		if !ok {
+			return fmt.Errorf("%s: listing libraries is not supported", cmd.Target)
+		}
+
+		libraries, err := lister.Libraries(context.Background())
+		if err != nil {
+			return fmt.Errorf("%v: %w", target, err)
+		}
+
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+
+		fmt.Fprintln(w, target)
+		for _, lib := range libraries {
+			if lib.Type == "" {
+				fmt.Fprintf(w, "  %s\n", lib.Name)
+			} else {
+				fmt.Fprintf(w, "  %s (%s)\n", lib.Name, lib.Type)
+			}
+
+			for _, path := range lib.Paths {
+				fmt.Fprintf(w, "    %s\n", path)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kri100f86/autoscan/targets/jellyfin"
+	outbound "github.com/kri100f86/autoscan/targets/webhook"
+)
+
+func TestLibrariesCommand(t *testing.T) {
+	ts := httptest.NewServer(&jellyfinServer{})
+	defer ts.Close()
+
+	var c config
+	c.Targets.Jellyfin = []jellyfin.Config{{URL: ts.URL, Token: "token"}}
+	c.Targets.Webhook = []outbound.Config{{URL: ts.URL}}
+
+	var out bytes.Buffer
+	if err := (librariesCmd{Target: "jellyfin"}).run(c, &out); err != nil {
+		t.Fatalf("Could not list libraries: %v", err)
+	}
+
+	want := fmt.Sprintf("jellyfin: %s\n  Movies (movies)\n    /data/Movies/\n", ts.URL)
+	if out.String() != want {
+		t.Errorf("Output does not match: %q vs %q", out.String(), want)
+	}
+
+	if err := (librariesCmd{Target: "webhook"}).run(c, &out); err == nil {
+		t.Errorf("Expected an error for a target which cannot list its libraries")
+	}
+}
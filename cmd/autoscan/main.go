@@ -1,37 +1,45 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/alecthomas/kong"
-	"github.com/natefinch/lumberjack"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
-	"gopkg.in/yaml.v2"
 
 	"github.com/kri100f86/autoscan"
 	"github.com/kri100f86/autoscan/migrate"
+	"github.com/kri100f86/autoscan/notify"
 	"github.com/kri100f86/autoscan/processor"
+	"github.com/kri100f86/autoscan/targets/audiobookshelf"
 	ast "github.com/kri100f86/autoscan/targets/autoscan"
+	"github.com/kri100f86/autoscan/targets/broker"
 	"github.com/kri100f86/autoscan/targets/emby"
 	"github.com/kri100f86/autoscan/targets/jellyfin"
+	"github.com/kri100f86/autoscan/targets/kodi"
+	"github.com/kri100f86/autoscan/targets/navidrome"
 	"github.com/kri100f86/autoscan/targets/plex"
+	outbound "github.com/kri100f86/autoscan/targets/webhook"
 	"github.com/kri100f86/autoscan/triggers/a_train"
 	"github.com/kri100f86/autoscan/triggers/bernard"
 	"github.com/kri100f86/autoscan/triggers/inotify"
 	"github.com/kri100f86/autoscan/triggers/lidarr"
 	"github.com/kri100f86/autoscan/triggers/manual"
 	"github.com/kri100f86/autoscan/triggers/radarr"
+	"github.com/kri100f86/autoscan/triggers/rclone"
 	"github.com/kri100f86/autoscan/triggers/readarr"
 	"github.com/kri100f86/autoscan/triggers/sonarr"
+	"github.com/kri100f86/autoscan/triggers/webhook"
 
 	// sqlite3 driver
 	_ "modernc.org/sqlite"
@@ -39,12 +47,44 @@ import (
 
 type config struct {
 	// General configuration
-	Host       []string      `yaml:"host"`
-	Port       int           `yaml:"port"`
-	MinimumAge time.Duration `yaml:"minimum-age"`
-	ScanDelay  time.Duration `yaml:"scan-delay"`
-	ScanStats  time.Duration `yaml:"scan-stats"`
-	Anchors    []string      `yaml:"anchors"`
+	Host            []string      `yaml:"host"`
+	Port            int           `yaml:"port"`
+	MinimumAge      time.Duration `yaml:"minimum-age"`
+	ScanDelay       time.Duration `yaml:"scan-delay"`
+	ScanStats       time.Duration `yaml:"scan-stats"`
+	ScanTimeout     time.Duration `yaml:"scan-timeout"`
+	StartupTimeout  time.Duration `yaml:"startup-timeout"`
+	BatchWindow     time.Duration `yaml:"batch-window"`
+	BatchSize       int           `yaml:"batch-size"`
+	DedupWindow     time.Duration `yaml:"dedup-window"`
+	MaxRetryBackoff time.Duration `yaml:"max-retry-backoff"`
+	RetryBackoff    time.Duration `yaml:"retry-backoff"`
+	MaxRetries      int           `yaml:"max-retries"`
+	Anchors         []string      `yaml:"anchors"`
+	FastPaths       []string      `yaml:"fast-paths"`
+	DryRun          bool          `yaml:"dry-run"`
+	MaxBodyBytes    int64         `yaml:"max-body-bytes"`
+
+	// Failed availability checks before a target is unavailable
+	Availability struct {
+		Failures int           `yaml:"failures"`
+		Grace    time.Duration `yaml:"grace"`
+	} `yaml:"availability"`
+
+	// History of the processed scans per target
+	History struct {
+		Size   int           `yaml:"size"`
+		MaxAge time.Duration `yaml:"max-age"`
+	} `yaml:"history"`
+
+	// Library-specific processor settings
+	Libraries []processor.Library `yaml:"libraries"`
+
+	// Notifications on repeated scan failures
+	Notifications notify.Config `yaml:"notifications"`
+
+	// Log sinks
+	Log autoscan.LogConfig `yaml:"log"`
 
 	// Authentication for autoscan.HTTPTrigger
 	Auth struct {
@@ -60,16 +100,23 @@ type config struct {
 		Inotify []inotify.Config `yaml:"inotify"`
 		Lidarr  []lidarr.Config  `yaml:"lidarr"`
 		Radarr  []radarr.Config  `yaml:"radarr"`
+		Rclone  []rclone.Config  `yaml:"rclone"`
 		Readarr []readarr.Config `yaml:"readarr"`
 		Sonarr  []sonarr.Config  `yaml:"sonarr"`
+		Webhook []webhook.Config `yaml:"webhook"`
 	} `yaml:"triggers"`
 
 	// autoscan.Target
 	Targets struct {
-		Autoscan []ast.Config      `yaml:"autoscan"`
-		Emby     []emby.Config     `yaml:"emby"`
-		Jellyfin []jellyfin.Config `yaml:"jellyfin"`
-		Plex     []plex.Config     `yaml:"plex"`
+		Audiobookshelf []audiobookshelf.Config `yaml:"audiobookshelf"`
+		Autoscan       []ast.Config            `yaml:"autoscan"`
+		Broker         []broker.Config         `yaml:"broker"`
+		Emby           []emby.Config           `yaml:"emby"`
+		Jellyfin       []jellyfin.Config       `yaml:"jellyfin"`
+		Kodi           []kodi.Config           `yaml:"kodi"`
+		Navidrome      []navidrome.Config      `yaml:"navidrome"`
+		Plex           []plex.Config           `yaml:"plex"`
+		Webhook        []outbound.Config       `yaml:"webhook"`
 	} `yaml:"targets"`
 }
 
@@ -88,6 +135,15 @@ var (
 		Database  string `type:"path" default:"${database_file}" env:"AUTOSCAN_DATABASE" help:"Database file path"`
 		Log       string `type:"path" default:"${log_file}" env:"AUTOSCAN_LOG" help:"Log file path"`
 		Verbosity int    `type:"counter" default:"0" short:"v" env:"AUTOSCAN_VERBOSITY" help:"Log level verbosity"`
+		DryRun    bool   `name:"dry-run" env:"AUTOSCAN_DRY_RUN" help:"Log scans instead of sending them to the targets"`
+
+		// commands
+		Run       struct{}     `cmd:"" default:"1" help:"Run autoscan (default)"`
+		Rewrite   rewriteCmd   `cmd:"" help:"Test the rewrite rules of a target against a path"`
+		TestScan  testScanCmd  `cmd:"" name:"test-scan" help:"Send a test scan to the targets of a type"`
+		Libraries librariesCmd `cmd:"" help:"List the libraries of the targets of a type"`
+		Validate  validateCmd  `cmd:"" help:"Validate the config and report every error found"`
+		Build     versionCmd   `cmd:"" name:"version" help:"Print build information as JSON"`
 	}
 )
 
@@ -116,7 +172,7 @@ func main() {
 			Compact: true,
 		}),
 		kong.Vars{
-			"version":       fmt.Sprintf("%s (%s@%s)", Version, GitCommit, Timestamp),
+			"version":       currentBuild().String(),
 			"config_file":   filepath.Join(defaultConfigDirectory("autoscan", "config.yml"), "config.yml"),
 			"log_file":      filepath.Join(defaultConfigDirectory("autoscan", "config.yml"), "activity.log"),
 			"database_file": filepath.Join(defaultConfigDirectory("autoscan", "config.yml"), "autoscan.db"),
@@ -128,66 +184,72 @@ func main() {
 		os.Exit(1)
 	}
 
-	// logger
-	logger := log.Output(io.MultiWriter(zerolog.ConsoleWriter{
+	// logger (console only, until the config has been decoded)
+	setLogger(log.Output(zerolog.ConsoleWriter{
 		TimeFormat: time.Stamp,
 		Out:        os.Stderr,
-	}, zerolog.ConsoleWriter{
-		TimeFormat: time.Stamp,
-		Out: &lumberjack.Logger{
-			Filename:   cli.Log,
-			MaxSize:    5,
-			MaxAge:     14,
-			MaxBackups: 5,
-		},
-		NoColor: true,
 	}))
 
-	switch {
-	case cli.Verbosity == 1:
-		log.Logger = logger.Level(zerolog.DebugLevel)
-	case cli.Verbosity > 1:
-		log.Logger = logger.Level(zerolog.TraceLevel)
-	default:
-		log.Logger = logger.Level(zerolog.InfoLevel)
-	}
-
-	// datastore
-	db, err := sql.Open("sqlite", cli.Database)
-	if err != nil {
-		log.Fatal().
-			Err(err).
-			Msg("Failed opening datastore")
+	switch ctx.Command() {
+	case "validate":
+		if err := cli.Validate.run(cli.Config, os.Stdout); err != nil {
+			fmt.Println("Failed validating config:", err)
+			os.Exit(1)
+		}
+		return
+	case "version":
+		if err := cli.Build.run(os.Stdout); err != nil {
+			fmt.Println("Failed printing version:", err)
+			os.Exit(1)
+		}
+		return
 	}
-	db.SetMaxOpenConns(1)
 
 	// config
-	file, err := os.Open(cli.Config)
+	c, err := loadConfig(cli.Config)
 	if err != nil {
 		log.Fatal().
 			Err(err).
-			Msg("Failed opening config")
+			Msg("Failed loading config")
 	}
-	defer file.Close()
-
-	// set default values
-	c := config{
-		MinimumAge: 10 * time.Minute,
-		ScanDelay:  5 * time.Second,
-		ScanStats:  1 * time.Hour,
-		Host:       []string{""},
-		Port:       3030,
+
+	switch ctx.Command() {
+	case "rewrite":
+		if err := cli.Rewrite.run(c, os.Stdout); err != nil {
+			fmt.Println("Failed testing rewrite:", err)
+			os.Exit(1)
+		}
+		return
+	case "test-scan":
+		if err := cli.TestScan.run(c, os.Stdout); err != nil {
+			fmt.Println("Failed sending test scan:", err)
+			os.Exit(1)
+		}
+		return
+	case "libraries":
+		if err := cli.Libraries.run(c, os.Stdout); err != nil {
+			fmt.Println("Failed listing libraries:", err)
+			os.Exit(1)
+		}
+		return
 	}
 
-	decoder := yaml.NewDecoder(file)
-	decoder.SetStrict(true)
-	err = decoder.Decode(&c)
+	// datastore
+	db, err := sql.Open("sqlite", cli.Database)
 	if err != nil {
 		log.Fatal().
 			Err(err).
-			Msg("Failed decoding config")
+			Msg("Failed opening datastore")
+	}
+	db.SetMaxOpenConns(1)
+
+	// logger
+	if c.Log.File == "" {
+		c.Log.File = cli.Log
 	}
 
+	setLogger(log.Output(autoscan.NewLogWriter(c.Log)))
+
 	// migrator
 	mg, err := migrate.New(db, "migrations")
 	if err != nil {
@@ -197,11 +259,27 @@ func main() {
 	}
 
 	// processor
+	notifier := notify.New(c.Notifications)
 	proc, err := processor.New(processor.Config{
-		Anchors:    c.Anchors,
-		MinimumAge: c.MinimumAge,
-		Db:         db,
-		Mg:         mg,
+		Anchors:              c.Anchors,
+		MinimumAge:           c.MinimumAge,
+		Libraries:            c.Libraries,
+		ScanTimeout:          c.ScanTimeout,
+		BatchWindow:          c.BatchWindow,
+		BatchSize:            c.BatchSize,
+		DedupWindow:          c.DedupWindow,
+		FastPaths:            c.FastPaths,
+		MaxRetryBackoff:      c.MaxRetryBackoff,
+		RetryBackoff:         c.RetryBackoff,
+		MaxRetries:           c.MaxRetries,
+		AvailabilityFailures: c.Availability.Failures,
+		AvailabilityGrace:    c.Availability.Grace,
+		HistorySize:          c.History.Size,
+		HistoryMaxAge:        c.History.MaxAge,
+		Db:                   db,
+		Mg:                   mg,
+		Hooks:                []autoscan.OutcomeHook{processor.OutcomeMetrics{}, notifier},
+		Notifier:             notifier,
 	})
 
 	if err != nil {
@@ -212,7 +290,15 @@ func main() {
 
 	log.Info().
 		Stringer("min_age", c.MinimumAge).
+		Stringer("batch_window", c.BatchWindow).
+		Int("batch_size", c.BatchSize).
+		Stringer("dedup_window", c.DedupWindow).
+		Stringer("max_retry_backoff", c.MaxRetryBackoff).
+		Stringer("retry_backoff", c.RetryBackoff).
+		Int("max_retries", c.MaxRetries).
 		Strs("anchors", c.Anchors).
+		Strs("fast_paths", c.FastPaths).
+		Int("libraries", len(c.Libraries)).
 		Msg("Initialised processor")
 
 	// Check authentication. If no auth -> warn user.
@@ -230,7 +316,7 @@ func main() {
 				Msg("Failed initialising trigger")
 		}
 
-		go trigger(proc.Add)
+		go trigger(countEvents("bernard", proc.Add))
 	}
 
 	for _, t := range c.Triggers.Inotify {
@@ -242,11 +328,25 @@ func main() {
 				Msg("Failed initialising trigger")
 		}
 
-		go trigger(proc.Add)
+		go trigger(countEvents("inotify", proc.Add))
+	}
+
+	for _, t := range c.Triggers.Rclone {
+		trigger, err := rclone.New(t)
+		if err != nil {
+			log.Fatal().
+				Err(err).
+				Str("trigger", "rclone").
+				Msg("Failed initialising trigger")
+		}
+
+		go trigger(countEvents("rclone", proc.Add))
 	}
 
 	// http triggers
-	router := getRouter(c, proc)
+	insp := new(inspectors)
+	rf := new(refreshers)
+	router := getRouter(c, proc, insp, rf)
 
 	for _, h := range c.Host {
 		go func(host string) {
@@ -271,72 +371,126 @@ func main() {
 		Int("inotify", len(c.Triggers.Inotify)).
 		Int("lidarr", len(c.Triggers.Lidarr)).
 		Int("radarr", len(c.Triggers.Radarr)).
+		Int("rclone", len(c.Triggers.Rclone)).
 		Int("readarr", len(c.Triggers.Readarr)).
 		Int("sonarr", len(c.Triggers.Sonarr)).
+		Int("webhook", len(c.Triggers.Webhook)).
 		Msg("Initialised triggers")
 
 	// targets
-	targets := make([]autoscan.Target, 0)
+	builders := make([]targetBuilder, 0)
 
 	for _, t := range c.Targets.Autoscan {
-		tp, err := ast.New(t)
-		if err != nil {
-			log.Fatal().
-				Err(err).
-				Str("target", "autoscan").
-				Str("target_url", t.URL).
-				Msg("Failed initialising target")
-		}
-
-		targets = append(targets, tp)
+		t := t
+		builders = append(builders, targetBuilder{kind: "autoscan", url: t.URL, new: func() (autoscan.Target, error) {
+			return ast.New(t)
+		}})
 	}
 
 	for _, t := range c.Targets.Plex {
-		tp, err := plex.New(t)
-		if err != nil {
-			log.Fatal().
-				Err(err).
-				Str("target", "plex").
-				Str("target_url", t.URL).
-				Msg("Failed initialising target")
-		}
-
-		targets = append(targets, tp)
+		t := t
+		builders = append(builders, targetBuilder{kind: "plex", url: t.URL, new: func() (autoscan.Target, error) {
+			return plex.New(t)
+		}})
 	}
 
 	for _, t := range c.Targets.Emby {
-		tp, err := emby.New(t)
-		if err != nil {
-			log.Fatal().
-				Err(err).
-				Str("target", "emby").
-				Str("target_url", t.URL).
-				Msg("Failed initialising target")
-		}
-
-		targets = append(targets, tp)
+		t := t
+		builders = append(builders, targetBuilder{kind: "emby", url: t.URL, new: func() (autoscan.Target, error) {
+			return emby.New(t)
+		}})
 	}
 
 	for _, t := range c.Targets.Jellyfin {
-		tp, err := jellyfin.New(t)
-		if err != nil {
-			log.Fatal().
-				Err(err).
-				Str("target", "jellyfin").
-				Str("target_url", t.URL).
-				Msg("Failed initialising target")
+		t := t
+		t.Db = db
+		t.Mg = mg
+
+		builders = append(builders, targetBuilder{kind: "jellyfin", url: t.URL, new: func() (autoscan.Target, error) {
+			return jellyfin.New(t)
+		}})
+	}
+
+	for _, t := range c.Targets.Kodi {
+		t := t
+		builders = append(builders, targetBuilder{kind: "kodi", url: t.URL, new: func() (autoscan.Target, error) {
+			return kodi.New(t)
+		}})
+	}
+
+	for _, t := range c.Targets.Audiobookshelf {
+		t := t
+		builders = append(builders, targetBuilder{kind: "audiobookshelf", url: t.URL, new: func() (autoscan.Target, error) {
+			return audiobookshelf.New(t)
+		}})
+	}
+
+	for _, t := range c.Targets.Navidrome {
+		t := t
+		builders = append(builders, targetBuilder{kind: "navidrome", url: t.URL, new: func() (autoscan.Target, error) {
+			return navidrome.New(t)
+		}})
+	}
+
+	for _, t := range c.Targets.Webhook {
+		t := t
+		builders = append(builders, targetBuilder{kind: "webhook", url: t.URL, new: func() (autoscan.Target, error) {
+			return outbound.New(t)
+		}})
+	}
+
+	for _, t := range c.Targets.Broker {
+		t := t
+		builders = append(builders, targetBuilder{kind: "broker", url: t.Address, new: func() (autoscan.Target, error) {
+			return broker.New(t)
+		}})
+	}
+
+	targets, err := buildTargets(builders, maxTargetWorkers, c.StartupTimeout)
+	if err != nil {
+		var failed targetErrors
+		if errors.As(err, &failed) {
+			for _, f := range failed {
+				log.Error().
+					Err(f.err).
+					Str("target", f.kind).
+					Str("target_url", f.url).
+					Msg("Failed initialising target")
+			}
 		}
 
-		targets = append(targets, tp)
+		log.Fatal().
+			Err(err).
+			Msg("Failed initialising targets")
 	}
 
+	insp.set(targets)
+	go reloadTokens(cli.Config, newTokenTargets(builders, targets))
+
 	log.Info().
 		Int("autoscan", len(c.Targets.Autoscan)).
 		Int("plex", len(c.Targets.Plex)).
 		Int("emby", len(c.Targets.Emby)).
 		Int("jellyfin", len(c.Targets.Jellyfin)).
+		Int("kodi", len(c.Targets.Kodi)).
+		Int("navidrome", len(c.Targets.Navidrome)).
+		Int("audiobookshelf", len(c.Targets.Audiobookshelf)).
+		Int("webhook", len(c.Targets.Webhook)).
+		Int("broker", len(c.Targets.Broker)).
 		Msg("Initialised targets")
 
+	// dry run
+	if c.DryRun || cli.DryRun {
+		for i, t := range targets {
+			targets[i] = autoscan.DryRun(t)
+		}
+
+		log.Warn().Msg("Dry run enabled, scans are logged instead of sent to the targets")
+	}
+
+	// after the dry run, so library refreshes are logged instead of sent as well.
+	rf.set(targets)
+
 	// scan stats
 	if c.ScanStats.Seconds() > 0 {
 		go scanStats(proc, c.ScanStats)
@@ -344,19 +498,36 @@ func main() {
 
 	// display initialised banner
 	log.Info().
-		Str("version", fmt.Sprintf("%s (%s@%s)", Version, GitCommit, Timestamp)).
+		Str("version", currentBuild().String()).
 		Msg("Initialised")
 
+	// cancelled on shutdown, passed on to the targets
+	daemonCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// processor
 	log.Info().Msg("Processor started")
 
 	targetsAvailable := false
 	targetsSize := len(targets)
 	for {
+		// stop processing on shutdown
+		if daemonCtx.Err() != nil {
+			if err := proc.Flush(); err != nil {
+				log.Error().
+					Err(err).
+					Msg("Failed flushing batched scans")
+			}
+
+			log.Info().Msg("Processor stopped")
+			return
+		}
+
 		// sleep indefinitely when no targets setup
 		if targetsSize == 0 {
 			log.Warn().Msg("No targets initialised, processor stopped, triggers will continue...")
-			select {}
+			<-daemonCtx.Done()
+			continue
 		}
 
 		// target availability checker
@@ -370,38 +541,42 @@ func main() {
 					Err(err).
 					Msg("Fatal error occurred while checking target availability, processor stopped, triggers will continue...")
 
-				// sleep indefinitely
-				select {}
+				// sleep until shutdown
+				<-daemonCtx.Done()
+				continue
 			default:
 				log.Error().
 					Err(err).
 					Msg("Not all targets are available, retrying in 15 seconds...")
 
-				time.Sleep(15 * time.Second)
+				sleep(daemonCtx, 15*time.Second)
 				continue
 			}
 		}
 
 		// process scans
-		err = proc.Process(targets)
+		err = proc.Process(daemonCtx, targets)
 		switch {
+		case daemonCtx.Err() != nil:
+			// shutting down, the scan remains queued
+
 		case err == nil:
 			// Sleep scan-delay between successful requests to reduce the load on targets.
-			time.Sleep(c.ScanDelay)
+			sleep(daemonCtx, c.ScanDelay)
 
 		case errors.Is(err, autoscan.ErrNoScans):
 			// No scans currently available, let's wait a couple of seconds
 			log.Trace().
 				Msg("No scans are available, retrying in 15 seconds...")
 
-			time.Sleep(15 * time.Second)
+			sleep(daemonCtx, 15*time.Second)
 
 		case errors.Is(err, autoscan.ErrAnchorUnavailable):
 			log.Error().
 				Err(err).
 				Msg("Not all anchor files are available, retrying in 15 seconds...")
 
-			time.Sleep(15 * time.Second)
+			sleep(daemonCtx, 15*time.Second)
 
 		case errors.Is(err, autoscan.ErrTargetUnavailable):
 			targetsAvailable = false
@@ -409,7 +584,14 @@ func main() {
 				Err(err).
 				Msg("Not all targets are available, retrying in 15 seconds...")
 
-			time.Sleep(15 * time.Second)
+			sleep(daemonCtx, 15*time.Second)
+
+		case errors.Is(err, context.DeadlineExceeded):
+			log.Error().
+				Err(err).
+				Msg("Scan exceeded its timeout, retrying in 15 seconds...")
+
+			sleep(daemonCtx, 15*time.Second)
 
 		case errors.Is(err, autoscan.ErrFatal):
 			// fatal error occurred, processor must stop (however, triggers must not)
@@ -417,8 +599,8 @@ func main() {
 				Err(err).
 				Msg("Fatal error occurred while processing targets, processor stopped, triggers will continue...")
 
-			// sleep indefinitely
-			select {}
+			// sleep until shutdown
+			<-daemonCtx.Done()
 
 		default:
 			// unexpected error
@@ -428,3 +610,25 @@ func main() {
 		}
 	}
 }
+
+func setLogger(logger zerolog.Logger) {
+	switch {
+	case cli.Verbosity == 1:
+		log.Logger = logger.Level(zerolog.DebugLevel)
+	case cli.Verbosity > 1:
+		log.Logger = logger.Level(zerolog.TraceLevel)
+	default:
+		log.Logger = logger.Level(zerolog.InfoLevel)
+	}
+}
+
+// sleep pauses for the given duration or until the context is cancelled.
+func sleep(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/kri100f86/autoscan"
+	"github.com/kri100f86/autoscan/metrics"
+)
+
+var (
+	eventsReceived = metrics.Default.NewCounterVec(
+		"autoscan_trigger_events_received_total",
+		"Number of events received by a trigger.",
+		"trigger")
+
+	eventsAccepted = metrics.Default.NewCounterVec(
+		"autoscan_trigger_events_accepted_total",
+		"Number of events of which the scans were enqueued.",
+		"trigger")
+
+	eventsRejected = metrics.Default.NewCounterVec(
+		"autoscan_trigger_events_rejected_total",
+		"Number of events which did not result in any scans.",
+		"trigger", "reason")
+)
+
+// Reasons for rejecting an event.
+const (
+	reasonAuth     = "auth"
+	reasonInvalid  = "invalid"
+	reasonFiltered = "filtered"
+	reasonError    = "error"
+)
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+// countRequests counts the events received by an HTTP-trigger.
+// The trigger is created for every request so the events of which the scans were enqueued can be told apart
+// from the events which were filtered by the trigger.
+// Requests are authenticated by auth to count the events rejected due to bad credentials.
+func countRequests(name string, trigger autoscan.HTTPTrigger, auth func(http.Handler) http.Handler, callback autoscan.ProcessorFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		// GET and HEAD requests, e.g. the manual trigger's UI, are not events.
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			auth(trigger(callback)).ServeHTTP(rw, r)
+			return
+		}
+
+		eventsReceived.Inc(name)
+
+		enqueued := false
+		handler := trigger(func(scans ...autoscan.Scan) error {
+			err := callback(scans...)
+			if err == nil {
+				enqueued = true
+			}
+
+			return err
+		})
+
+		sw := &statusWriter{ResponseWriter: rw}
+		auth(handler).ServeHTTP(sw, r)
+
+		switch {
+		case sw.status == http.StatusUnauthorized || sw.status == http.StatusForbidden:
+			eventsRejected.Inc(name, reasonAuth)
+		case sw.status >= 500:
+			eventsRejected.Inc(name, reasonError)
+		case sw.status >= 400:
+			eventsRejected.Inc(name, reasonInvalid)
+		case enqueued:
+			eventsAccepted.Inc(name)
+		default:
+			eventsRejected.Inc(name, reasonFiltered)
+		}
+	}
+}
+
+// countEvents counts the events of a daemon-trigger.
+func countEvents(name string, callback autoscan.ProcessorFunc) autoscan.ProcessorFunc {
+	return func(scans ...autoscan.Scan) error {
+		eventsReceived.Inc(name)
+
+		err := callback(scans...)
+		if err != nil {
+			eventsRejected.Inc(name, reasonError)
+			return err
+		}
+
+		eventsAccepted.Inc(name)
+		return nil
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/kri100f86/autoscan"
+	"github.com/kri100f86/autoscan/triggers/sonarr"
+)
+
+func TestCountRequests(t *testing.T) {
+	type Given struct {
+		Name     string
+		Body     string
+		Password string
+		Err      error
+	}
+
+	type Expected struct {
+		Accepted bool
+		Reason   string
+	}
+
+	type Test struct {
+		Name     string
+		Given    Given
+		Expected Expected
+	}
+
+	download := `{"eventType": "Download", "episodeFile": {"relativePath": "Season 1/S01E01.mkv"}, "series": {"path": "/TV/Westworld"}}`
+
+	var testCases = []Test{
+		{
+			"Counts enqueued events as accepted",
+			Given{
+				Name:     "sonarr-accepted",
+				Body:     download,
+				Password: "secret",
+			},
+			Expected{
+				Accepted: true,
+			},
+		},
+		{
+			"Counts bad credentials as rejected",
+			Given{
+				Name:     "sonarr-auth",
+				Body:     download,
+				Password: "wrong",
+			},
+			Expected{
+				Reason: reasonAuth,
+			},
+		},
+		{
+			"Counts parse errors as rejected",
+			Given{
+				Name:     "sonarr-invalid",
+				Body:     `{"eventType": `,
+				Password: "secret",
+			},
+			Expected{
+				Reason: reasonInvalid,
+			},
+		},
+		{
+			"Counts events without scans as filtered",
+			Given{
+				Name:     "sonarr-filtered",
+				Body:     `{"eventType": "Test"}`,
+				Password: "secret",
+			},
+			Expected{
+				Reason: reasonFiltered,
+			},
+		},
+		{
+			"Counts processor errors as rejected",
+			Given{
+				Name:     "sonarr-error",
+				Body:     download,
+				Password: "secret",
+				Err:      errors.New("database is locked"),
+			},
+			Expected{
+				Reason: reasonError,
+			},
+		},
+	}
+
+	auth := middleware.BasicAuth("Autoscan 1.x", map[string]string{"user": "secret"})
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			trigger, err := sonarr.New(sonarr.Config{Name: tc.Given.Name})
+			if err != nil {
+				t.Fatalf("Could not create Sonarr Trigger: %v", err)
+			}
+
+			callback := func(scans ...autoscan.Scan) error {
+				return tc.Given.Err
+			}
+
+			request := httptest.NewRequest("POST", "/triggers/"+tc.Given.Name, strings.NewReader(tc.Given.Body))
+			request.SetBasicAuth("user", tc.Given.Password)
+
+			// the counters are process-wide, so only their change is asserted
+			reasons := []string{reasonAuth, reasonInvalid, reasonFiltered, reasonError}
+			received := eventsReceived.Value(tc.Given.Name)
+			accepted := eventsAccepted.Value(tc.Given.Name)
+			rejected := make(map[string]uint64)
+			for _, reason := range reasons {
+				rejected[reason] = eventsRejected.Value(tc.Given.Name, reason)
+			}
+
+			countRequests(tc.Given.Name, trigger, auth, callback).ServeHTTP(httptest.NewRecorder(), request)
+
+			if v := eventsReceived.Value(tc.Given.Name) - received; v != 1 {
+				t.Errorf("Received events do not match: %d vs %d", v, 1)
+			}
+
+			wantAccepted := uint64(0)
+			if tc.Expected.Accepted {
+				wantAccepted = 1
+			}
+
+			if v := eventsAccepted.Value(tc.Given.Name) - accepted; v != wantAccepted {
+				t.Errorf("Accepted events do not match: %d vs %d", v, wantAccepted)
+			}
+
+			for _, reason := range reasons {
+				wantRejected := uint64(0)
+				if reason == tc.Expected.Reason {
+					wantRejected = 1
+				}
+
+				if v := eventsRejected.Value(tc.Given.Name, reason) - rejected[reason]; v != wantRejected {
+					t.Errorf("Rejected events (%s) do not match: %d vs %d", reason, v, wantRejected)
+				}
+			}
+		})
+	}
+}
+
+func TestCountRequestsIgnoresGet(t *testing.T) {
+	trigger := func(callback autoscan.ProcessorFunc) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {})
+	}
+
+	identity := func(h http.Handler) http.Handler { return h }
+	received := eventsReceived.Value("manual-get")
+	countRequests("manual-get", trigger, identity, nil).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if v := eventsReceived.Value("manual-get") - received; v != 0 {
+		t.Errorf("Received events do not match: %d vs %d", v, 0)
+	}
+}
+
+func TestCountEvents(t *testing.T) {
+	fail := errors.New("database is locked")
+	calls := 0
+
+	received := eventsReceived.Value("inotify-test")
+	accepted := eventsAccepted.Value("inotify-test")
+	rejected := eventsRejected.Value("inotify-test", reasonError)
+
+	callback := countEvents("inotify-test", func(scans ...autoscan.Scan) error {
+		calls++
+		if calls == 2 {
+			return fail
+		}
+
+		return nil
+	})
+
+	_ = callback(autoscan.Scan{Folder: "/mnt/Movies"})
+	if err := callback(autoscan.Scan{Folder: "/mnt/Movies"}); !errors.Is(err, fail) {
+		t.Errorf("Errors do not match: %v vs %v", err, fail)
+	}
+
+	if v := eventsReceived.Value("inotify-test") - received; v != 2 {
+		t.Errorf("Received events do not match: %d vs %d", v, 2)
+	}
+
+	if v := eventsAccepted.Value("inotify-test") - accepted; v != 1 {
+		t.Errorf("Accepted events do not match: %d vs %d", v, 1)
+	}
+
+	if v := eventsRejected.Value("inotify-test", reasonError) - rejected; v != 1 {
+		t.Errorf("Rejected events do not match: %d vs %d", v, 1)
+	}
+}
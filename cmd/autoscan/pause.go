@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/rs/zerolog/hlog"
+
+	"github.com/kri100f86/autoscan/processor"
+)
+
+// pauseHandler pauses or resumes the target named by the target query parameter.
+// Unknown targets respond with 404 Not Found.
+func pauseHandler(proc *processor.Processor, paused bool) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		target := r.URL.Query().Get("target")
+		if target == "" {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		change := proc.Resume
+		if paused {
+			change = proc.Pause
+		}
+
+		err := change(target)
+		switch {
+		case err == nil:
+			rw.WriteHeader(http.StatusNoContent)
+		case errors.Is(err, processor.ErrUnknownTarget):
+			rw.WriteHeader(http.StatusNotFound)
+		default:
+			hlog.FromRequest(r).Error().Err(err).Msg("Failed changing the pause of the target")
+			rw.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kri100f86/autoscan"
+	"github.com/kri100f86/autoscan/migrate"
+	"github.com/kri100f86/autoscan/processor"
+
+	// sqlite3 driver
+	_ "modernc.org/sqlite"
+)
+
+func TestPauseHandler(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	mg, err := migrate.New(db, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proc, err := processor.New(processor.Config{Db: db, Mg: mg})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var c config
+	c.Auth.Username = "admin"
+	c.Auth.Password = "secret"
+	router := getRouter(c, proc, new(inspectors), new(refreshers))
+
+	post := func(path string, password string) int {
+		req := httptest.NewRequest("POST", path, nil)
+		req.SetBasicAuth("admin", password)
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	paused := func() bool {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", "/health", nil))
+
+		status := health{}
+		if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(status.Targets) != 1 {
+			t.Fatalf("Health does not list the target: %+v", status)
+		}
+
+		return status.Targets[0].Paused
+	}
+
+	target := &healthTarget{}
+	targets := []autoscan.Target{target}
+	if err := proc.Process(context.Background(), targets); !errors.Is(err, autoscan.ErrNoScans) {
+		t.Fatal(err)
+	}
+
+	if code := post("/targets/pause?target=jellyfin", "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("Pausing without credentials does not match: %d vs %d", code, http.StatusUnauthorized)
+	}
+
+	if code := post("/targets/pause?target=plex", "secret"); code != http.StatusNotFound {
+		t.Errorf("Pausing an unknown target does not match: %d vs %d", code, http.StatusNotFound)
+	}
+
+	if code := post("/targets/pause?target=jellyfin", "secret"); code != http.StatusNoContent {
+		t.Fatalf("Pausing the target does not match: %d vs %d", code, http.StatusNoContent)
+	}
+
+	if !paused() {
+		t.Errorf("Health does not report the target as paused")
+	}
+
+	if code := post("/targets/resume?target=jellyfin", "secret"); code != http.StatusNoContent {
+		t.Fatalf("Resuming the target does not match: %d vs %d", code, http.StatusNoContent)
+	}
+
+	if paused() {
+		t.Errorf("Health reports the resumed target as paused")
+	}
+}
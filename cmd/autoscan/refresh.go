@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/rs/zerolog/hlog"
+
+	"github.com/kri100f86/autoscan"
+)
+
+// refreshedLibraries lists the libraries a target refreshed fully.
+type refreshedLibraries struct {
+	Target    string   `json:"target"`
+	Libraries []string `json:"libraries"`
+}
+
+// refreshers holds the targets which can refresh a whole library on demand.
+// Like the inspectors, they are set once the targets are initialised.
+type refreshers struct {
+	lock    sync.RWMutex
+	targets []autoscan.LibraryRefresher
+}
+
+// set retains the targets implementing autoscan.LibraryRefresher.
+func (rf *refreshers) set(targets []autoscan.Target) {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+
+	rf.targets = make([]autoscan.LibraryRefresher, 0)
+	for _, target := range targets {
+		if refresher, ok := target.(autoscan.LibraryRefresher); ok {
+			rf.targets = append(rf.targets, refresher)
+		}
+	}
+}
+
+// matching returns the targets of the given name, or all of them when the name is empty.
+func (rf *refreshers) matching(target string) []autoscan.LibraryRefresher {
+	rf.lock.RLock()
+	defer rf.lock.RUnlock()
+
+	var targets []autoscan.LibraryRefresher
+	for _, refresher := range rf.targets {
+		if target == "" || fmt.Sprint(refresher) == target {
+			targets = append(targets, refresher)
+		}
+	}
+
+	return targets
+}
+
+// refreshHandler fully refreshes the library named by the library query parameter, or all libraries without it,
+// for the target named by the target query parameter, or all targets which can refresh their libraries without it.
+// Unknown targets and libraries respond with 404 Not Found.
+func refreshHandler(rf *refreshers) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		target := r.URL.Query().Get("target")
+		library := r.URL.Query().Get("library")
+
+		targets := rf.matching(target)
+		if len(targets) == 0 {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		refreshed := make([]refreshedLibraries, 0, len(targets))
+		for _, refresher := range targets {
+			libraries, err := refresher.RefreshLibrary(r.Context(), library)
+			switch {
+			case err == nil:
+			case errors.Is(err, autoscan.ErrUnknownLibrary):
+				// without a target, only the targets which have the library refresh it.
+				continue
+			default:
+				hlog.FromRequest(r).Error().
+					Err(err).
+					Str("target", fmt.Sprint(refresher)).
+					Str("library", library).
+					Msg("Failed refreshing the library")
+				rw.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			refreshed = append(refreshed, refreshedLibraries{
+				Target:    fmt.Sprint(refresher),
+				Libraries: libraries,
+			})
+		}
+
+		if len(refreshed) == 0 {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(rw).Encode(refreshed)
+	}
+}
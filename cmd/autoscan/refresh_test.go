@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/kri100f86/autoscan"
+	"github.com/kri100f86/autoscan/migrate"
+	"github.com/kri100f86/autoscan/processor"
+
+	// sqlite3 driver
+	_ "modernc.org/sqlite"
+)
+
+// refreshTarget is a target with fixed libraries which records the libraries it refreshed.
+type refreshTarget struct {
+	healthTarget
+	name      string
+	libraries []string
+	err       error
+	refreshed []string
+}
+
+func (t *refreshTarget) String() string {
+	return t.name
+}
+
+func (t *refreshTarget) RefreshLibrary(_ context.Context, name string) ([]string, error) {
+	if t.err != nil {
+		return nil, t.err
+	}
+
+	for _, lib := range t.libraries {
+		if name == "" || lib == name {
+			t.refreshed = append(t.refreshed, lib)
+		}
+	}
+
+	if len(t.refreshed) == 0 {
+		return nil, fmt.Errorf("%s: %w", name, autoscan.ErrUnknownLibrary)
+	}
+
+	return t.refreshed, nil
+}
+
+func TestRefreshHandler(t *testing.T) {
+	type Test struct {
+		Name      string
+		Path      string
+		Err       error
+		Code      int
+		Refreshed map[string][]string
+	}
+
+	var testCases = []Test{
+		{
+			Name:      "Refreshes the library of the target",
+			Path:      "/targets/refresh?target=jellyfin&library=Movies",
+			Code:      http.StatusOK,
+			Refreshed: map[string][]string{"jellyfin": {"Movies"}},
+		},
+		{
+			Name:      "Refreshes all libraries of the target",
+			Path:      "/targets/refresh?target=jellyfin",
+			Code:      http.StatusOK,
+			Refreshed: map[string][]string{"jellyfin": {"Movies", "TV"}},
+		},
+		{
+			Name:      "Refreshes the library of all targets which have it",
+			Path:      "/targets/refresh?library=TV",
+			Code:      http.StatusOK,
+			Refreshed: map[string][]string{"jellyfin": {"TV"}, "jellyfin-4k": {"TV"}},
+		},
+		{
+			Name: "Unknown targets are not found",
+			Path: "/targets/refresh?target=plex",
+			Code: http.StatusNotFound,
+		},
+		{
+			Name: "Unknown libraries are not found",
+			Path: "/targets/refresh?library=Music",
+			Code: http.StatusNotFound,
+		},
+		{
+			Name: "Failed refreshes respond with an error",
+			Path: "/targets/refresh?target=jellyfin",
+			Err:  errors.New("refresh failed"),
+			Code: http.StatusInternalServerError,
+		},
+	}
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	mg, err := migrate.New(db, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proc, err := processor.New(processor.Config{Db: db, Mg: mg})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			targets := []*refreshTarget{
+				{name: "jellyfin", libraries: []string{"Movies", "TV"}, err: tc.Err},
+				{name: "jellyfin-4k", libraries: []string{"TV"}},
+			}
+
+			rf := new(refreshers)
+			rf.set([]autoscan.Target{targets[0], targets[1], &healthTarget{}})
+
+			var c config
+			c.Auth.Username = "admin"
+			c.Auth.Password = "secret"
+			router := getRouter(c, proc, new(inspectors), rf)
+
+			req := httptest.NewRequest("POST", tc.Path, nil)
+			req.SetBasicAuth("admin", "secret")
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tc.Code {
+				t.Fatalf("Status codes do not match: %d vs %d", rec.Code, tc.Code)
+			}
+
+			if tc.Code != http.StatusOK {
+				return
+			}
+
+			var refreshed []refreshedLibraries
+			if err := json.NewDecoder(rec.Body).Decode(&refreshed); err != nil {
+				t.Fatal(err)
+			}
+
+			got := make(map[string][]string)
+			for _, r := range refreshed {
+				got[r.Target] = r.Libraries
+			}
+
+			if !reflect.DeepEqual(got, tc.Refreshed) {
+				t.Errorf("Refreshed libraries do not match: %v vs %v", got, tc.Refreshed)
+			}
+		})
+	}
+
+	t.Run("Refreshes nothing in dry run", func(t *testing.T) {
+		target := &refreshTarget{name: "jellyfin", libraries: []string{"Movies", "TV"}}
+
+		rf := new(refreshers)
+		rf.set([]autoscan.Target{autoscan.DryRun(target), autoscan.DryRun(&healthTarget{})})
+
+		var c config
+		router := getRouter(c, proc, new(inspectors), rf)
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("POST", "/targets/refresh?target=jellyfin&library=Movies", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Status codes do not match: %d vs %d", rec.Code, http.StatusOK)
+		}
+
+		if len(target.refreshed) > 0 {
+			t.Errorf("Libraries were refreshed in dry run: %v", target.refreshed)
+		}
+	})
+
+	t.Run("Requires credentials", func(t *testing.T) {
+		var c config
+		c.Auth.Username = "admin"
+		c.Auth.Password = "secret"
+
+		rec := httptest.NewRecorder()
+		getRouter(c, proc, new(inspectors), new(refreshers)).
+			ServeHTTP(rec, httptest.NewRequest("POST", "/targets/refresh", nil))
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Status codes do not match: %d vs %d", rec.Code, http.StatusUnauthorized)
+		}
+	})
+}
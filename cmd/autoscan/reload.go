@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/kri100f86/autoscan"
+)
+
+// tokenTargets holds the targets whose token can be rotated, by their kind and URL.
+type tokenTargets map[string]autoscan.TokenRotator
+
+func tokenKey(kind string, url string) string {
+	return kind + " " + url
+}
+
+// newTokenTargets retains the targets implementing autoscan.TokenRotator,
+// the targets must be in the order of the builders.
+func newTokenTargets(builders []targetBuilder, targets []autoscan.Target) tokenTargets {
+	tt := make(tokenTargets)
+	for i, target := range targets {
+		if r, ok := target.(autoscan.TokenRotator); ok {
+			tt[tokenKey(builders[i].kind, builders[i].url)] = r
+		}
+	}
+
+	return tt
+}
+
+// rotate applies the tokens of the config to the targets with the same URL,
+// and returns the number of targets it applied to.
+func (tt tokenTargets) rotate(c config) int {
+	rotated := 0
+	for _, t := range c.Targets.Jellyfin {
+		if r, ok := tt[tokenKey("jellyfin", t.URL)]; ok {
+			r.SetToken(t.Token)
+			rotated++
+		}
+	}
+
+	return rotated
+}
+
+// reloadTokens reloads the config on SIGHUP and rotates the tokens of the targets.
+// Other changes to the config require a restart.
+func reloadTokens(path string, tt tokenTargets) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	for range hup {
+		c, err := loadConfig(path)
+		if err != nil {
+			log.Error().
+				Err(err).
+				Msg("Failed reloading config, tokens were not rotated")
+			continue
+		}
+
+		log.Info().
+			Int("targets", tt.rotate(c)).
+			Msg("Reloaded the tokens of the targets")
+	}
+}
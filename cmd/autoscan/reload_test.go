@@ -0,0 +1,49 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kri100f86/autoscan"
+	"github.com/kri100f86/autoscan/targets/jellyfin"
+)
+
+type rotatingTarget struct {
+	namedTarget
+	tokens []string
+}
+
+func (t *rotatingTarget) SetToken(token string) {
+	t.tokens = append(t.tokens, token)
+}
+
+func TestRotateTokens(t *testing.T) {
+	first := &rotatingTarget{namedTarget: "first"}
+	second := &rotatingTarget{namedTarget: "second"}
+
+	builders := []targetBuilder{
+		{kind: "jellyfin", url: "http://first"},
+		{kind: "plex", url: "http://plex"},
+		{kind: "jellyfin", url: "http://second"},
+	}
+
+	tt := newTokenTargets(builders, []autoscan.Target{first, namedTarget("plex"), second})
+
+	var c config
+	c.Targets.Jellyfin = []jellyfin.Config{
+		{URL: "http://second", Token: "rotated"},
+		{URL: "http://unknown", Token: "ignored"},
+	}
+
+	if rotated := tt.rotate(c); rotated != 1 {
+		t.Errorf("Rotated targets do not match: %d vs %d", rotated, 1)
+	}
+
+	if first.tokens != nil {
+		t.Errorf("Token of a target missing from the config was rotated: %v", first.tokens)
+	}
+
+	if want := []string{"rotated"}; !reflect.DeepEqual(second.tokens, want) {
+		t.Errorf("Tokens do not match: %v vs %v", second.tokens, want)
+	}
+}
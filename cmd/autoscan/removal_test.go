@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/kri100f86/autoscan"
+	"github.com/kri100f86/autoscan/migrate"
+	"github.com/kri100f86/autoscan/processor"
+	"github.com/kri100f86/autoscan/targets/jellyfin"
+
+	// sqlite3 driver
+	_ "modernc.org/sqlite"
+)
+
+func TestRemovalBatch(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	mg, err := migrate.New(db, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proc, err := processor.New(processor.Config{Db: db, Mg: mg})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// three files deleted within one folder
+	folder := "/data/Movies/Collection/Parasite (2019)"
+	for i := 0; i < 3; i++ {
+		if err := proc.Add(autoscan.Scan{Folder: folder, Removed: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	js := &jellyfinServer{items: `{"Items": [{"Id": "collection", "Path": "/data/Movies/Collection"}]}`}
+	ts := httptest.NewServer(js)
+	defer ts.Close()
+
+	target, err := jellyfin.New(jellyfin.Config{
+		URL:            ts.URL,
+		Token:          "token",
+		UserID:         "user",
+		PreciseRefresh: true,
+		RemoveDeleted:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	targets := []autoscan.Target{target}
+	if err := proc.Process(context.Background(), targets); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := proc.Process(context.Background(), targets); !errors.Is(err, autoscan.ErrNoScans) {
+		t.Fatalf("Removals were not merged into a single scan: %v", err)
+	}
+
+	want := []string{"POST /Library/Media/Updated", "POST /Items/collection/Refresh"}
+	if !reflect.DeepEqual(js.requests, want) {
+		t.Errorf("Requests do not match: %v vs %v", js.requests, want)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/kri100f86/autoscan"
+)
+
+// rewriteCmd prints how a path is rewritten by the rules of a target,
+// optionally preceded by the rules of the trigger which received the path.
+type rewriteCmd struct {
+	Target  string `required:"" help:"Target type, e.g. plex or jellyfin"`
+	Trigger string `help:"Trigger type or name, its rewrite rules are applied before those of the target"`
+	Path    string `required:"" help:"Path to rewrite"`
+}
+
+// rewriteSource is a trigger or target with its rewrite rules.
+type rewriteSource struct {
+	kind  string
+	label string
+	rules []autoscan.Rewrite
+}
+
+func (s rewriteSource) String() string {
+	if s.label == "" {
+		return s.kind
+	}
+
+	return fmt.Sprintf("%s %s", s.kind, s.label)
+}
+
+func (cmd rewriteCmd) run(c config, w io.Writer) error {
+	targets := rewriteSources(c.Targets, func(s rewriteSource) bool {
+		return s.kind == cmd.Target
+	})
+
+	if len(targets) == 0 {
+		return fmt.Errorf("no %s targets configured", cmd.Target)
+	}
+
+	var chain []rewriteSource
+	if cmd.Trigger != "" {
+		triggers := rewriteSources(c.Triggers, func(s rewriteSource) bool {
+			return s.kind == cmd.Trigger || s.label == cmd.Trigger
+		})
+
+		switch {
+		case len(triggers) == 0:
+			return fmt.Errorf("no %s trigger configured", cmd.Trigger)
+		case len(triggers) > 1:
+			return fmt.Errorf("multiple %s triggers configured, select one by name", cmd.Trigger)
+		}
+
+		chain = append(chain, triggers[0])
+	}
+
+	for i, target := range targets {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+
+		path := cmd.Path
+		fmt.Fprintln(w, path)
+
+		for _, source := range append(chain, target) {
+			rewritten, rule, err := autoscan.MatchRewrite(source.rules, path)
+			if err != nil {
+				return fmt.Errorf("%v: %w", source, err)
+			}
+
+			if rule < 0 {
+				fmt.Fprintf(w, "  -> %s (%v: no rule matched)\n", rewritten, source)
+				continue
+			}
+
+			fmt.Fprintf(w, "  -> %s (%v: rule %d, %q to %q)\n", rewritten, source, rule+1,
+				source.rules[rule].From, source.rules[rule].To)
+			path = rewritten
+		}
+	}
+
+	return nil
+}
+
+// rewriteSources collects the rewrite rules of the triggers or targets section of the config.
+// Each field of the section is named after its yaml key and holds either a single config or a list of configs.
+func rewriteSources(section interface{}, match func(rewriteSource) bool) []rewriteSource {
+	var sources []rewriteSource
+
+	v := reflect.ValueOf(section)
+	for i := 0; i < v.NumField(); i++ {
+		kind := strings.Split(v.Type().Field(i).Tag.Get("yaml"), ",")[0]
+
+		field := v.Field(i)
+		if field.Kind() != reflect.Slice {
+			if source, ok := newRewriteSource(kind, field); ok && match(source) {
+				sources = append(sources, source)
+			}
+			continue
+		}
+
+		for j := 0; j < field.Len(); j++ {
+			if source, ok := newRewriteSource(kind, field.Index(j)); ok && match(source) {
+				sources = append(sources, source)
+			}
+		}
+	}
+
+	return sources
+}
+
+func newRewriteSource(kind string, c reflect.Value) (rewriteSource, bool) {
+	f := c.FieldByName("Rewrite")
+	if !f.IsValid() {
+		return rewriteSource{}, false
+	}
+
+	rules, ok := f.Interface().([]autoscan.Rewrite)
+	if !ok {
+		return rewriteSource{}, false
+	}
+
+	source := rewriteSource{
+		kind:  kind,
+		rules: rules,
+	}
+
+	// identify the config by its name, or else its url.
+	for _, name := range []string{"Name", "URL"} {
+		if f := c.FieldByName(name); f.IsValid() && f.String() != "" {
+			source.label = f.String()
+			break
+		}
+	}
+
+	return source, true
+}
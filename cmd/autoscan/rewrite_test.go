@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRewriteCommand(t *testing.T) {
+	type Given struct {
+		Command rewriteCmd
+	}
+
+	type Expected struct {
+		Output string
+		Err    string
+	}
+
+	type Test struct {
+		Name     string
+		Given    Given
+		Expected Expected
+	}
+
+	const sample = `
+triggers:
+  sonarr:
+    - name: sonarr-docker
+      rewrite:
+        - from: ^/tv/
+          to: /mnt/unionfs/Media/TV/
+    - name: sonarr-4k
+      rewrite:
+        - from: ^/tv4k/
+          to: /mnt/unionfs/Media/TV 4K/
+  manual:
+    rewrite:
+      - from: ^/media/
+        to: /mnt/unionfs/Media/
+
+targets:
+  jellyfin:
+    - url: http://jellyfin:8096
+      token: secret
+      rewrite:
+        - from: ^/mnt/unionfs/Media/Movies/
+          to: /data/Movies/
+        - from: ^/mnt/unionfs/Media/(TV|TV 4K)/
+          to: /data/$1/
+  plex:
+    - url: http://plex:32400
+      token: secret
+    - url: http://plex-4k:32400
+      token: secret
+      rewrite:
+        - from: ^/mnt/unionfs/
+          to: /
+`
+
+	c, err := decodeConfig(strings.NewReader(sample))
+	if err != nil {
+		t.Fatalf("Could not decode the config: %v", err)
+	}
+
+	var testCases = []Test{
+		{
+			"Prints the matching rule of the target",
+			Given{
+				Command: rewriteCmd{Target: "jellyfin", Path: "/mnt/unionfs/Media/TV/Westworld"},
+			},
+			Expected{
+				Output: `/mnt/unionfs/Media/TV/Westworld
+  -> /data/TV/Westworld (jellyfin http://jellyfin:8096: rule 2, "^/mnt/unionfs/Media/(TV|TV 4K)/" to "/data/$1/")
+`,
+			},
+		},
+		{
+			"Chains the rules of the trigger and the target",
+			Given{
+				Command: rewriteCmd{Target: "jellyfin", Trigger: "sonarr-4k", Path: "/tv4k/Westworld"},
+			},
+			Expected{
+				Output: `/tv4k/Westworld
+  -> /mnt/unionfs/Media/TV 4K/Westworld (sonarr sonarr-4k: rule 1, "^/tv4k/" to "/mnt/unionfs/Media/TV 4K/")
+  -> /data/TV 4K/Westworld (jellyfin http://jellyfin:8096: rule 2, "^/mnt/unionfs/Media/(TV|TV 4K)/" to "/data/$1/")
+`,
+			},
+		},
+		{
+			"Selects a single trigger by its type",
+			Given{
+				Command: rewriteCmd{Target: "jellyfin", Trigger: "manual", Path: "/media/Movies/Interstellar (2014)"},
+			},
+			Expected{
+				Output: `/media/Movies/Interstellar (2014)
+  -> /mnt/unionfs/Media/Movies/Interstellar (2014) (manual: rule 1, "^/media/" to "/mnt/unionfs/Media/")
+  -> /data/Movies/Interstellar (2014) (jellyfin http://jellyfin:8096: rule 1, "^/mnt/unionfs/Media/Movies/" to "/data/Movies/")
+`,
+			},
+		},
+		{
+			"Prints every target of the type",
+			Given{
+				Command: rewriteCmd{Target: "plex", Path: "/mnt/unionfs/Media/Movies/Interstellar (2014)"},
+			},
+			Expected{
+				Output: `/mnt/unionfs/Media/Movies/Interstellar (2014)
+  -> /mnt/unionfs/Media/Movies/Interstellar (2014) (plex http://plex:32400: no rule matched)
+
+/mnt/unionfs/Media/Movies/Interstellar (2014)
+  -> /Media/Movies/Interstellar (2014) (plex http://plex-4k:32400: rule 1, "^/mnt/unionfs/" to "/")
+`,
+			},
+		},
+		{
+			"Returns an error when the target is not configured",
+			Given{
+				Command: rewriteCmd{Target: "emby", Path: "/mnt/unionfs/Media/TV/Westworld"},
+			},
+			Expected{
+				Err: "no emby targets configured",
+			},
+		},
+		{
+			"Returns an error when the trigger is ambiguous",
+			Given{
+				Command: rewriteCmd{Target: "jellyfin", Trigger: "sonarr", Path: "/tv/Westworld"},
+			},
+			Expected{
+				Err: "multiple sonarr triggers configured, select one by name",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := tc.Given.Command.run(c, &out)
+			if tc.Expected.Err != "" {
+				if err == nil || err.Error() != tc.Expected.Err {
+					t.Fatalf("Errors do not match: %v vs %s", err, tc.Expected.Err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Rewrite failed: %v", err)
+			}
+
+			if out.String() != tc.Expected.Output {
+				t.Logf("want:\n%s", tc.Expected.Output)
+				t.Logf("got:\n%s", out.String())
+				t.Errorf("Output does not match")
+			}
+		})
+	}
+}
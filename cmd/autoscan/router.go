@@ -11,6 +11,8 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 
+	"github.com/kri100f86/autoscan"
+	"github.com/kri100f86/autoscan/metrics"
 	"github.com/kri100f86/autoscan/processor"
 	"github.com/kri100f86/autoscan/triggers/a_train"
 	"github.com/kri100f86/autoscan/triggers/lidarr"
@@ -18,8 +20,12 @@ import (
 	"github.com/kri100f86/autoscan/triggers/radarr"
 	"github.com/kri100f86/autoscan/triggers/readarr"
 	"github.com/kri100f86/autoscan/triggers/sonarr"
+	"github.com/kri100f86/autoscan/triggers/webhook"
 )
 
+// defaultMaxBodyBytes limits the size of (decompressed) trigger requests unless max-body-bytes is set.
+const defaultMaxBodyBytes = 10 << 20
+
 func pattern(name string) string {
 	return fmt.Sprintf("/%s", name)
 }
@@ -30,7 +36,7 @@ func createCredentials(c config) map[string]string {
 	return creds
 }
 
-func getRouter(c config, proc *processor.Processor) chi.Router {
+func getRouter(c config, proc *processor.Processor, insp *inspectors, rf *refreshers) chi.Router {
 	r := chi.NewRouter()
 
 	// Middleware
@@ -49,13 +55,45 @@ func getRouter(c config, proc *processor.Processor) chi.Router {
 	}))
 
 	// Health check
-	r.Get("/health", healthHandler)
+	r.Get("/health", healthHandler(proc))
+
+	// Build information
+	r.Get("/version", versionHandler)
+
+	// Metrics
+	r.Get("/metrics", metrics.Default.Handler().ServeHTTP)
+
+	// Use Basic Auth middleware if username and password are set.
+	// The triggers authenticate within countRequests to count the rejected events.
+	auth := func(h http.Handler) http.Handler { return h }
+	if c.Auth.Username != "" && c.Auth.Password != "" {
+		auth = middleware.BasicAuth("Autoscan 1.x", createCredentials(c))
+	}
+
+	// Pending scans, protected like the triggers as they reveal the library paths.
+	r.With(auth).Get("/scans", scansHandler(proc, insp))
+
+	// Recently processed scans, protected like the pending scans.
+	r.With(auth).Get("/history", historyHandler(proc))
+
+	// Pausing targets, e.g. during maintenance of the media server.
+	r.With(auth).Post("/targets/pause", pauseHandler(proc, true))
+	r.With(auth).Post("/targets/resume", pauseHandler(proc, false))
+
+	// Full library refreshes, e.g. to reconcile the libraries after bulk changes of the files.
+	r.With(auth).Post("/targets/refresh", refreshHandler(rf))
 
 	// HTTP-Triggers
 	r.Route("/triggers", func(r chi.Router) {
-		// Use Basic Auth middleware if username and password are set.
-		if c.Auth.Username != "" && c.Auth.Password != "" {
-			r.Use(middleware.BasicAuth("Autoscan 1.x", createCredentials(c)))
+		// Decompress gzip-encoded payloads and reject oversized ones,
+		// only after authentication so unauthenticated clients cannot make Autoscan inflate their payloads.
+		maxBodyBytes := c.MaxBodyBytes
+		if maxBodyBytes <= 0 {
+			maxBodyBytes = defaultMaxBodyBytes
+		}
+
+		triggerAuth := func(h http.Handler) http.Handler {
+			return auth(autoscan.DecompressBody(maxBodyBytes)(autoscan.LimitBody(maxBodyBytes)(h)))
 		}
 
 		// A-Train HTTP-trigger
@@ -65,7 +103,7 @@ func getRouter(c config, proc *processor.Processor) chi.Router {
 				log.Fatal().Err(err).Str("trigger", "a-train").Msg("Failed initialising trigger")
 			}
 
-			r.Post("/{drive}", trigger(proc.Add).ServeHTTP)
+			r.Post("/{drive}", countRequests("a-train", trigger, triggerAuth, proc.Add))
 		})
 
 		// Mixed-style Manual HTTP-trigger
@@ -75,7 +113,7 @@ func getRouter(c config, proc *processor.Processor) chi.Router {
 				log.Fatal().Err(err).Str("trigger", "manual").Msg("Failed initialising trigger")
 			}
 
-			r.HandleFunc("/", trigger(proc.Add).ServeHTTP)
+			r.HandleFunc("/", countRequests("manual", trigger, triggerAuth, proc.Add))
 		})
 
 		// OLD-style HTTP-triggers. Can be converted to the /{trigger}/{id} format in a 2.0 release.
@@ -85,7 +123,7 @@ func getRouter(c config, proc *processor.Processor) chi.Router {
 				log.Fatal().Err(err).Str("trigger", t.Name).Msg("Failed initialising trigger")
 			}
 
-			r.Post(pattern(t.Name), trigger(proc.Add).ServeHTTP)
+			r.Post(pattern(t.Name), countRequests(t.Name, trigger, triggerAuth, proc.Add))
 		}
 
 		for _, t := range c.Triggers.Radarr {
@@ -94,7 +132,7 @@ func getRouter(c config, proc *processor.Processor) chi.Router {
 				log.Fatal().Err(err).Str("trigger", t.Name).Msg("Failed initialising trigger")
 			}
 
-			r.Post(pattern(t.Name), trigger(proc.Add).ServeHTTP)
+			r.Post(pattern(t.Name), countRequests(t.Name, trigger, triggerAuth, proc.Add))
 		}
 
 		for _, t := range c.Triggers.Readarr {
@@ -103,7 +141,7 @@ func getRouter(c config, proc *processor.Processor) chi.Router {
 				log.Fatal().Err(err).Str("trigger", t.Name).Msg("Failed initialising trigger")
 			}
 
-			r.Post(pattern(t.Name), trigger(proc.Add).ServeHTTP)
+			r.Post(pattern(t.Name), countRequests(t.Name, trigger, triggerAuth, proc.Add))
 		}
 
 		for _, t := range c.Triggers.Sonarr {
@@ -112,14 +150,18 @@ func getRouter(c config, proc *processor.Processor) chi.Router {
 				log.Fatal().Err(err).Str("trigger", t.Name).Msg("Failed initialising trigger")
 			}
 
-			r.Post(pattern(t.Name), trigger(proc.Add).ServeHTTP)
+			r.Post(pattern(t.Name), countRequests(t.Name, trigger, triggerAuth, proc.Add))
+		}
+
+		for _, t := range c.Triggers.Webhook {
+			trigger, err := webhook.New(t)
+			if err != nil {
+				log.Fatal().Err(err).Str("trigger", t.Name).Msg("Failed initialising trigger")
+			}
+
+			r.Post(pattern(t.Name), countRequests(t.Name, trigger, triggerAuth, proc.Add))
 		}
 	})
 
 	return r
 }
-
-// Other Handlers
-func healthHandler(rw http.ResponseWriter, r *http.Request) {
-	rw.WriteHeader(http.StatusOK)
-}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kri100f86/autoscan/migrate"
+	"github.com/kri100f86/autoscan/processor"
+
+	// sqlite3 driver
+	_ "modernc.org/sqlite"
+)
+
+func TestMaxBodyBytes(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	mg, err := migrate.New(db, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proc, err := processor.New(processor.Config{Db: db, Mg: mg})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var c config
+	c.MaxBodyBytes = 64
+	router := getRouter(c, proc, new(inspectors), new(refreshers))
+
+	post := func(body string) int {
+		req := httptest.NewRequest("POST", "/triggers/manual", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := post(`{"dirs": ["/data/Movies/Parasite (2019)"]}`); code != http.StatusOK {
+		t.Errorf("Status codes within the limit do not match: %d vs %d", code, http.StatusOK)
+	}
+
+	oversized := `{"dirs": ["/data/Movies/Parasite (2019)", "/data/Movies/Interstellar (2014)"]}`
+	if code := post(oversized); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Status codes beyond the limit do not match: %d vs %d", code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestTriggerAuthBeforeDecompression(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	mg, err := migrate.New(db, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proc, err := processor.New(processor.Config{Db: db, Mg: mg})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var c config
+	c.Auth.Username = "user"
+	c.Auth.Password = "secret"
+	router := getRouter(c, proc, new(inspectors), new(refreshers))
+
+	// the payload is not valid gzip, so it fails once it is decompressed
+	post := func(password string) int {
+		req := httptest.NewRequest("POST", "/triggers/manual", strings.NewReader("not gzip"))
+		req.Header.Set("Content-Encoding", "gzip")
+		req.SetBasicAuth("user", password)
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := post("wrong"); code != http.StatusUnauthorized {
+		t.Errorf("Status codes of unauthenticated requests do not match: %d vs %d", code, http.StatusUnauthorized)
+	}
+
+	if code := post("secret"); code != http.StatusBadRequest {
+		t.Errorf("Status codes of authenticated requests do not match: %d vs %d", code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/hlog"
+
+	"github.com/kri100f86/autoscan"
+	"github.com/kri100f86/autoscan/processor"
+)
+
+// pendingScan describes a scan which has not been sent to all targets yet.
+type pendingScan struct {
+	ID             string    `json:"id"`
+	Folder         string    `json:"folder"`
+	Priority       int       `json:"priority"`
+	Removed        bool      `json:"removed"`
+	ItemID         string    `json:"item_id,omitempty"`
+	Event          string    `json:"event,omitempty"`
+	File           string    `json:"file,omitempty"`
+	CollectionName string    `json:"collection_name,omitempty"`
+	LibraryHint    string    `json:"library_hint,omitempty"`
+	ItemIDs        []string  `json:"item_ids,omitempty"`
+	Time           time.Time `json:"time"`
+	Eligible       time.Time `json:"eligible"`
+	Target         string    `json:"target,omitempty"`
+	Waiting        string    `json:"waiting,omitempty"`
+
+	Inspections []scanInspection `json:"inspections,omitempty"`
+}
+
+// scanInspection describes how a target will handle a pending scan.
+type scanInspection struct {
+	Target  string `json:"target"`
+	Library string `json:"library"`
+	ItemID  string `json:"item_id,omitempty"`
+	Precise bool   `json:"precise"`
+}
+
+// inspectors holds the targets which can inspect the pending scans.
+// The router serves the scans before the targets are initialised, so they are set afterwards.
+type inspectors struct {
+	lock    sync.RWMutex
+	targets []autoscan.ScanInspector
+}
+
+// set retains the targets implementing autoscan.ScanInspector.
+func (i *inspectors) set(targets []autoscan.Target) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	i.targets = make([]autoscan.ScanInspector, 0)
+	for _, target := range targets {
+		if inspector, ok := target.(autoscan.ScanInspector); ok {
+			i.targets = append(i.targets, inspector)
+		}
+	}
+}
+
+// inspect returns the inspections of the targets which can tell how they handle the scan.
+func (i *inspectors) inspect(scan autoscan.Scan) []scanInspection {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	var inspections []scanInspection
+	for _, inspector := range i.targets {
+		in, ok := inspector.Inspect(scan)
+		if !ok {
+			continue
+		}
+
+		inspections = append(inspections, scanInspection{
+			Target:  fmt.Sprint(inspector),
+			Library: in.Library,
+			ItemID:  in.ItemID,
+			Precise: in.Precise,
+		})
+	}
+
+	return inspections
+}
+
+// scansHandler lists the pending scans as JSON, in the order in which they are processed.
+// Targets implementing autoscan.ScanInspector describe how they will handle each scan.
+func scansHandler(proc *processor.Processor, insp *inspectors) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		pending, err := proc.Pending()
+		if err != nil {
+			hlog.FromRequest(r).Error().Err(err).Msg("Failed retrieving pending scans")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		scans := make([]pendingScan, 0, len(pending))
+		for _, scan := range pending {
+			scans = append(scans, pendingScan{
+				ID:             scan.ID,
+				Folder:         scan.Folder,
+				Priority:       scan.Priority,
+				Removed:        scan.Removed,
+				ItemID:         scan.ItemID,
+				Event:          scan.Event,
+				File:           scan.File,
+				CollectionName: scan.CollectionName,
+				LibraryHint:    scan.LibraryHint,
+				ItemIDs:        scan.ItemIDs,
+				Time:           scan.Time,
+				Eligible:       scan.Eligible,
+				Target:         scan.Target,
+				Waiting:        scan.Waiting,
+
+				Inspections: insp.inspect(scan.Scan),
+			})
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(rw).Encode(scans)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/kri100f86/autoscan"
+	"github.com/kri100f86/autoscan/migrate"
+	"github.com/kri100f86/autoscan/processor"
+	"github.com/kri100f86/autoscan/targets/jellyfin"
+
+	// sqlite3 driver
+	_ "modernc.org/sqlite"
+)
+
+func TestScansHandler(t *testing.T) {
+	type Test struct {
+		Name       string
+		Username   string
+		Password   string
+		StatusCode int
+		Folders    []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:       "Lists the enqueued scans",
+			Username:   "admin",
+			Password:   "secret",
+			StatusCode: http.StatusOK,
+			Folders: []string{
+				"/data/Movies/Interstellar (2014)",
+				"/data/Movies/Parasite (2019)",
+			},
+		},
+		{
+			Name:       "Requires the trigger credentials",
+			Username:   "admin",
+			Password:   "wrong",
+			StatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			db, err := sql.Open("sqlite", ":memory:")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			db.SetMaxOpenConns(1)
+
+			mg, err := migrate.New(db, "migrations")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			proc, err := processor.New(processor.Config{Db: db, Mg: mg})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = proc.Add(
+				autoscan.Scan{Folder: "/data/Movies/Parasite (2019)", Priority: 1},
+				autoscan.Scan{Folder: "/data/Movies/Interstellar (2014)", Priority: 5},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var c config
+			c.Auth.Username = "admin"
+			c.Auth.Password = "secret"
+
+			req := httptest.NewRequest("GET", "/scans", nil)
+			req.SetBasicAuth(tc.Username, tc.Password)
+
+			rec := httptest.NewRecorder()
+			getRouter(c, proc, new(inspectors), new(refreshers)).ServeHTTP(rec, req)
+
+			if rec.Code != tc.StatusCode {
+				t.Fatalf("Status codes do not match: %d vs %d", rec.Code, tc.StatusCode)
+			}
+
+			if tc.StatusCode != http.StatusOK {
+				return
+			}
+
+			var scans []pendingScan
+			if err := json.NewDecoder(rec.Body).Decode(&scans); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(scans) != len(tc.Folders) {
+				t.Fatalf("Scans do not match: %+v", scans)
+			}
+
+			for i, scan := range scans {
+				if scan.Folder != tc.Folders[i] || scan.ID == "" {
+					t.Errorf("Scans do not match: %+v vs %v", scan, tc.Folders[i])
+				}
+			}
+		})
+	}
+}
+
+func TestScansInspection(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	mg, err := migrate.New(db, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proc, err := processor.New(processor.Config{Db: db, Mg: mg})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = proc.Add(
+		autoscan.Scan{Folder: "/data/Movies/Parasite (2019)", Priority: 5},
+		autoscan.Scan{Folder: "/data/Movies/Interstellar (2014)", Priority: 1},
+		autoscan.Scan{Folder: "/data/TV/Chernobyl", Priority: 1},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	js := &jellyfinServer{items: `{"Items": [{"Id": "parasite", "Path": "/data/Movies/Parasite (2019)"}]}`}
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		requests++
+		js.ServeHTTP(rw, r)
+	}))
+	defer ts.Close()
+
+	target, err := jellyfin.New(jellyfin.Config{
+		URL:            ts.URL,
+		Token:          "token",
+		UserID:         "user",
+		PreciseRefresh: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// match the folder of Parasite to its item
+	if err := target.Scan(context.Background(), autoscan.Scan{Folder: "/data/Movies/Parasite (2019)"}); err != nil {
+		t.Fatal(err)
+	}
+
+	insp := new(inspectors)
+	insp.set([]autoscan.Target{target})
+
+	sent := requests
+	rec := httptest.NewRecorder()
+	getRouter(config{}, proc, insp, new(refreshers)).ServeHTTP(rec, httptest.NewRequest("GET", "/scans", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status codes do not match: %d vs %d", rec.Code, http.StatusOK)
+	}
+
+	if requests != sent {
+		t.Errorf("Inspecting the scans contacted Jellyfin: %d requests", requests-sent)
+	}
+
+	var scans []pendingScan
+	if err := json.NewDecoder(rec.Body).Decode(&scans); err != nil {
+		t.Fatal(err)
+	}
+
+	name := fmt.Sprint(target)
+	want := map[string][]scanInspection{
+		"/data/Movies/Parasite (2019)":     {{Target: name, Library: "Movies", ItemID: "parasite", Precise: true}},
+		"/data/Movies/Interstellar (2014)": {{Target: name, Library: "Movies", Precise: true}},
+		"/data/TV/Chernobyl":               nil,
+	}
+
+	if len(scans) != len(want) {
+		t.Fatalf("Scans do not match: %+v", scans)
+	}
+
+	for _, scan := range scans {
+		if !reflect.DeepEqual(scan.Inspections, want[scan.Folder]) {
+			t.Errorf("Inspections of %s do not match: %+v vs %+v", scan.Folder, scan.Inspections, want[scan.Folder])
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kri100f86/autoscan"
+)
+
+// maxTargetWorkers limits the number of targets initialised at the same time.
+const maxTargetWorkers = 4
+
+// A targetBuilder initialises a single configured target.
+type targetBuilder struct {
+	kind string
+	url  string
+	new  func() (autoscan.Target, error)
+}
+
+// A targetError is the failure of a single targetBuilder.
+type targetError struct {
+	kind string
+	url  string
+	err  error
+}
+
+func (e targetError) Error() string {
+	return fmt.Sprintf("%s (%s): %v", e.kind, e.url, e.err)
+}
+
+func (e targetError) Unwrap() error {
+	return e.err
+}
+
+// targetErrors holds the failures of all targetBuilders which failed.
+type targetErrors []targetError
+
+func (e targetErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// buildTargets initialises the targets with a pool of workers,
+// so a slow target does not delay the others.
+//
+// The targets are returned in the order of the builders.
+// A builder exceeding the timeout fails, a timeout of zero disables the timeout.
+// When any builder fails, a targetErrors of all failures is returned.
+func buildTargets(builders []targetBuilder, workers int, timeout time.Duration) ([]autoscan.Target, error) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	targets := make([]autoscan.Target, len(builders))
+	errs := make([]error, len(builders))
+
+	jobs := make(chan int)
+	wg := new(sync.WaitGroup)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				targets[i], errs[i] = buildTarget(builders[i], timeout)
+			}
+		}()
+	}
+
+	for i := range builders {
+		jobs <- i
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	failed := make(targetErrors, 0)
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, targetError{kind: builders[i].kind, url: builders[i].url, err: err})
+		}
+	}
+
+	if len(failed) > 0 {
+		return nil, failed
+	}
+
+	return targets, nil
+}
+
+func buildTarget(b targetBuilder, timeout time.Duration) (autoscan.Target, error) {
+	if timeout <= 0 {
+		return b.new()
+	}
+
+	type result struct {
+		target autoscan.Target
+		err    error
+	}
+
+	// the constructors do not accept a context, so a slow one is left behind
+	done := make(chan result, 1)
+	go func() {
+		t, err := b.new()
+		done <- result{target: t, err: err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case r := <-done:
+		return r.target, r.err
+	case <-timer.C:
+		return nil, fmt.Errorf("initialisation exceeded the startup timeout of %v", timeout)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kri100f86/autoscan"
+)
+
+type namedTarget string
+
+func (t namedTarget) Scan(context.Context, autoscan.Scan) error { return nil }
+func (t namedTarget) Available() error                          { return nil }
+
+func TestBuildTargets(t *testing.T) {
+	errBuild := errors.New("connection refused")
+
+	t.Run("Targets are built concurrently", func(t *testing.T) {
+		lock := new(sync.Mutex)
+		running, concurrent := 0, 0
+		builder := func(name string) targetBuilder {
+			return targetBuilder{kind: "plex", url: name, new: func() (autoscan.Target, error) {
+				lock.Lock()
+				running++
+				if running > concurrent {
+					concurrent = running
+				}
+				lock.Unlock()
+
+				time.Sleep(50 * time.Millisecond)
+
+				lock.Lock()
+				running--
+				lock.Unlock()
+				return namedTarget(name), nil
+			}}
+		}
+
+		builders := []targetBuilder{builder("a"), builder("b"), builder("c"), builder("d"), builder("e")}
+		targets, err := buildTargets(builders, 3, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []autoscan.Target{namedTarget("a"), namedTarget("b"), namedTarget("c"), namedTarget("d"), namedTarget("e")}
+		if !reflect.DeepEqual(targets, want) {
+			t.Errorf("Targets do not match: %v vs %v", targets, want)
+		}
+
+		if concurrent != 3 {
+			t.Errorf("Concurrent builders do not match: %d vs %d", concurrent, 3)
+		}
+	})
+
+	t.Run("A slow target does not delay the others", func(t *testing.T) {
+		fast := make(chan struct{})
+		builders := []targetBuilder{
+			{kind: "jellyfin", url: "slow", new: func() (autoscan.Target, error) {
+				<-fast
+				return namedTarget("slow"), nil
+			}},
+			{kind: "plex", url: "fast", new: func() (autoscan.Target, error) {
+				close(fast)
+				return namedTarget("fast"), nil
+			}},
+		}
+
+		done := make(chan error)
+		go func() {
+			_, err := buildTargets(builders, 2, 0)
+			done <- err
+		}()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("The slow target blocked the fast target")
+		}
+	})
+
+	t.Run("Errors are aggregated", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+
+		builders := []targetBuilder{
+			{kind: "plex", url: "http://plex", new: func() (autoscan.Target, error) {
+				return namedTarget("plex"), nil
+			}},
+			{kind: "emby", url: "http://emby", new: func() (autoscan.Target, error) {
+				return nil, errBuild
+			}},
+			{kind: "jellyfin", url: "http://jellyfin", new: func() (autoscan.Target, error) {
+				<-release
+				return namedTarget("jellyfin"), nil
+			}},
+		}
+
+		targets, err := buildTargets(builders, 2, 50*time.Millisecond)
+		if targets != nil {
+			t.Errorf("Targets were returned despite the errors: %v", targets)
+		}
+
+		var failed targetErrors
+		if !errors.As(err, &failed) {
+			t.Fatalf("Error is not a targetErrors: %v", err)
+		}
+
+		kinds := make([]string, 0)
+		for _, f := range failed {
+			kinds = append(kinds, f.kind)
+		}
+
+		if want := []string{"emby", "jellyfin"}; !reflect.DeepEqual(kinds, want) {
+			t.Errorf("Failed targets do not match: %v vs %v", kinds, want)
+		}
+
+		if !errors.Is(failed[0], errBuild) {
+			t.Errorf("Error of the emby target does not match: %v", failed[0])
+		}
+	})
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/kri100f86/autoscan"
+	"github.com/kri100f86/autoscan/targets/audiobookshelf"
+	ast "github.com/kri100f86/autoscan/targets/autoscan"
+	"github.com/kri100f86/autoscan/targets/broker"
+	"github.com/kri100f86/autoscan/targets/emby"
+	"github.com/kri100f86/autoscan/targets/jellyfin"
+	"github.com/kri100f86/autoscan/targets/kodi"
+	"github.com/kri100f86/autoscan/targets/navidrome"
+	"github.com/kri100f86/autoscan/targets/plex"
+	outbound "github.com/kri100f86/autoscan/targets/webhook"
+)
+
+// testScanCmd sends a single scan to each target of a type, bypassing the triggers and the processor.
+// The path is given from the perspective of autoscan, the rewrite rules of the target still apply.
+type testScanCmd struct {
+	Target  string `required:"" help:"Target type, e.g. plex or jellyfin"`
+	Path    string `required:"" help:"Folder to scan"`
+	Removed bool   `help:"Send the scan as a removal"`
+}
+
+func (cmd testScanCmd) run(c config, w io.Writer) error {
+	targets, err := newTargets(c, cmd.Target)
+	if err != nil {
+		return err
+	}
+
+	scan := autoscan.Scan{
+		Folder:  cmd.Path,
+		Removed: cmd.Removed,
+		Time:    time.Now(),
+	}
+
+	failed := 0
+	for _, target := range targets {
+		refresh, itemID, err := scanTarget(c, target, scan)
+		if err != nil {
+			fmt.Fprintf(w, "%v: scan failed: %v\n", target, err)
+			failed++
+			continue
+		}
+
+		if report := refreshReport(refresh, itemID); report != "" {
+			fmt.Fprintf(w, "%v: scan sent: %s\n", target, report)
+			continue
+		}
+
+		fmt.Fprintf(w, "%v: scan sent\n", target)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d scans failed", failed, len(targets))
+	}
+
+	return nil
+}
+
+// scanTarget sends the scan to the target and returns how the target reported to have handled it.
+func scanTarget(c config, target autoscan.Target, scan autoscan.Scan) (refresh string, itemID string, err error) {
+	ctx, report := autoscan.WithRefreshReport(context.Background())
+	if c.ScanTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.ScanTimeout)
+		defer cancel()
+	}
+
+	err = target.Scan(ctx, scan)
+	refresh, itemID = report()
+	return refresh, itemID, err
+}
+
+// refreshReport describes how the target handled the scan,
+// it is empty for targets which do not report it.
+func refreshReport(refresh string, itemID string) string {
+	switch refresh {
+	case autoscan.RefreshPrecise:
+		if itemID != "" {
+			return fmt.Sprintf("precise refresh of item %s", itemID)
+		}
+		return "precise refresh"
+	case autoscan.RefreshFallback:
+		return "no matching item, fell back to a library scan"
+	case autoscan.RefreshLibrary:
+		return "library scan"
+	case autoscan.RefreshRemoval:
+		return "removal reported"
+	case autoscan.RefreshSkipped:
+		return "skipped by the target"
+	}
+
+	return ""
+}
+
+// newTargets initialises the targets of the given type.
+func newTargets(c config, kind string) ([]autoscan.Target, error) {
+	targets := make([]autoscan.Target, 0)
+	add := func(t autoscan.Target, err error) error {
+		if err != nil {
+			return fmt.Errorf("%s: %w", kind, err)
+		}
+
+		targets = append(targets, t)
+		return nil
+	}
+
+	var err error
+	switch kind {
+	case "audiobookshelf":
+		for _, t := range c.Targets.Audiobookshelf {
+			if err = add(audiobookshelf.New(t)); err != nil {
+				break
+			}
+		}
+	case "autoscan":
+		for _, t := range c.Targets.Autoscan {
+			if err = add(ast.New(t)); err != nil {
+				break
+			}
+		}
+	case "broker":
+		for _, t := range c.Targets.Broker {
+			if err = add(broker.New(t)); err != nil {
+				break
+			}
+		}
+	case "emby":
+		for _, t := range c.Targets.Emby {
+			if err = add(emby.New(t)); err != nil {
+				break
+			}
+		}
+	case "jellyfin":
+		for _, t := range c.Targets.Jellyfin {
+			if err = add(jellyfin.New(t)); err != nil {
+				break
+			}
+		}
+	case "kodi":
+		for _, t := range c.Targets.Kodi {
+			if err = add(kodi.New(t)); err != nil {
+				break
+			}
+		}
+	case "navidrome":
+		for _, t := range c.Targets.Navidrome {
+			if err = add(navidrome.New(t)); err != nil {
+				break
+			}
+		}
+	case "plex":
+		for _, t := range c.Targets.Plex {
+			if err = add(plex.New(t)); err != nil {
+				break
+			}
+		}
+	case "webhook":
+		for _, t := range c.Targets.Webhook {
+			if err = add(outbound.New(t)); err != nil {
+				break
+			}
+		}
+	default:
+		return nil, fmt.Errorf("%s: unknown target", kind)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no %s targets configured", kind)
+	}
+
+	return targets, nil
+}
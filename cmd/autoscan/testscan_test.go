@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/kri100f86/autoscan"
+	"github.com/kri100f86/autoscan/targets/jellyfin"
+)
+
+type jellyfinServer struct {
+	items    string
+	requests []string
+}
+
+func (s *jellyfinServer) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Emby-Token") != "token" {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/Library/VirtualFolders":
+		_, _ = rw.Write([]byte(`[{"Name": "Movies", "Locations": ["/data/Movies"], "CollectionType": "movies"}]`))
+		return
+	case "/Users/user/Views":
+		_, _ = rw.Write([]byte(`{"Items": [{"Id": "view", "Name": "Movies"}]}`))
+		return
+	case "/Users/user/Items":
+		_, _ = rw.Write([]byte(s.items))
+		return
+	}
+
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func TestTestScanCommand(t *testing.T) {
+	type Given struct {
+		Token string
+		Items string
+		Path  string
+	}
+
+	type Expected struct {
+		Requests []string
+		Output   string
+		Log      string
+		Err      bool
+	}
+
+	type Test struct {
+		Name     string
+		Given    Given
+		Expected Expected
+	}
+
+	var testCases = []Test{
+		{
+			"Refreshes the matching item",
+			Given{
+				Token: "token",
+				Items: `{"Items": [{"Id": "parasite", "Path": "/data/Movies/Parasite (2019)"}]}`,
+				Path:  "/mnt/unionfs/Media/Movies/Parasite (2019)",
+			},
+			Expected{
+				Requests: []string{"POST /Items/parasite/Refresh"},
+				Output:   "scan sent: precise refresh of item parasite",
+				Log:      "precise refresh",
+			},
+		},
+		{
+			"Falls back to a library scan without a matching item",
+			Given{
+				Token: "token",
+				Items: `{"Items": []}`,
+				Path:  "/mnt/unionfs/Media/Movies/Parasite (2019)",
+			},
+			Expected{
+				Requests: []string{"POST /Library/Media/Updated"},
+				Output:   "scan sent: no matching item, fell back to a library scan",
+				Log:      "falling back to library scan",
+			},
+		},
+		{
+			"Skips folders outside of all libraries",
+			Given{
+				Token: "token",
+				Path:  "/mnt/unionfs/Media/Books/Dune (1965)",
+			},
+			Expected{
+				Output: "scan sent: skipped by the target",
+				Log:    "No target libraries found",
+			},
+		},
+		{
+			"Fails on an invalid token",
+			Given{
+				Token: "invalid",
+				Path:  "/mnt/unionfs/Media/Movies/Parasite (2019)",
+			},
+			Expected{
+				Err: true,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &jellyfinServer{items: tc.Given.Items}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			var logs bytes.Buffer
+			logger := log.Logger
+			log.Logger = zerolog.New(&logs)
+			defer func() {
+				log.Logger = logger
+			}()
+
+			var c config
+			c.Targets.Jellyfin = []jellyfin.Config{{
+				URL:   ts.URL,
+				Token: tc.Given.Token,
+				Rewrite: []autoscan.Rewrite{{
+					From: "^/mnt/unionfs/Media/",
+					To:   "/data/",
+				}},
+				UserID:         "user",
+				PreciseRefresh: true,
+			}}
+
+			var out bytes.Buffer
+			cmd := testScanCmd{Target: "jellyfin", Path: tc.Given.Path}
+			err := cmd.run(c, &out)
+			if (err != nil) != tc.Expected.Err {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if tc.Expected.Err {
+				return
+			}
+
+			if want := fmt.Sprintf("jellyfin: %s: %s\n", ts.URL, tc.Expected.Output); out.String() != want {
+				t.Errorf("Output does not match: %q vs %q", out.String(), want)
+			}
+
+			if !strings.Contains(logs.String(), tc.Expected.Log) {
+				t.Logf("logs: %s", logs.String())
+				t.Errorf("Logs do not contain %q", tc.Expected.Log)
+			}
+
+			if !reflect.DeepEqual(s.requests, tc.Expected.Requests) {
+				t.Logf("want: %v", tc.Expected.Requests)
+				t.Logf("got:  %v", s.requests)
+				t.Errorf("Requests do not match")
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/kri100f86/autoscan"
+	"github.com/kri100f86/autoscan/triggers/a_train"
+	"github.com/kri100f86/autoscan/triggers/inotify"
+	"github.com/kri100f86/autoscan/triggers/lidarr"
+	"github.com/kri100f86/autoscan/triggers/manual"
+	"github.com/kri100f86/autoscan/triggers/radarr"
+	"github.com/kri100f86/autoscan/triggers/rclone"
+	"github.com/kri100f86/autoscan/triggers/readarr"
+	"github.com/kri100f86/autoscan/triggers/sonarr"
+	"github.com/kri100f86/autoscan/triggers/webhook"
+)
+
+// validateCmd checks the config file without starting autoscan.
+type validateCmd struct{}
+
+func (cmd validateCmd) run(path string, w io.Writer) error {
+	b, err := readConfig(path)
+	if err != nil {
+		return err
+	}
+
+	errs := validateConfig(bytes.NewReader(b))
+	for _, err := range errs {
+		fmt.Fprintln(w, err)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("config has %d error(s)", len(errs))
+	}
+
+	fmt.Fprintln(w, "Config is valid")
+	return nil
+}
+
+// validateConfig decodes the config and returns every error found, instead of only the first.
+// Triggers are initialised without being started, targets are not initialised
+// as that requires their media server to be online, only their rewrite rules are checked.
+func validateConfig(r io.Reader) []error {
+	var errs []error
+
+	c := defaultConfig()
+
+	decoder := yaml.NewDecoder(r)
+	decoder.SetStrict(true)
+	if err := decoder.Decode(&c); err != nil {
+		// the decoder continues past type errors, such as unknown fields.
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			return []error{fmt.Errorf("decoding config: %w", err)}
+		}
+
+		for _, msg := range typeErr.Errors {
+			errs = append(errs, errors.New(msg))
+		}
+	}
+
+	errs = append(errs, expandEnv("", reflect.ValueOf(&c))...)
+
+	check := func(name string, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	// triggers
+	_, err := manual.New(c.Triggers.Manual)
+	check("triggers.manual", err)
+
+	_, err = a_train.New(c.Triggers.ATrain)
+	check("triggers.a-train", err)
+
+	for i, t := range c.Triggers.Bernard {
+		name := fmt.Sprintf("triggers.bernard[%d]", i)
+		check(name, validateRules(t.Rewrite, t.Include, t.Exclude))
+
+		for j, d := range t.Drives {
+			check(fmt.Sprintf("%s.drives[%d]", name, j), validateRules(d.Rewrite, d.Include, d.Exclude))
+		}
+	}
+
+	for i, t := range c.Triggers.Inotify {
+		_, err := inotify.New(t)
+		check(fmt.Sprintf("triggers.inotify[%d]", i), err)
+	}
+
+	for i, t := range c.Triggers.Lidarr {
+		_, err := lidarr.New(t)
+		check(fmt.Sprintf("triggers.lidarr[%d]", i), err)
+	}
+
+	for i, t := range c.Triggers.Radarr {
+		_, err := radarr.New(t)
+		check(fmt.Sprintf("triggers.radarr[%d]", i), err)
+	}
+
+	for i, t := range c.Triggers.Rclone {
+		_, err := rclone.New(t)
+		check(fmt.Sprintf("triggers.rclone[%d]", i), err)
+	}
+
+	for i, t := range c.Triggers.Readarr {
+		_, err := readarr.New(t)
+		check(fmt.Sprintf("triggers.readarr[%d]", i), err)
+	}
+
+	for i, t := range c.Triggers.Sonarr {
+		_, err := sonarr.New(t)
+		check(fmt.Sprintf("triggers.sonarr[%d]", i), err)
+	}
+
+	for i, t := range c.Triggers.Webhook {
+		_, err := webhook.New(t)
+		check(fmt.Sprintf("triggers.webhook[%d]", i), err)
+	}
+
+	// targets
+	targets := reflect.ValueOf(c.Targets)
+	for i := 0; i < targets.NumField(); i++ {
+		kind := targets.Type().Field(i).Tag.Get("yaml")
+
+		configs := targets.Field(i)
+		for j := 0; j < configs.Len(); j++ {
+			if source, ok := newRewriteSource(kind, configs.Index(j)); ok {
+				_, err := autoscan.NewRewriter(source.rules)
+				check(fmt.Sprintf("targets.%s[%d]", kind, j), err)
+			}
+		}
+	}
+
+	return errs
+}
+
+func validateRules(rewrite []autoscan.Rewrite, include []string, exclude []string) error {
+	if _, err := autoscan.NewRewriter(rewrite); err != nil {
+		return err
+	}
+
+	_, err := autoscan.NewFilterer(include, exclude)
+	return err
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateConfig(t *testing.T) {
+	type Test struct {
+		Name     string
+		Given    string
+		Expected []string
+	}
+
+	var testCases = []Test{
+		{
+			"Accepts a valid config",
+			`
+port: 3030
+triggers:
+  sonarr:
+    - name: sonarr
+      rewrite:
+        - from: ^/tv/
+          to: /mnt/unionfs/Media/TV/
+targets:
+  plex:
+    - url: http://plex:32400
+      token: secret
+`,
+			nil,
+		},
+		{
+			"Reports every unknown field",
+			`
+prot: 3030
+triggers:
+  sonarr:
+    - name: sonarr
+      priorty: 2
+targets:
+  plex:
+    - url: http://plex:32400
+      tokne: secret
+`,
+			[]string{
+				"field prot not found",
+				"field priorty not found",
+				"field tokne not found",
+			},
+		},
+		{
+			"Reports every invalid trigger and target",
+			`
+triggers:
+  bernard:
+    - account: account.json
+      drives:
+        - id: drive
+          include:
+            - ^/Media/(
+  rclone:
+    - url: http://rclone:5572
+  sonarr:
+    - name: sonarr
+      allowed-cidrs:
+        - 10.0.0.0/33
+  webhook:
+    - name: webhook
+      path: $.path
+      rewrite:
+        - from: ^/data/[
+          to: /mnt/unionfs/
+targets:
+  jellyfin:
+    - url: http://jellyfin:8096
+      token: secret
+      rewrite:
+        - from: ^/mnt/unionfs/(
+          to: /data/
+`,
+			[]string{
+				"triggers.bernard[0].drives[0]: compiling include",
+				"triggers.rclone[0]: remote is required",
+				"triggers.sonarr[0]:",
+				"triggers.webhook[0]: error parsing regexp",
+				"targets.jellyfin[0]: error parsing regexp",
+			},
+		},
+		{
+			"Reports a syntax error",
+			"port: [3030",
+			[]string{"decoding config: yaml:"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			errs := validateConfig(strings.NewReader(tc.Given))
+			if len(errs) != len(tc.Expected) {
+				t.Fatalf("Expected %d errors, got %d: %v", len(tc.Expected), len(errs), errs)
+			}
+
+			for i, err := range errs {
+				if !strings.Contains(err.Error(), tc.Expected[i]) {
+					t.Errorf("Error %d does not match: %q does not contain %q", i, err, tc.Expected[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+)
+
+// buildInfo describes the running build, the release variables are set with -ldflags.
+type buildInfo struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"git_commit"`
+	Timestamp string `json:"timestamp"`
+	GoVersion string `json:"go_version"`
+}
+
+func currentBuild() buildInfo {
+	orUnknown := func(s string) string {
+		if s == "" {
+			return "unknown"
+		}
+
+		return s
+	}
+
+	return buildInfo{
+		Version:   orUnknown(Version),
+		GitCommit: orUnknown(GitCommit),
+		Timestamp: orUnknown(Timestamp),
+		GoVersion: runtime.Version(),
+	}
+}
+
+func (b buildInfo) String() string {
+	return fmt.Sprintf("%s (%s@%s)", b.Version, b.GitCommit, b.Timestamp)
+}
+
+// versionCmd prints the build information as JSON.
+type versionCmd struct{}
+
+func (cmd versionCmd) run(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(currentBuild())
+}
+
+func versionHandler(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(rw).Encode(currentBuild())
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+)
+
+func TestVersionHandler(t *testing.T) {
+	type Test struct {
+		Name     string
+		Version  string
+		Commit   string
+		Expected buildInfo
+	}
+
+	var testCases = []Test{
+		{
+			Name:    "Returns the injected build information",
+			Version: "1.4.0",
+			Commit:  "e3edbd3",
+			Expected: buildInfo{
+				Version:   "1.4.0",
+				GitCommit: "e3edbd3",
+				Timestamp: "unknown",
+				GoVersion: runtime.Version(),
+			},
+		},
+		{
+			Name: "Falls back to unknown",
+			Expected: buildInfo{
+				Version:   "unknown",
+				GitCommit: "unknown",
+				Timestamp: "unknown",
+				GoVersion: runtime.Version(),
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			Version, GitCommit = tc.Version, tc.Commit
+			defer func() {
+				Version, GitCommit = "", ""
+			}()
+
+			rec := httptest.NewRecorder()
+			versionHandler(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+			var got buildInfo
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatalf("Could not decode the response: %v", err)
+			}
+
+			if got != tc.Expected {
+				t.Errorf("Build information does not match: %+v vs %+v", got, tc.Expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package autoscan
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// A DryRunner is a Target which can describe how it would handle a Scan,
+// without changing anything on the media server.
+type DryRunner interface {
+	DryRun(context.Context, Scan) error
+}
+
+// A LibraryDryRunner is a LibraryRefresher which can describe how it would refresh a library,
+// without changing anything on the media server.
+type LibraryDryRunner interface {
+	DryRunLibrary(ctx context.Context, name string) ([]string, error)
+}
+
+// DryRun wraps the Target so scans and library refreshes are logged instead of sent.
+// Targets implementing DryRunner or LibraryDryRunner describe them themselves.
+func DryRun(t Target) Target {
+	return dryRunTarget{Target: t}
+}
+
+type dryRunTarget struct {
+	Target
+}
+
+func (t dryRunTarget) String() string {
+	return fmt.Sprint(t.Target)
+}
+
+func (t dryRunTarget) Inspect(scan Scan) (Inspection, bool) {
+	if i, ok := t.Target.(ScanInspector); ok {
+		return i.Inspect(scan)
+	}
+
+	return Inspection{}, false
+}
+
+// ScanTimeout, SettleDelay and RetryPolicy are those of the Target, so the processor times and retries
+// the scans of a dry run like those of a real run. Zero values leave the processor's settings in place.
+func (t dryRunTarget) ScanTimeout() time.Duration {
+	if s, ok := t.Target.(ScanTimeouter); ok {
+		return s.ScanTimeout()
+	}
+
+	return 0
+}
+
+func (t dryRunTarget) SettleDelay() time.Duration {
+	if s, ok := t.Target.(SettleDelayer); ok {
+		return s.SettleDelay()
+	}
+
+	return 0
+}
+
+func (t dryRunTarget) RetryPolicy() RetryPolicy {
+	if r, ok := t.Target.(RetryPolicer); ok {
+		return r.RetryPolicy()
+	}
+
+	return RetryPolicy{}
+}
+
+func (t dryRunTarget) Scan(ctx context.Context, scan Scan) error {
+	if d, ok := t.Target.(DryRunner); ok {
+		return d.DryRun(ctx, scan)
+	}
+
+	log.Info().
+		Str("target", t.String()).
+		Str("id", scan.ID).
+		Str("path", scan.Folder).
+		Bool("removed", scan.Removed).
+		Msg("Dry run, scan not sent to target")
+
+	return nil
+}
+
+// RefreshLibrary logs the refresh instead of sending it.
+// Targets which cannot refresh their libraries return ErrUnknownLibrary, as without the dry run.
+func (t dryRunTarget) RefreshLibrary(ctx context.Context, name string) ([]string, error) {
+	if d, ok := t.Target.(LibraryDryRunner); ok {
+		return d.DryRunLibrary(ctx, name)
+	}
+
+	if _, ok := t.Target.(LibraryRefresher); !ok {
+		return nil, fmt.Errorf("%s: target does not refresh libraries: %w", name, ErrUnknownLibrary)
+	}
+
+	log.Info().
+		Str("target", t.String()).
+		Str("library", name).
+		Msg("Dry run, library refresh not sent to target")
+
+	return []string{}, nil
+}
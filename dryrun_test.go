@@ -0,0 +1,97 @@
+package autoscan
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type recordingTarget struct {
+	scans   []Scan
+	dryRuns []Scan
+}
+
+func (t *recordingTarget) Scan(_ context.Context, scan Scan) error {
+	t.scans = append(t.scans, scan)
+	return nil
+}
+
+func (t *recordingTarget) Available() error {
+	return nil
+}
+
+type dryRunningTarget struct {
+	recordingTarget
+}
+
+func (t *dryRunningTarget) DryRun(_ context.Context, scan Scan) error {
+	t.dryRuns = append(t.dryRuns, scan)
+	return nil
+}
+
+func TestDryRun(t *testing.T) {
+	scan := Scan{Folder: "/mnt/unionfs/Media/Movies/Parasite (2019)"}
+
+	plain := &recordingTarget{}
+	if err := DryRun(plain).Scan(context.Background(), scan); err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+
+	if len(plain.scans) > 0 {
+		t.Errorf("Scans were sent in dry run: %v", plain.scans)
+	}
+
+	described := &dryRunningTarget{}
+	if err := DryRun(described).Scan(context.Background(), scan); err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+
+	if len(described.scans) > 0 {
+		t.Errorf("Scans were sent in dry run: %v", described.scans)
+	}
+
+	if len(described.dryRuns) != 1 {
+		t.Errorf("Target did not describe the scan: %v", described.dryRuns)
+	}
+}
+
+// timedTarget has timing and retry settings of its own.
+type timedTarget struct {
+	recordingTarget
+}
+
+func (t *timedTarget) ScanTimeout() time.Duration {
+	return 5 * time.Minute
+}
+
+func (t *timedTarget) SettleDelay() time.Duration {
+	return 2 * time.Minute
+}
+
+func (t *timedTarget) RetryPolicy() RetryPolicy {
+	return RetryPolicy{MaxRetries: 3, Backoff: time.Minute, MaxBackoff: time.Hour}
+}
+
+func TestDryRunSettings(t *testing.T) {
+	timed := DryRun(&timedTarget{})
+
+	if got := timed.(ScanTimeouter).ScanTimeout(); got != 5*time.Minute {
+		t.Errorf("Scan timeouts do not match: %v vs %v", got, 5*time.Minute)
+	}
+
+	if got := timed.(SettleDelayer).SettleDelay(); got != 2*time.Minute {
+		t.Errorf("Settle delays do not match: %v vs %v", got, 2*time.Minute)
+	}
+
+	want := RetryPolicy{MaxRetries: 3, Backoff: time.Minute, MaxBackoff: time.Hour}
+	if got := timed.(RetryPolicer).RetryPolicy(); got != want {
+		t.Errorf("Retry policies do not match: %v vs %v", got, want)
+	}
+
+	// without settings of its own, the target keeps those of the processor.
+	plain := DryRun(&recordingTarget{})
+	if plain.(ScanTimeouter).ScanTimeout() != 0 || plain.(SettleDelayer).SettleDelay() != 0 ||
+		plain.(RetryPolicer).RetryPolicy() != (RetryPolicy{}) {
+		t.Errorf("Plain targets should have no settings of their own")
+	}
+}
@@ -1,6 +1,11 @@
 package autoscan
 
 import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/natefinch/lumberjack"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
@@ -17,3 +22,43 @@ func GetLogger(verbosity string) zerolog.Logger {
 
 	return log.Level(level)
 }
+
+// LogConfig defines the sinks log output is written to.
+//
+// The log file is rotated once it reaches MaxSize megabytes.
+// MaxBackups and MaxAge (in days) control how many rotated files are retained.
+type LogConfig struct {
+	File       string `yaml:"file"`
+	MaxSize    int    `yaml:"max-size"`
+	MaxBackups int    `yaml:"max-backups"`
+	MaxAge     int    `yaml:"max-age"`
+	Console    bool   `yaml:"console"`
+}
+
+// NewLogWriter creates a writer which mirrors log output to the console and
+// to a rotating log file, depending on the given config.
+func NewLogWriter(c LogConfig) io.Writer {
+	writers := make([]io.Writer, 0)
+
+	if c.Console {
+		writers = append(writers, zerolog.ConsoleWriter{
+			TimeFormat: time.Stamp,
+			Out:        os.Stderr,
+		})
+	}
+
+	if c.File != "" {
+		writers = append(writers, zerolog.ConsoleWriter{
+			TimeFormat: time.Stamp,
+			Out: &lumberjack.Logger{
+				Filename:   c.File,
+				MaxSize:    c.MaxSize,
+				MaxAge:     c.MaxAge,
+				MaxBackups: c.MaxBackups,
+			},
+			NoColor: true,
+		})
+	}
+
+	return io.MultiWriter(writers...)
+}
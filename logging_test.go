@@ -0,0 +1,51 @@
+package autoscan
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestLogWriterRotation(t *testing.T) {
+	dir := t.TempDir()
+
+	w := NewLogWriter(LogConfig{
+		File:       filepath.Join(dir, "activity.log"),
+		MaxSize:    1,
+		MaxBackups: 5,
+	})
+
+	logger := zerolog.New(w).Level(zerolog.InfoLevel)
+
+	// write a little over 1 megabyte of log lines
+	line := strings.Repeat("a", 1024)
+	for i := 0; i < 1100; i++ {
+		logger.Info().Msg(line)
+	}
+
+	// debug lines must not reach the file sink
+	logger.Debug().Msg("should be skipped")
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) < 2 {
+		t.Errorf("Log file was not rotated: %d files", len(files))
+	}
+
+	for _, f := range files {
+		b, err := os.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.Contains(string(b), "should be skipped") {
+			t.Errorf("Debug line written to %s", f.Name())
+		}
+	}
+}
@@ -0,0 +1,138 @@
+// Package metrics provides counters which are exposed in the Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A Registry holds the metrics exposed by its Handler.
+type Registry struct {
+	lock     sync.Mutex
+	counters []*CounterVec
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Default is the registry used by autoscan.
+var Default = NewRegistry()
+
+// A CounterVec is a counter partitioned by its labels.
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	lock   sync.Mutex
+	values map[string]*sample
+}
+
+type sample struct {
+	labels []string
+	value  uint64
+}
+
+// NewCounterVec registers a counter with the given label names.
+func (r *Registry) NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: make(map[string]*sample),
+	}
+
+	r.lock.Lock()
+	r.counters = append(r.counters, c)
+	r.lock.Unlock()
+
+	return c
+}
+
+// Inc increments the counter of the given label values by one.
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add increments the counter of the given label values.
+func (c *CounterVec) Add(n uint64, values ...string) {
+	if len(values) != len(c.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", c.name, len(c.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	s, ok := c.values[key]
+	if !ok {
+		s = &sample{labels: append([]string{}, values...)}
+		c.values[key] = s
+	}
+
+	s.value += n
+}
+
+// Value returns the counter of the given label values.
+func (c *CounterVec) Value(values ...string) uint64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if s, ok := c.values[strings.Join(values, "\xff")]; ok {
+		return s.value
+	}
+
+	return 0
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (c *CounterVec) write(w io.Writer) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", c.name, c.help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", c.name)
+
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := c.values[key]
+
+		pairs := make([]string, len(c.labels))
+		for i, label := range c.labels {
+			pairs[i] = fmt.Sprintf(`%s="%s"`, label, escaper.Replace(s.labels[i]))
+		}
+
+		if len(pairs) == 0 {
+			fmt.Fprintf(w, "%s %d\n", c.name, s.value)
+			continue
+		}
+
+		fmt.Fprintf(w, "%s{%s} %d\n", c.name, strings.Join(pairs, ","), s.value)
+	}
+}
+
+// Handler exposes the metrics of the registry in the Prometheus text format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		rw.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+		r.lock.Lock()
+		defer r.lock.Unlock()
+
+		for _, c := range r.counters {
+			c.write(rw)
+		}
+	})
+}
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+
+	events := r.NewCounterVec("autoscan_test_events_total", "Events received.", "trigger", "reason")
+	events.Inc("sonarr", "invalid")
+	events.Inc("sonarr", "invalid")
+	events.Add(3, `my "radarr"`, "filtered")
+
+	total := r.NewCounterVec("autoscan_test_total", "Total.")
+	total.Inc()
+
+	if v := events.Value("sonarr", "invalid"); v != 2 {
+		t.Errorf("Values do not match: %d vs %d", v, 2)
+	}
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	want := `# HELP autoscan_test_events_total Events received.
+# TYPE autoscan_test_events_total counter
+autoscan_test_events_total{trigger="my \"radarr\"",reason="filtered"} 3
+autoscan_test_events_total{trigger="sonarr",reason="invalid"} 2
+# HELP autoscan_test_total Total.
+# TYPE autoscan_test_total counter
+autoscan_test_total 1
+`
+
+	if got := rec.Body.String(); got != want {
+		t.Logf("want: %s", want)
+		t.Logf("got:  %s", got)
+		t.Errorf("Exposition does not match")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"embed"
 	"errors"
 	"fmt"
+	"sync"
 
 	"github.com/oriser/regroup"
 	"modernc.org/sqlite"
@@ -15,6 +16,9 @@ type Migrator struct {
 	dir string
 
 	re *regroup.ReGroup
+
+	// serialises migrations of targets initialised concurrently
+	lock sync.Mutex
 }
 
 /* Credits to https://github.com/Boostport/migration */
@@ -47,6 +51,9 @@ func New(db *sql.DB, dir string) (*Migrator, error) {
 }
 
 func (m *Migrator) Migrate(fs *embed.FS, component string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
 	// parse migrations
 	migrations, err := m.parse(fs)
 	if err != nil {
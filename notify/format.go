@@ -0,0 +1,163 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	FormatWebhook = "webhook"
+	FormatDiscord = "discord"
+	FormatSlack   = "slack"
+)
+
+// format translates the notification into the payload of the given provider.
+// Unknown formats fall back to the generic webhook payload.
+func format(provider string, notification Notification) interface{} {
+	switch strings.ToLower(provider) {
+	case FormatDiscord:
+		return discordPayload(notification)
+	case FormatSlack:
+		return slackPayload(notification)
+	default:
+		return notification
+	}
+}
+
+func title(notification Notification) string {
+	switch notification.Event {
+	case EventRecovered:
+		return "Target recovered"
+	case EventScanSucceeded:
+		return "Scan succeeded"
+	case EventScanFailed:
+		return "Scan failed"
+	}
+
+	return "Target failing"
+}
+
+func description(notification Notification) string {
+	switch notification.Event {
+	case EventRecovered:
+		return fmt.Sprintf("Scans to %s succeed again after %d failures.", notification.Target, notification.Failures)
+	case EventScanSucceeded:
+		return fmt.Sprintf("Scan of %s was sent to %s.", notification.Folder, notification.Target)
+	case EventScanFailed:
+		return fmt.Sprintf("Scan of %s to %s failed.", notification.Folder, notification.Target)
+	}
+
+	return fmt.Sprintf("Scans to %s failed %d times.", notification.Target, notification.Failures)
+}
+
+// succeeded reports whether the notification is good news.
+func succeeded(notification Notification) bool {
+	return notification.Event == EventRecovered || notification.Event == EventScanSucceeded
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields"`
+	Timestamp   string         `json:"timestamp"`
+}
+
+type discordMessage struct {
+	Username string         `json:"username"`
+	Embeds   []discordEmbed `json:"embeds"`
+}
+
+func discordPayload(notification Notification) discordMessage {
+	color := 0xE74C3C // red
+	if succeeded(notification) {
+		color = 0x2ECC71 // green
+	}
+
+	fields := []discordField{
+		{Name: "Target", Value: notification.Target, Inline: true},
+		{Name: "Failures", Value: fmt.Sprint(notification.Failures), Inline: true},
+	}
+
+	if notification.Folder != "" {
+		fields = []discordField{
+			{Name: "Target", Value: notification.Target, Inline: true},
+			{Name: "Folder", Value: notification.Folder, Inline: true},
+		}
+	}
+
+	if notification.Error != "" {
+		fields = append(fields, discordField{Name: "Error", Value: notification.Error})
+	}
+
+	return discordMessage{
+		Username: "Autoscan",
+		Embeds: []discordEmbed{{
+			Title:       title(notification),
+			Description: description(notification),
+			Color:       color,
+			Fields:      fields,
+			Timestamp:   notification.Time.Format(time.RFC3339),
+		}},
+	}
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short,omitempty"`
+}
+
+type slackAttachment struct {
+	Fallback string       `json:"fallback"`
+	Color    string       `json:"color"`
+	Title    string       `json:"title"`
+	Text     string       `json:"text"`
+	Fields   []slackField `json:"fields"`
+	Ts       int64        `json:"ts"`
+}
+
+type slackMessage struct {
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+func slackPayload(notification Notification) slackMessage {
+	color := "danger"
+	if succeeded(notification) {
+		color = "good"
+	}
+
+	fields := []slackField{
+		{Title: "Target", Value: notification.Target, Short: true},
+		{Title: "Failures", Value: fmt.Sprint(notification.Failures), Short: true},
+	}
+
+	if notification.Folder != "" {
+		fields = []slackField{
+			{Title: "Target", Value: notification.Target, Short: true},
+			{Title: "Folder", Value: notification.Folder, Short: true},
+		}
+	}
+
+	if notification.Error != "" {
+		fields = append(fields, slackField{Title: "Error", Value: notification.Error})
+	}
+
+	return slackMessage{
+		Attachments: []slackAttachment{{
+			Fallback: description(notification),
+			Color:    color,
+			Title:    title(notification),
+			Text:     description(notification),
+			Fields:   fields,
+			Ts:       notification.Time.Unix(),
+		}},
+	}
+}
@@ -0,0 +1,120 @@
+package notify
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	type Test struct {
+		Name         string
+		Format       string
+		Notification Notification
+		Want         string
+	}
+
+	testTime := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	failing := Notification{
+		Event:    EventFailing,
+		Target:   "plex: http://plex:32400",
+		Error:    "503 Service Unavailable",
+		Failures: 3,
+		Time:     testTime,
+	}
+
+	recovered := Notification{
+		Event:    EventRecovered,
+		Target:   "plex: http://plex:32400",
+		Failures: 4,
+		Time:     testTime,
+	}
+
+	var testCases = []Test{
+		{
+			Name:         "Generic webhook",
+			Format:       FormatWebhook,
+			Notification: failing,
+			Want: `{
+				"event": "failing",
+				"target": "plex: http://plex:32400",
+				"error": "503 Service Unavailable",
+				"failures": 3,
+				"time": "2020-06-01T12:00:00Z"
+			}`,
+		},
+		{
+			Name:         "Unknown format falls back to the generic webhook",
+			Format:       "teams",
+			Notification: recovered,
+			Want: `{
+				"event": "recovered",
+				"target": "plex: http://plex:32400",
+				"failures": 4,
+				"time": "2020-06-01T12:00:00Z"
+			}`,
+		},
+		{
+			Name:         "Discord embed",
+			Format:       FormatDiscord,
+			Notification: failing,
+			Want: `{
+				"username": "Autoscan",
+				"embeds": [{
+					"title": "Target failing",
+					"description": "Scans to plex: http://plex:32400 failed 3 times.",
+					"color": 15158332,
+					"fields": [
+						{"name": "Target", "value": "plex: http://plex:32400", "inline": true},
+						{"name": "Failures", "value": "3", "inline": true},
+						{"name": "Error", "value": "503 Service Unavailable"}
+					],
+					"timestamp": "2020-06-01T12:00:00Z"
+				}]
+			}`,
+		},
+		{
+			Name:         "Slack attachment",
+			Format:       FormatSlack,
+			Notification: recovered,
+			Want: `{
+				"attachments": [{
+					"fallback": "Scans to plex: http://plex:32400 succeed again after 4 failures.",
+					"color": "good",
+					"title": "Target recovered",
+					"text": "Scans to plex: http://plex:32400 succeed again after 4 failures.",
+					"fields": [
+						{"title": "Target", "value": "plex: http://plex:32400", "short": true},
+						{"title": "Failures", "value": "4", "short": true}
+					],
+					"ts": 1591012800
+				}]
+			}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			b, err := json.Marshal(format(tc.Format, tc.Notification))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got, want interface{}
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := json.Unmarshal([]byte(tc.Want), &want); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Log(string(b))
+				t.Errorf("Payloads do not match")
+			}
+		})
+	}
+}
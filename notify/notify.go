@@ -0,0 +1,224 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/cloudbox/autoscan"
+)
+
+type Config struct {
+	URL       string        `yaml:"url"`
+	Format    string        `yaml:"format"`
+	Threshold int           `yaml:"threshold"`
+	Window    time.Duration `yaml:"window"`
+	Outcomes  bool          `yaml:"outcomes"`
+}
+
+const (
+	EventFailing   = "failing"
+	EventRecovered = "recovered"
+
+	// Events of single scans, only sent when outcomes are enabled.
+	EventScanSucceeded = "scan-succeeded"
+	EventScanFailed    = "scan-failed"
+)
+
+// A Notification is sent as JSON to the configured URL.
+type Notification struct {
+	Event    string    `json:"event"`
+	Target   string    `json:"target"`
+	Error    string    `json:"error,omitempty"`
+	Failures int       `json:"failures"`
+	Time     time.Time `json:"time"`
+
+	// Set for the events of single scans.
+	Folder  string `json:"folder,omitempty"`
+	Refresh string `json:"refresh,omitempty"`
+	ItemID  string `json:"item_id,omitempty"`
+}
+
+// A Notifier keeps track of scan failures per target and sends a notification
+// when a target crosses the failure threshold within the window,
+// and again when the target recovers.
+//
+// Notifications are sent in the background and never block the caller.
+type Notifier struct {
+	url       string
+	format    string
+	threshold int
+	window    time.Duration
+	outcomes  bool
+	client    *http.Client
+
+	lock    sync.Mutex
+	targets map[string]*state
+	queue   chan Notification
+}
+
+type state struct {
+	failures []time.Time
+	failing  bool
+}
+
+// New returns nil when no URL is configured, all methods of a nil Notifier are no-ops.
+func New(c Config) *Notifier {
+	if c.URL == "" {
+		return nil
+	}
+
+	n := &Notifier{
+		url:       c.URL,
+		format:    c.Format,
+		threshold: c.Threshold,
+		window:    c.Window,
+		outcomes:  c.Outcomes,
+		client:    &http.Client{Timeout: 30 * time.Second},
+		targets:   make(map[string]*state),
+		queue:     make(chan Notification, 100),
+	}
+
+	if n.threshold <= 0 {
+		n.threshold = 3
+	}
+
+	if n.window <= 0 {
+		n.window = 10 * time.Minute
+	}
+
+	go n.worker()
+	return n
+}
+
+// Report registers the outcome of a scan sent to the target.
+// A nil error marks a successful scan.
+func (n *Notifier) Report(target string, err error) {
+	if n == nil {
+		return
+	}
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	st, ok := n.targets[target]
+	if !ok {
+		st = new(state)
+		n.targets[target] = st
+	}
+
+	current := now()
+
+	// scan succeeded
+	if err == nil {
+		if st.failing {
+			n.send(Notification{
+				Event:    EventRecovered,
+				Target:   target,
+				Failures: len(st.failures),
+				Time:     current,
+			})
+		}
+
+		st.failures = st.failures[:0]
+		st.failing = false
+		return
+	}
+
+	// drop failures outside of the window
+	failures := st.failures[:0]
+	for _, t := range st.failures {
+		if current.Sub(t) < n.window {
+			failures = append(failures, t)
+		}
+	}
+
+	st.failures = append(failures, current)
+
+	if !st.failing && len(st.failures) >= n.threshold {
+		st.failing = true
+		n.send(Notification{
+			Event:    EventFailing,
+			Target:   target,
+			Error:    err.Error(),
+			Failures: len(st.failures),
+			Time:     current,
+		})
+	}
+}
+
+// Outcome sends a notification for every scan which succeeded or failed, when outcomes are enabled.
+func (n *Notifier) Outcome(o autoscan.Outcome) {
+	if n == nil || !n.outcomes {
+		return
+	}
+
+	notification := Notification{
+		Target:  o.Target,
+		Time:    now(),
+		Folder:  o.Scan.Folder,
+		Refresh: o.Refresh,
+		ItemID:  o.ItemID,
+	}
+
+	switch o.Stage {
+	case autoscan.OutcomeSucceeded:
+		notification.Event = EventScanSucceeded
+	case autoscan.OutcomeFailed:
+		notification.Event = EventScanFailed
+		notification.Error = o.Err.Error()
+	default:
+		return
+	}
+
+	n.send(notification)
+}
+
+func (n *Notifier) send(notification Notification) {
+	select {
+	case n.queue <- notification:
+	default:
+		log.Warn().
+			Str("target", notification.Target).
+			Str("event", notification.Event).
+			Msg("Notification queue is full, dropping notification")
+	}
+}
+
+func (n *Notifier) worker() {
+	for notification := range n.queue {
+		if err := n.post(notification); err != nil {
+			log.Error().
+				Err(err).
+				Str("target", notification.Target).
+				Str("event", notification.Event).
+				Msg("Failed sending notification")
+		}
+	}
+}
+
+func (n *Notifier) post(notification Notification) error {
+	b, err := json.Marshal(format(n.format, notification))
+	if err != nil {
+		return fmt.Errorf("encoding notification: %w", err)
+	}
+
+	res, err := n.client.Post(n.url, "application/json", bytes.NewBuffer(b))
+	if err != nil {
+		return fmt.Errorf("sending notification: %w", err)
+	}
+
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("sending notification: %s", res.Status)
+	}
+
+	return nil
+}
+
+var now = time.Now
@@ -0,0 +1,198 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cloudbox/autoscan"
+)
+
+func TestNotifier(t *testing.T) {
+	type Report struct {
+		Offset time.Duration
+		Err    error
+	}
+
+	type Test struct {
+		Name    string
+		Reports []Report
+		Want    []Notification
+	}
+
+	testTime := time.Now().UTC()
+	scanErr := errors.New("503 Service Unavailable")
+
+	var testCases = []Test{
+		{
+			Name: "Notifies once the threshold is crossed and on recovery",
+			Reports: []Report{
+				{Offset: 0, Err: scanErr},
+				{Offset: time.Minute, Err: scanErr},
+				{Offset: 2 * time.Minute, Err: scanErr},
+				{Offset: 3 * time.Minute, Err: scanErr},
+				{Offset: 4 * time.Minute},
+			},
+			Want: []Notification{
+				{Event: EventFailing, Target: "plex", Error: scanErr.Error(), Failures: 3, Time: testTime.Add(2 * time.Minute)},
+				{Event: EventRecovered, Target: "plex", Failures: 4, Time: testTime.Add(4 * time.Minute)},
+			},
+		},
+		{
+			Name: "Ignores failures outside of the window",
+			Reports: []Report{
+				{Offset: 0, Err: scanErr},
+				{Offset: 6 * time.Minute, Err: scanErr},
+				{Offset: 12 * time.Minute, Err: scanErr},
+				{Offset: 18 * time.Minute},
+			},
+		},
+		{
+			Name: "Successful scans reset the failure count",
+			Reports: []Report{
+				{Offset: 0, Err: scanErr},
+				{Offset: time.Minute, Err: scanErr},
+				{Offset: 2 * time.Minute},
+				{Offset: 3 * time.Minute, Err: scanErr},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			received := make(chan Notification, 10)
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				notification := Notification{}
+				if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
+					t.Errorf("Failed decoding notification: %v", err)
+				}
+
+				received <- notification
+			}))
+			defer server.Close()
+
+			n := New(Config{
+				URL:       server.URL,
+				Threshold: 3,
+				Window:    10 * time.Minute,
+			})
+
+			for _, report := range tc.Reports {
+				report := report
+				now = func() time.Time {
+					return testTime.Add(report.Offset)
+				}
+
+				n.Report("plex", report.Err)
+			}
+
+			var notifications []Notification
+			for range tc.Want {
+				select {
+				case notification := <-received:
+					notifications = append(notifications, notification)
+				case <-time.After(time.Second):
+					t.Fatal("Timed out waiting for notification")
+				}
+			}
+
+			// no further notifications
+			select {
+			case notification := <-received:
+				t.Errorf("Unexpected notification: %v", notification)
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			for i := range notifications {
+				if !notifications[i].Time.Equal(tc.Want[i].Time) {
+					t.Errorf("Times do not match: %v vs %v", notifications[i].Time, tc.Want[i].Time)
+				}
+
+				notifications[i].Time = tc.Want[i].Time
+			}
+
+			if !reflect.DeepEqual(notifications, tc.Want) {
+				t.Log(notifications)
+				t.Log(tc.Want)
+				t.Errorf("Notifications do not match")
+			}
+		})
+	}
+}
+
+func TestOutcomes(t *testing.T) {
+	received := make(chan Notification, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		notification := Notification{}
+		if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
+			t.Errorf("Failed decoding notification: %v", err)
+		}
+
+		received <- notification
+	}))
+	defer server.Close()
+
+	testTime := time.Now().UTC()
+	now = func() time.Time {
+		return testTime
+	}
+
+	scan := autoscan.Scan{Folder: "/data/Movies/Parasite (2019)"}
+	outcomes := []autoscan.Outcome{
+		{Stage: autoscan.OutcomeEnqueued, Scan: scan},
+		{Stage: autoscan.OutcomeDispatched, Scan: scan, Target: "jellyfin"},
+		{Stage: autoscan.OutcomeSucceeded, Scan: scan, Target: "jellyfin", Refresh: autoscan.RefreshPrecise, ItemID: "parasite"},
+		{Stage: autoscan.OutcomeFailed, Scan: scan, Target: "plex", Err: errors.New("503 Service Unavailable")},
+	}
+
+	// outcomes are not sent unless enabled
+	n := New(Config{URL: server.URL})
+	for _, o := range outcomes {
+		n.Outcome(o)
+	}
+
+	select {
+	case notification := <-received:
+		t.Errorf("Unexpected notification: %v", notification)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	n = New(Config{URL: server.URL, Outcomes: true})
+	for _, o := range outcomes {
+		n.Outcome(o)
+	}
+
+	want := []Notification{
+		{Event: EventScanSucceeded, Target: "jellyfin", Folder: scan.Folder, Refresh: autoscan.RefreshPrecise, ItemID: "parasite", Time: testTime},
+		{Event: EventScanFailed, Target: "plex", Folder: scan.Folder, Error: "503 Service Unavailable", Time: testTime},
+	}
+
+	var notifications []Notification
+	for i := range want {
+		select {
+		case notification := <-received:
+			notification.Time = want[i].Time
+			notifications = append(notifications, notification)
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for notification")
+		}
+	}
+
+	if !reflect.DeepEqual(notifications, want) {
+		t.Errorf("Notifications do not match: %v vs %v", notifications, want)
+	}
+}
+
+func TestNilNotifier(t *testing.T) {
+	n := New(Config{})
+	if n != nil {
+		t.Fatal("Notifier created without URL")
+	}
+
+	// must not panic
+	n.Report("plex", errors.New("failed"))
+}
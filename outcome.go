@@ -0,0 +1,80 @@
+package autoscan
+
+import (
+	"context"
+	"sync"
+)
+
+// Stages within the lifecycle of a Scan, see Outcome.
+const (
+	OutcomeEnqueued   = "enqueued"
+	OutcomeDispatched = "dispatched"
+	OutcomeSucceeded  = "succeeded"
+	OutcomeFailed     = "failed"
+)
+
+// How a Target handled a Scan, see ReportRefresh.
+const (
+	RefreshPrecise  = "precise"
+	RefreshFallback = "fallback"
+	RefreshLibrary  = "library"
+	RefreshRemoval  = "removal"
+	RefreshSkipped  = "skipped"
+)
+
+// An Outcome is an event within the lifecycle of a Scan.
+//
+// Target is empty when the Scan was enqueued.
+// Refresh and ItemID are only set when the Scan succeeded or failed,
+// and the Target reported how it handled the Scan.
+type Outcome struct {
+	Stage   string
+	Scan    Scan
+	Target  string
+	Refresh string
+	ItemID  string
+	Err     error
+}
+
+// An OutcomeHook receives the outcomes of all scans, for example to publish them.
+// The Processor invokes the hooks synchronously, so hooks should return quickly.
+type OutcomeHook interface {
+	Outcome(Outcome)
+}
+
+type refreshKey struct{}
+
+type refreshReport struct {
+	lock    sync.Mutex
+	refresh string
+	itemID  string
+}
+
+// WithRefreshReport returns a context on which a Target can report how it handled a Scan,
+// and a function returning the last report.
+func WithRefreshReport(ctx context.Context) (context.Context, func() (refresh string, itemID string)) {
+	r := new(refreshReport)
+	report := func() (string, string) {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+
+		return r.refresh, r.itemID
+	}
+
+	return context.WithValue(ctx, refreshKey{}, r), report
+}
+
+// ReportRefresh reports how the Target handled the Scan of the context, such as RefreshPrecise.
+// Contexts without a report are ignored.
+func ReportRefresh(ctx context.Context, refresh string, itemID string) {
+	r, ok := ctx.Value(refreshKey{}).(*refreshReport)
+	if !ok {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.refresh = refresh
+	r.itemID = itemID
+}
@@ -0,0 +1,82 @@
+package autoscan
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// ActiveFunc returns whether media is being played from a Target.
+type ActiveFunc func(context.Context) (bool, error)
+
+// A PlaybackGuard defers the scans of a Target while media is being played,
+// scanning during playback can cause buffering on some setups.
+type PlaybackGuard struct {
+	active   ActiveFunc
+	maxDefer time.Duration
+	log      zerolog.Logger
+
+	lock  sync.Mutex
+	since time.Time
+}
+
+// DefaultMaxDefer is the longest time scans are deferred by default.
+const DefaultMaxDefer = 30 * time.Minute
+
+// NewPlaybackGuard creates a PlaybackGuard which defers scans for at most maxDefer.
+func NewPlaybackGuard(active ActiveFunc, maxDefer time.Duration, log zerolog.Logger) *PlaybackGuard {
+	if maxDefer <= 0 {
+		maxDefer = DefaultMaxDefer
+	}
+
+	return &PlaybackGuard{
+		active:   active,
+		maxDefer: maxDefer,
+		log:      log,
+	}
+}
+
+// Check returns ErrTargetNotReady while media is being played,
+// unless scans have already been deferred for longer than the maximum.
+// Scans are not deferred when the playback state cannot be determined.
+// A nil PlaybackGuard never defers scans.
+func (g *PlaybackGuard) Check(ctx context.Context) error {
+	if g == nil {
+		return nil
+	}
+
+	active, err := g.active(ctx)
+	if err != nil {
+		g.log.Warn().
+			Err(err).
+			Msg("Failed determining playback state, not deferring scan")
+		return nil
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if !active {
+		g.since = time.Time{}
+		return nil
+	}
+
+	if g.since.IsZero() {
+		g.since = now()
+	}
+
+	deferred := now().Sub(g.since)
+	if deferred >= g.maxDefer {
+		g.log.Debug().
+			Dur("deferred", deferred).
+			Msg("Playback is active, but scans were deferred for too long")
+		return nil
+	}
+
+	return fmt.Errorf("playback is active: %w", ErrTargetNotReady)
+}
+
+var now = time.Now
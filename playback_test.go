@@ -0,0 +1,84 @@
+package autoscan
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPlaybackGuard(t *testing.T) {
+	type Step struct {
+		After   time.Duration
+		Active  bool
+		Err     error
+		WantErr error
+	}
+
+	type Test struct {
+		Name  string
+		Steps []Step
+	}
+
+	var testCases = []Test{
+		{
+			Name: "Defers scans while playback is active",
+			Steps: []Step{
+				{Active: true, WantErr: ErrTargetNotReady},
+				{After: time.Minute, Active: true, WantErr: ErrTargetNotReady},
+				{After: time.Minute, Active: false},
+			},
+		},
+		{
+			Name: "Stops deferring after the maximum",
+			Steps: []Step{
+				{Active: true, WantErr: ErrTargetNotReady},
+				{After: 9 * time.Minute, Active: true, WantErr: ErrTargetNotReady},
+				{After: time.Minute, Active: true},
+			},
+		},
+		{
+			Name: "Restarts the maximum once playback stops",
+			Steps: []Step{
+				{Active: true, WantErr: ErrTargetNotReady},
+				{After: 9 * time.Minute, Active: false},
+				{After: 9 * time.Minute, Active: true, WantErr: ErrTargetNotReady},
+			},
+		},
+		{
+			Name: "Does not defer scans when the playback state is unknown",
+			Steps: []Step{
+				{Err: errors.New("connection refused")},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			current := time.Now()
+			now = func() time.Time {
+				return current
+			}
+
+			var step Step
+			guard := NewPlaybackGuard(func(context.Context) (bool, error) {
+				return step.Active, step.Err
+			}, 10*time.Minute, GetLogger(""))
+
+			for i, s := range tc.Steps {
+				step = s
+				current = current.Add(s.After)
+
+				err := guard.Check(context.Background())
+				if !errors.Is(err, s.WantErr) {
+					t.Errorf("Step %d: errors do not match: %v vs %v", i, err, s.WantErr)
+				}
+			}
+		})
+	}
+
+	var guard *PlaybackGuard
+	if err := guard.Check(context.Background()); err != nil {
+		t.Errorf("Nil guard defers scans: %v", err)
+	}
+}
@@ -0,0 +1,193 @@
+package processor
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/cloudbox/autoscan"
+)
+
+const (
+	// defaultRetryBackoff is the delay after the first failed retry of a target, it doubles with every failed retry.
+	defaultRetryBackoff = 15 * time.Second
+
+	// defaultMaxRetryBackoff caps the delay between the retries of a target.
+	defaultMaxRetryBackoff = 10 * time.Minute
+)
+
+// retries tracks the failed retries of the scans held for each target,
+// so a target which is down for a long time is not retried on every run of the processor.
+type retries struct {
+	policy autoscan.RetryPolicy
+
+	lock    sync.Mutex
+	targets map[string]retry
+}
+
+type retry struct {
+	attempts int
+	next     time.Time
+}
+
+func newRetries(policy autoscan.RetryPolicy) *retries {
+	if policy.Backoff <= 0 {
+		policy.Backoff = defaultRetryBackoff
+	}
+
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = defaultMaxRetryBackoff
+	}
+
+	return &retries{
+		policy:  policy,
+		targets: make(map[string]retry),
+	}
+}
+
+// policyOf returns the retry policy of the target, its own settings override those of the processor.
+func (r *retries) policyOf(target autoscan.Target) autoscan.RetryPolicy {
+	policy := r.policy
+
+	t, ok := target.(autoscan.RetryPolicer)
+	if !ok {
+		return policy
+	}
+
+	own := t.RetryPolicy()
+	if own.MaxRetries > 0 {
+		policy.MaxRetries = own.MaxRetries
+	}
+
+	if own.Backoff > 0 {
+		policy.Backoff = own.Backoff
+	}
+
+	if own.MaxBackoff > 0 {
+		policy.MaxBackoff = own.MaxBackoff
+	}
+
+	return policy
+}
+
+// failed delays the next retry of the target by the backoff of its policy and returns the delay.
+func (r *retries) failed(target autoscan.Target) time.Duration {
+	policy := r.policyOf(target)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	rt := r.targets[targetName(target)]
+	rt.attempts++
+
+	delay := backoff(rt.attempts, policy.Backoff, policy.MaxBackoff)
+	rt.next = now().Add(delay)
+	r.targets[targetName(target)] = rt
+
+	return delay
+}
+
+// succeeded resets the backoff of the target.
+func (r *retries) succeeded(target string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.targets, target)
+}
+
+// waiting reports whether the next retry of the target is delayed.
+func (r *retries) waiting(target string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	rt, ok := r.targets[target]
+	return ok && now().Before(rt.next)
+}
+
+// backoff returns the delay after the given number of failed retries,
+// which starts at base and doubles with every retry up to max.
+// The delay is jittered between half and all of it, so it never exceeds max.
+func backoff(attempts int, base time.Duration, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+
+	if delay > max {
+		delay = max
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// backOff delays the next retry of the target after a failed retry of the scan,
+// and drops the scan once it failed the maximum retries of the policy of the target.
+func (p *Processor) backOff(target autoscan.Target, scan autoscan.Scan, err error) {
+	delay := p.retries.failed(target)
+
+	log.Debug().
+		Err(err).
+		Str("id", scan.ID).
+		Str("path", scan.Folder).
+		Str("target", targetName(target)).
+		Dur("delay", delay).
+		Msg("Retry of the target failed, backing off")
+
+	maxRetries := p.retries.policyOf(target).MaxRetries
+	if retries := p.failedRetry(target, scan); maxRetries == 0 || retries < maxRetries {
+		return
+	}
+
+	p.heldLock.Lock()
+	delete(p.held[target], scan.Folder)
+	if len(p.held[target]) == 0 {
+		delete(p.held, target)
+	}
+	p.heldLock.Unlock()
+
+	log.Error().
+		Err(err).
+		Str("id", scan.ID).
+		Str("path", scan.Folder).
+		Str("target", targetName(target)).
+		Int("retries", maxRetries).
+		Msg("Scan failed the maximum retries of the target, dropping scan")
+
+	// the scan is counted as failed, rather than as held for a target which is not ready
+	p.outcome(autoscan.Outcome{
+		Stage:  autoscan.OutcomeFailed,
+		Scan:   scan,
+		Target: targetName(target),
+		Err:    fmt.Errorf("dropped after %d retries: %v", maxRetries, err),
+	})
+}
+
+// failedRetry counts a failed retry of the scan held for the target and returns its failed retries.
+func (p *Processor) failedRetry(target autoscan.Target, scan autoscan.Scan) int {
+	p.heldLock.Lock()
+	defer p.heldLock.Unlock()
+
+	held, ok := p.held[target][scan.Folder]
+	if !ok {
+		return 0
+	}
+
+	held.retries++
+	p.held[target][scan.Folder] = held
+	return held.retries
+}
+
+// holdBackingOff holds the scan while the retries of its target are backing off.
+func (p *Processor) holdBackingOff(target autoscan.Target, scan autoscan.Scan) {
+	held := p.holdScan(target, scan, waitingBackoff)
+
+	log.Debug().
+		Str("id", scan.ID).
+		Str("path", scan.Folder).
+		Str("target", targetName(target)).
+		Int("held", held).
+		Msg("Retries of the target are backing off, holding scan")
+}
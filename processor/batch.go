@@ -0,0 +1,214 @@
+package processor
+
+import (
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/cloudbox/autoscan"
+)
+
+// batch collects the scans received within a window and collapses scans
+// for the same folder and priority, regardless of which trigger sent them.
+// Scans are meant for all targets until they are dispatched, so the scans
+// held for a single target are collapsed per target when they are held instead.
+// The window is flushed early once it holds size scans, unless size is zero.
+// Scans of a window which failed to flush are batched again for the next window.
+type batch struct {
+	window time.Duration
+	size   int
+	flush  func([]autoscan.Scan) error
+
+	// summarise receives the scans of every flushed window,
+	// with the amount of scans received and the start of the window.
+	summarise func(received int, started time.Time, scans []autoscan.Scan)
+
+	lock     sync.Mutex
+	scans    map[batchKey]autoscan.Scan
+	received int
+	started  time.Time
+	timer    *time.Timer
+}
+
+func newBatch(window time.Duration, size int, flush func([]autoscan.Scan) error) *batch {
+	return &batch{
+		window: window,
+		size:   size,
+		flush:  flush,
+		scans:  make(map[batchKey]autoscan.Scan),
+	}
+}
+
+// batchKey identifies the scans which collapse within a window.
+type batchKey struct {
+	folder   string
+	priority int
+}
+
+func keyOf(scan autoscan.Scan) batchKey {
+	return batchKey{folder: scan.Folder, priority: scan.Priority}
+}
+
+// collapse merges the scan into an existing scan of the same key,
+// the same behaviour as the datastore upsert.
+func collapse(existing autoscan.Scan, scan autoscan.Scan) autoscan.Scan {
+	if existing.File != scan.File {
+		scan.File = ""
+	}
+
+	if existing.ID != scan.ID {
+		deduplicated("", scan, existing)
+	}
+
+	return scan
+}
+
+func (b *batch) Add(scans ...autoscan.Scan) error {
+	if b.window <= 0 {
+		if err := b.flush(scans); err != nil {
+			return err
+		}
+
+		b.summary(len(scans), now(), scans)
+		return nil
+	}
+
+	b.lock.Lock()
+
+	if b.received == 0 {
+		b.started = now()
+	}
+	b.received += len(scans)
+
+	for _, scan := range scans {
+		scan.Folder = filepath.Clean(scan.Folder)
+
+		if existing, ok := b.scans[keyOf(scan)]; ok {
+			scan = collapse(existing, scan)
+		}
+
+		b.scans[keyOf(scan)] = scan
+	}
+
+	// a very large import does not wait for the window to elapse
+	if b.size > 0 && len(b.scans) >= b.size {
+		size := len(b.scans)
+		b.lock.Unlock()
+
+		log.Debug().
+			Int("scans", size).
+			Msg("Batch is full, flushing before the window elapsed")
+		return b.Flush()
+	}
+
+	// the window starts with the first scan
+	b.schedule()
+
+	b.lock.Unlock()
+	return nil
+}
+
+// schedule flushes the batch once the window elapsed, the lock must be held.
+func (b *batch) schedule() {
+	if b.timer != nil {
+		return
+	}
+
+	b.timer = time.AfterFunc(b.window, func() {
+		if err := b.Flush(); err != nil {
+			log.Error().
+				Err(err).
+				Msg("Failed flushing batched scans, retrying once the window elapsed")
+		}
+	})
+}
+
+// Flush moves all batched scans to the datastore.
+// When this fails, the scans are batched again and flushed with the next window.
+func (b *batch) Flush() error {
+	b.lock.Lock()
+	scans := make([]autoscan.Scan, 0, len(b.scans))
+	for _, scan := range b.scans {
+		scans = append(scans, scan)
+	}
+
+	received, started := b.received, b.started
+	b.scans = make(map[batchKey]autoscan.Scan)
+	b.received = 0
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.lock.Unlock()
+
+	if len(scans) == 0 {
+		return nil
+	}
+
+	// the latest scan of a folder wins in the datastore
+	sort.SliceStable(scans, func(i, j int) bool {
+		return scans[i].Time.Before(scans[j].Time)
+	})
+
+	if err := b.flush(scans); err != nil {
+		b.requeue(received, started, scans)
+		return err
+	}
+
+	b.summary(received, started, scans)
+	return nil
+}
+
+// requeue batches the scans of a window which failed to flush again,
+// scans received since then take precedence over them.
+func (b *batch) requeue(received int, started time.Time, scans []autoscan.Scan) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.received == 0 || started.Before(b.started) {
+		b.started = started
+	}
+	b.received += received
+
+	for _, scan := range scans {
+		if newer, ok := b.scans[keyOf(scan)]; ok {
+			scan = collapse(scan, newer)
+		}
+
+		b.scans[keyOf(scan)] = scan
+	}
+
+	if b.window > 0 {
+		b.schedule()
+	}
+}
+
+func (b *batch) summary(received int, started time.Time, scans []autoscan.Scan) {
+	if b.summarise != nil {
+		b.summarise(received, started, scans)
+	}
+}
+
+// Size returns the amount of scans currently batched.
+func (b *batch) Size() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return len(b.scans)
+}
+
+// Scans returns the scans currently batched.
+func (b *batch) Scans() []autoscan.Scan {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	scans := make([]autoscan.Scan, 0, len(b.scans))
+	for _, scan := range b.scans {
+		scans = append(scans, scan)
+	}
+
+	return scans
+}
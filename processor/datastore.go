@@ -2,9 +2,11 @@ package processor
 
 import (
 	"database/sql"
+	"database/sql/driver"
 	"embed"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/cloudbox/autoscan"
@@ -33,18 +35,66 @@ func newDatastore(db *sql.DB, mg *migrate.Migrator) (*datastore, error) {
 }
 
 const sqlUpsert = `
-INSERT INTO scan (folder, priority, time)
-VALUES (?, ?, ?)
+INSERT INTO scan (folder, priority, time, removed, id, item_id, event, file, collection_name, library_hint, item_ids)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 ON CONFLICT (folder) DO UPDATE SET
 	priority = MAX(excluded.priority, scan.priority),
-	time = excluded.time
+	time = excluded.time,
+	removed = excluded.removed,
+	id = excluded.id,
+	item_id = excluded.item_id,
+	event = excluded.event,
+	file = CASE WHEN scan.file = excluded.file THEN scan.file ELSE '' END,
+	collection_name = excluded.collection_name,
+	library_hint = excluded.library_hint,
+	item_ids = excluded.item_ids
 `
 
+const sqlGetID = `SELECT id FROM scan WHERE folder = ?`
+
 func (store *datastore) upsert(tx *sql.Tx, scan autoscan.Scan) error {
-	_, err := tx.Exec(sqlUpsert, scan.Folder, scan.Priority, scan.Time)
+	// a queued scan of the folder is absorbed by the new scan
+	var absorbed autoscan.Scan
+	err := tx.QueryRow(sqlGetID, scan.Folder).Scan(&absorbed.ID)
+	switch {
+	case err == nil && absorbed.ID != scan.ID:
+		deduplicated("", scan, absorbed)
+	case err != nil && !errors.Is(err, sql.ErrNoRows):
+		return err
+	}
+
+	_, err = tx.Exec(sqlUpsert, scan.Folder, scan.Priority, scan.Time, scan.Removed, scan.ID, scan.ItemID, scan.Event, scan.File, scan.CollectionName, scan.LibraryHint, itemIDs(scan.ItemIDs))
 	return err
 }
 
+// itemIDs stores the ItemIDs of a scan as a comma-separated column,
+// an empty list is stored as an empty string and read back as nil.
+type itemIDs []string
+
+func (ids itemIDs) Value() (driver.Value, error) {
+	return strings.Join(ids, ","), nil
+}
+
+func (ids *itemIDs) Scan(src interface{}) error {
+	var value string
+	switch v := src.(type) {
+	case string:
+		value = v
+	case []byte:
+		value = string(v)
+	case nil:
+	default:
+		return fmt.Errorf("item ids: unexpected type %T", src)
+	}
+
+	*ids = nil
+	if value != "" {
+		*ids = strings.Split(value, ",")
+	}
+
+	return nil
+}
+
 func (store *datastore) Upsert(scans []autoscan.Scan) error {
 	tx, err := store.Begin()
 	if err != nil {
@@ -82,7 +132,7 @@ func (store *datastore) GetScansRemaining() (int, error) {
 }
 
 const sqlGetAvailableScan = `
-SELECT folder, priority, time FROM scan
+SELECT folder, priority, time, removed, id, item_id, event, file, collection_name, library_hint, item_ids FROM scan
 WHERE time < ?
 ORDER BY priority DESC, time ASC
 LIMIT 1
@@ -92,7 +142,7 @@ func (store *datastore) GetAvailableScan(minAge time.Duration) (autoscan.Scan, e
 	row := store.QueryRow(sqlGetAvailableScan, now().Add(-1*minAge))
 
 	scan := autoscan.Scan{}
-	err := row.Scan(&scan.Folder, &scan.Priority, &scan.Time)
+	err := row.Scan(&scan.Folder, &scan.Priority, &scan.Time, &scan.Removed, &scan.ID, &scan.ItemID, &scan.Event, &scan.File, &scan.CollectionName, &scan.LibraryHint, (*itemIDs)(&scan.ItemIDs))
 	switch {
 	case errors.Is(err, sql.ErrNoRows):
 		return scan, autoscan.ErrNoScans
@@ -103,8 +153,44 @@ func (store *datastore) GetAvailableScan(minAge time.Duration) (autoscan.Scan, e
 	return scan, nil
 }
 
+const sqlGetAvailableScans = `
+SELECT folder, priority, time, removed, id, item_id, event, file, collection_name, library_hint, item_ids FROM scan
+WHERE time < ?
+ORDER BY priority DESC, time ASC
+`
+
+// GetAvailableScanFunc returns the first scan which is older than
+// the minimum age returned by folderAge for its folder.
+// minAge must be the lowest minimum age folderAge can return.
+func (store *datastore) GetAvailableScanFunc(minAge time.Duration, folderAge func(string) time.Duration) (autoscan.Scan, error) {
+	current := now()
+
+	rows, err := store.Query(sqlGetAvailableScans, current.Add(-1*minAge))
+	if err != nil {
+		return autoscan.Scan{}, fmt.Errorf("get matching: %s: %w", err, autoscan.ErrFatal)
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		scan := autoscan.Scan{}
+		if err := rows.Scan(&scan.Folder, &scan.Priority, &scan.Time, &scan.Removed, &scan.ID, &scan.ItemID, &scan.Event, &scan.File, &scan.CollectionName, &scan.LibraryHint, (*itemIDs)(&scan.ItemIDs)); err != nil {
+			return autoscan.Scan{}, fmt.Errorf("get matching: %s: %w", err, autoscan.ErrFatal)
+		}
+
+		if scan.Time.Before(current.Add(-1 * folderAge(scan.Folder))) {
+			return scan, nil
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return autoscan.Scan{}, fmt.Errorf("get matching: %s: %w", err, autoscan.ErrFatal)
+	}
+
+	return autoscan.Scan{}, autoscan.ErrNoScans
+}
+
 const sqlGetAll = `
-SELECT folder, priority, time FROM scan
+SELECT folder, priority, time, removed, id, item_id, event, file, collection_name, library_hint, item_ids FROM scan
 `
 
 func (store *datastore) GetAll() (scans []autoscan.Scan, err error) {
@@ -116,7 +202,7 @@ func (store *datastore) GetAll() (scans []autoscan.Scan, err error) {
 	defer rows.Close()
 	for rows.Next() {
 		scan := autoscan.Scan{}
-		err = rows.Scan(&scan.Folder, &scan.Priority, &scan.Time)
+		err = rows.Scan(&scan.Folder, &scan.Priority, &scan.Time, &scan.Removed, &scan.ID, &scan.ItemID, &scan.Event, &scan.File, &scan.CollectionName, &scan.LibraryHint, (*itemIDs)(&scan.ItemIDs))
 		if err != nil {
 			return scans, err
 		}
@@ -140,4 +226,133 @@ func (store *datastore) Delete(scan autoscan.Scan) error {
 	return nil
 }
 
+const sqlDispatch = `
+INSERT INTO dispatched (target, folder, removed, time)
+VALUES (?, ?, ?, ?)
+ON CONFLICT (target, folder) DO UPDATE SET
+	removed = excluded.removed,
+	time = excluded.time
+`
+
+// Dispatch records that the scan was sent to the target.
+func (store *datastore) Dispatch(target string, scan autoscan.Scan) error {
+	_, err := store.Exec(sqlDispatch, target, scan.Folder, scan.Removed, now())
+	if err != nil {
+		return fmt.Errorf("dispatch: %s: %w", err, autoscan.ErrFatal)
+	}
+
+	return nil
+}
+
+const sqlDispatched = `
+SELECT COUNT(folder) FROM dispatched
+WHERE target=? AND folder=? AND removed=? AND time > ?
+`
+
+// Dispatched reports whether a scan of the same folder, which was removed alike,
+// was sent to the target within the window.
+func (store *datastore) Dispatched(target string, scan autoscan.Scan, window time.Duration) (bool, error) {
+	row := store.QueryRow(sqlDispatched, target, scan.Folder, scan.Removed, now().Add(-1*window))
+
+	count := 0
+	if err := row.Scan(&count); err != nil {
+		return false, fmt.Errorf("dispatched: %s: %w", err, autoscan.ErrFatal)
+	}
+
+	return count > 0, nil
+}
+
+const sqlPruneDispatched = `
+DELETE FROM dispatched WHERE time <= ?
+`
+
+// PruneDispatched drops the records of folders sent to targets before the window.
+func (store *datastore) PruneDispatched(window time.Duration) error {
+	_, err := store.Exec(sqlPruneDispatched, now().Add(-1*window))
+	if err != nil {
+		return fmt.Errorf("prune dispatched: %s: %w", err, autoscan.ErrFatal)
+	}
+
+	return nil
+}
+
+const sqlAddHistory = `
+INSERT INTO history (target, id, folder, outcome, refresh, item_id, error, duration, time)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+`
+
+const sqlPruneHistorySize = `
+DELETE FROM history WHERE target=? AND rowid NOT IN (
+	SELECT rowid FROM history WHERE target=? ORDER BY rowid DESC LIMIT ?
+)
+`
+
+const sqlPruneHistoryAge = `
+DELETE FROM history WHERE time <= ?
+`
+
+// AddHistory records the processed scan and prunes the history of its target to the size,
+// and the history of all targets to the maximum age unless it is zero.
+func (store *datastore) AddHistory(entry HistoryEntry, size int, maxAge time.Duration) error {
+	tx, err := store.Begin()
+	if err != nil {
+		return fmt.Errorf("add history: %s: %w", err, autoscan.ErrFatal)
+	}
+
+	_, err = tx.Exec(sqlAddHistory, entry.Target, entry.ID, entry.Folder, entry.Outcome,
+		entry.Refresh, entry.ItemID, entry.Error, entry.Duration, entry.Time)
+	if err == nil {
+		_, err = tx.Exec(sqlPruneHistorySize, entry.Target, entry.Target, size)
+	}
+	if err == nil && maxAge > 0 {
+		_, err = tx.Exec(sqlPruneHistoryAge, now().Add(-1*maxAge))
+	}
+
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			panic(rollbackErr)
+		}
+
+		return fmt.Errorf("add history: %s: %w", err, autoscan.ErrFatal)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("add history: %s: %w", err, autoscan.ErrFatal)
+	}
+
+	return nil
+}
+
+const sqlGetHistory = `
+SELECT target, id, folder, outcome, refresh, item_id, error, duration, time FROM history
+WHERE ? = '' OR target = ?
+ORDER BY rowid DESC
+`
+
+// GetHistory returns the processed scans of the target, or of all targets when it is empty, most recent first.
+func (store *datastore) GetHistory(target string) ([]HistoryEntry, error) {
+	rows, err := store.Query(sqlGetHistory, target, target)
+	if err != nil {
+		return nil, fmt.Errorf("get history: %s: %w", err, autoscan.ErrFatal)
+	}
+
+	defer rows.Close()
+	entries := make([]HistoryEntry, 0)
+	for rows.Next() {
+		e := HistoryEntry{}
+		err := rows.Scan(&e.Target, &e.ID, &e.Folder, &e.Outcome, &e.Refresh, &e.ItemID, &e.Error, &e.Duration, &e.Time)
+		if err != nil {
+			return nil, fmt.Errorf("get history: %s: %w", err, autoscan.ErrFatal)
+		}
+
+		entries = append(entries, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("get history: %s: %w", err, autoscan.ErrFatal)
+	}
+
+	return entries, nil
+}
+
 var now = time.Now
@@ -15,7 +15,7 @@ import (
 )
 
 const sqlGetScan = `
-SELECT folder, priority, time FROM scan
+SELECT folder, priority, time, removed, item_id, event, file, collection_name, library_hint, item_ids FROM scan
 WHERE folder = ?
 `
 
@@ -23,7 +23,7 @@ func (store *datastore) GetScan(folder string) (autoscan.Scan, error) {
 	row := store.QueryRow(sqlGetScan, folder)
 
 	scan := autoscan.Scan{}
-	err := row.Scan(&scan.Folder, &scan.Priority, &scan.Time)
+	err := row.Scan(&scan.Folder, &scan.Priority, &scan.Time, &scan.Removed, &scan.ItemID, &scan.Event, &scan.File, &scan.CollectionName, &scan.LibraryHint, (*itemIDs)(&scan.ItemIDs))
 
 	return scan, err
 }
@@ -34,6 +34,10 @@ func getDatastore(t *testing.T) *datastore {
 		t.Fatal(err)
 	}
 
+	// every connection opens its own in-memory database,
+	// so the concurrent targets share one like they do in production.
+	db.SetMaxOpenConns(1)
+
 	mg, err := migrate.New(db, "migrations")
 	if err != nil {
 		t.Fatal(err)
@@ -70,6 +74,166 @@ func TestUpsert(t *testing.T) {
 				Time:     time.Time{}.Add(1),
 			},
 		},
+		{
+			Name: "Latest scan determines whether the folder was removed",
+			Scans: []autoscan.Scan{
+				{
+					Folder:  "testfolder/test",
+					Time:    time.Time{}.Add(1),
+					Removed: true,
+				},
+				{
+					Folder: "testfolder/test",
+					Time:   time.Time{}.Add(2),
+				},
+			},
+			WantScan: autoscan.Scan{
+				Folder: "testfolder/test",
+				Time:   time.Time{}.Add(2),
+			},
+		},
+		{
+			Name: "Removed flag is stored",
+			Scans: []autoscan.Scan{
+				{
+					Folder:  "testfolder/test",
+					Time:    time.Time{}.Add(1),
+					Removed: true,
+				},
+			},
+			WantScan: autoscan.Scan{
+				Folder:  "testfolder/test",
+				Time:    time.Time{}.Add(1),
+				Removed: true,
+			},
+		},
+		{
+			Name: "Item ID is stored",
+			Scans: []autoscan.Scan{
+				{
+					Folder: "testfolder/test",
+					Time:   time.Time{}.Add(1),
+					ItemID: "9fa3b8c2",
+				},
+			},
+			WantScan: autoscan.Scan{
+				Folder: "testfolder/test",
+				Time:   time.Time{}.Add(1),
+				ItemID: "9fa3b8c2",
+			},
+		},
+		{
+			Name: "Event is stored",
+			Scans: []autoscan.Scan{
+				{
+					Folder: "testfolder/test",
+					Time:   time.Time{}.Add(1),
+					Event:  autoscan.EventUpgrade,
+				},
+			},
+			WantScan: autoscan.Scan{
+				Folder: "testfolder/test",
+				Time:   time.Time{}.Add(1),
+				Event:  autoscan.EventUpgrade,
+			},
+		},
+		{
+			Name: "File is stored",
+			Scans: []autoscan.Scan{
+				{
+					Folder: "testfolder/test",
+					Time:   time.Time{}.Add(1),
+					File:   "testfolder/test/movie.srt",
+				},
+				{
+					Folder: "testfolder/test",
+					Time:   time.Time{}.Add(2),
+					File:   "testfolder/test/movie.srt",
+				},
+			},
+			WantScan: autoscan.Scan{
+				Folder: "testfolder/test",
+				Time:   time.Time{}.Add(2),
+				File:   "testfolder/test/movie.srt",
+			},
+		},
+		{
+			Name: "File is cleared when several files changed",
+			Scans: []autoscan.Scan{
+				{
+					Folder: "testfolder/test",
+					Time:   time.Time{}.Add(1),
+					File:   "testfolder/test/movie.srt",
+				},
+				{
+					Folder: "testfolder/test",
+					Time:   time.Time{}.Add(2),
+					File:   "testfolder/test/movie.mkv",
+				},
+			},
+			WantScan: autoscan.Scan{
+				Folder: "testfolder/test",
+				Time:   time.Time{}.Add(2),
+			},
+		},
+		{
+			Name: "Latest scan determines the collection",
+			Scans: []autoscan.Scan{
+				{
+					Folder:         "testfolder/test",
+					Time:           time.Time{}.Add(1),
+					CollectionName: "Marvel",
+				},
+				{
+					Folder:         "testfolder/test",
+					Time:           time.Time{}.Add(2),
+					CollectionName: "Pixar",
+				},
+			},
+			WantScan: autoscan.Scan{
+				Folder:         "testfolder/test",
+				Time:           time.Time{}.Add(2),
+				CollectionName: "Pixar",
+			},
+		},
+		{
+			Name: "Latest scan determines the library hint",
+			Scans: []autoscan.Scan{
+				{
+					Folder:      "testfolder/test",
+					Time:        time.Time{}.Add(1),
+					LibraryHint: "Movies 4K",
+				},
+				{
+					Folder: "testfolder/test",
+					Time:   time.Time{}.Add(2),
+				},
+			},
+			WantScan: autoscan.Scan{
+				Folder: "testfolder/test",
+				Time:   time.Time{}.Add(2),
+			},
+		},
+		{
+			Name: "Latest scan determines the item ids",
+			Scans: []autoscan.Scan{
+				{
+					Folder:  "testfolder/test",
+					Time:    time.Time{}.Add(1),
+					ItemIDs: []string{"a1", "b2"},
+				},
+				{
+					Folder:  "testfolder/test",
+					Time:    time.Time{}.Add(2),
+					ItemIDs: []string{"c3"},
+				},
+			},
+			WantScan: autoscan.Scan{
+				Folder:  "testfolder/test",
+				Time:    time.Time{}.Add(2),
+				ItemIDs: []string{"c3"},
+			},
+		},
 		{
 			Name: "Priority shall increase but not decrease",
 			Scans: []autoscan.Scan{
@@ -178,6 +342,9 @@ func TestGetAvailableScan(t *testing.T) {
 			now = func() time.Time {
 				return tc.Now
 			}
+			defer func() {
+				now = time.Now
+			}()
 
 			scan, err := store.GetAvailableScan(tc.MinAge)
 			if !errors.Is(err, tc.WantErr) {
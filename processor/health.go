@@ -0,0 +1,128 @@
+package processor
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cloudbox/autoscan"
+)
+
+// TargetHealth describes the last scans a target handled, whether the target is paused,
+// and whether its availability checks failed for too long.
+// The times are zero when the target did not succeed or fail yet.
+type TargetHealth struct {
+	Target      string
+	LastSuccess time.Time
+	LastFailure time.Time
+	LastError   string
+	Paused      bool
+
+	// Unavailable is set once the availability checks failed ProbeFailures times in a row,
+	// for at least the grace window of the processor.
+	Unavailable   bool
+	ProbeFailures int
+
+	failingSince time.Time
+}
+
+// health keeps track of the last scans per target name.
+type health struct {
+	lock    sync.Mutex
+	targets map[string]TargetHealth
+
+	// failures and grace to pass before a target is unavailable.
+	failures int
+	grace    time.Duration
+}
+
+func newHealth(failures int, grace time.Duration) *health {
+	if failures < 1 {
+		failures = 1
+	}
+
+	return &health{
+		targets:  make(map[string]TargetHealth),
+		failures: failures,
+		grace:    grace,
+	}
+}
+
+// register adds the targets which did not handle any scans yet.
+func (h *health) register(targets []autoscan.Target) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for _, target := range targets {
+		name := targetName(target)
+		if _, ok := h.targets[name]; !ok {
+			h.targets[name] = TargetHealth{Target: name}
+		}
+	}
+}
+
+// update records the outcome of a scan sent to the target.
+func (h *health) update(target string, err error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	th := h.targets[target]
+	th.Target = target
+	if err == nil {
+		th.LastSuccess = now()
+		th.recovered()
+	} else {
+		th.LastFailure = now()
+		th.LastError = err.Error()
+	}
+
+	h.targets[target] = th
+}
+
+// probe records the availability check of the target,
+// and reports whether the target is unavailable.
+func (h *health) probe(target string, err error) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	th := h.targets[target]
+	th.Target = target
+	if err == nil {
+		th.recovered()
+		h.targets[target] = th
+		return false
+	}
+
+	if th.ProbeFailures == 0 {
+		th.failingSince = now()
+	}
+
+	th.ProbeFailures++
+	th.Unavailable = th.ProbeFailures >= h.failures && now().Sub(th.failingSince) >= h.grace
+	h.targets[target] = th
+
+	return th.Unavailable
+}
+
+func (th *TargetHealth) recovered() {
+	th.Unavailable = false
+	th.ProbeFailures = 0
+	th.failingSince = time.Time{}
+}
+
+// Health returns the health of all targets the processor knows of, sorted by name.
+func (p *Processor) Health() []TargetHealth {
+	p.health.lock.Lock()
+	defer p.health.lock.Unlock()
+
+	targets := make([]TargetHealth, 0, len(p.health.targets))
+	for _, th := range p.health.targets {
+		targets = append(targets, th)
+	}
+
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].Target < targets[j].Target
+	})
+
+	return targets
+}
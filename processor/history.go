@@ -0,0 +1,59 @@
+package processor
+
+import (
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/cloudbox/autoscan"
+)
+
+// defaultHistorySize is the number of processed scans kept per target.
+const defaultHistorySize = 100
+
+// A HistoryEntry records how a target handled a scan which was sent to it.
+// Error is empty when the target succeeded.
+type HistoryEntry struct {
+	Target   string
+	ID       string
+	Folder   string
+	Outcome  string
+	Refresh  string
+	ItemID   string
+	Error    string
+	Duration time.Duration
+	Time     time.Time
+}
+
+// History returns the processed scans of the named target, or of all targets when it is empty,
+// most recent first.
+func (p *Processor) History(target string) ([]HistoryEntry, error) {
+	return p.store.GetHistory(target)
+}
+
+// record adds the outcome of a scan sent to a target to the history.
+func (p *Processor) record(o autoscan.Outcome, started time.Time) {
+	entry := HistoryEntry{
+		Target:   o.Target,
+		ID:       o.Scan.ID,
+		Folder:   o.Scan.Folder,
+		Outcome:  o.Stage,
+		Refresh:  o.Refresh,
+		ItemID:   o.ItemID,
+		Duration: now().Sub(started),
+		Time:     started,
+	}
+
+	if o.Err != nil {
+		entry.Error = o.Err.Error()
+	}
+
+	if err := p.store.AddHistory(entry, p.historySize, p.historyAge); err != nil {
+		log.Warn().
+			Err(err).
+			Str("id", o.Scan.ID).
+			Str("path", o.Scan.Folder).
+			Str("target", o.Target).
+			Msg("Failed recording the scan in the history")
+	}
+}
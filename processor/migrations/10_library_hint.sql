@@ -0,0 +1 @@
+ALTER TABLE scan ADD COLUMN "library_hint" TEXT NOT NULL DEFAULT ''
\ No newline at end of file
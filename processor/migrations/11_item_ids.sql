@@ -0,0 +1 @@
+ALTER TABLE scan ADD COLUMN "item_ids" TEXT NOT NULL DEFAULT ''
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE scan ADD COLUMN "removed" BOOLEAN NOT NULL DEFAULT 0
\ No newline at end of file
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS dispatched (
+    "target" TEXT NOT NULL,
+    "folder" TEXT NOT NULL,
+    "removed" BOOLEAN NOT NULL,
+    "time" DATETIME NOT NULL,
+    PRIMARY KEY(target, folder)
+)
@@ -0,0 +1 @@
+ALTER TABLE scan ADD COLUMN "file" TEXT NOT NULL DEFAULT ''
\ No newline at end of file
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS history (
+    "target" TEXT NOT NULL,
+    "id" TEXT NOT NULL,
+    "folder" TEXT NOT NULL,
+    "outcome" TEXT NOT NULL,
+    "refresh" TEXT NOT NULL,
+    "item_id" TEXT NOT NULL,
+    "error" TEXT NOT NULL,
+    "duration" INTEGER NOT NULL,
+    "time" DATETIME NOT NULL
+)
\ No newline at end of file
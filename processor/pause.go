@@ -0,0 +1,63 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/cloudbox/autoscan"
+)
+
+// ErrUnknownTarget indicates that no target of the given name received or was registered for scans.
+var ErrUnknownTarget = errors.New("unknown target")
+
+// Pause holds the scans of the named target until it is resumed, the other targets are unaffected.
+func (p *Processor) Pause(target string) error {
+	return p.setPaused(target, true)
+}
+
+// Resume sends the scans held for the paused target again.
+func (p *Processor) Resume(target string) error {
+	return p.setPaused(target, false)
+}
+
+func (p *Processor) setPaused(target string, paused bool) error {
+	p.health.lock.Lock()
+	defer p.health.lock.Unlock()
+
+	th, ok := p.health.targets[target]
+	if !ok {
+		return fmt.Errorf("%s: %w", target, ErrUnknownTarget)
+	}
+
+	th.Paused = paused
+	p.health.targets[target] = th
+
+	log.Info().
+		Str("target", target).
+		Bool("paused", paused).
+		Msg("Target pause changed")
+
+	return nil
+}
+
+// paused reports whether the target is paused.
+func (p *Processor) paused(target autoscan.Target) bool {
+	p.health.lock.Lock()
+	defer p.health.lock.Unlock()
+
+	return p.health.targets[targetName(target)].Paused
+}
+
+// pause holds the scan while its target is paused.
+func (p *Processor) pause(target autoscan.Target, scan autoscan.Scan) {
+	held := p.holdScan(target, scan, waitingPaused)
+
+	log.Debug().
+		Str("id", scan.ID).
+		Str("path", scan.Folder).
+		Str("target", targetName(target)).
+		Int("held", held).
+		Msg("Target paused, holding scan")
+}
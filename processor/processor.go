@@ -1,24 +1,119 @@
 package processor
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"math"
 	"os"
+	"sort"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/rs/zerolog/log"
+
 	"github.com/cloudbox/autoscan"
+	"github.com/cloudbox/autoscan/metrics"
 	"github.com/cloudbox/autoscan/migrate"
+	"github.com/cloudbox/autoscan/notify"
 
 	"golang.org/x/sync/errgroup"
 )
 
+// scanTimeouts counts the scans requeued after exceeding the scan timeout of their target.
+var scanTimeouts = metrics.Default.NewCounterVec(
+	"autoscan_target_scan_timeouts_total",
+	"Number of scans requeued after exceeding the scan timeout of a target.",
+	"target")
+
+// scansRefused counts the scans dropped after their target refused to scan them.
+var scansRefused = metrics.Default.NewCounterVec(
+	"autoscan_target_scans_refused_total",
+	"Number of scans dropped after a target refused to scan them.",
+	"target")
+
+// scanOutcomes counts the outcomes of scans, by stage, target and how the target handled the scan.
+var scanOutcomes = metrics.Default.NewCounterVec(
+	"autoscan_scan_outcomes_total",
+	"Number of scan outcomes, by stage.",
+	"stage", "target", "refresh")
+
+// OutcomeMetrics is an autoscan.OutcomeHook counting the outcomes of scans,
+// by stage, target and how the target handled the scan.
+type OutcomeMetrics struct{}
+
+func (OutcomeMetrics) Outcome(o autoscan.Outcome) {
+	scanOutcomes.Inc(o.Stage, o.Target, o.Refresh)
+}
+
+// scansDeduplicated counts the scans absorbed by a scan of the same folder, by target.
+// The target is empty for scans absorbed before they reached the targets.
+var scansDeduplicated = metrics.Default.NewCounterVec(
+	"autoscan_scans_deduplicated_total",
+	"Number of scans absorbed by a scan of the same folder.",
+	"target")
+
+// deduplicated counts the scan absorbed by another scan of the same folder.
+func deduplicated(target string, scan autoscan.Scan, absorbed autoscan.Scan) {
+	scansDeduplicated.Inc(target)
+
+	log.Debug().
+		Str("id", scan.ID).
+		Str("absorbed", absorbed.ID).
+		Str("path", scan.Folder).
+		Str("target", target).
+		Msg("Scan absorbed a scan of the same folder")
+}
+
+// A Library overrides the processor settings for all scans
+// within its path.
+type Library struct {
+	Path       string        `yaml:"path"`
+	MinimumAge time.Duration `yaml:"minimum-age"`
+}
+
 type Config struct {
-	Anchors    []string
-	MinimumAge time.Duration
+	Anchors     []string
+	MinimumAge  time.Duration
+	Libraries   []Library
+	ScanTimeout time.Duration
+	BatchWindow time.Duration
+	BatchSize   int
+	DedupWindow time.Duration
+
+	// A target is unavailable once its availability checks failed AvailabilityFailures times
+	// in a row (1 by default), for at least the AvailabilityGrace.
+	AvailabilityFailures int
+	AvailabilityGrace    time.Duration
+
+	// MaxRetryBackoff caps the delay between the retries of the scans held for a target,
+	// which doubles with every failed retry from RetryBackoff on. Defaults to 10 minutes and 15 seconds.
+	// A held scan is dropped after MaxRetries failed retries, unless it is zero.
+	// Targets implementing autoscan.RetryPolicer override these settings.
+	MaxRetryBackoff time.Duration
+	RetryBackoff    time.Duration
+	MaxRetries      int
+
+	// Scans within the FastPaths skip the minimum age, the settle delays and the anchor files.
+	FastPaths []string
+
+	// The history keeps the last HistorySize scans processed by each target (100 by default),
+	// scans older than HistoryMaxAge are pruned unless it is zero.
+	HistorySize   int
+	HistoryMaxAge time.Duration
+
+	// Hooks receive the outcomes of all scans, such as OutcomeMetrics and the Notifier.
+	Hooks []autoscan.OutcomeHook
 
 	Db *sql.DB
 	Mg *migrate.Migrator
+
+	// The Notifier is told when targets keep failing and when they recover.
+	// To notify the outcomes of all scans, it is also one of the Hooks.
+	Notifier *notify.Notifier
 }
 
 func New(c Config) (*Processor, error) {
@@ -27,28 +122,133 @@ func New(c Config) (*Processor, error) {
 		return nil, err
 	}
 
+	return newProcessor(c, store), nil
+}
+
+func newProcessor(c Config, store *datastore) *Processor {
+	// most specific library first
+	libraries := append([]Library(nil), c.Libraries...)
+	sort.SliceStable(libraries, func(i, j int) bool {
+		return len(libraries[i].Path) > len(libraries[j].Path)
+	})
+
+	historySize := c.HistorySize
+	if historySize <= 0 {
+		historySize = defaultHistorySize
+	}
+
+	retries := newRetries(autoscan.RetryPolicy{
+		MaxRetries: c.MaxRetries,
+		Backoff:    c.RetryBackoff,
+		MaxBackoff: c.MaxRetryBackoff,
+	})
+
 	proc := &Processor{
-		anchors:    c.Anchors,
-		minimumAge: c.MinimumAge,
-		store:      store,
+		anchors:     c.Anchors,
+		minimumAge:  c.MinimumAge,
+		libraries:   libraries,
+		scanTimeout: c.ScanTimeout,
+		dedupWindow: c.DedupWindow,
+		fastPaths:   c.FastPaths,
+		historySize: historySize,
+		historyAge:  c.HistoryMaxAge,
+		store:       store,
+		notifier:    c.Notifier,
+		hooks:       c.Hooks,
+		health:      newHealth(c.AvailabilityFailures, c.AvailabilityGrace),
+		summaries:   new(summaries),
+		retries:     retries,
+		held:        make(map[autoscan.Target]map[string]heldScan),
 	}
-	return proc, nil
+
+	proc.batch = newBatch(c.BatchWindow, c.BatchSize, store.Upsert)
+	proc.batch.summarise = proc.summaries.start
+	return proc
 }
 
 type Processor struct {
-	anchors    []string
-	minimumAge time.Duration
-	store      *datastore
-	processed  int64
+	anchors     []string
+	minimumAge  time.Duration
+	libraries   []Library
+	scanTimeout time.Duration
+	dedupWindow time.Duration
+	fastPaths   []string
+	historySize int
+	historyAge  time.Duration
+	store       *datastore
+	batch       *batch
+	notifier    *notify.Notifier
+	hooks       []autoscan.OutcomeHook
+	health      *health
+	summaries   *summaries
+	retries     *retries
+	processed   int64
+
+	// scans held for targets which are not ready or exceeded their scan timeout
+	held     map[autoscan.Target]map[string]heldScan
+	heldLock sync.Mutex
 }
 
+// A heldScan is retried for a single target, waiting describes why it is held.
+// Retries counts the failed retries of the scan.
+type heldScan struct {
+	autoscan.Scan
+	waiting string
+	retries int
+}
+
+// Add enqueues the scans, assigning an ID to the scans without one.
 func (p *Processor) Add(scans ...autoscan.Scan) error {
+	for i := range scans {
+		if scans[i].ID == "" {
+			scans[i].ID = autoscan.NewScanID()
+		}
+	}
+
+	if err := p.batch.Add(scans...); err != nil {
+		return err
+	}
+
+	for _, scan := range scans {
+		p.outcome(autoscan.Outcome{Stage: autoscan.OutcomeEnqueued, Scan: scan})
+	}
+
+	return nil
+}
+
+// Flush moves all scans waiting in the batch window
+// and all scans held for targets which are not ready to the datastore.
+func (p *Processor) Flush() error {
+	if err := p.batch.Flush(); err != nil {
+		return err
+	}
+
+	p.heldLock.Lock()
+	scans := make([]autoscan.Scan, 0)
+	for target, held := range p.held {
+		for _, scan := range held {
+			scans = append(scans, scan.Scan)
+		}
+
+		delete(p.held, target)
+	}
+	p.heldLock.Unlock()
+
+	if len(scans) == 0 {
+		return nil
+	}
+
 	return p.store.Upsert(scans)
 }
 
 // ScansRemaining returns the amount of scans remaining
 func (p *Processor) ScansRemaining() (int, error) {
-	return p.store.GetScansRemaining()
+	remaining, err := p.store.GetScansRemaining()
+	if err != nil {
+		return remaining, err
+	}
+
+	return remaining + p.batch.Size(), nil
 }
 
 // ScansProcessed returns the amount of scans processed
@@ -56,49 +256,485 @@ func (p *Processor) ScansProcessed() int64 {
 	return atomic.LoadInt64(&p.processed)
 }
 
+// A PendingScan is a scan which has not been sent to all targets yet.
+type PendingScan struct {
+	autoscan.Scan
+
+	// Target is the target holding the scan, empty when the scan was not sent yet.
+	Target string
+
+	// Eligible is the time from which the scan has reached its minimum age.
+	Eligible time.Time
+
+	// Waiting describes why the scan is not sent yet, empty when the scan can be sent.
+	Waiting string
+}
+
+const (
+	waitingBatch      = "batch window"
+	waitingMinimumAge = "minimum age"
+	waitingAnchors    = "anchor files"
+	waitingTarget     = "target not ready"
+	waitingTimeout    = "target timeout"
+	waitingSettle     = "settle delay"
+	waitingPaused     = "target paused"
+	waitingBackoff    = "retry backoff"
+)
+
+// Pending returns the scans which are batched, queued or held for a single target,
+// in the order in which the processor handles them.
+func (p *Processor) Pending() ([]PendingScan, error) {
+	queued, err := p.store.GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("get all: %s: %w", err, autoscan.ErrFatal)
+	}
+
+	current := now()
+	anchors := p.checkAnchors()
+
+	pending := make([]PendingScan, 0, len(queued))
+	add := func(scan autoscan.Scan, target string, waiting string) {
+		pending = append(pending, PendingScan{
+			Scan:     scan,
+			Target:   target,
+			Eligible: scan.Time.Add(p.folderMinimumAge(scan.Folder)),
+			Waiting:  waiting,
+		})
+	}
+
+	p.heldLock.Lock()
+	for target, scans := range p.held {
+		for _, scan := range scans {
+			add(scan.Scan, targetName(target), scan.waiting)
+		}
+	}
+	p.heldLock.Unlock()
+
+	for _, scan := range queued {
+		switch {
+		case !scan.Time.Before(current.Add(-1 * p.folderMinimumAge(scan.Folder))):
+			add(scan, "", waitingMinimumAge)
+		case anchors != nil && !p.fastPath(scan.Folder):
+			add(scan, "", waitingAnchors)
+		default:
+			add(scan, "", "")
+		}
+	}
+
+	for _, scan := range p.batch.Scans() {
+		add(scan, "", waitingBatch)
+	}
+
+	// held scans first, then by priority and age, as within the datastore
+	sort.SliceStable(pending, func(i, j int) bool {
+		if (pending[i].Target != "") != (pending[j].Target != "") {
+			return pending[i].Target != ""
+		}
+
+		if pending[i].Priority != pending[j].Priority {
+			return pending[i].Priority > pending[j].Priority
+		}
+
+		return pending[i].Time.Before(pending[j].Time)
+	})
+
+	return pending, nil
+}
+
 // CheckAvailability checks whether all targets are available.
 // If one target is not available, the error will return.
+// Failed checks are only returned once they exceed the AvailabilityFailures
+// and the AvailabilityGrace of the processor, fatal errors are returned right away.
 func (p *Processor) CheckAvailability(targets []autoscan.Target) error {
+	p.health.register(targets)
+
 	g := new(errgroup.Group)
 
 	for _, target := range targets {
 		target := target
 		g.Go(func() error {
-			return target.Available()
+			err := target.Available()
+			if errors.Is(err, autoscan.ErrFatal) || p.health.probe(targetName(target), err) {
+				return err
+			}
+
+			if err != nil {
+				log.Warn().
+					Err(err).
+					Str("target", targetName(target)).
+					Msg("Target failed its availability check, considered available within the grace")
+			}
+
+			return nil
 		})
 	}
 
 	return g.Wait()
 }
 
-func (p *Processor) callTargets(targets []autoscan.Target, scan autoscan.Scan) error {
+func (p *Processor) scanContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	// limit the time targets can spend on a single scan
+	if p.scanTimeout > 0 {
+		return context.WithTimeout(ctx, p.scanTimeout)
+	}
+
+	return context.WithCancel(ctx)
+}
+
+func (p *Processor) callTargets(ctx context.Context, targets []autoscan.Target, scan autoscan.Scan) error {
+	ctx, cancel := p.scanContext(ctx)
+	defer cancel()
+
 	g := new(errgroup.Group)
 
 	for _, target := range targets {
 		target := target
 		g.Go(func() error {
-			return target.Scan(scan)
+			if p.recentlyDispatched(target, scan) {
+				p.summaries.skipped(targetName(target), scan)
+				return nil
+			}
+
+			if p.paused(target) {
+				p.pause(target, scan)
+				return nil
+			}
+
+			if p.settling(target, scan) {
+				p.settle(target, scan)
+				return nil
+			}
+
+			if p.retries.waiting(targetName(target)) {
+				p.holdBackingOff(target, scan)
+				return nil
+			}
+
+			err := p.sendScan(ctx, target, scan)
+			if errors.Is(err, autoscan.ErrTargetNotReady) {
+				// do not block the other targets
+				p.hold(target, scan, err)
+				return nil
+			}
+
+			if p.targetTimedOut(ctx, err) {
+				p.requeue(target, scan, err)
+				return nil
+			}
+
+			p.report(ctx, target, err)
+			if errors.Is(err, autoscan.ErrScanRefused) {
+				// do not stop the processor for all targets
+				p.refuse(target, scan, err)
+				return nil
+			}
+
+			if err == nil {
+				p.retries.succeeded(targetName(target))
+				p.dispatched(target, scan)
+			}
+			return err
 		})
 	}
 
 	return g.Wait()
 }
 
-func (p *Processor) Process(targets []autoscan.Target) error {
-	scan, err := p.store.GetAvailableScan(p.minimumAge)
+// sendScan sends the scan to the target and passes the outcomes of the scan to the hooks.
+func (p *Processor) sendScan(ctx context.Context, target autoscan.Target, scan autoscan.Scan) error {
+	name := targetName(target)
+	p.outcome(autoscan.Outcome{Stage: autoscan.OutcomeDispatched, Scan: scan, Target: name})
+
+	started := now()
+	ctx, report := autoscan.WithRefreshReport(ctx)
+	err := p.scanTarget(ctx, target, scan)
+	refresh, itemID := report()
+
+	stage := autoscan.OutcomeSucceeded
+	if err != nil {
+		stage = autoscan.OutcomeFailed
+	}
+
+	o := autoscan.Outcome{
+		Stage:   stage,
+		Scan:    scan,
+		Target:  name,
+		Refresh: refresh,
+		ItemID:  itemID,
+		Err:     err,
+	}
+
+	p.outcome(o)
+	p.record(o, started)
+
+	return err
+}
+
+// outcome passes the outcome to the summaries and the hooks.
+func (p *Processor) outcome(o autoscan.Outcome) {
+	p.summaries.handled(o)
+
+	for _, hook := range p.hooks {
+		hook.Outcome(o)
+	}
+}
+
+// scanTarget sends the scan to the target, within the scan timeout of the target.
+func (p *Processor) scanTarget(ctx context.Context, target autoscan.Target, scan autoscan.Scan) error {
+	if t, ok := target.(autoscan.ScanTimeouter); ok && t.ScanTimeout() > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.ScanTimeout())
+		defer cancel()
+	}
+
+	return target.Scan(ctx, scan)
+}
+
+// targetTimedOut reports whether the scan exceeded the scan timeout of the target,
+// rather than the scan timeout of the processor or a shutdown.
+func (p *Processor) targetTimedOut(ctx context.Context, err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil
+}
+
+func (p *Processor) hold(target autoscan.Target, scan autoscan.Scan, err error) {
+	held := p.holdScan(target, scan, waitingTarget)
+
+	log.Warn().
+		Err(err).
+		Str("id", scan.ID).
+		Str("path", scan.Folder).
+		Int("held", held).
+		Msg("Target not ready, holding scan")
+}
+
+// requeue holds the scan for a target which exceeded its scan timeout,
+// so the scan is retried for this target without stalling the other targets.
+func (p *Processor) requeue(target autoscan.Target, scan autoscan.Scan, err error) {
+	held := p.holdScan(target, scan, waitingTimeout)
+	scanTimeouts.Inc(targetName(target))
+
+	log.Warn().
+		Err(err).
+		Str("id", scan.ID).
+		Str("path", scan.Folder).
+		Str("target", targetName(target)).
+		Int("held", held).
+		Msg("Scan exceeded the scan timeout of the target, requeueing scan")
+}
+
+// refuse drops the scan which the target refused to scan, such as a scan of the root after a misconfigured rewrite.
+// Retrying the scan would fail just the same, so it is not held for the target.
+func (p *Processor) refuse(target autoscan.Target, scan autoscan.Scan, err error) {
+	scansRefused.Inc(targetName(target))
+
+	log.Error().
+		Err(err).
+		Str("id", scan.ID).
+		Str("path", scan.Folder).
+		Str("target", targetName(target)).
+		Msg("Target refused the scan, dropping scan for this target")
+}
+
+// recentlyDispatched reports whether the scan was sent to the target within the dedup window,
+// such as a scan of a webhook which was replayed after a restart.
+func (p *Processor) recentlyDispatched(target autoscan.Target, scan autoscan.Scan) bool {
+	if p.dedupWindow <= 0 {
+		return false
+	}
+
+	dispatched, err := p.store.Dispatched(targetName(target), scan, p.dedupWindow)
+	if err != nil {
+		log.Warn().
+			Err(err).
+			Str("id", scan.ID).
+			Str("path", scan.Folder).
+			Msg("Failed checking whether the scan was sent recently, sending scan")
+		return false
+	}
+
+	if dispatched {
+		scansDeduplicated.Inc(targetName(target))
+		log.Debug().
+			Str("id", scan.ID).
+			Str("path", scan.Folder).
+			Str("target", targetName(target)).
+			Dur("dedup_window", p.dedupWindow).
+			Msg("Scan was sent to the target recently, skipping scan")
+	}
+
+	return dispatched
+}
+
+// dispatched records the scan sent to the target and prunes the records outside of the dedup window.
+func (p *Processor) dispatched(target autoscan.Target, scan autoscan.Scan) {
+	if p.dedupWindow <= 0 {
+		return
+	}
+
+	err := p.store.Dispatch(targetName(target), scan)
+	if err == nil {
+		err = p.store.PruneDispatched(p.dedupWindow)
+	}
+
+	if err != nil {
+		log.Warn().
+			Err(err).
+			Str("id", scan.ID).
+			Str("path", scan.Folder).
+			Msg("Failed recording the scan sent to the target")
+	}
+}
+
+// settling reports whether the scan became eligible within the settle delay of the target.
+func (p *Processor) settling(target autoscan.Target, scan autoscan.Scan) bool {
+	t, ok := target.(autoscan.SettleDelayer)
+	if !ok || t.SettleDelay() <= 0 || p.fastPath(scan.Folder) {
+		return false
+	}
+
+	eligible := scan.Time.Add(p.folderMinimumAge(scan.Folder))
+	return now().Before(eligible.Add(t.SettleDelay()))
+}
+
+// settle holds the scan until the settle delay of the target has passed.
+func (p *Processor) settle(target autoscan.Target, scan autoscan.Scan) {
+	held := p.holdScan(target, scan, waitingSettle)
+
+	log.Debug().
+		Str("id", scan.ID).
+		Str("path", scan.Folder).
+		Str("target", targetName(target)).
+		Int("held", held).
+		Msg("Holding scan until the settle delay of the target has passed")
+}
+
+func (p *Processor) holdScan(target autoscan.Target, scan autoscan.Scan, waiting string) int {
+	p.heldLock.Lock()
+	defer p.heldLock.Unlock()
+
+	if _, ok := p.held[target]; !ok {
+		p.held[target] = make(map[string]heldScan)
+	}
+
+	held := heldScan{Scan: scan, waiting: waiting}
+	if existing, ok := p.held[target][scan.Folder]; ok && existing.ID != scan.ID {
+		deduplicated(targetName(target), scan, existing.Scan)
+	} else if ok {
+		// a requeued scan keeps its failed retries
+		held.retries = existing.retries
+	}
+
+	p.held[target][scan.Folder] = held
+	return len(p.held[target])
+}
+
+// processHeld retries the scans held for targets which were not ready or exceeded their scan timeout,
+// sends the scans held for the settle delay of their target once it has passed,
+// and sends the scans held for paused targets once they are resumed.
+func (p *Processor) processHeld(ctx context.Context) error {
+	p.heldLock.Lock()
+	held := make(map[autoscan.Target][]autoscan.Scan)
+	for target, scans := range p.held {
+		for _, scan := range scans {
+			held[target] = append(held[target], scan.Scan)
+		}
+	}
+	p.heldLock.Unlock()
+
+	for target, scans := range held {
+		if p.paused(target) || p.retries.waiting(targetName(target)) {
+			continue
+		}
+
+		for _, scan := range scans {
+			if p.settling(target, scan) {
+				continue
+			}
+
+			scanCtx, cancel := p.scanContext(ctx)
+			err := p.sendScan(scanCtx, target, scan)
+			timedOut := p.targetTimedOut(scanCtx, err)
+			cancel()
+
+			if errors.Is(err, autoscan.ErrTargetNotReady) {
+				// still not ready, try again later
+				p.backOff(target, scan, err)
+				break
+			}
+
+			if timedOut {
+				p.requeue(target, scan, err)
+				p.backOff(target, scan, err)
+				break
+			}
+
+			p.report(ctx, target, err)
+			switch {
+			case errors.Is(err, autoscan.ErrScanRefused):
+				p.refuse(target, scan, err)
+			case err != nil:
+				return err
+			default:
+				p.retries.succeeded(targetName(target))
+				p.dispatched(target, scan)
+			}
+
+			p.heldLock.Lock()
+			delete(p.held[target], scan.Folder)
+			if len(p.held[target]) == 0 {
+				delete(p.held, target)
+			}
+			p.heldLock.Unlock()
+		}
+	}
+
+	return nil
+}
+
+// Process sends the next available scan to all targets.
+// The given context is passed on to the targets.
+func (p *Processor) Process(ctx context.Context, targets []autoscan.Target) error {
+	// Targets are listed in the health before they receive any scans
+	p.health.register(targets)
+	p.summaries.register(targets)
+
+	// Targets which are ready again receive their held scans first
+	if p.heldSize() > 0 {
+		if err := p.checkAnchors(); err != nil {
+			return err
+		}
+
+		if err := p.processHeld(ctx); err != nil {
+			return err
+		}
+	}
+
+	scan, err := p.getAvailableScan()
 	if err != nil {
 		return err
 	}
 
-	// Check whether all anchors are present
-	for _, anchor := range p.anchors {
-		if !fileExists(anchor) {
-			return fmt.Errorf("%s: %w", anchor, autoscan.ErrAnchorUnavailable)
+	// Check whether all anchors are present, scans within the fast paths do not wait for them
+	if !p.fastPath(scan.Folder) {
+		if err := p.checkAnchors(); err != nil {
+			fast, fastErr := p.getFastScan()
+			if errors.Is(fastErr, autoscan.ErrNoScans) {
+				return err
+			} else if fastErr != nil {
+				return fastErr
+			}
+
+			scan = fast
 		}
 	}
 
+	log.Debug().
+		Str("id", scan.ID).
+		Str("path", scan.Folder).
+		Msg("Sending scan to targets")
+
 	// Fatal or Target Unavailable -> return original error
-	err = p.callTargets(targets, scan)
+	err = p.callTargets(ctx, targets, scan)
 	if err != nil {
 		return err
 	}
@@ -112,6 +748,113 @@ func (p *Processor) Process(targets []autoscan.Target) error {
 	return nil
 }
 
+func (p *Processor) getAvailableScan() (autoscan.Scan, error) {
+	if len(p.libraries) == 0 && len(p.fastPaths) == 0 {
+		return p.store.GetAvailableScan(p.minimumAge)
+	}
+
+	lowest := p.minimumAge
+	if len(p.fastPaths) > 0 {
+		lowest = 0
+	}
+
+	for _, lib := range p.libraries {
+		if lib.MinimumAge < lowest {
+			lowest = lib.MinimumAge
+		}
+	}
+
+	return p.store.GetAvailableScanFunc(lowest, p.folderMinimumAge)
+}
+
+// getFastScan returns a scan within the fast paths,
+// so these are still sent while the anchors are unavailable.
+func (p *Processor) getFastScan() (autoscan.Scan, error) {
+	if len(p.fastPaths) == 0 {
+		return autoscan.Scan{}, autoscan.ErrNoScans
+	}
+
+	return p.store.GetAvailableScanFunc(0, func(folder string) time.Duration {
+		if p.fastPath(folder) {
+			return 0
+		}
+
+		return math.MaxInt64
+	})
+}
+
+// folderMinimumAge returns the minimum age of the most specific
+// library containing the folder, or the global minimum age.
+// Folders within the fast paths have no minimum age.
+func (p *Processor) folderMinimumAge(folder string) time.Duration {
+	if p.fastPath(folder) {
+		return 0
+	}
+
+	for _, lib := range p.libraries {
+		if folder == strings.TrimRight(lib.Path, "/") || strings.HasPrefix(folder, withTrailingSlash(lib.Path)) {
+			return lib.MinimumAge
+		}
+	}
+
+	return p.minimumAge
+}
+
+// fastPath reports whether the folder is within one of the fast paths.
+func (p *Processor) fastPath(folder string) bool {
+	for _, path := range p.fastPaths {
+		if folder == strings.TrimRight(path, "/") || strings.HasPrefix(folder, withTrailingSlash(path)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func withTrailingSlash(path string) string {
+	if strings.HasSuffix(path, "/") {
+		return path
+	}
+
+	return path + "/"
+}
+
+// report passes the outcome of a scan to the notifier and the health of the target.
+// Scans interrupted by a shutdown are not reported.
+func (p *Processor) report(ctx context.Context, target autoscan.Target, err error) {
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return
+	}
+
+	p.health.update(targetName(target), err)
+	p.notifier.Report(targetName(target), err)
+}
+
+func targetName(target autoscan.Target) string {
+	if s, ok := target.(fmt.Stringer); ok {
+		return s.String()
+	}
+
+	return fmt.Sprintf("%T", target)
+}
+
+func (p *Processor) checkAnchors() error {
+	for _, anchor := range p.anchors {
+		if !fileExists(anchor) {
+			return fmt.Errorf("%s: %w", anchor, autoscan.ErrAnchorUnavailable)
+		}
+	}
+
+	return nil
+}
+
+func (p *Processor) heldSize() int {
+	p.heldLock.Lock()
+	defer p.heldLock.Unlock()
+
+	return len(p.held)
+}
+
 var fileExists = func(fileName string) bool {
 	info, err := os.Stat(fileName)
 	if err != nil {
@@ -0,0 +1,1783 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/cloudbox/autoscan"
+	"github.com/cloudbox/autoscan/migrate"
+	"github.com/cloudbox/autoscan/triggers/manual"
+	"github.com/cloudbox/autoscan/triggers/sonarr"
+	"github.com/cloudbox/autoscan/triggers/webhook"
+)
+
+type blockingTarget struct{}
+
+func (t blockingTarget) Scan(ctx context.Context, scan autoscan.Scan) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (t blockingTarget) Available() error {
+	return nil
+}
+
+func TestProcessCancellation(t *testing.T) {
+	type Test struct {
+		Name        string
+		ScanTimeout time.Duration
+		Cancel      bool
+		WantErr     error
+	}
+
+	var testCases = []Test{
+		{
+			Name:        "Scan exceeds its timeout",
+			ScanTimeout: 10 * time.Millisecond,
+			WantErr:     context.DeadlineExceeded,
+		},
+		{
+			Name:    "Daemon context is cancelled",
+			Cancel:  true,
+			WantErr: context.Canceled,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			store := getDatastore(t)
+			err := store.Upsert([]autoscan.Scan{{Folder: "1"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			proc := newProcessor(Config{ScanTimeout: tc.ScanTimeout}, store)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			if tc.Cancel {
+				go func() {
+					time.Sleep(10 * time.Millisecond)
+					cancel()
+				}()
+			}
+
+			err = proc.Process(ctx, []autoscan.Target{blockingTarget{}})
+			if !errors.Is(err, tc.WantErr) {
+				t.Fatalf("Errors do not match: %v vs %v", err, tc.WantErr)
+			}
+
+			// the scan must remain queued
+			scans, err := store.GetAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(scans) != 1 {
+				t.Errorf("Scan was removed from the datastore")
+			}
+		})
+	}
+}
+
+func TestBatchWindow(t *testing.T) {
+	type Test struct {
+		Name      string
+		Window    time.Duration
+		GiveScans [][]autoscan.Scan
+		Batched   int
+		WantScans []autoscan.Scan
+	}
+
+	testTime := time.Now().UTC()
+
+	var testCases = []Test{
+		{
+			Name:   "Collapses scans of multiple triggers for the same folder",
+			Window: time.Minute,
+			GiveScans: [][]autoscan.Scan{
+				{{Folder: "/tv/Westworld/Season 1", Priority: 5, Time: testTime}},
+				{{Folder: "/tv/Westworld/Season 1/", Priority: 5, Time: testTime.Add(1)}},
+			},
+			Batched: 1,
+			WantScans: []autoscan.Scan{
+				{Folder: "/tv/Westworld/Season 1", Priority: 5, Time: testTime.Add(1)},
+			},
+		},
+		{
+			Name:   "Keeps scans of different priorities apart until they are queued",
+			Window: time.Minute,
+			GiveScans: [][]autoscan.Scan{
+				{{Folder: "/tv/Westworld/Season 1", Priority: 5, Time: testTime}},
+				{{Folder: "/tv/Westworld/Season 1/", Priority: 1, Time: testTime.Add(1)}},
+			},
+			Batched: 2,
+			WantScans: []autoscan.Scan{
+				{Folder: "/tv/Westworld/Season 1", Priority: 5, Time: testTime.Add(1)},
+			},
+		},
+		{
+			Name:   "Keeps scans for different folders",
+			Window: time.Minute,
+			GiveScans: [][]autoscan.Scan{
+				{{Folder: "/tv/Westworld/Season 1", Time: testTime}},
+				{{Folder: "/tv/Westworld/Season 2", Time: testTime}},
+			},
+			Batched: 2,
+			WantScans: []autoscan.Scan{
+				{Folder: "/tv/Westworld/Season 1", Time: testTime},
+				{Folder: "/tv/Westworld/Season 2", Time: testTime},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			store := getDatastore(t)
+			proc := newProcessor(Config{BatchWindow: tc.Window}, store)
+
+			for _, scans := range tc.GiveScans {
+				if err := proc.Add(scans...); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// nothing reaches the datastore within the window
+			scans, err := store.GetAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(scans) != 0 {
+				t.Fatalf("Scans reached the datastore within the window: %v", scans)
+			}
+
+			remaining, err := proc.ScansRemaining()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if remaining != tc.Batched {
+				t.Errorf("Remaining scans do not match: %d vs %d", remaining, tc.Batched)
+			}
+
+			if err := proc.Flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			scans, err = store.GetAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sort.Slice(scans, func(i, j int) bool {
+				return scans[i].Folder < scans[j].Folder
+			})
+
+			// the IDs are random, but must be assigned
+			for i := range scans {
+				if scans[i].ID == "" {
+					t.Errorf("Scan without ID: %v", scans[i].Folder)
+				}
+
+				scans[i].ID = ""
+			}
+
+			if !reflect.DeepEqual(scans, tc.WantScans) {
+				t.Log(scans)
+				t.Log(tc.WantScans)
+				t.Errorf("Scans do not match")
+			}
+		})
+	}
+}
+
+func TestBatchWindowElapses(t *testing.T) {
+	store := getDatastore(t)
+	proc := newProcessor(Config{BatchWindow: 10 * time.Millisecond}, store)
+
+	if err := proc.Add(autoscan.Scan{Folder: "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	scans, err := store.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(scans) != 1 {
+		t.Errorf("Batch was not flushed after the window elapsed: %v", scans)
+	}
+}
+
+func TestBatchFlushFailure(t *testing.T) {
+	fail := errors.New("database is locked")
+	flushed := make(chan []autoscan.Scan, 1)
+	calls := 0
+
+	b := newBatch(10*time.Millisecond, 0, func(scans []autoscan.Scan) error {
+		calls++
+		if calls == 1 {
+			return fail
+		}
+
+		flushed <- scans
+		return nil
+	})
+
+	if err := b.Add(autoscan.Scan{Folder: "1", ID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the failed window is batched again and retried with the next window
+	select {
+	case scans := <-flushed:
+		if len(scans) != 1 || scans[0].ID != "a" {
+			t.Errorf("Flushed scans do not match: %v", scans)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Batch was not flushed again after the failure")
+	}
+
+	// an explicit flush returns the error and keeps the scans
+	b = newBatch(time.Minute, 0, func(scans []autoscan.Scan) error {
+		return fail
+	})
+
+	if err := b.Add(autoscan.Scan{Folder: "2", ID: "b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Flush(); !errors.Is(err, fail) {
+		t.Errorf("Errors do not match: %v vs %v", err, fail)
+	}
+
+	if b.Size() != 1 {
+		t.Errorf("Scans of the failed flush were not batched again: %d", b.Size())
+	}
+}
+
+func TestBatchSize(t *testing.T) {
+	type Test struct {
+		Name      string
+		Size      int
+		GiveScans []autoscan.Scan
+		WantStore int
+	}
+
+	var testCases = []Test{
+		{
+			Name: "Flushes early once the batch holds the size",
+			Size: 2,
+			GiveScans: []autoscan.Scan{
+				{Folder: "/tv/Westworld/Season 1"},
+				{Folder: "/tv/Westworld/Season 1"},
+				{Folder: "/tv/Westworld/Season 2"},
+			},
+			WantStore: 2,
+		},
+		{
+			Name: "Collapsed scans do not fill the batch",
+			Size: 2,
+			GiveScans: []autoscan.Scan{
+				{Folder: "/tv/Westworld/Season 1"},
+				{Folder: "/tv/Westworld/Season 1/"},
+				{Folder: "/tv/Westworld/Season 1"},
+			},
+		},
+		{
+			Name: "Waits for the window without a size",
+			GiveScans: []autoscan.Scan{
+				{Folder: "/tv/Westworld/Season 1"},
+				{Folder: "/tv/Westworld/Season 2"},
+				{Folder: "/tv/Westworld/Season 3"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			store := getDatastore(t)
+			proc := newProcessor(Config{BatchWindow: time.Minute, BatchSize: tc.Size}, store)
+
+			for _, scan := range tc.GiveScans {
+				if err := proc.Add(scan); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			scans, err := store.GetAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(scans) != tc.WantStore {
+				t.Errorf("Flushed scans do not match: %d vs %d", len(scans), tc.WantStore)
+			}
+
+			// the timer flushes the scans which did not fill the batch
+			if tc.WantStore == 0 && proc.batch.Size() == 0 {
+				t.Errorf("Batch was flushed before the window elapsed")
+			}
+		})
+	}
+}
+
+type readyTarget struct {
+	readyPath string
+	scans     []autoscan.Scan
+}
+
+func (t *readyTarget) Scan(ctx context.Context, scan autoscan.Scan) error {
+	if err := autoscan.CheckReadyPath(t.readyPath); err != nil {
+		return err
+	}
+
+	t.scans = append(t.scans, scan)
+	return nil
+}
+
+func (t *readyTarget) Available() error {
+	return nil
+}
+
+// refreshTarget reports the refresh of every folder, precise by default.
+type refreshTarget struct {
+	refresh map[string]string
+}
+
+func (t *refreshTarget) Scan(ctx context.Context, scan autoscan.Scan) error {
+	refresh, ok := t.refresh[scan.Folder]
+	if !ok {
+		refresh = autoscan.RefreshPrecise
+	}
+
+	autoscan.ReportRefresh(ctx, refresh, "")
+	return nil
+}
+
+func (t *refreshTarget) Available() error {
+	return nil
+}
+
+func TestBatchSummary(t *testing.T) {
+	var logs bytes.Buffer
+	logger := log.Logger
+	log.Logger = zerolog.New(&logs)
+	defer func() {
+		log.Logger = logger
+	}()
+
+	current := time.Now()
+	now = func() time.Time {
+		return current
+	}
+	defer func() {
+		now = time.Now
+	}()
+
+	store := getDatastore(t)
+	proc := newProcessor(Config{BatchWindow: time.Minute}, store)
+
+	testTime := current.Add(-1 * time.Second)
+	err := proc.Add(
+		autoscan.Scan{Folder: "/tv/Westworld/Season 1/Episode 1", Time: testTime},
+		autoscan.Scan{Folder: "/tv/Westworld/Season 1/Episode 2", Time: testTime},
+		autoscan.Scan{Folder: "/tv/Westworld/Season 1/Episode 3", Time: testTime},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the episodes are imported again by another trigger within the window
+	err = proc.Add(
+		autoscan.Scan{Folder: "/tv/Westworld/Season 1/Episode 1/", Time: testTime},
+		autoscan.Scan{Folder: "/tv/Westworld/Season 1/Episode 2", Time: testTime},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := proc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	jellyfin := &refreshTarget{refresh: map[string]string{"/tv/Westworld/Season 1/Episode 3": autoscan.RefreshFallback}}
+	plex := &readyTarget{}
+	targets := []autoscan.Target{jellyfin, plex}
+
+	for {
+		err := proc.Process(context.Background(), targets)
+		if errors.Is(err, autoscan.ErrNoScans) {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	type summary struct {
+		Level     string   `json:"level"`
+		Target    string   `json:"target"`
+		Scans     int      `json:"scans"`
+		Collapsed int      `json:"collapsed"`
+		Refreshed int      `json:"refreshed"`
+		Fallbacks int      `json:"fallbacks"`
+		Skipped   int      `json:"skipped"`
+		Failed    int      `json:"failed"`
+		Duration  *float64 `json:"duration"`
+	}
+
+	summaries := make(map[string]summary)
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var entry struct {
+			summary
+			Message string `json:"message"`
+		}
+
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+
+		if entry.Message != "Batch of scans handled by target" {
+			continue
+		}
+
+		if entry.Duration == nil {
+			t.Errorf("Summary of %s has no duration", entry.Target)
+		}
+
+		entry.Duration = nil
+		summaries[entry.Target] = entry.summary
+	}
+
+	want := map[string]summary{
+		targetName(jellyfin): {Level: "info", Target: targetName(jellyfin), Scans: 3, Collapsed: 2, Refreshed: 2, Fallbacks: 1},
+		targetName(plex):     {Level: "info", Target: targetName(plex), Scans: 3, Collapsed: 2, Refreshed: 3},
+	}
+
+	if !reflect.DeepEqual(summaries, want) {
+		t.Errorf("Summaries do not match:\n%+v\nvs\n%+v", summaries, want)
+	}
+
+	if len(proc.summaries.batches) != 0 {
+		t.Errorf("Summary of the batch was not removed: %d", len(proc.summaries.batches))
+	}
+}
+
+func TestProcessReadyPath(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "mount")
+
+	store := getDatastore(t)
+	err := store.Upsert([]autoscan.Scan{{Folder: "1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proc := newProcessor(Config{}, store)
+
+	healthy := &readyTarget{readyPath: dir}
+	down := &readyTarget{readyPath: missing}
+	targets := []autoscan.Target{healthy, down}
+
+	// the healthy target receives the scan, the other target holds it
+	if err := proc.Process(context.Background(), targets); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(healthy.scans) != 1 {
+		t.Errorf("Healthy target did not receive the scan")
+	}
+
+	if len(down.scans) != 0 {
+		t.Errorf("Target without ready path received the scan")
+	}
+
+	remaining, err := store.GetScansRemaining()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if remaining != 0 {
+		t.Errorf("Scan was not removed from the datastore")
+	}
+
+	// the held scan is dispatched once the path is available
+	if err := os.Mkdir(missing, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	err = proc.Process(context.Background(), targets)
+	if !errors.Is(err, autoscan.ErrNoScans) {
+		t.Fatal(err)
+	}
+
+	if len(healthy.scans) != 1 {
+		t.Errorf("Healthy target received the held scan")
+	}
+
+	if len(down.scans) != 1 {
+		t.Errorf("Held scan was not dispatched")
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	t.Run("Backoff never exceeds the ceiling", func(t *testing.T) {
+		ceiling := 2 * time.Minute
+		for attempts := 1; attempts <= 1000; attempts++ {
+			delay := backoff(attempts, defaultRetryBackoff, ceiling)
+			if delay > ceiling {
+				t.Fatalf("Backoff of attempt %d exceeds the ceiling: %v vs %v", attempts, delay, ceiling)
+			}
+
+			// the jitter keeps at least half of the delay
+			if attempts > 4 && delay < ceiling/2 {
+				t.Fatalf("Backoff of attempt %d is below half the ceiling: %v", attempts, delay)
+			}
+
+			if attempts == 1 && delay > defaultRetryBackoff {
+				t.Fatalf("Backoff of the first attempt exceeds the initial delay: %v", delay)
+			}
+		}
+	})
+
+	t.Run("Retries of a target wait for the backoff", func(t *testing.T) {
+		current := time.Now()
+		now = func() time.Time {
+			return current
+		}
+		defer func() {
+			now = time.Now
+		}()
+
+		dir := t.TempDir()
+		missing := filepath.Join(dir, "mount")
+
+		store := getDatastore(t)
+		if err := store.Upsert([]autoscan.Scan{{Folder: "1", Time: current.Add(-1 * time.Second)}}); err != nil {
+			t.Fatal(err)
+		}
+
+		proc := newProcessor(Config{MaxRetryBackoff: time.Minute}, store)
+		down := &readyTarget{readyPath: missing}
+		targets := []autoscan.Target{down}
+
+		// the scan is held, and its first retry fails
+		for i := 0; i < 2; i++ {
+			err := proc.Process(context.Background(), targets)
+			if err != nil && !errors.Is(err, autoscan.ErrNoScans) {
+				t.Fatal(err)
+			}
+		}
+
+		if err := os.Mkdir(missing, 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := proc.Process(context.Background(), targets); !errors.Is(err, autoscan.ErrNoScans) {
+			t.Fatal(err)
+		}
+
+		if len(down.scans) != 0 {
+			t.Errorf("Held scan was retried within the backoff")
+		}
+
+		current = current.Add(time.Minute)
+		if err := proc.Process(context.Background(), targets); !errors.Is(err, autoscan.ErrNoScans) {
+			t.Fatal(err)
+		}
+
+		if len(down.scans) != 1 {
+			t.Errorf("Held scan was not retried after the backoff")
+		}
+	})
+}
+
+// policyTarget is a readyTarget with a retry policy of its own.
+type policyTarget struct {
+	readyTarget
+	policy autoscan.RetryPolicy
+}
+
+func (t *policyTarget) RetryPolicy() autoscan.RetryPolicy {
+	return t.policy
+}
+
+func TestRetryPolicy(t *testing.T) {
+	current := time.Now()
+	now = func() time.Time {
+		return current
+	}
+	defer func() {
+		now = time.Now
+	}()
+
+	missing := filepath.Join(t.TempDir(), "mount")
+
+	store := getDatastore(t)
+	if err := store.Upsert([]autoscan.Scan{{Folder: "1", Time: current.Add(-1 * time.Second)}}); err != nil {
+		t.Fatal(err)
+	}
+
+	proc := newProcessor(Config{MaxRetries: 5, MaxRetryBackoff: time.Minute}, store)
+	global := &readyTarget{readyPath: missing}
+	own := &policyTarget{
+		readyTarget: readyTarget{readyPath: missing},
+		policy:      autoscan.RetryPolicy{MaxRetries: 2, Backoff: time.Second, MaxBackoff: 2 * time.Second},
+	}
+	targets := []autoscan.Target{global, own}
+
+	// the scan is held, and its first retry fails
+	for i := 0; i < 2; i++ {
+		err := proc.Process(context.Background(), targets)
+		if err != nil && !errors.Is(err, autoscan.ErrNoScans) {
+			t.Fatal(err)
+		}
+	}
+
+	if delay := proc.retries.targets[targetName(own)].next.Sub(current); delay > 2*time.Second {
+		t.Errorf("Backoff of the target policy exceeds its maximum: %v", delay)
+	}
+
+	if delay := proc.retries.targets[targetName(global)].next.Sub(current); delay < defaultRetryBackoff/2 {
+		t.Errorf("Backoff of the global policy is below half its initial delay: %v", delay)
+	}
+
+	// the second retry fails, which exhausts the retries of the target policy only
+	current = current.Add(time.Minute)
+	if err := proc.Process(context.Background(), targets); !errors.Is(err, autoscan.ErrNoScans) {
+		t.Fatal(err)
+	}
+
+	if _, ok := proc.held[own]["1"]; ok {
+		t.Errorf("Scan was not dropped after the retries of the target policy")
+	}
+
+	if held, ok := proc.held[global]["1"]; !ok || held.retries != 2 {
+		t.Errorf("Scan held for the global policy does not match: %+v", held)
+	}
+}
+
+// probeTarget fails its availability checks with the errors in order, and succeeds afterwards.
+type probeTarget struct {
+	readyTarget
+	errs []error
+}
+
+func (t *probeTarget) Available() error {
+	if len(t.errs) == 0 {
+		return nil
+	}
+
+	err := t.errs[0]
+	t.errs = t.errs[1:]
+	return err
+}
+
+func TestAvailabilityGrace(t *testing.T) {
+	errProbe := fmt.Errorf("connection refused: %w", autoscan.ErrTargetUnavailable)
+
+	type Test struct {
+		Name        string
+		Failures    int
+		Grace       time.Duration
+		Probes      []error
+		Interval    time.Duration
+		WantErrs    []bool
+		Unavailable bool
+	}
+
+	var testCases = []Test{
+		{
+			Name:        "A single failed check makes the target unavailable by default",
+			Probes:      []error{errProbe},
+			WantErrs:    []bool{true},
+			Unavailable: true,
+		},
+		{
+			Name:     "Intermittent failures below the threshold keep the target available",
+			Failures: 3,
+			Probes:   []error{errProbe, errProbe, nil, errProbe, errProbe, nil},
+			WantErrs: []bool{false, false, false, false, false, false},
+		},
+		{
+			Name:        "Consecutive failures reaching the threshold make the target unavailable",
+			Failures:    3,
+			Probes:      []error{errProbe, nil, errProbe, errProbe, errProbe},
+			WantErrs:    []bool{false, false, false, false, true},
+			Unavailable: true,
+		},
+		{
+			Name:     "Failures within the grace keep the target available",
+			Grace:    time.Minute,
+			Probes:   []error{errProbe, errProbe, errProbe},
+			Interval: 20 * time.Second,
+			WantErrs: []bool{false, false, false},
+		},
+		{
+			Name:        "Failures beyond the grace make the target unavailable",
+			Grace:       time.Minute,
+			Probes:      []error{errProbe, errProbe, errProbe, errProbe},
+			Interval:    20 * time.Second,
+			WantErrs:    []bool{false, false, false, true},
+			Unavailable: true,
+		},
+		{
+			Name:        "Fatal errors are returned right away",
+			Failures:    3,
+			Probes:      []error{fmt.Errorf("invalid token: %w", autoscan.ErrFatal)},
+			WantErrs:    []bool{true},
+			Unavailable: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			current := time.Now()
+			now = func() time.Time {
+				return current
+			}
+			defer func() {
+				now = time.Now
+			}()
+
+			proc := newProcessor(Config{AvailabilityFailures: tc.Failures, AvailabilityGrace: tc.Grace}, getDatastore(t))
+			target := &probeTarget{errs: tc.Probes}
+			targets := []autoscan.Target{target}
+
+			for i, wantErr := range tc.WantErrs {
+				err := proc.CheckAvailability(targets)
+				if (err != nil) != wantErr {
+					t.Errorf("Check %d does not match: %v vs %v", i, err, wantErr)
+				}
+
+				current = current.Add(tc.Interval)
+			}
+
+			health := proc.Health()
+			if len(health) != 1 || health[0].Unavailable != tc.Unavailable {
+				t.Errorf("Health does not match: %+v vs %v", health, tc.Unavailable)
+			}
+		})
+	}
+}
+
+func TestFlushHeldScans(t *testing.T) {
+	store := getDatastore(t)
+	proc := newProcessor(Config{}, store)
+
+	down := &readyTarget{readyPath: filepath.Join(t.TempDir(), "mount")}
+	proc.hold(down, autoscan.Scan{Folder: "1"}, autoscan.ErrTargetNotReady)
+
+	if err := proc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	scans, err := store.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(scans) != 1 {
+		t.Errorf("Held scan was not moved to the datastore: %v", scans)
+	}
+}
+
+func TestLibraryMinimumAge(t *testing.T) {
+	type Test struct {
+		Name      string
+		Libraries []Library
+		GiveScans []autoscan.Scan
+		WantErr   error
+		WantScan  autoscan.Scan
+	}
+
+	testTime := time.Now().UTC()
+
+	var testCases = []Test{
+		{
+			Name: "Library minimum age wins over the global default",
+			Libraries: []Library{
+				{Path: "/mnt/unionfs/Media/Movies/", MinimumAge: 30 * time.Minute},
+			},
+			GiveScans: []autoscan.Scan{
+				{Folder: "/mnt/unionfs/Media/Movies/Interstellar (2014)", Priority: 5, Time: testTime.Add(-20 * time.Minute)},
+				{Folder: "/mnt/unionfs/Media/TV/Westworld/Season 1", Priority: 1, Time: testTime.Add(-15 * time.Minute)},
+			},
+			WantScan: autoscan.Scan{
+				Folder: "/mnt/unionfs/Media/TV/Westworld/Season 1", Priority: 1, Time: testTime.Add(-15 * time.Minute),
+			},
+		},
+		{
+			Name: "Library minimum age can be lower than the global default",
+			Libraries: []Library{
+				{Path: "/mnt/unionfs/Media/TV", MinimumAge: time.Minute},
+			},
+			GiveScans: []autoscan.Scan{
+				{Folder: "/mnt/unionfs/Media/TV/Westworld/Season 1", Time: testTime.Add(-2 * time.Minute)},
+			},
+			WantScan: autoscan.Scan{
+				Folder: "/mnt/unionfs/Media/TV/Westworld/Season 1", Time: testTime.Add(-2 * time.Minute),
+			},
+		},
+		{
+			Name: "Most specific library is used",
+			Libraries: []Library{
+				{Path: "/mnt/unionfs/Media/", MinimumAge: time.Minute},
+				{Path: "/mnt/unionfs/Media/Movies/", MinimumAge: 30 * time.Minute},
+			},
+			GiveScans: []autoscan.Scan{
+				{Folder: "/mnt/unionfs/Media/Movies/Interstellar (2014)", Time: testTime.Add(-20 * time.Minute)},
+			},
+			WantErr: autoscan.ErrNoScans,
+		},
+		{
+			Name: "Library path must match a whole directory",
+			Libraries: []Library{
+				{Path: "/mnt/unionfs/Media/Movies", MinimumAge: 30 * time.Minute},
+			},
+			GiveScans: []autoscan.Scan{
+				{Folder: "/mnt/unionfs/Media/Movies 4K/Interstellar (2014)", Time: testTime.Add(-20 * time.Minute)},
+			},
+			WantScan: autoscan.Scan{
+				Folder: "/mnt/unionfs/Media/Movies 4K/Interstellar (2014)", Time: testTime.Add(-20 * time.Minute),
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			store := getDatastore(t)
+			err := store.Upsert(tc.GiveScans)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			now = func() time.Time {
+				return testTime
+			}
+			defer func() {
+				now = time.Now
+			}()
+
+			proc := newProcessor(Config{
+				MinimumAge: 10 * time.Minute,
+				Libraries:  tc.Libraries,
+			}, store)
+
+			scan, err := proc.getAvailableScan()
+			if !errors.Is(err, tc.WantErr) {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(scan, tc.WantScan) {
+				t.Log(scan)
+				t.Log(tc.WantScan)
+				t.Errorf("Scan does not match")
+			}
+		})
+	}
+}
+
+func TestTriggerPriority(t *testing.T) {
+	store := getDatastore(t)
+	proc := newProcessor(Config{}, store)
+
+	now = func() time.Time {
+		return time.Now().Add(time.Minute)
+	}
+	defer func() {
+		now = time.Now
+	}()
+
+	bulk, err := webhook.New(webhook.Config{Name: "bulk", Priority: 1, Path: "{{ .folder }}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	urgent, err := manual.New(manual.Config{Priority: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the low priority trigger sends its scan first
+	rec := httptest.NewRecorder()
+	bulk(proc.Add).ServeHTTP(rec, httptest.NewRequest("POST", "/triggers/bulk",
+		strings.NewReader(`{"folder": "/mnt/unionfs/Media/Movies/Parasite (2019)"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Bulk trigger responded with %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	query := url.Values{"dir": []string{"/mnt/unionfs/Media/Movies/Interstellar (2014)"}}
+	urgent(proc.Add).ServeHTTP(rec, httptest.NewRequest("POST", "/triggers/manual?"+query.Encode(), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Manual trigger responded with %d", rec.Code)
+	}
+
+	target := &readyTarget{}
+	for i := 0; i < 2; i++ {
+		if err := proc.Process(context.Background(), []autoscan.Target{target}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var folders []string
+	for _, scan := range target.scans {
+		folders = append(folders, scan.Folder)
+	}
+
+	want := []string{
+		"/mnt/unionfs/Media/Movies/Interstellar (2014)",
+		"/mnt/unionfs/Media/Movies/Parasite (2019)",
+	}
+
+	if !reflect.DeepEqual(want, folders) {
+		t.Logf("want: %v", want)
+		t.Logf("got:  %v", folders)
+		t.Errorf("Scans were not dispatched by trigger priority")
+	}
+}
+
+func TestPendingScans(t *testing.T) {
+	type Test struct {
+		Name    string
+		Anchors []string
+		Want    []string
+	}
+
+	var testCases = []Test{
+		{
+			Name: "Describes why scans are waiting",
+			Want: []string{waitingTarget, "", waitingMinimumAge, waitingBatch},
+		},
+		{
+			Name:    "Eligible scans wait for the anchor files",
+			Anchors: []string{filepath.Join(t.TempDir(), "anchor")},
+			Want:    []string{waitingTarget, waitingAnchors, waitingMinimumAge, waitingBatch},
+		},
+	}
+
+	testTime := time.Now().UTC()
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			now = func() time.Time {
+				return testTime
+			}
+			defer func() {
+				now = time.Now
+			}()
+
+			store := getDatastore(t)
+			err := store.Upsert([]autoscan.Scan{
+				{Folder: "/mnt/unionfs/Media/Movies/Parasite (2019)", Time: testTime.Add(-20 * time.Minute)},
+				{Folder: "/mnt/unionfs/Media/Movies/Tenet (2020)", Time: testTime.Add(-5 * time.Minute)},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			proc := newProcessor(Config{
+				Anchors:     tc.Anchors,
+				MinimumAge:  10 * time.Minute,
+				BatchWindow: time.Hour,
+			}, store)
+
+			down := &readyTarget{readyPath: filepath.Join(t.TempDir(), "mount")}
+			proc.hold(down, autoscan.Scan{Folder: "/mnt/unionfs/Media/Movies/Up (2009)", Time: testTime.Add(-30 * time.Minute)}, autoscan.ErrTargetNotReady)
+
+			if err := proc.Add(autoscan.Scan{Folder: "/mnt/unionfs/Media/Movies/Joker (2019)", Time: testTime}); err != nil {
+				t.Fatal(err)
+			}
+
+			pending, err := proc.Pending()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			waiting := make([]string, 0, len(pending))
+			for _, scan := range pending {
+				waiting = append(waiting, scan.Waiting)
+
+				if want := scan.Time.Add(10 * time.Minute); !scan.Eligible.Equal(want) {
+					t.Errorf("Eligible times do not match for %s: %v vs %v", scan.Folder, scan.Eligible, want)
+				}
+			}
+
+			if !reflect.DeepEqual(waiting, tc.Want) {
+				t.Errorf("Waiting reasons do not match: %q vs %q", waiting, tc.Want)
+			}
+
+			if pending[0].Target != "*processor.readyTarget" {
+				t.Errorf("Held scan does not name its target: %q", pending[0].Target)
+			}
+		})
+	}
+}
+
+type slowTarget struct {
+	timeout   time.Duration
+	slow      bool
+	cancelled int
+	scans     []autoscan.Scan
+}
+
+func (t *slowTarget) Scan(ctx context.Context, scan autoscan.Scan) error {
+	if t.slow {
+		<-ctx.Done()
+		t.cancelled++
+		return ctx.Err()
+	}
+
+	t.scans = append(t.scans, scan)
+	return nil
+}
+
+func (t *slowTarget) Available() error {
+	return nil
+}
+
+func (t *slowTarget) ScanTimeout() time.Duration {
+	return t.timeout
+}
+
+func TestTargetScanTimeout(t *testing.T) {
+	store := getDatastore(t)
+	err := store.Upsert([]autoscan.Scan{{Folder: "1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proc := newProcessor(Config{}, store)
+
+	healthy := &readyTarget{}
+	slow := &slowTarget{timeout: 10 * time.Millisecond, slow: true}
+	targets := []autoscan.Target{healthy, slow}
+
+	// the slow target is cancelled and requeues the scan, the other target receives it
+	if err := proc.Process(context.Background(), targets); err != nil {
+		t.Fatal(err)
+	}
+
+	if slow.cancelled != 1 {
+		t.Errorf("Slow scan was not cancelled")
+	}
+
+	if len(healthy.scans) != 1 {
+		t.Errorf("Healthy target did not receive the scan")
+	}
+
+	pending, err := proc.Pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pending) != 1 || pending[0].Waiting != waitingTimeout {
+		t.Fatalf("Scan was not requeued for the slow target: %+v", pending)
+	}
+
+	// the requeued scan is retried for the slow target only
+	slow.slow = false
+
+	err = proc.Process(context.Background(), targets)
+	if !errors.Is(err, autoscan.ErrNoScans) {
+		t.Fatal(err)
+	}
+
+	if len(healthy.scans) != 1 {
+		t.Errorf("Healthy target received the requeued scan")
+	}
+
+	if len(slow.scans) != 1 {
+		t.Errorf("Requeued scan was not retried")
+	}
+}
+
+type refusingTarget struct {
+	refused int
+}
+
+func (t *refusingTarget) Scan(ctx context.Context, scan autoscan.Scan) error {
+	t.refused++
+	return fmt.Errorf("%s: %w", scan.Folder, autoscan.ErrScanRefused)
+}
+
+func (t *refusingTarget) Available() error {
+	return nil
+}
+
+func TestRefusedScan(t *testing.T) {
+	store := getDatastore(t)
+	err := store.Upsert([]autoscan.Scan{{Folder: "1"}, {Folder: "2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proc := newProcessor(Config{}, store)
+
+	healthy := &readyTarget{}
+	refusing := &refusingTarget{}
+	targets := []autoscan.Target{healthy, refusing}
+	before := scansRefused.Value(targetName(refusing))
+
+	// the refused scans are dropped, the other target receives all of them
+	for i := 0; i < 2; i++ {
+		if err := proc.Process(context.Background(), targets); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = proc.Process(context.Background(), targets)
+	if !errors.Is(err, autoscan.ErrNoScans) {
+		t.Fatal(err)
+	}
+
+	if len(healthy.scans) != 2 {
+		t.Errorf("Healthy target did not receive all scans: %d vs %d", len(healthy.scans), 2)
+	}
+
+	if refusing.refused != 2 {
+		t.Errorf("Refused scans were retried: %d vs %d", refusing.refused, 2)
+	}
+
+	remaining, err := store.GetScansRemaining()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if remaining != 0 {
+		t.Errorf("Refused scans were not removed from the datastore")
+	}
+
+	pending, err := proc.Pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pending) != 0 {
+		t.Errorf("Refused scans were held: %+v", pending)
+	}
+
+	if got := scansRefused.Value(targetName(refusing)) - before; got != 2 {
+		t.Errorf("Refused scans do not match: %d vs %d", got, 2)
+	}
+}
+
+type settleTarget struct {
+	readyTarget
+	delay time.Duration
+}
+
+func (t *settleTarget) SettleDelay() time.Duration {
+	return t.delay
+}
+
+func TestSettleDelay(t *testing.T) {
+	store := getDatastore(t)
+	proc := newProcessor(Config{MinimumAge: time.Minute}, store)
+
+	eligible := time.Now()
+	err := store.Upsert([]autoscan.Scan{{Folder: "1", Time: eligible.Add(-1 * time.Minute)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	immediate := &readyTarget{}
+	settling := &settleTarget{delay: 5 * time.Minute}
+	targets := []autoscan.Target{immediate, settling}
+
+	testCases := []struct {
+		Name      string
+		Now       time.Time
+		Immediate int
+		Settling  int
+		Waiting   string
+	}{
+		{
+			Name:      "Eligible scan is held for the settle delay",
+			Now:       eligible.Add(time.Second),
+			Immediate: 1,
+			Settling:  0,
+			Waiting:   waitingSettle,
+		},
+		{
+			Name:      "Scan is held within the settle delay",
+			Now:       eligible.Add(4 * time.Minute),
+			Immediate: 1,
+			Settling:  0,
+			Waiting:   waitingSettle,
+		},
+		{
+			Name:      "Scan is sent after the settle delay",
+			Now:       eligible.Add(5 * time.Minute),
+			Immediate: 1,
+			Settling:  1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			now = func() time.Time {
+				return tc.Now
+			}
+			defer func() {
+				now = time.Now
+			}()
+
+			err := proc.Process(context.Background(), targets)
+			if err != nil && !errors.Is(err, autoscan.ErrNoScans) {
+				t.Fatal(err)
+			}
+
+			if len(immediate.scans) != tc.Immediate {
+				t.Errorf("Scans sent without settle delay do not match: %d vs %d", len(immediate.scans), tc.Immediate)
+			}
+
+			if len(settling.scans) != tc.Settling {
+				t.Errorf("Scans sent after settle delay do not match: %d vs %d", len(settling.scans), tc.Settling)
+			}
+
+			pending, err := proc.Pending()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			waiting := ""
+			if len(pending) > 0 {
+				waiting = pending[0].Waiting
+			}
+
+			if waiting != tc.Waiting {
+				t.Errorf("Waiting reasons do not match: %q vs %q", waiting, tc.Waiting)
+			}
+		})
+	}
+}
+
+func TestFastPaths(t *testing.T) {
+	current := time.Now()
+	now = func() time.Time {
+		return current
+	}
+	defer func() {
+		now = time.Now
+	}()
+
+	store := getDatastore(t)
+	proc := newProcessor(Config{
+		MinimumAge: 10 * time.Minute,
+		Anchors:    []string{filepath.Join(t.TempDir(), "missing.anchor")},
+		FastPaths:  []string{"/mnt/unionfs/Media/Music/"},
+	}, store)
+
+	err := store.Upsert([]autoscan.Scan{
+		{Folder: "/mnt/unionfs/Media/Movies/Interstellar (2014)", Priority: 5, Time: current.Add(-20 * time.Minute)},
+		{Folder: "/mnt/unionfs/Media/Music/Daft Punk", Time: current.Add(-1 * time.Second)},
+		{Folder: "/mnt/unionfs/Media/Music 4K/Daft Punk", Time: current.Add(-1 * time.Second)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	immediate := &readyTarget{}
+	settling := &settleTarget{delay: 5 * time.Minute}
+	targets := []autoscan.Target{immediate, settling}
+
+	if err := proc.Process(context.Background(), targets); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"/mnt/unionfs/Media/Music/Daft Punk"}
+	for name, target := range map[string]*readyTarget{"immediate": immediate, "settling": &settling.readyTarget} {
+		folders := make([]string, 0)
+		for _, scan := range target.scans {
+			folders = append(folders, scan.Folder)
+		}
+
+		if !reflect.DeepEqual(folders, want) {
+			t.Errorf("Scans of the %s target do not match: %v vs %v", name, folders, want)
+		}
+	}
+
+	// scans outside the fast paths still wait for the anchors and the minimum age
+	if err := proc.Process(context.Background(), targets); !errors.Is(err, autoscan.ErrAnchorUnavailable) {
+		t.Errorf("Scan outside the fast paths was not held for the anchors: %v", err)
+	}
+
+	scans, err := store.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(scans) != 2 {
+		t.Errorf("Scans outside the fast paths were removed: %v", scans)
+	}
+}
+
+func TestRemovedPropagation(t *testing.T) {
+	store := getDatastore(t)
+	proc := newProcessor(Config{}, store)
+
+	now = func() time.Time {
+		return time.Now().Add(time.Minute)
+	}
+	defer func() {
+		now = time.Now
+	}()
+
+	trigger, err := sonarr.New(sonarr.Config{Name: "sonarr"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := []string{
+		`{"eventType": "Download", "episodeFile": {"relativePath": "Season 1/Westworld.S01E01.mkv"}, "series": {"path": "/TV/Westworld"}}`,
+		`{"eventType": "SeriesDelete", "series": {"path": "/TV/Chernobyl"}}`,
+	}
+
+	for _, event := range events {
+		rec := httptest.NewRecorder()
+		trigger(proc.Add).ServeHTTP(rec, httptest.NewRequest("POST", "/triggers/sonarr", strings.NewReader(event)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Sonarr trigger responded with %d", rec.Code)
+		}
+	}
+
+	target := &readyTarget{}
+	for range events {
+		if err := proc.Process(context.Background(), []autoscan.Target{target}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed := make(map[string]bool)
+	for _, scan := range target.scans {
+		removed[scan.Folder] = scan.Removed
+	}
+
+	want := map[string]bool{
+		"/TV/Westworld/Season 1": false,
+		"/TV/Chernobyl":          true,
+	}
+
+	if !reflect.DeepEqual(want, removed) {
+		t.Errorf("Removed flags do not match: %v vs %v", removed, want)
+	}
+}
+
+func TestDedupWindow(t *testing.T) {
+	current := time.Now()
+	now = func() time.Time {
+		return current
+	}
+	defer func() {
+		now = time.Now
+	}()
+
+	file := filepath.Join(t.TempDir(), "autoscan.db")
+	target := &readyTarget{}
+
+	// start opens the datastore like autoscan does on startup
+	start := func() (*Processor, *sql.DB) {
+		db, err := sql.Open("sqlite", file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.SetMaxOpenConns(1)
+
+		mg, err := migrate.New(db, "migrations")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		store, err := newDatastore(db, mg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return newProcessor(Config{DedupWindow: time.Hour}, store), db
+	}
+
+	process := func(proc *Processor, scan autoscan.Scan) {
+		scan.Time = current.Add(-1 * time.Second)
+		if err := proc.store.Upsert([]autoscan.Scan{scan}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := proc.Process(context.Background(), []autoscan.Target{target}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	proc, db := start()
+	process(proc, autoscan.Scan{Folder: "/data/Movies/Parasite (2019)"})
+	db.Close()
+
+	// the webhook is replayed after a restart
+	proc, db = start()
+	defer db.Close()
+
+	process(proc, autoscan.Scan{Folder: "/data/Movies/Parasite (2019)"})
+	if len(target.scans) != 1 {
+		t.Errorf("Duplicate scan was sent after the restart: %d", len(target.scans))
+	}
+
+	remaining, err := proc.ScansRemaining()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if remaining != 0 {
+		t.Errorf("Duplicate scan was not dropped: %d remaining", remaining)
+	}
+
+	// a removal of the folder is not a duplicate
+	process(proc, autoscan.Scan{Folder: "/data/Movies/Parasite (2019)", Removed: true})
+	if len(target.scans) != 2 {
+		t.Errorf("Removal was skipped as a duplicate: %d", len(target.scans))
+	}
+
+	// outside of the window the folder is sent again
+	current = current.Add(2 * time.Hour)
+	process(proc, autoscan.Scan{Folder: "/data/Movies/Parasite (2019)", Removed: true})
+	if len(target.scans) != 3 {
+		t.Errorf("Scan outside of the dedup window was skipped: %d", len(target.scans))
+	}
+}
+
+type reportingTarget struct{}
+
+func (t reportingTarget) Scan(ctx context.Context, scan autoscan.Scan) error {
+	autoscan.ReportRefresh(ctx, autoscan.RefreshPrecise, "parasite")
+	return nil
+}
+
+func (t reportingTarget) Available() error {
+	return nil
+}
+
+func (t reportingTarget) String() string {
+	return "jellyfin"
+}
+
+type outcomeHook struct {
+	lock     sync.Mutex
+	outcomes []autoscan.Outcome
+}
+
+func (h *outcomeHook) Outcome(o autoscan.Outcome) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.outcomes = append(h.outcomes, o)
+}
+
+func TestScansDeduplicated(t *testing.T) {
+	store := getDatastore(t)
+	proc := newProcessor(Config{BatchWindow: time.Minute, DedupWindow: time.Hour}, store)
+
+	target := &readyTarget{}
+	name := targetName(target)
+	queued, sent := scansDeduplicated.Value(""), scansDeduplicated.Value(name)
+
+	testTime := time.Now().Add(-1 * time.Second)
+	add := func(scans ...autoscan.Scan) {
+		t.Helper()
+		if err := proc.Add(scans...); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := proc.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// collapsed within the batch window
+	add(
+		autoscan.Scan{Folder: "/tv/Westworld/Season 1", Time: testTime},
+		autoscan.Scan{Folder: "/tv/Westworld/Season 1", Time: testTime},
+		autoscan.Scan{Folder: "/tv/Westworld/Season 2", Time: testTime},
+	)
+
+	// collapsed with the scan waiting in the datastore
+	add(autoscan.Scan{Folder: "/tv/Westworld/Season 2", Time: testTime})
+
+	if got := scansDeduplicated.Value("") - queued; got != 2 {
+		t.Errorf("Scans deduplicated before the targets do not match: %d vs %d", got, 2)
+	}
+
+	for {
+		err := proc.Process(context.Background(), []autoscan.Target{target})
+		if errors.Is(err, autoscan.ErrNoScans) {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// skipped within the dedup window of the target
+	add(autoscan.Scan{Folder: "/tv/Westworld/Season 1", Time: testTime})
+	if err := proc.Process(context.Background(), []autoscan.Target{target}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := scansDeduplicated.Value(name) - sent; got != 1 {
+		t.Errorf("Scans deduplicated by the target do not match: %d vs %d", got, 1)
+	}
+
+	if len(target.scans) != 2 {
+		t.Errorf("Scans sent to the target do not match: %d vs %d", len(target.scans), 2)
+	}
+}
+
+func TestOutcomeHooks(t *testing.T) {
+	now = func() time.Time {
+		return time.Now().Add(time.Minute)
+	}
+	defer func() {
+		now = time.Now
+	}()
+
+	hook := &outcomeHook{}
+	proc := newProcessor(Config{Hooks: []autoscan.OutcomeHook{hook, OutcomeMetrics{}}}, getDatastore(t))
+	succeeded := scanOutcomes.Value(autoscan.OutcomeSucceeded, "jellyfin", autoscan.RefreshPrecise)
+
+	if err := proc.Add(autoscan.Scan{Folder: "/data/Movies/Parasite (2019)"}); err != nil {
+		t.Fatal(err)
+	}
+
+	down := &readyTarget{readyPath: filepath.Join(t.TempDir(), "mount")}
+	if err := proc.Process(context.Background(), []autoscan.Target{reportingTarget{}, down}); err != nil {
+		t.Fatal(err)
+	}
+
+	stages := make(map[string][]string)
+	for _, o := range hook.outcomes {
+		if o.Scan.Folder != "/data/Movies/Parasite (2019)" {
+			t.Errorf("Outcome of an unknown scan: %v", o.Scan)
+		}
+
+		stages[o.Target] = append(stages[o.Target], o.Stage)
+
+		switch {
+		case o.Target == "jellyfin" && o.Stage == autoscan.OutcomeSucceeded:
+			if o.Refresh != autoscan.RefreshPrecise || o.ItemID != "parasite" || o.Err != nil {
+				t.Errorf("Succeeded outcome does not match: %+v", o)
+			}
+		case o.Stage == autoscan.OutcomeFailed:
+			if !errors.Is(o.Err, autoscan.ErrTargetNotReady) {
+				t.Errorf("Failed outcome without the error: %+v", o)
+			}
+		}
+	}
+
+	want := map[string][]string{
+		"":               {autoscan.OutcomeEnqueued},
+		"jellyfin":       {autoscan.OutcomeDispatched, autoscan.OutcomeSucceeded},
+		targetName(down): {autoscan.OutcomeDispatched, autoscan.OutcomeFailed},
+	}
+
+	if !reflect.DeepEqual(stages, want) {
+		t.Errorf("Outcomes do not match: %v vs %v", stages, want)
+	}
+
+	if got := scanOutcomes.Value(autoscan.OutcomeSucceeded, "jellyfin", autoscan.RefreshPrecise) - succeeded; got != 1 {
+		t.Errorf("Counted outcomes do not match: %d vs %d", got, 1)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	current := time.Now()
+	now = func() time.Time {
+		return current
+	}
+	defer func() {
+		now = time.Now
+	}()
+
+	proc := newProcessor(Config{HistorySize: 2, HistoryMaxAge: time.Hour}, getDatastore(t))
+
+	down := &readyTarget{readyPath: filepath.Join(t.TempDir(), "mount")}
+	targets := []autoscan.Target{reportingTarget{}, down}
+
+	process := func(folders ...string) {
+		t.Helper()
+		for _, folder := range folders {
+			if err := proc.Add(autoscan.Scan{Folder: folder, Time: current.Add(-1 * time.Second)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for {
+			err := proc.Process(context.Background(), targets)
+			if errors.Is(err, autoscan.ErrNoScans) {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	folders := func(entries []HistoryEntry) []string {
+		got := make([]string, 0)
+		for _, e := range entries {
+			got = append(got, e.Folder)
+		}
+		return got
+	}
+
+	process("/data/Movies/Joker (2019)")
+	process("/data/Movies/Parasite (2019)")
+	process("/data/Movies/Interstellar (2014)")
+
+	history, err := proc.History("jellyfin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"/data/Movies/Interstellar (2014)", "/data/Movies/Parasite (2019)"}
+	if got := folders(history); !reflect.DeepEqual(got, want) {
+		t.Errorf("History beyond the size was not pruned: %v vs %v", got, want)
+	}
+
+	if e := history[0]; e.Outcome != autoscan.OutcomeSucceeded || e.Refresh != autoscan.RefreshPrecise || e.ItemID != "parasite" || e.Error != "" {
+		t.Errorf("Succeeded entry does not match: %+v", e)
+	}
+
+	failed, err := proc.History(targetName(down))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(failed) == 0 || failed[0].Outcome != autoscan.OutcomeFailed || failed[0].Error == "" {
+		t.Errorf("Failed entry does not match: %+v", failed)
+	}
+
+	// the entries of all targets beyond the maximum age are pruned
+	current = current.Add(2 * time.Hour)
+	process("/data/Movies/Tenet (2020)")
+
+	all, err := proc.History("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range all {
+		if e.Time.Before(current.Add(-1 * time.Hour)) {
+			t.Errorf("History beyond the maximum age was not pruned: %+v", e)
+		}
+	}
+
+	history, err = proc.History("jellyfin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want = []string{"/data/Movies/Tenet (2020)"}
+	if got := folders(history); !reflect.DeepEqual(got, want) {
+		t.Errorf("History of the target does not match: %v vs %v", got, want)
+	}
+}
+
+type namedTarget struct {
+	readyTarget
+	name string
+}
+
+func (t *namedTarget) String() string {
+	return t.name
+}
+
+func TestPause(t *testing.T) {
+	store := getDatastore(t)
+	proc := newProcessor(Config{}, store)
+
+	plex := &namedTarget{name: "plex"}
+	jellyfin := &namedTarget{name: "jellyfin"}
+	targets := []autoscan.Target{plex, jellyfin}
+
+	if err := proc.Pause("jellyfin"); !errors.Is(err, ErrUnknownTarget) {
+		t.Fatalf("Target without scans was paused: %v", err)
+	}
+
+	proc.health.register(targets)
+	if err := proc.Pause("jellyfin"); err != nil {
+		t.Fatal(err)
+	}
+
+	paused := func() map[string]bool {
+		m := make(map[string]bool)
+		for _, th := range proc.Health() {
+			m[th.Target] = th.Paused
+		}
+
+		return m
+	}
+
+	if want := map[string]bool{"jellyfin": true, "plex": false}; !reflect.DeepEqual(paused(), want) {
+		t.Errorf("Paused targets do not match: %v vs %v", paused(), want)
+	}
+
+	// the paused target holds the scans, the other target receives them
+	for _, folder := range []string{"1", "2"} {
+		if err := store.Upsert([]autoscan.Scan{{Folder: folder}}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := proc.Process(context.Background(), targets); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(plex.scans) != 2 || len(jellyfin.scans) != 0 {
+		t.Fatalf("Scans do not match: %d and %d", len(plex.scans), len(jellyfin.scans))
+	}
+
+	pending, err := proc.Pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pending) != 2 || pending[0].Waiting != waitingPaused || pending[0].Target != "jellyfin" {
+		t.Errorf("Paused scans are not pending: %+v", pending)
+	}
+
+	// the held scans are sent once the target is resumed
+	if err := proc.Resume("jellyfin"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := proc.Process(context.Background(), targets); !errors.Is(err, autoscan.ErrNoScans) {
+		t.Fatal(err)
+	}
+
+	if len(plex.scans) != 2 || len(jellyfin.scans) != 2 {
+		t.Errorf("Held scans were not sent on resume: %d and %d", len(plex.scans), len(jellyfin.scans))
+	}
+
+	if proc.heldSize() != 0 {
+		t.Errorf("Scans are still held after resuming the target")
+	}
+}
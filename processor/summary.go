@@ -0,0 +1,168 @@
+package processor
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/cloudbox/autoscan"
+)
+
+// maxSummaries limits the batches awaiting their summary,
+// a batch of scans which are never handled by a target is dropped eventually.
+const maxSummaries = 32
+
+// summaries logs one summary for every target once it handled all the scans of a batch,
+// the scans themselves are logged at the debug level.
+type summaries struct {
+	lock    sync.Mutex
+	targets []string
+	batches []*batchSummary
+}
+
+// A batchSummary counts how the targets handled the scans of a flushed batch.
+type batchSummary struct {
+	started  time.Time
+	received int
+	folders  map[string]bool
+	targets  map[string]*targetSummary
+}
+
+type targetSummary struct {
+	remaining map[string]bool
+	refreshed int
+	fallbacks int
+	skipped   int
+	failed    int
+}
+
+// register sets the targets receiving the scans.
+func (s *summaries) register(targets []autoscan.Target) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.targets = s.targets[:0]
+	for _, target := range targets {
+		s.targets = append(s.targets, targetName(target))
+	}
+}
+
+// start begins the summary of the flushed scans.
+func (s *summaries) start(received int, started time.Time, scans []autoscan.Scan) {
+	folders := make(map[string]bool, len(scans))
+	for _, scan := range scans {
+		folders[scan.Folder] = true
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(s.batches) == maxSummaries {
+		s.batches = s.batches[1:]
+	}
+
+	s.batches = append(s.batches, &batchSummary{
+		started:  started,
+		received: received,
+		folders:  folders,
+		targets:  make(map[string]*targetSummary),
+	})
+}
+
+// handled counts the outcome of a scan which succeeded or failed.
+// Scans held because the target is not ready are counted once they are retried.
+func (s *summaries) handled(o autoscan.Outcome) {
+	switch {
+	case o.Stage == autoscan.OutcomeSucceeded:
+	case o.Stage == autoscan.OutcomeFailed && !errors.Is(o.Err, autoscan.ErrTargetNotReady):
+	default:
+		return
+	}
+
+	s.count(o.Target, o.Scan, func(ts *targetSummary) {
+		switch {
+		case o.Err != nil:
+			ts.failed++
+		case o.Refresh == autoscan.RefreshFallback:
+			ts.fallbacks++
+		case o.Refresh == autoscan.RefreshSkipped:
+			ts.skipped++
+		default:
+			ts.refreshed++
+		}
+	})
+}
+
+// skipped counts a scan which was not sent to the target.
+func (s *summaries) skipped(target string, scan autoscan.Scan) {
+	s.count(target, scan, func(ts *targetSummary) {
+		ts.skipped++
+	})
+}
+
+// count passes the summary of the oldest batch awaiting the scan for the target to fn,
+// and logs the summary once the target handled all the scans of the batch.
+func (s *summaries) count(target string, scan autoscan.Scan, fn func(*targetSummary)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for i, b := range s.batches {
+		if !b.folders[scan.Folder] {
+			continue
+		}
+
+		ts, ok := b.targets[target]
+		if !ok {
+			ts = &targetSummary{remaining: make(map[string]bool, len(b.folders))}
+			for folder := range b.folders {
+				ts.remaining[folder] = true
+			}
+
+			b.targets[target] = ts
+		}
+
+		if !ts.remaining[scan.Folder] {
+			continue
+		}
+
+		delete(ts.remaining, scan.Folder)
+		fn(ts)
+
+		if len(ts.remaining) == 0 {
+			b.log(target, ts)
+			ts.remaining = nil
+		}
+
+		if b.done(s.targets) {
+			s.batches = append(s.batches[:i], s.batches[i+1:]...)
+		}
+
+		return
+	}
+}
+
+// done reports whether all the targets handled all the scans of the batch.
+func (b *batchSummary) done(targets []string) bool {
+	for _, target := range targets {
+		if ts, ok := b.targets[target]; !ok || ts.remaining != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (b *batchSummary) log(target string, ts *targetSummary) {
+	log.Info().
+		Str("target", target).
+		Int("scans", len(b.folders)).
+		Int("collapsed", b.received-len(b.folders)).
+		Int("refreshed", ts.refreshed).
+		Int("fallbacks", ts.fallbacks).
+		Int("skipped", ts.skipped).
+		Int("failed", ts.failed).
+		Dur("duration", now().Sub(b.started)).
+		Msg("Batch of scans handled by target")
+}
@@ -0,0 +1,112 @@
+package autoscan
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// QuietHours are daily time ranges, such as 22:00-06:00, during which a Target defers its heavy scans.
+// A nil QuietHours is never quiet.
+type QuietHours struct {
+	ranges []quietRange
+	loc    *time.Location
+}
+
+// quietRange starts and ends at minutes since midnight, it wraps around midnight when it ends before it starts.
+type quietRange struct {
+	start int
+	end   int
+}
+
+// NewQuietHours parses the ranges, given as HH:MM-HH:MM, in the timezone, such as Europe/Warsaw.
+// The local timezone is used when the timezone is empty. Without ranges, nil is returned.
+func NewQuietHours(ranges []string, timezone string) (*QuietHours, error) {
+	if len(ranges) == 0 {
+		return nil, nil
+	}
+
+	loc := time.Local
+	if timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(timezone); err != nil {
+			return nil, fmt.Errorf("timezone %q: %w", timezone, err)
+		}
+	}
+
+	q := &QuietHours{loc: loc}
+	for _, r := range ranges {
+		start, end, ok := strings.Cut(r, "-")
+		if !ok {
+			return nil, fmt.Errorf("range %q: expected HH:MM-HH:MM", r)
+		}
+
+		qr := quietRange{}
+		for _, clock := range []struct {
+			value string
+			into  *int
+		}{{start, &qr.start}, {end, &qr.end}} {
+			t, err := time.Parse("15:04", strings.TrimSpace(clock.value))
+			if err != nil {
+				return nil, fmt.Errorf("range %q: expected HH:MM-HH:MM", r)
+			}
+
+			*clock.into = t.Hour()*60 + t.Minute()
+		}
+
+		if qr.start == qr.end {
+			return nil, fmt.Errorf("range %q: starts when it ends", r)
+		}
+
+		q.ranges = append(q.ranges, qr)
+	}
+
+	return q, nil
+}
+
+// Until returns the end of the quiet hours at the given time, or false outside of the quiet hours.
+// Overlapping ranges end with the range ending last.
+func (q *QuietHours) Until(at time.Time) (time.Time, bool) {
+	if q == nil {
+		return time.Time{}, false
+	}
+
+	at = at.In(q.loc)
+	minute := at.Hour()*60 + at.Minute()
+
+	// the end is taken from the wall clock, so it is right on the days the clock changes.
+	endOf := func(days int, r quietRange) time.Time {
+		return time.Date(at.Year(), at.Month(), at.Day()+days, r.end/60, r.end%60, 0, 0, q.loc)
+	}
+
+	var until time.Time
+	for _, r := range q.ranges {
+		var end time.Time
+		switch {
+		case r.start < r.end && minute >= r.start && minute < r.end:
+			end = endOf(0, r)
+		case r.start > r.end && minute >= r.start:
+			end = endOf(1, r)
+		case r.start > r.end && minute < r.end:
+			end = endOf(0, r)
+		default:
+			continue
+		}
+
+		if end.After(until) {
+			until = end
+		}
+	}
+
+	return until, !until.IsZero()
+}
+
+// Check returns ErrTargetNotReady during the quiet hours, so the scan is held until they end.
+func (q *QuietHours) Check(at time.Time) error {
+	until, ok := q.Until(at)
+	if !ok {
+		return nil
+	}
+
+	return fmt.Errorf("quiet hours until %s: %w", until.Format("15:04"), ErrTargetNotReady)
+}
@@ -0,0 +1,121 @@
+package autoscan
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestQuietHours(t *testing.T) {
+	type Test struct {
+		Name     string
+		Ranges   []string
+		Timezone string
+		At       string
+		Until    string
+	}
+
+	var testCases = []Test{
+		{
+			Name:   "Within a range",
+			Ranges: []string{"01:00-05:00"},
+			At:     "2026-03-10T02:30:00Z",
+			Until:  "2026-03-10T05:00:00Z",
+		},
+		{
+			Name:   "Before a range",
+			Ranges: []string{"01:00-05:00"},
+			At:     "2026-03-10T00:59:00Z",
+		},
+		{
+			Name:   "At the end of a range",
+			Ranges: []string{"01:00-05:00"},
+			At:     "2026-03-10T05:00:00Z",
+		},
+		{
+			Name:   "Before midnight of a range wrapping around midnight",
+			Ranges: []string{"22:00-06:00"},
+			At:     "2026-03-10T23:00:00Z",
+			Until:  "2026-03-11T06:00:00Z",
+		},
+		{
+			Name:   "After midnight of a range wrapping around midnight",
+			Ranges: []string{"22:00-06:00"},
+			At:     "2026-03-11T03:00:00Z",
+			Until:  "2026-03-11T06:00:00Z",
+		},
+		{
+			Name:   "Outside of a range wrapping around midnight",
+			Ranges: []string{"22:00-06:00"},
+			At:     "2026-03-11T12:00:00Z",
+		},
+		{
+			Name:   "Overlapping ranges end with the last one",
+			Ranges: []string{"01:00-03:00", "02:00-04:00"},
+			At:     "2026-03-10T02:30:00Z",
+			Until:  "2026-03-10T04:00:00Z",
+		},
+		{
+			Name:     "Ranges are given in the timezone",
+			Ranges:   []string{"22:00-06:00"},
+			Timezone: "Europe/Warsaw",
+			At:       "2026-01-10T21:30:00Z",
+			Until:    "2026-01-11T05:00:00Z",
+		},
+		{
+			Name:     "Outside of the range in the timezone",
+			Ranges:   []string{"22:00-06:00"},
+			Timezone: "Europe/Warsaw",
+			At:       "2026-01-10T20:30:00Z",
+		},
+		{
+			Name: "Never quiet without ranges",
+			At:   "2026-03-10T02:30:00Z",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			timezone := tc.Timezone
+			if timezone == "" {
+				timezone = "UTC"
+			}
+
+			q, err := NewQuietHours(tc.Ranges, timezone)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			at, err := time.Parse(time.RFC3339, tc.At)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			until, ok := q.Until(at)
+			if ok != (tc.Until != "") {
+				t.Fatalf("Quiet hours do not match: %v vs %v", ok, tc.Until != "")
+			}
+
+			if ok && until.UTC().Format(time.RFC3339) != tc.Until {
+				t.Errorf("End of the quiet hours does not match: %s vs %s", until.UTC().Format(time.RFC3339), tc.Until)
+			}
+
+			err = q.Check(at)
+			if ok != errors.Is(err, ErrTargetNotReady) {
+				t.Errorf("Check does not match the quiet hours: %v", err)
+			}
+		})
+	}
+
+	t.Run("Rejects invalid ranges", func(t *testing.T) {
+		for _, r := range []string{"22:00", "22:00-25:00", "6:00-6:00", "night"} {
+			if _, err := NewQuietHours([]string{r}, ""); err == nil {
+				t.Errorf("Expected an error for %q", r)
+			}
+		}
+
+		if _, err := NewQuietHours([]string{"22:00-06:00"}, "Mars/Olympus"); err == nil {
+			t.Error("Expected an error for an unknown timezone")
+		}
+	})
+}
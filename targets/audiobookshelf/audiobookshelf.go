@@ -0,0 +1,118 @@
+package audiobookshelf
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cloudbox/autoscan"
+)
+
+type Config struct {
+	URL       string             `yaml:"url"`
+	Token     string             `yaml:"token"`
+	ReadyPath string             `yaml:"ready-path"`
+	Rewrite   []autoscan.Rewrite `yaml:"rewrite"`
+	Verbosity string             `yaml:"verbosity"`
+}
+
+type target struct {
+	url       string
+	token     string
+	readyPath string
+	libraries []library
+
+	log     zerolog.Logger
+	rewrite autoscan.Rewriter
+	api     apiClient
+}
+
+// New creates a target which scans the Audiobookshelf library containing the folder.
+func New(c Config) (autoscan.Target, error) {
+	l := autoscan.GetLogger(c.Verbosity).With().
+		Str("target", "audiobookshelf").
+		Str("url", c.URL).
+		Logger()
+
+	rewriter, err := autoscan.NewRewriter(c.Rewrite)
+	if err != nil {
+		return nil, err
+	}
+
+	api := newAPIClient(c.URL, c.Token, l)
+
+	libraries, err := api.Libraries()
+	if err != nil {
+		return nil, err
+	}
+
+	l.Debug().
+		Interface("libraries", libraries).
+		Msg("Retrieved libraries")
+
+	return &target{
+		url:       c.URL,
+		token:     c.Token,
+		readyPath: c.ReadyPath,
+		libraries: libraries,
+
+		log:     l,
+		rewrite: rewriter,
+		api:     api,
+	}, nil
+}
+
+func (t target) String() string {
+	return fmt.Sprintf("audiobookshelf: %s", t.url)
+}
+
+func (t target) Available() error {
+	return t.api.Available()
+}
+
+func (t target) Scan(ctx context.Context, scan autoscan.Scan) error {
+	if err := autoscan.CheckReadyPath(t.readyPath); err != nil {
+		return err
+	}
+
+	// determine library for this scan
+	scanFolder := t.rewrite(scan.Folder)
+
+	lib, err := t.getScanLibrary(scanFolder)
+	if err != nil {
+		t.log.Warn().
+			Err(err).
+			Str("id", scan.ID).
+			Msg("No target libraries found")
+
+		return nil
+	}
+
+	l := t.log.With().
+		Str("id", scan.ID).
+		Str("path", scanFolder).
+		Str("library", lib.Name).
+		Logger()
+
+	// send scan request
+	l.Trace().Msg("Sending scan request")
+
+	if err := t.api.Scan(ctx, lib.ID); err != nil {
+		return err
+	}
+
+	l.Info().Msg("Scan moved to target")
+	return nil
+}
+
+func (t target) getScanLibrary(folder string) (*library, error) {
+	for _, l := range t.libraries {
+		if strings.HasPrefix(folder, l.Path) {
+			return &l, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%v: failed determining library", folder)
+}
@@ -0,0 +1,122 @@
+package audiobookshelf
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/cloudbox/autoscan"
+)
+
+type server struct {
+	lock     sync.Mutex
+	requests []string
+}
+
+func (s *server) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer token" {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/api/libraries":
+		b, err := os.ReadFile("testdata/libraries.json")
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		_, _ = rw.Write(b)
+		return
+	case "/ping":
+		_, _ = rw.Write([]byte(`{"success": true}`))
+		return
+	}
+
+	s.lock.Lock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	s.lock.Unlock()
+}
+
+func TestScan(t *testing.T) {
+	type Test struct {
+		Name     string
+		Folder   string
+		Requests []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:     "Scans the library of the book",
+			Folder:   "/audiobooks/Frank Herbert/Dune",
+			Requests: []string{"POST /api/libraries/lib_c1u6t4p45c35rf0nzd/scan"},
+		},
+		{
+			Name:     "Scans the library of the podcast",
+			Folder:   "/podcasts/Darknet Diaries",
+			Requests: []string{"POST /api/libraries/lib_p9wkw2i85qy9oltijt/scan"},
+		},
+		{
+			Name:   "Ignores folders outside of the libraries",
+			Folder: "/audiobooks-old/Frank Herbert/Dune",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			target, err := New(Config{URL: ts.URL, Token: "token"})
+			if err != nil {
+				t.Fatalf("Could not create Audiobookshelf Target: %v", err)
+			}
+
+			err = target.Scan(context.Background(), autoscan.Scan{Folder: tc.Folder})
+			if err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(s.requests, tc.Requests) {
+				t.Logf("want: %v", tc.Requests)
+				t.Logf("got:  %v", s.requests)
+				t.Errorf("Requests do not match")
+			}
+		})
+	}
+}
+
+func TestAvailable(t *testing.T) {
+	ts := httptest.NewServer(&server{})
+
+	target, err := New(Config{URL: ts.URL, Token: "token"})
+	if err != nil {
+		t.Fatalf("Could not create Audiobookshelf Target: %v", err)
+	}
+
+	if err := target.Available(); err != nil {
+		t.Errorf("Target is not available: %v", err)
+	}
+
+	ts.Close()
+	if err := target.Available(); !errors.Is(err, autoscan.ErrTargetUnavailable) {
+		t.Errorf("Errors do not match: %v vs %v", err, autoscan.ErrTargetUnavailable)
+	}
+}
+
+func TestInvalidToken(t *testing.T) {
+	ts := httptest.NewServer(&server{})
+	defer ts.Close()
+
+	_, err := New(Config{URL: ts.URL, Token: "wrong"})
+	if !errors.Is(err, autoscan.ErrFatal) {
+		t.Errorf("Errors do not match: %v vs %v", err, autoscan.ErrFatal)
+	}
+}
@@ -1,9 +1,11 @@
 package autoscan
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
-	"net/url"
 
 	"github.com/rs/zerolog"
 
@@ -77,21 +79,59 @@ func (c apiClient) Available() error {
 	return nil
 }
 
-func (c apiClient) Scan(path string) error {
+type scanRequest struct {
+	Folder         string   `json:"folder"`
+	Priority       int      `json:"priority"`
+	Removed        bool     `json:"removed"`
+	ItemID         string   `json:"item_id,omitempty"`
+	Event          string   `json:"event,omitempty"`
+	File           string   `json:"file,omitempty"`
+	CollectionName string   `json:"collection_name,omitempty"`
+	LibraryHint    string   `json:"library_hint,omitempty"`
+	ItemIDs        []string `json:"item_ids,omitempty"`
+}
+
+// Scan forwards the scan to the manual trigger of the remote instance.
+func (c apiClient) Scan(ctx context.Context, scan autoscan.Scan) error {
+	// create request payload
+	type Payload struct {
+		Scans []scanRequest `json:"scans"`
+	}
+
+	payload := &Payload{
+		Scans: []scanRequest{
+			{
+				Folder:   scan.Folder,
+				Priority: scan.Priority,
+				Removed:  scan.Removed,
+				ItemID:   scan.ItemID,
+				Event:    scan.Event,
+				File:     scan.File,
+
+				CollectionName: scan.CollectionName,
+				LibraryHint:    scan.LibraryHint,
+				ItemIDs:        scan.ItemIDs,
+			},
+		},
+	}
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed encoding scan request payload: %v: %w", err, autoscan.ErrFatal)
+	}
+
 	// create request
-	req, err := http.NewRequest("POST", autoscan.JoinURL(c.baseURL, "triggers", "manual"), nil)
+	req, err := http.NewRequestWithContext(ctx, "POST", autoscan.JoinURL(c.baseURL, "triggers", "manual"), bytes.NewBuffer(b))
 	if err != nil {
 		return fmt.Errorf("failed creating scan request: %v: %w", err, autoscan.ErrFatal)
 	}
 
+	req.Header.Set("Content-Type", "application/json")
+
 	if c.user != "" && c.pass != "" {
 		req.SetBasicAuth(c.user, c.pass)
 	}
 
-	q := url.Values{}
-	q.Add("dir", path)
-	req.URL.RawQuery = q.Encode()
-
 	// send request
 	res, err := c.do(req)
 	if err != nil {
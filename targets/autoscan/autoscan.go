@@ -1,6 +1,9 @@
 package autoscan
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/rs/zerolog"
 
 	"github.com/cloudbox/autoscan"
@@ -10,14 +13,16 @@ type Config struct {
 	URL       string             `yaml:"url"`
 	User      string             `yaml:"username"`
 	Pass      string             `yaml:"password"`
+	ReadyPath string             `yaml:"ready-path"`
 	Rewrite   []autoscan.Rewrite `yaml:"rewrite"`
 	Verbosity string             `yaml:"verbosity"`
 }
 
 type target struct {
-	url  string
-	user string
-	pass string
+	url       string
+	user      string
+	pass      string
+	readyPath string
 
 	log     zerolog.Logger
 	rewrite autoscan.Rewriter
@@ -35,9 +40,10 @@ func New(c Config) (autoscan.Target, error) {
 	}
 
 	return &target{
-		url:  c.URL,
-		user: c.User,
-		pass: c.Pass,
+		url:       c.URL,
+		user:      c.User,
+		pass:      c.Pass,
+		readyPath: c.ReadyPath,
 
 		log:     l,
 		rewrite: rewriter,
@@ -45,17 +51,28 @@ func New(c Config) (autoscan.Target, error) {
 	}, nil
 }
 
-func (t target) Scan(scan autoscan.Scan) error {
+func (t target) Scan(ctx context.Context, scan autoscan.Scan) error {
+	if err := autoscan.CheckReadyPath(t.readyPath); err != nil {
+		return err
+	}
+
 	scanFolder := t.rewrite(scan.Folder)
 
 	// send scan request
 	l := t.log.With().
+		Str("id", scan.ID).
 		Str("path", scanFolder).
 		Logger()
 
 	l.Trace().Msg("Sending scan request")
 
-	if err := t.api.Scan(scanFolder); err != nil {
+	// the remote instance rewrites both with its own rules, so the file stays within the folder.
+	scan.Folder = scanFolder
+	if scan.File != "" {
+		scan.File = t.rewrite(scan.File)
+	}
+
+	if err := t.api.Scan(ctx, scan); err != nil {
 		return err
 	}
 
@@ -63,6 +80,10 @@ func (t target) Scan(scan autoscan.Scan) error {
 	return nil
 }
 
+func (t target) String() string {
+	return fmt.Sprintf("autoscan: %s", t.url)
+}
+
 func (t target) Available() error {
 	return t.api.Available()
 }
@@ -0,0 +1,162 @@
+package autoscan
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/cloudbox/autoscan"
+	"github.com/cloudbox/autoscan/triggers/manual"
+)
+
+// downstream runs the manual trigger of a remote instance.
+func downstream(t *testing.T, callback autoscan.ProcessorFunc) *httptest.Server {
+	trigger, err := manual.New(manual.Config{Priority: 1})
+	if err != nil {
+		t.Fatalf("Could not create Manual Trigger: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/triggers/manual", trigger(callback))
+
+	auth := middleware.BasicAuth("Autoscan 1.x", map[string]string{"autoscan": "secret"})
+	return httptest.NewServer(auth(mux))
+}
+
+func TestScan(t *testing.T) {
+	type Given struct {
+		Scan        autoscan.Scan
+		Password    string
+		CallbackErr error
+	}
+
+	type Expected struct {
+		Scans []autoscan.Scan
+		Err   error
+	}
+
+	type Test struct {
+		Name     string
+		Given    Given
+		Expected Expected
+	}
+
+	var testCases = []Test{
+		{
+			"Forwards the fields of the scan",
+			Given{
+				Scan:     autoscan.Scan{Folder: "/mnt/unionfs/Media/Movies/Parasite (2019)", Priority: 5, Removed: true},
+				Password: "secret",
+			},
+			Expected{
+				Scans: []autoscan.Scan{{Folder: "/mnt/nfs/Media/Movies/Parasite (2019)", Priority: 5, Removed: true}},
+			},
+		},
+		{
+			"Rewrites the file of the scan like its folder",
+			Given{
+				Scan: autoscan.Scan{
+					Folder:   "/mnt/unionfs/Media/Movies/Parasite (2019)",
+					File:     "/mnt/unionfs/Media/Movies/Parasite (2019)/Parasite (2019).mkv",
+					Priority: 5,
+				},
+				Password: "secret",
+			},
+			Expected{
+				Scans: []autoscan.Scan{{
+					Folder:   "/mnt/nfs/Media/Movies/Parasite (2019)",
+					File:     "/mnt/nfs/Media/Movies/Parasite (2019)/Parasite (2019).mkv",
+					Priority: 5,
+				}},
+			},
+		},
+		{
+			"Returns fatal error on bad credentials",
+			Given{
+				Scan:     autoscan.Scan{Folder: "/mnt/unionfs/Media/Movies/Parasite (2019)"},
+				Password: "wrong",
+			},
+			Expected{
+				Err: autoscan.ErrFatal,
+			},
+		},
+		{
+			"Returns target unavailable when the remote processor fails",
+			Given{
+				Scan:        autoscan.Scan{Folder: "/mnt/unionfs/Media/Movies/Parasite (2019)"},
+				Password:    "secret",
+				CallbackErr: errors.New("database is locked"),
+			},
+			Expected{
+				Scans: []autoscan.Scan{{Folder: "/mnt/nfs/Media/Movies/Parasite (2019)", Priority: 1}},
+				Err:   autoscan.ErrTargetUnavailable,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			var scans []autoscan.Scan
+			callback := func(received ...autoscan.Scan) error {
+				for _, scan := range received {
+					scan.Time = time.Time{}
+					scans = append(scans, scan)
+				}
+
+				return tc.Given.CallbackErr
+			}
+
+			server := downstream(t, callback)
+			defer server.Close()
+
+			target, err := New(Config{
+				URL:  server.URL,
+				User: "autoscan",
+				Pass: tc.Given.Password,
+				Rewrite: []autoscan.Rewrite{{
+					From: "^/mnt/unionfs/",
+					To:   "/mnt/nfs/",
+				}},
+			})
+			if err != nil {
+				t.Fatalf("Could not create Autoscan Target: %v", err)
+			}
+
+			err = target.Scan(context.Background(), tc.Given.Scan)
+			if !errors.Is(err, tc.Expected.Err) {
+				t.Errorf("Errors do not match: %v vs %v", err, tc.Expected.Err)
+			}
+
+			if !reflect.DeepEqual(scans, tc.Expected.Scans) {
+				t.Logf("want: %v", tc.Expected.Scans)
+				t.Logf("got:  %v", scans)
+				t.Errorf("Scans do not match")
+			}
+		})
+	}
+}
+
+func TestUnavailable(t *testing.T) {
+	server := downstream(t, func(...autoscan.Scan) error { return nil })
+	server.Close()
+
+	target, err := New(Config{URL: server.URL, User: "autoscan", Pass: "secret"})
+	if err != nil {
+		t.Fatalf("Could not create Autoscan Target: %v", err)
+	}
+
+	err = target.Scan(context.Background(), autoscan.Scan{Folder: "/mnt/unionfs/Media/Movies/Parasite (2019)"})
+	if !errors.Is(err, autoscan.ErrTargetUnavailable) {
+		t.Errorf("Errors do not match: %v vs %v", err, autoscan.ErrTargetUnavailable)
+	}
+
+	if err := target.Available(); !errors.Is(err, autoscan.ErrTargetUnavailable) {
+		t.Errorf("Errors do not match: %v vs %v", err, autoscan.ErrTargetUnavailable)
+	}
+}
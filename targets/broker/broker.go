@@ -0,0 +1,253 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cloudbox/autoscan"
+)
+
+type Config struct {
+	Name      string             `yaml:"name"`
+	Type      string             `yaml:"type"`
+	Address   string             `yaml:"address"`
+	Subject   string             `yaml:"subject"`
+	Username  string             `yaml:"username"`
+	Password  string             `yaml:"password"`
+	Timeout   time.Duration      `yaml:"timeout"`
+	ReadyPath string             `yaml:"ready-path"`
+	Rewrite   []autoscan.Rewrite `yaml:"rewrite"`
+	Verbosity string             `yaml:"verbosity"`
+}
+
+// Types of the broker.
+const (
+	typeNATS  = "nats"
+	typeRedis = "redis"
+)
+
+const (
+	// defaultSubject is the NATS subject or Redis channel of the scans unless subject is set.
+	defaultSubject = "autoscan.scans"
+
+	// defaultTimeout limits connecting to the broker and every message unless timeout is set.
+	defaultTimeout = 10 * time.Second
+)
+
+// Events of the payload.
+const (
+	eventAdd    = "add"
+	eventDelete = "delete"
+)
+
+type payload struct {
+	Target    string    `json:"target"`
+	Folder    string    `json:"folder"`
+	File      string    `json:"file,omitempty"`
+	Event     string    `json:"event"`
+	Priority  int       `json:"priority"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// A conn is a connection to the broker.
+type conn interface {
+	publish(subject string, message []byte) error
+	ping() error
+	setDeadline(deadline time.Time) error
+	close() error
+}
+
+type target struct {
+	name      string
+	kind      string
+	address   string
+	subject   string
+	username  string
+	password  string
+	timeout   time.Duration
+	readyPath string
+
+	log     zerolog.Logger
+	rewrite autoscan.Rewriter
+
+	// the connection is kept between scans and replaced once it failed.
+	lock sync.Mutex
+	conn conn
+}
+
+// New creates a target which publishes every scan as JSON to a NATS subject or a Redis channel.
+func New(c Config) (autoscan.Target, error) {
+	l := autoscan.GetLogger(c.Verbosity).With().
+		Str("target", "broker").
+		Str("type", c.Type).
+		Str("address", c.Address).
+		Logger()
+
+	switch c.Type {
+	case typeNATS, typeRedis:
+	default:
+		return nil, fmt.Errorf("invalid broker type: %q, expected %s or %s: %w", c.Type, typeNATS, typeRedis, autoscan.ErrFatal)
+	}
+
+	if c.Address == "" {
+		return nil, fmt.Errorf("broker target requires an address: %w", autoscan.ErrFatal)
+	}
+
+	rewriter, err := autoscan.NewRewriter(c.Rewrite)
+	if err != nil {
+		return nil, err
+	}
+
+	name := c.Name
+	if name == "" {
+		name = c.Type
+	}
+
+	subject := c.Subject
+	if subject == "" {
+		subject = defaultSubject
+	}
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	return &target{
+		name:      name,
+		kind:      c.Type,
+		address:   c.Address,
+		subject:   subject,
+		username:  c.Username,
+		password:  c.Password,
+		timeout:   timeout,
+		readyPath: c.ReadyPath,
+
+		log:     l,
+		rewrite: rewriter,
+	}, nil
+}
+
+func (t *target) String() string {
+	return fmt.Sprintf("%s: %s", t.kind, t.address)
+}
+
+func (t *target) dial() (conn, error) {
+	nc, err := net.DialTimeout("tcp", t.address, t.timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	// connecting includes the handshake.
+	if err := nc.SetDeadline(time.Now().Add(t.timeout)); err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	if t.kind == typeNATS {
+		return newNATSConn(nc, t.username, t.password)
+	}
+
+	return newRedisConn(nc, t.username, t.password)
+}
+
+// do runs fn on the connection to the broker, connecting first when needed.
+// A failed connection is replaced and fn is retried once, as the broker may have closed an idle connection.
+// A broker which cannot be reached returns ErrTargetUnavailable.
+func (t *target) do(ctx context.Context, fn func(conn) error) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if t.conn == nil {
+			if t.conn, err = t.dial(); err != nil {
+				t.conn = nil
+				continue
+			}
+		}
+
+		if err = t.deadline(ctx); err == nil {
+			if err = fn(t.conn); err == nil {
+				return nil
+			}
+		}
+
+		t.log.Trace().Err(err).Int("attempt", attempt+1).Msg("Broker connection failed")
+		t.conn.close()
+		t.conn = nil
+	}
+
+	return fmt.Errorf("%v: %w", err, autoscan.ErrTargetUnavailable)
+}
+
+// deadline limits the next message to the timeout, or the deadline of the context when earlier.
+func (t *target) deadline(ctx context.Context) error {
+	deadline := time.Now().Add(t.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	return t.conn.setDeadline(deadline)
+}
+
+// Available checks whether the broker answers a ping.
+func (t *target) Available() error {
+	return t.do(context.Background(), func(c conn) error {
+		return c.ping()
+	})
+}
+
+func (t *target) Scan(ctx context.Context, scan autoscan.Scan) error {
+	if err := autoscan.CheckReadyPath(t.readyPath); err != nil {
+		return err
+	}
+
+	scanFolder := t.rewrite(scan.Folder)
+
+	// the file is rewritten like the folder, so subscribers receive paths of the same system.
+	scanFile := scan.File
+	if scanFile != "" {
+		scanFile = t.rewrite(scanFile)
+	}
+
+	event := eventAdd
+	if scan.Removed {
+		event = eventDelete
+	}
+
+	message, err := json.Marshal(payload{
+		Target:    t.name,
+		Folder:    scanFolder,
+		File:      scanFile,
+		Event:     event,
+		Priority:  scan.Priority,
+		Timestamp: scan.Time,
+	})
+	if err != nil {
+		return fmt.Errorf("failed encoding scan message: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	l := t.log.With().
+		Str("id", scan.ID).
+		Str("path", scanFolder).
+		Str("event", event).
+		Logger()
+
+	l.Trace().Str("subject", t.subject).Msg("Publishing scan")
+
+	if err := t.do(ctx, func(c conn) error {
+		return c.publish(t.subject, message)
+	}); err != nil {
+		return fmt.Errorf("scan: %w", err)
+	}
+
+	l.Info().Msg("Scan moved to target")
+	return nil
+}
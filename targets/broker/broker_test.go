@@ -0,0 +1,424 @@
+package broker
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudbox/autoscan"
+)
+
+// message is a message published to the mock broker.
+type message struct {
+	Subject string
+	Payload payload
+}
+
+// mockBroker accepts NATS or Redis clients and records the messages they publish.
+type mockBroker struct {
+	kind     string
+	password string
+	// closeAfter closes every connection once it published this many messages.
+	closeAfter int
+
+	listener net.Listener
+
+	lock     sync.Mutex
+	conns    int
+	open     []net.Conn
+	messages []message
+}
+
+func newMockBroker(t *testing.T, kind string, password string, closeAfter int) *mockBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &mockBroker{kind: kind, password: password, closeAfter: closeAfter, listener: listener}
+	go func() {
+		for {
+			nc, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			b.lock.Lock()
+			b.conns++
+			b.open = append(b.open, nc)
+			b.lock.Unlock()
+
+			go b.serve(nc)
+		}
+	}()
+
+	t.Cleanup(b.close)
+	return b
+}
+
+func (b *mockBroker) address() string {
+	return b.listener.Addr().String()
+}
+
+// close takes the broker down, including the connections of its clients.
+func (b *mockBroker) close() {
+	b.listener.Close()
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, nc := range b.open {
+		nc.Close()
+	}
+}
+
+func (b *mockBroker) received() []message {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return append([]message(nil), b.messages...)
+}
+
+func (b *mockBroker) connections() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.conns
+}
+
+func (b *mockBroker) record(subject string, raw []byte) {
+	m := message{Subject: subject}
+	_ = json.Unmarshal(raw, &m.Payload)
+
+	b.lock.Lock()
+	b.messages = append(b.messages, m)
+	b.lock.Unlock()
+}
+
+func (b *mockBroker) serve(nc net.Conn) {
+	defer nc.Close()
+
+	r := bufio.NewReader(nc)
+	if b.kind == typeNATS {
+		b.serveNATS(nc, r)
+		return
+	}
+
+	b.serveRedis(nc, r)
+}
+
+func (b *mockBroker) serveNATS(nc net.Conn, r *bufio.Reader) {
+	fmt.Fprint(nc, "INFO {\"server_id\":\"mock\"}\r\n")
+
+	published := 0
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+		case fields[0] == "CONNECT":
+			var connect natsConnect
+			_ = json.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(line), "CONNECT ")), &connect)
+			if connect.Token != b.password && connect.Pass != b.password {
+				fmt.Fprint(nc, "-ERR 'Authorization Violation'\r\n")
+				return
+			}
+		case fields[0] == "PING":
+			fmt.Fprint(nc, "PONG\r\n")
+			if b.closeAfter > 0 && published >= b.closeAfter {
+				return
+			}
+		case fields[0] == "PUB" && len(fields) == 3:
+			size, _ := strconv.Atoi(fields[2])
+			raw := make([]byte, size+2)
+			if _, err := io.ReadFull(r, raw); err != nil {
+				return
+			}
+
+			b.record(fields[1], raw[:size])
+			published++
+		}
+	}
+}
+
+func (b *mockBroker) serveRedis(nc net.Conn, r *bufio.Reader) {
+	authenticated := b.password == ""
+
+	published := 0
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		switch strings.ToUpper(args[0]) {
+		case "AUTH":
+			if args[len(args)-1] != b.password {
+				fmt.Fprint(nc, "-WRONGPASS invalid password\r\n")
+				continue
+			}
+
+			authenticated = true
+			fmt.Fprint(nc, "+OK\r\n")
+		case "PING":
+			fmt.Fprint(nc, "+PONG\r\n")
+		case "PUBLISH":
+			if !authenticated {
+				fmt.Fprint(nc, "-NOAUTH Authentication required.\r\n")
+				continue
+			}
+
+			b.record(args[1], []byte(args[2]))
+			fmt.Fprint(nc, ":1\r\n")
+
+			published++
+			if b.closeAfter > 0 && published >= b.closeAfter {
+				return
+			}
+		}
+	}
+}
+
+// readCommand reads an array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil || count == 0 {
+		return nil, fmt.Errorf("invalid command: %q", line)
+	}
+
+	args := make([]string, count)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+
+		raw := make([]byte, size+2)
+		if _, err := io.ReadFull(r, raw); err != nil {
+			return nil, err
+		}
+
+		args[i] = string(raw[:size])
+	}
+
+	return args, nil
+}
+
+func TestScan(t *testing.T) {
+	type Given struct {
+		Type     string
+		Password string
+		Scans    []autoscan.Scan
+		// CloseAfter closes the connections of the broker after this many messages.
+		CloseAfter int
+	}
+
+	type Expected struct {
+		Messages    []message
+		Connections int
+	}
+
+	type Test struct {
+		Name     string
+		Given    Given
+		Expected Expected
+	}
+
+	scanTime := time.Date(2021, 3, 14, 15, 9, 26, 0, time.UTC)
+
+	added := autoscan.Scan{
+		Folder:   "/mnt/unionfs/Media/Movies/Parasite (2019)",
+		File:     "/mnt/unionfs/Media/Movies/Parasite (2019)/Parasite (2019).mkv",
+		Priority: 5,
+		Time:     scanTime,
+	}
+
+	removed := autoscan.Scan{
+		Folder:  "/mnt/unionfs/Media/Movies/Parasite (2019)",
+		Time:    scanTime,
+		Removed: true,
+	}
+
+	addMessage := message{
+		Subject: "media.scans",
+		Payload: payload{
+			Target:    "events",
+			Folder:    "/data/Movies/Parasite (2019)",
+			File:      "/data/Movies/Parasite (2019)/Parasite (2019).mkv",
+			Event:     "add",
+			Priority:  5,
+			Timestamp: scanTime,
+		},
+	}
+
+	deleteMessage := message{
+		Subject: "media.scans",
+		Payload: payload{
+			Target:    "events",
+			Folder:    "/data/Movies/Parasite (2019)",
+			Event:     "delete",
+			Timestamp: scanTime,
+		},
+	}
+
+	var testCases []Test
+	for _, kind := range []string{typeNATS, typeRedis} {
+		testCases = append(testCases, []Test{
+			{
+				kind + ": Publishes the fields of the scan",
+				Given{
+					Type:     kind,
+					Password: "secret",
+					Scans:    []autoscan.Scan{added},
+				},
+				Expected{
+					Messages:    []message{addMessage},
+					Connections: 1,
+				},
+			},
+			{
+				kind + ": Publishes removed folders as delete events",
+				Given{
+					Type:  kind,
+					Scans: []autoscan.Scan{removed},
+				},
+				Expected{
+					Messages:    []message{deleteMessage},
+					Connections: 1,
+				},
+			},
+			{
+				kind + ": Keeps the connection between scans",
+				Given{
+					Type:  kind,
+					Scans: []autoscan.Scan{added, removed},
+				},
+				Expected{
+					Messages:    []message{addMessage, deleteMessage},
+					Connections: 1,
+				},
+			},
+			{
+				kind + ": Reconnects once the broker closed the connection",
+				Given{
+					Type:       kind,
+					Scans:      []autoscan.Scan{added, removed},
+					CloseAfter: 1,
+				},
+				Expected{
+					Messages:    []message{addMessage, deleteMessage},
+					Connections: 2,
+				},
+			},
+		}...)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			b := newMockBroker(t, tc.Given.Type, tc.Given.Password, tc.Given.CloseAfter)
+
+			target, err := New(Config{
+				Name:     "events",
+				Type:     tc.Given.Type,
+				Address:  b.address(),
+				Subject:  "media.scans",
+				Password: tc.Given.Password,
+				Rewrite: []autoscan.Rewrite{{
+					From: "^/mnt/unionfs/Media/",
+					To:   "/data/",
+				}},
+			})
+			if err != nil {
+				t.Fatalf("Could not create Broker Target: %v", err)
+			}
+
+			for _, scan := range tc.Given.Scans {
+				if err := target.Scan(context.Background(), scan); err != nil {
+					t.Fatalf("Could not publish the scan: %v", err)
+				}
+			}
+
+			messages := b.received()
+			if !reflect.DeepEqual(messages, tc.Expected.Messages) {
+				t.Logf("want: %v", tc.Expected.Messages)
+				t.Logf("got:  %v", messages)
+				t.Errorf("Messages do not match")
+			}
+
+			if b.connections() != tc.Expected.Connections {
+				t.Errorf("Connections do not match: %d vs %d", b.connections(), tc.Expected.Connections)
+			}
+		})
+	}
+}
+
+func TestUnavailable(t *testing.T) {
+	scan := autoscan.Scan{Folder: "/mnt/unionfs/Media/Movies/Parasite (2019)"}
+
+	for _, kind := range []string{typeNATS, typeRedis} {
+		t.Run(kind+": Broker is down", func(t *testing.T) {
+			b := newMockBroker(t, kind, "", 0)
+
+			target, err := New(Config{Type: kind, Address: b.address(), Timeout: time.Second})
+			if err != nil {
+				t.Fatalf("Could not create Broker Target: %v", err)
+			}
+
+			if err := target.Available(); err != nil {
+				t.Errorf("Target is not available: %v", err)
+			}
+
+			b.close()
+			if err := target.Scan(context.Background(), scan); !errors.Is(err, autoscan.ErrTargetUnavailable) {
+				t.Errorf("Errors do not match: %v vs %v", err, autoscan.ErrTargetUnavailable)
+			}
+
+			if err := target.Available(); !errors.Is(err, autoscan.ErrTargetUnavailable) {
+				t.Errorf("Errors do not match: %v vs %v", err, autoscan.ErrTargetUnavailable)
+			}
+		})
+
+		t.Run(kind+": Broker rejects the password", func(t *testing.T) {
+			b := newMockBroker(t, kind, "secret", 0)
+
+			target, err := New(Config{Type: kind, Address: b.address(), Password: "wrong", Timeout: time.Second})
+			if err != nil {
+				t.Fatalf("Could not create Broker Target: %v", err)
+			}
+
+			if err := target.Scan(context.Background(), scan); !errors.Is(err, autoscan.ErrTargetUnavailable) {
+				t.Errorf("Errors do not match: %v vs %v", err, autoscan.ErrTargetUnavailable)
+			}
+
+			if len(b.received()) != 0 {
+				t.Errorf("Expected no messages: %v", b.received())
+			}
+		})
+	}
+
+	t.Run("Rejects unknown types", func(t *testing.T) {
+		if _, err := New(Config{Type: "kafka", Address: "localhost:9092"}); !errors.Is(err, autoscan.ErrFatal) {
+			t.Errorf("Errors do not match: %v vs %v", err, autoscan.ErrFatal)
+		}
+	})
+}
@@ -0,0 +1,42 @@
+package broker
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// wire is the line based connection the NATS and Redis protocols share.
+type wire struct {
+	nc net.Conn
+	r  *bufio.Reader
+}
+
+func newWire(nc net.Conn) wire {
+	return wire{nc: nc, r: bufio.NewReader(nc)}
+}
+
+// readLine reads a line without its trailing CRLF.
+func (w wire) readLine() (string, error) {
+	line, err := w.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (w wire) write(format string, args ...interface{}) error {
+	_, err := fmt.Fprintf(w.nc, format, args...)
+	return err
+}
+
+func (w wire) setDeadline(deadline time.Time) error {
+	return w.nc.SetDeadline(deadline)
+}
+
+func (w wire) close() error {
+	return w.nc.Close()
+}
@@ -0,0 +1,101 @@
+package broker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// natsConn speaks the NATS client protocol.
+type natsConn struct {
+	wire
+}
+
+type natsConnect struct {
+	Verbose  bool   `json:"verbose"`
+	Pedantic bool   `json:"pedantic"`
+	Name     string `json:"name"`
+	Lang     string `json:"lang"`
+	User     string `json:"user,omitempty"`
+	Pass     string `json:"pass,omitempty"`
+	Token    string `json:"auth_token,omitempty"`
+}
+
+// newNATSConn waits for the INFO of the server and connects with the credentials.
+// A password without a username is sent as the token of the server.
+func newNATSConn(nc net.Conn, username string, password string) (conn, error) {
+	c := &natsConn{newWire(nc)}
+
+	line, err := c.readLine()
+	if err != nil {
+		c.close()
+		return nil, fmt.Errorf("nats info: %w", err)
+	}
+
+	if !strings.HasPrefix(line, "INFO ") {
+		c.close()
+		return nil, fmt.Errorf("nats info: unexpected %q", line)
+	}
+
+	connect := natsConnect{Name: "autoscan", Lang: "go"}
+	if username != "" {
+		connect.User, connect.Pass = username, password
+	} else {
+		connect.Token = password
+	}
+
+	options, err := json.Marshal(connect)
+	if err != nil {
+		c.close()
+		return nil, err
+	}
+
+	if err := c.write("CONNECT %s\r\n", options); err != nil {
+		c.close()
+		return nil, fmt.Errorf("nats connect: %w", err)
+	}
+
+	// the server rejects the credentials before it answers the ping.
+	if err := c.ping(); err != nil {
+		c.close()
+		return nil, fmt.Errorf("nats connect: %w", err)
+	}
+
+	return c, nil
+}
+
+// publish is flushed with a ping, so the message reached the server once the pong is in.
+func (c *natsConn) publish(subject string, message []byte) error {
+	if err := c.write("PUB %s %d\r\n%s\r\n", subject, len(message), message); err != nil {
+		return err
+	}
+
+	return c.ping()
+}
+
+func (c *natsConn) ping() error {
+	if err := c.write("PING\r\n"); err != nil {
+		return err
+	}
+
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if err := c.write("PONG\r\n"); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("nats: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+
+		// +OK and updated INFO of the server need no answer.
+	}
+}
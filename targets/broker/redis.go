@@ -0,0 +1,70 @@
+package broker
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// redisConn speaks the Redis serialization protocol.
+type redisConn struct {
+	wire
+}
+
+// newRedisConn authenticates with the password, and the username of an ACL user when set.
+func newRedisConn(nc net.Conn, username string, password string) (conn, error) {
+	c := &redisConn{newWire(nc)}
+	if password == "" {
+		return c, nil
+	}
+
+	args := []string{"AUTH", password}
+	if username != "" {
+		args = []string{"AUTH", username, password}
+	}
+
+	if _, err := c.command(args...); err != nil {
+		c.close()
+		return nil, fmt.Errorf("redis auth: %w", err)
+	}
+
+	return c, nil
+}
+
+// command sends the arguments as an array of bulk strings and returns the simple or integer reply.
+func (c *redisConn) command(args ...string) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	if err := c.write("%s", b.String()); err != nil {
+		return "", err
+	}
+
+	line, err := c.readLine()
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case strings.HasPrefix(line, "+"), strings.HasPrefix(line, ":"):
+		return line[1:], nil
+	case strings.HasPrefix(line, "-"):
+		return "", fmt.Errorf("redis: %s", line[1:])
+	default:
+		return "", fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
+
+// publish returns once Redis handed the message to the subscribers of the channel.
+func (c *redisConn) publish(channel string, message []byte) error {
+	_, err := c.command("PUBLISH", channel, string(message))
+	return err
+}
+
+func (c *redisConn) ping() error {
+	_, err := c.command("PING")
+	return err
+}
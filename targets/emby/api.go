@@ -2,9 +2,13 @@ package emby
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/rs/zerolog"
 
@@ -136,7 +140,7 @@ type scanRequest struct {
 	UpdateType string `json:"updateType"`
 }
 
-func (c apiClient) Scan(path string) error {
+func (c apiClient) Scan(ctx context.Context, path string) error {
 	// create request payload
 	type Payload struct {
 		Updates []scanRequest `json:"Updates"`
@@ -158,7 +162,7 @@ func (c apiClient) Scan(path string) error {
 
 	// create request
 	reqURL := autoscan.JoinURL(c.baseURL, "Library", "Media", "Updated")
-	req, err := http.NewRequest("POST", reqURL, bytes.NewBuffer(b))
+	req, err := http.NewRequestWithContext(ctx, "POST", reqURL, bytes.NewBuffer(b))
 	if err != nil {
 		return fmt.Errorf("failed creating scan request: %v: %w", err, autoscan.ErrFatal)
 	}
@@ -174,3 +178,145 @@ func (c apiClient) Scan(path string) error {
 	defer res.Body.Close()
 	return nil
 }
+
+// GetViewID returns the ID of the user view (library) with the given name.
+func (c apiClient) GetViewID(ctx context.Context, userID string, libraryName string) (string, error) {
+	// create request
+	reqURL := autoscan.JoinURL(c.baseURL, "emby", "Users", userID, "Views")
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed creating views request: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	// send request
+	res, err := c.do(req)
+	if err != nil {
+		return "", fmt.Errorf("views: %w", err)
+	}
+
+	defer res.Body.Close()
+
+	// decode response
+	type Response struct {
+		Items []struct {
+			ID   string `json:"Id"`
+			Name string `json:"Name"`
+		} `json:"Items"`
+	}
+
+	resp := new(Response)
+	if err := json.NewDecoder(res.Body).Decode(resp); err != nil {
+		return "", fmt.Errorf("failed decoding views response: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	for _, view := range resp.Items {
+		if strings.EqualFold(view.Name, libraryName) {
+			return view.ID, nil
+		}
+	}
+
+	return "", fmt.Errorf("%v: view not found", libraryName)
+}
+
+// itemsPageSize is the amount of folders requested at once while looking for a folder,
+// so large libraries are not fetched in a single response.
+const itemsPageSize = 500
+
+// FindItemIDByPath returns the ID of the folder within the view
+// whose path exactly matches the given path.
+// The folders are requested a page at a time, until the folder is found.
+func (c apiClient) FindItemIDByPath(ctx context.Context, userID string, viewID string, path string) (string, error) {
+	want := strings.TrimRight(path, "/")
+	for start := 0; ; start += itemsPageSize {
+		items, total, err := c.folders(ctx, userID, viewID, start)
+		if err != nil {
+			return "", err
+		}
+
+		for _, item := range items {
+			if strings.TrimRight(item.Path, "/") == want {
+				return item.ID, nil
+			}
+		}
+
+		if len(items) < itemsPageSize || (total > 0 && start+len(items) >= total) {
+			break
+		}
+	}
+
+	return "", fmt.Errorf("%v: item not found", path)
+}
+
+type folder struct {
+	ID   string `json:"Id"`
+	Path string `json:"Path"`
+}
+
+// folders returns a page of the folders within the view, starting at the given index,
+// and the total amount of folders within the view.
+func (c apiClient) folders(ctx context.Context, userID string, viewID string, start int) ([]folder, int, error) {
+	// create request
+	reqURL := autoscan.JoinURL(c.baseURL, "emby", "Users", userID, "Items")
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed creating items request: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	q := url.Values{}
+	q.Add("ParentId", viewID)
+	q.Add("Recursive", "true")
+	q.Add("Fields", "Path")
+	q.Add("IsFolder", "true")
+	q.Add("SortBy", "SortName")
+	q.Add("StartIndex", strconv.Itoa(start))
+	q.Add("Limit", strconv.Itoa(itemsPageSize))
+	req.URL.RawQuery = q.Encode()
+
+	// send request
+	res, err := c.do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("items: %w", err)
+	}
+
+	defer res.Body.Close()
+
+	// decode response
+	type Response struct {
+		Items            []folder `json:"Items"`
+		TotalRecordCount int      `json:"TotalRecordCount"`
+	}
+
+	resp := new(Response)
+	if err := json.NewDecoder(res.Body).Decode(resp); err != nil {
+		return nil, 0, fmt.Errorf("failed decoding items response: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	return resp.Items, resp.TotalRecordCount, nil
+}
+
+// RefreshItem requests a recursive metadata refresh of the given item.
+func (c apiClient) RefreshItem(ctx context.Context, itemID string) error {
+	// create request
+	reqURL := autoscan.JoinURL(c.baseURL, "emby", "Items", itemID, "Refresh")
+	req, err := http.NewRequestWithContext(ctx, "POST", reqURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed creating refresh request: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	q := url.Values{}
+	q.Add("Recursive", "true")
+	q.Add("MetadataRefreshMode", "Default")
+	q.Add("ImageRefreshMode", "Default")
+	q.Add("ReplaceAllMetadata", "false")
+	q.Add("ReplaceAllImages", "false")
+	req.URL.RawQuery = q.Encode()
+
+	// send request
+	res, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("refresh: %w", err)
+	}
+
+	defer res.Body.Close()
+	return nil
+}
@@ -1,6 +1,7 @@
 package emby
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -9,18 +10,31 @@ import (
 	"github.com/cloudbox/autoscan"
 )
 
+// Config matches the precise refresh options of the Jellyfin target:
+// - UserID: the ID of the Emby user used for the /Users/{userId}/... requests.
+// - Library: the name of the library to look up the item in, determined by the path when empty.
+// - PreciseRefresh: refresh the item of the scanned folder instead of sending a library scan.
 type Config struct {
-	URL       string             `yaml:"url"`
-	Token     string             `yaml:"token"`
-	Rewrite   []autoscan.Rewrite `yaml:"rewrite"`
-	Verbosity string             `yaml:"verbosity"`
+	URL            string             `yaml:"url"`
+	Token          string             `yaml:"token"`
+	UserID         string             `yaml:"user_id"`
+	Library        string             `yaml:"library"`
+	PreciseRefresh bool               `yaml:"precise_refresh"`
+	ReadyPath      string             `yaml:"ready-path"`
+	Rewrite        []autoscan.Rewrite `yaml:"rewrite"`
+	Verbosity      string             `yaml:"verbosity"`
 }
 
 type target struct {
 	url       string
 	token     string
+	readyPath string
 	libraries []library
 
+	userID         string
+	library        string
+	preciseRefresh bool
+
 	log     zerolog.Logger
 	rewrite autoscan.Rewriter
 	api     apiClient
@@ -51,19 +65,32 @@ func New(c Config) (autoscan.Target, error) {
 	return &target{
 		url:       c.URL,
 		token:     c.Token,
+		readyPath: c.ReadyPath,
 		libraries: libraries,
 
+		userID:         c.UserID,
+		library:        c.Library,
+		preciseRefresh: c.PreciseRefresh,
+
 		log:     l,
 		rewrite: rewriter,
 		api:     api,
 	}, nil
 }
 
+func (t target) String() string {
+	return fmt.Sprintf("emby: %s", t.url)
+}
+
 func (t target) Available() error {
 	return t.api.Available()
 }
 
-func (t target) Scan(scan autoscan.Scan) error {
+func (t target) Scan(ctx context.Context, scan autoscan.Scan) error {
+	if err := autoscan.CheckReadyPath(t.readyPath); err != nil {
+		return err
+	}
+
 	// determine library for this scan
 	scanFolder := t.rewrite(scan.Folder)
 
@@ -71,20 +98,26 @@ func (t target) Scan(scan autoscan.Scan) error {
 	if err != nil {
 		t.log.Warn().
 			Err(err).
+			Str("id", scan.ID).
 			Msg("No target libraries found")
 
 		return nil
 	}
 
 	l := t.log.With().
+		Str("id", scan.ID).
 		Str("path", scanFolder).
 		Str("library", lib.Name).
 		Logger()
 
+	if t.preciseRefresh && t.refresh(ctx, l, lib, scanFolder) {
+		return nil
+	}
+
 	// send scan request
 	l.Trace().Msg("Sending scan request")
 
-	if err := t.api.Scan(scanFolder); err != nil {
+	if err := t.api.Scan(ctx, scanFolder); err != nil {
 		return err
 	}
 
@@ -92,6 +125,46 @@ func (t target) Scan(scan autoscan.Scan) error {
 	return nil
 }
 
+// refresh refreshes the item of the folder, returns false when a library scan is required instead.
+func (t target) refresh(ctx context.Context, l zerolog.Logger, lib *library, folder string) bool {
+	l.Trace().Msg("Sending refresh request")
+
+	libraryName := t.library
+	if strings.TrimSpace(libraryName) == "" {
+		libraryName = lib.Name
+	}
+
+	viewID, err := t.api.GetViewID(ctx, t.userID, libraryName)
+	if err != nil {
+		l.Warn().
+			Err(err).
+			Str("view", libraryName).
+			Msg("Failed determining view, falling back to library scan")
+		return false
+	}
+
+	itemID, err := t.api.FindItemIDByPath(ctx, t.userID, viewID, folder)
+	if err != nil {
+		l.Warn().
+			Err(err).
+			Msg("Failed determining item, falling back to library scan")
+		return false
+	}
+
+	if err := t.api.RefreshItem(ctx, itemID); err != nil {
+		l.Error().
+			Err(err).
+			Str("item", itemID).
+			Msg("Failed refreshing item, falling back to library scan")
+		return false
+	}
+
+	l.Info().
+		Str("item", itemID).
+		Msg("Item refreshed")
+	return true
+}
+
 func (t target) getScanLibrary(folder string) (*library, error) {
 	for _, l := range t.libraries {
 		if strings.HasPrefix(folder, l.Path) {
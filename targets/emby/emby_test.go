@@ -0,0 +1,247 @@
+package emby
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cloudbox/autoscan"
+)
+
+type server struct {
+	lock     sync.Mutex
+	requests []string
+}
+
+func (s *server) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	s.lock.Unlock()
+
+	if r.Header.Get("X-Emby-Token") != "token" {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	fixtures := map[string]string{
+		"/emby/Library/SelectableMediaFolders": "testdata/libraries.json",
+		"/emby/Users/user/Views":               "testdata/views.json",
+		"/emby/Users/user/Items":               "testdata/items.json",
+	}
+
+	if fixture, ok := fixtures[r.URL.Path]; ok {
+		b, err := os.ReadFile(fixture)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		_, _ = rw.Write(b)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func TestScan(t *testing.T) {
+	type Given struct {
+		Config Config
+		Folder string
+	}
+
+	type Expected struct {
+		Requests []string
+	}
+
+	type Test struct {
+		Name     string
+		Given    Given
+		Expected Expected
+	}
+
+	var testCases = []Test{
+		{
+			"Refreshes the item of the folder",
+			Given{
+				Config: Config{UserID: "user", PreciseRefresh: true},
+				Folder: "/data/TV/Westworld/Season 1",
+			},
+			Expected{
+				Requests: []string{
+					"GET /emby/Users/user/Views",
+					"GET /emby/Users/user/Items",
+					"POST /emby/Items/1205/Refresh",
+				},
+			},
+		},
+		{
+			"Looks up the item in the configured library",
+			Given{
+				Config: Config{UserID: "user", Library: "tv shows", PreciseRefresh: true},
+				Folder: "/data/TV/Westworld",
+			},
+			Expected{
+				Requests: []string{
+					"GET /emby/Users/user/Views",
+					"GET /emby/Users/user/Items",
+					"POST /emby/Items/1204/Refresh",
+				},
+			},
+		},
+		{
+			"Falls back to a library scan when the item is not found",
+			Given{
+				Config: Config{UserID: "user", PreciseRefresh: true},
+				Folder: "/data/TV/Westworld/Season 2",
+			},
+			Expected{
+				Requests: []string{
+					"GET /emby/Users/user/Views",
+					"GET /emby/Users/user/Items",
+					"POST /Library/Media/Updated",
+				},
+			},
+		},
+		{
+			"Falls back to a library scan when the view is not found",
+			Given{
+				Config: Config{UserID: "user", Library: "Anime", PreciseRefresh: true},
+				Folder: "/data/TV/Westworld/Season 1",
+			},
+			Expected{
+				Requests: []string{
+					"GET /emby/Users/user/Views",
+					"POST /Library/Media/Updated",
+				},
+			},
+		},
+		{
+			"Sends a library scan without precise refresh",
+			Given{
+				Config: Config{UserID: "user"},
+				Folder: "/data/TV/Westworld/Season 1",
+			},
+			Expected{
+				Requests: []string{
+					"POST /Library/Media/Updated",
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			c := tc.Given.Config
+			c.URL = ts.URL
+			c.Token = "token"
+
+			target, err := New(c)
+			if err != nil {
+				t.Fatalf("Could not create Emby Target: %v", err)
+			}
+
+			err = target.Scan(context.Background(), autoscan.Scan{Folder: tc.Given.Folder})
+			if err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			// skip the libraries request of New
+			requests := s.requests[1:]
+			if !reflect.DeepEqual(requests, tc.Expected.Requests) {
+				t.Logf("want: %v", tc.Expected.Requests)
+				t.Logf("got:  %v", requests)
+				t.Errorf("Requests do not match")
+			}
+		})
+	}
+}
+
+// folderServer pages through the given amount of folders like Emby does.
+type folderServer struct {
+	folders int
+	starts  []string
+}
+
+func (s *folderServer) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	s.starts = append(s.starts, q.Get("StartIndex"))
+
+	start, _ := strconv.Atoi(q.Get("StartIndex"))
+	limit, _ := strconv.Atoi(q.Get("Limit"))
+
+	items := make([]folder, 0)
+	for i := start; i < s.folders && i < start+limit; i++ {
+		items = append(items, folder{ID: strconv.Itoa(i), Path: fmt.Sprintf("/data/Movies/Movie %d", i)})
+	}
+
+	_ = json.NewEncoder(rw).Encode(map[string]interface{}{
+		"Items":            items,
+		"TotalRecordCount": s.folders,
+	})
+}
+
+func TestFindItemIDByPath(t *testing.T) {
+	type Test struct {
+		Name       string
+		Path       string
+		WantID     string
+		WantStarts []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:       "Stops at the page of the folder",
+			Path:       "/data/Movies/Movie 42/",
+			WantID:     "42",
+			WantStarts: []string{"0"},
+		},
+		{
+			Name:       "Requests the next page until the folder is found",
+			Path:       "/data/Movies/Movie 742",
+			WantID:     "742",
+			WantStarts: []string{"0", "500"},
+		},
+		{
+			Name:       "Requests all pages of a missing folder",
+			Path:       "/data/Movies/Movie 1200",
+			WantStarts: []string{"0", "500", "1000"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &folderServer{folders: 1200}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			api := newAPIClient(ts.URL, "token", zerolog.Nop())
+			id, err := api.FindItemIDByPath(context.Background(), "user", "view", tc.Path)
+			if tc.WantID == "" && err == nil {
+				t.Fatalf("Missing folder was found: %s", id)
+			} else if tc.WantID != "" && err != nil {
+				t.Fatalf("Folder was not found: %v", err)
+			}
+
+			if id != tc.WantID {
+				t.Errorf("IDs do not match: %s vs %s", id, tc.WantID)
+			}
+
+			if !reflect.DeepEqual(s.starts, tc.WantStarts) {
+				t.Errorf("Requested pages do not match: %v vs %v", s.starts, tc.WantStarts)
+			}
+		})
+	}
+}
@@ -2,38 +2,258 @@ package jellyfin
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/rs/zerolog"
 
 	"github.com/cloudbox/autoscan"
 )
 
-type apiClient struct {
+// apiClient is the part of the Jellyfin API used by the target.
+// newAPIClient returns the implementation backed by HTTP, tests may replace it by a fake.
+type apiClient interface {
+	Available() error
+	Libraries() ([]library, error)
+	Scan(ctx context.Context, path string) error
+	Remove(ctx context.Context, path string) error
+	GetViewID(ctx context.Context, userID string, libraryName string) (string, error)
+	FindItemsByPath(ctx context.Context, userID string, viewID string, path string) ([]item, error)
+	FindMoviesByFolder(ctx context.Context, userID string, viewID string, folder string) ([]item, error)
+	FindCollection(ctx context.Context, name string) (string, error)
+	RefreshItem(ctx context.Context, itemID string) error
+	RefreshMetadata(ctx context.Context, itemID string) error
+	RefreshTask(ctx context.Context) (refreshTask, error)
+	ScheduledTasks(ctx context.Context) ([]scheduledTask, error)
+	RunTask(ctx context.Context, taskID string) error
+	ActiveSessions(ctx context.Context) (bool, error)
+
+	// token returns the current token, setToken rotates it.
+	token() string
+	setToken(token string)
+
+	// redact and redactError hide the tokens within a string or error.
+	redact(s string) string
+	redactError(err error) error
+}
+
+// httpClient implements apiClient with the HTTP API of Jellyfin.
+type httpClient struct {
 	client  *http.Client
 	log     zerolog.Logger
 	baseURL string
-	token   string
+	tokens  *tokenSource
+
+	// basic auth credentials of a reverse proxy in front of Jellyfin, empty if unused.
+	basicUser string
+	basicPass string
+
+	// headers are sent along with every request, such as the credentials of Cloudflare Access.
+	headers http.Header
+
+	// trace logs every request and response at trace level.
+	trace bool
+}
+
+func newAPIClient(cfg Config, log zerolog.Logger) httpClient {
+	c := httpClient{
+		log:       log,
+		baseURL:   cfg.URL,
+		tokens:    newTokenSource(cfg.Token),
+		basicUser: cfg.BasicAuthUser,
+		basicPass: cfg.BasicAuthPass,
+		headers:   make(http.Header, len(cfg.Headers)),
+		trace:     cfg.TraceHTTP,
+	}
+
+	for name, value := range cfg.Headers {
+		c.headers.Set(name, value)
+	}
+
+	c.client = &http.Client{CheckRedirect: c.checkRedirect}
+	return c
 }
 
-func newAPIClient(baseURL string, token string, log zerolog.Logger) apiClient {
-	return apiClient{
-		client:  &http.Client{},
-		log:     log,
-		baseURL: baseURL,
-		token:   token,
+// maxRedirects is the number of redirects followed per request.
+const maxRedirects = 5
+
+// checkRedirect follows at most maxRedirects redirects.
+// The token is only sent along to the host of the original request.
+func (c httpClient) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+
+	c.log.Warn().
+		Str("from", c.redact(via[len(via)-1].URL.String())).
+		Str("to", c.redact(req.URL.String())).
+		Msg("Jellyfin redirected the request, consider updating the URL of the target")
+
+	// a redirected request keeps its token, even when the token was rotated in between
+	if req.URL.Hostname() == via[0].URL.Hostname() {
+		req.Header.Set("X-Emby-Token", via[0].Header.Get("X-Emby-Token"))
+	} else {
+		req.Header.Del("X-Emby-Token")
+		for name := range c.headers {
+			req.Header.Del(name)
+		}
 	}
+
+	return nil
 }
 
-func (c apiClient) do(req *http.Request) (*http.Response, error) {
-	req.Header.Set("X-Emby-Token", c.token)
+// maxTraceBody is the number of bytes of a response body which are traced.
+const maxTraceBody = 4096
+
+// redacted replaces the token within log fields and errors.
+const redacted = "***"
+
+// redact replaces the token within s.
+func redact(s string, token string) string {
+	if token == "" {
+		return s
+	}
+
+	return strings.ReplaceAll(s, token, redacted)
+}
+
+// A redactedError hides the token within the message of err,
+// errors.Is and errors.As still match the wrapped errors.
+type redactedError struct {
+	err   error
+	token string
+}
+
+func (e redactedError) Error() string {
+	return redact(e.err.Error(), e.token)
+}
+
+func (e redactedError) Unwrap() error {
+	return e.err
+}
+
+// redactError hides the token within the message of err.
+func redactError(err error, token string) error {
+	if err == nil || token == "" || !strings.Contains(err.Error(), token) {
+		return err
+	}
+
+	return redactedError{err: err, token: token}
+}
+
+// A tokenSource holds the token of the client, which can be rotated at runtime.
+// Requests read the token once, so in-flight requests finish with the previous token.
+type tokenSource struct {
+	lock  sync.RWMutex
+	token string
+
+	// all tokens used so far, which are all redacted.
+	used []string
+}
+
+func newTokenSource(token string) *tokenSource {
+	return &tokenSource{token: token, used: []string{token}}
+}
+
+func (ts *tokenSource) get() string {
+	ts.lock.RLock()
+	defer ts.lock.RUnlock()
+
+	return ts.token
+}
+
+func (ts *tokenSource) set(token string) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	ts.token = token
+	ts.used = append(ts.used, token)
+}
+
+func (ts *tokenSource) all() []string {
+	ts.lock.RLock()
+	defer ts.lock.RUnlock()
+
+	return append([]string(nil), ts.used...)
+}
+
+func (c httpClient) token() string {
+	return c.tokens.get()
+}
+
+func (c httpClient) setToken(token string) {
+	c.tokens.set(token)
+}
+
+// redact replaces the current and all previous tokens within s.
+func (c httpClient) redact(s string) string {
+	for _, token := range c.tokens.all() {
+		s = redact(s, token)
+	}
+
+	return s
+}
+
+// redactError hides the current and all previous tokens within the message of err.
+func (c httpClient) redactError(err error) error {
+	for _, token := range c.tokens.all() {
+		err = redactError(err, token)
+	}
+
+	return err
+}
+
+func (c httpClient) do(req *http.Request) (*http.Response, error) {
+	req.Header.Set("X-Emby-Token", c.tokens.get())
 	req.Header.Set("Accept", "application/json") // Force JSON Response.
 
+	// configured headers only replace the token or the user agent when set explicitly
+	for name, values := range c.headers {
+		req.Header[name] = append([]string(nil), values...)
+	}
+
+	if c.basicUser != "" {
+		req.SetBasicAuth(c.basicUser, c.basicPass)
+	}
+
+	if c.trace {
+		c.log.Trace().
+			Str("method", req.Method).
+			Str("request_url", c.redact(req.URL.String())).
+			Msg("Sending request")
+	}
+
+	start := time.Now()
 	res, err := c.client.Do(req)
+	latency := time.Since(start)
 	if err != nil {
-		return nil, fmt.Errorf("%v: %w", err, autoscan.ErrTargetUnavailable)
+		c.log.Debug().
+			Str("method", req.Method).
+			Str("endpoint", req.URL.Path).
+			Dur("latency", latency).
+			Msg("Request failed")
+		return nil, fmt.Errorf("%v: %w", c.redact(err.Error()), autoscan.ErrTargetUnavailable)
+	}
+
+	c.log.Debug().
+		Str("method", req.Method).
+		Str("endpoint", req.URL.Path).
+		Int("status", res.StatusCode).
+		Dur("latency", latency).
+		Msg("Request completed")
+
+	if c.trace {
+		c.traceResponse(res)
 	}
 
 	if res.StatusCode >= 200 && res.StatusCode < 300 {
@@ -41,7 +261,7 @@ func (c apiClient) do(req *http.Request) (*http.Response, error) {
 	}
 
 	c.log.Trace().
-		Stringer("request_url", res.Request.URL).
+		Str("request_url", c.redact(res.Request.URL.String())).
 		Int("response_status", res.StatusCode).
 		Msg("Request failed")
 
@@ -58,7 +278,28 @@ func (c apiClient) do(req *http.Request) (*http.Response, error) {
 	}
 }
 
-func (c apiClient) Available() error {
+// traceResponse logs the status and the start of the body of the response.
+// The body is restored, so it can still be decoded.
+func (c httpClient) traceResponse(res *http.Response) {
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxTraceBody))
+	res.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), res.Body), res.Body}
+
+	if err != nil {
+		c.log.Trace().Err(err).Msg("Failed reading response body")
+	}
+
+	c.log.Trace().
+		Str("method", res.Request.Method).
+		Str("request_url", c.redact(res.Request.URL.String())).
+		Int("response_status", res.StatusCode).
+		Str("response_body", c.redact(string(body))).
+		Msg("Received response")
+}
+
+func (c httpClient) Available() error {
 	// create request
 	reqURL := autoscan.JoinURL(c.baseURL, "System", "Info")
 	req, err := http.NewRequest("GET", reqURL, nil)
@@ -76,12 +317,27 @@ func (c apiClient) Available() error {
 	return nil
 }
 
+// A library holds all physical locations of a Jellyfin library.
+// TaskID is the scheduled task scanning only this library, if any.
 type library struct {
-	Name string
-	Path string
+	Name   string
+	Type   string
+	Paths  []string
+	TaskID string
 }
 
-func (c apiClient) Libraries() ([]library, error) {
+// depth returns the number of folders between the library location containing folder and folder.
+func (l library) depth(folder string) int {
+	for _, p := range l.Paths {
+		if withinPath(folder, p) {
+			return len(pathSegments(folder)) - len(pathSegments(p))
+		}
+	}
+
+	return 0
+}
+
+func (c httpClient) Libraries() ([]library, error) {
 	// create request
 	reqURL := autoscan.JoinURL(c.baseURL, "Library", "VirtualFolders")
 	req, err := http.NewRequest("GET", reqURL, nil)
@@ -99,31 +355,58 @@ func (c apiClient) Libraries() ([]library, error) {
 
 	// decode response
 	type Response struct {
-		Name      string   `json:"Name"`
-		Locations []string `json:"Locations"`
+		Name           string   `json:"Name"`
+		CollectionType string   `json:"CollectionType"`
+		Locations      []string `json:"Locations"`
 	}
 
-	resp := make([]Response, 0)
+	// libraries are decoded one by one, so a single malformed library does not fail the others
+	resp := make([]json.RawMessage, 0)
 	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
 		return nil, fmt.Errorf("failed decoding libraries request response: %v: %w", err, autoscan.ErrFatal)
 	}
 
 	// process response
 	libraries := make([]library, 0)
-	for _, lib := range resp {
+	for i, raw := range resp {
+		lib := Response{}
+		if err := json.Unmarshal(raw, &lib); err != nil {
+			c.log.Warn().
+				Err(err).
+				Int("index", i).
+				Msg("Failed decoding library, skipping library")
+			continue
+		}
+
+		paths := make([]string, 0, len(lib.Locations))
 		for _, folder := range lib.Locations {
-			libPath := folder
+			// an empty location would match every path
+			if strings.TrimSpace(folder) == "" {
+				c.log.Warn().
+					Str("library", lib.Name).
+					Msg("Library has an empty location, skipping location")
+				continue
+			}
+
+			libPath := normalizePath(folder)
 
 			// Add trailing slash if there is none.
 			if len(libPath) > 0 && libPath[len(libPath)-1] != '/' {
 				libPath += "/"
 			}
 
-			libraries = append(libraries, library{
-				Name: lib.Name,
-				Path: libPath,
-			})
+			paths = append(paths, libPath)
 		}
+
+		libraries = append(libraries, library{
+			Name:  lib.Name,
+			Type:  lib.CollectionType,
+			Paths: paths,
+		})
+	}
+
+	if len(resp) > 0 && len(libraries) == 0 {
+		return nil, fmt.Errorf("failed decoding all %d libraries: %w", len(resp), autoscan.ErrFatal)
 	}
 
 	return libraries, nil
@@ -134,7 +417,16 @@ type scanRequest struct {
 	UpdateType string `json:"updateType"`
 }
 
-func (c apiClient) Scan(path string) error {
+func (c httpClient) Scan(ctx context.Context, path string) error {
+	return c.update(ctx, path, "Modified")
+}
+
+// Remove informs Jellyfin that the path has been deleted.
+func (c httpClient) Remove(ctx context.Context, path string) error {
+	return c.update(ctx, path, "Deleted")
+}
+
+func (c httpClient) update(ctx context.Context, path string, updateType string) error {
 	// create request payload
 	type Payload struct {
 		Updates []scanRequest `json:"Updates"`
@@ -144,7 +436,7 @@ func (c apiClient) Scan(path string) error {
 		Updates: []scanRequest{
 			{
 				Path:       path,
-				UpdateType: "Modified",
+				UpdateType: updateType,
 			},
 		},
 	}
@@ -156,7 +448,7 @@ func (c apiClient) Scan(path string) error {
 
 	// create request
 	reqURL := autoscan.JoinURL(c.baseURL, "Library", "Media", "Updated")
-	req, err := http.NewRequest("POST", reqURL, bytes.NewBuffer(b))
+	req, err := http.NewRequestWithContext(ctx, "POST", reqURL, bytes.NewBuffer(b))
 	if err != nil {
 		return fmt.Errorf("failed creating scan request: %v: %w", err, autoscan.ErrFatal)
 	}
@@ -172,3 +464,434 @@ func (c apiClient) Scan(path string) error {
 	defer res.Body.Close()
 	return nil
 }
+
+// errViewNotFound indicates that the user has no view of the library,
+// either because the library does not exist or because the user cannot access it.
+var errViewNotFound = errors.New("view not found")
+
+// GetViewID returns the ID of the user view (library) with the given name.
+func (c httpClient) GetViewID(ctx context.Context, userID string, libraryName string) (string, error) {
+	// create request
+	reqURL := autoscan.JoinURL(c.baseURL, "Users", userID, "Views")
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed creating views request: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	// send request
+	res, err := c.do(req)
+	if err != nil {
+		return "", fmt.Errorf("views: %w", err)
+	}
+
+	defer res.Body.Close()
+
+	// decode response
+	type Response struct {
+		Items []struct {
+			ID   string `json:"Id"`
+			Name string `json:"Name"`
+		} `json:"Items"`
+	}
+
+	resp := new(Response)
+	if err := json.NewDecoder(res.Body).Decode(resp); err != nil {
+		return "", fmt.Errorf("failed decoding views response: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	// names differing only in case or whitespace match, an exact name wins an ambiguous match
+	names := make([]string, 0, len(resp.Items))
+	matches := make([]string, 0)
+	for _, view := range resp.Items {
+		names = append(names, strconv.Quote(view.Name))
+
+		if view.Name == libraryName {
+			return view.ID, nil
+		}
+
+		if normalizeName(view.Name) == normalizeName(libraryName) {
+			matches = append(matches, view.ID)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("%q: %w, available views: %s", libraryName, errViewNotFound, strings.Join(names, ", "))
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("%q: view is ambiguous, available views: %s", libraryName, strings.Join(names, ", "))
+	}
+}
+
+// normalizeName lowercases the name and collapses its whitespace.
+func normalizeName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+type item struct {
+	ID   string
+	Type string
+	Etag string
+
+	// season and series of the item when it belongs to a show, empty otherwise.
+	SeasonID string
+	SeriesID string
+}
+
+// FindItemsByPath returns the items within the view whose path exactly matches the given path,
+// in the order returned by Jellyfin. Duplicate imports or mixed libraries can hold several items with the same path.
+func (c httpClient) FindItemsByPath(ctx context.Context, userID string, viewID string, path string) ([]item, error) {
+	// create request
+	reqURL := autoscan.JoinURL(c.baseURL, "Users", userID, "Items")
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating items request: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	q := url.Values{}
+	q.Add("ParentId", viewID)
+	q.Add("Recursive", "true")
+	q.Add("Fields", "Path,Etag")
+	q.Add("IsFolder", "true")
+	req.URL.RawQuery = q.Encode()
+
+	// send request
+	res, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("items: %w", err)
+	}
+
+	defer res.Body.Close()
+
+	// decode response
+	type Response struct {
+		Items []struct {
+			ID       string `json:"Id"`
+			Type     string `json:"Type"`
+			Path     string `json:"Path"`
+			Etag     string `json:"Etag"`
+			SeasonID string `json:"SeasonId"`
+			SeriesID string `json:"SeriesId"`
+		} `json:"Items"`
+	}
+
+	resp := new(Response)
+	if err := json.NewDecoder(res.Body).Decode(resp); err != nil {
+		return nil, fmt.Errorf("failed decoding items response: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	want := strings.TrimRight(normalizePath(path), "/")
+	items := make([]item, 0)
+	for _, i := range resp.Items {
+		if strings.TrimRight(normalizePath(i.Path), "/") == want {
+			items = append(items, item{
+				ID:       strings.TrimSpace(i.ID),
+				Type:     i.Type,
+				Etag:     i.Etag,
+				SeasonID: strings.TrimSpace(i.SeasonID),
+				SeriesID: strings.TrimSpace(i.SeriesID),
+			})
+		}
+	}
+
+	if len(items) == 0 {
+		return nil, fmt.Errorf("%v: item not found", path)
+	}
+
+	return items, nil
+}
+
+// FindMoviesByFolder returns the movies within the view whose files are located directly in the folder.
+// The versions of a multi-version movie share their folder and belong to the same movie,
+// while a folder without subfolders per movie holds several movies.
+func (c httpClient) FindMoviesByFolder(ctx context.Context, userID string, viewID string, folder string) ([]item, error) {
+	// create request
+	reqURL := autoscan.JoinURL(c.baseURL, "Users", userID, "Items")
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating movies request: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	q := url.Values{}
+	q.Add("ParentId", viewID)
+	q.Add("Recursive", "true")
+	q.Add("Fields", "Path,Etag")
+	q.Add("IncludeItemTypes", "Movie")
+	req.URL.RawQuery = q.Encode()
+
+	// send request
+	res, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("movies: %w", err)
+	}
+
+	defer res.Body.Close()
+
+	// decode response
+	type Response struct {
+		Items []struct {
+			ID   string `json:"Id"`
+			Type string `json:"Type"`
+			Path string `json:"Path"`
+			Etag string `json:"Etag"`
+		} `json:"Items"`
+	}
+
+	resp := new(Response)
+	if err := json.NewDecoder(res.Body).Decode(resp); err != nil {
+		return nil, fmt.Errorf("failed decoding movies response: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	want := strings.TrimRight(normalizePath(folder), "/")
+	movies := make([]item, 0)
+	for _, i := range resp.Items {
+		if path.Dir(normalizePath(i.Path)) == want {
+			movies = append(movies, item{ID: strings.TrimSpace(i.ID), Type: i.Type, Etag: i.Etag})
+		}
+	}
+
+	if len(movies) == 0 {
+		return nil, fmt.Errorf("%v: movie not found", folder)
+	}
+
+	return movies, nil
+}
+
+// FindCollection returns the ID of the collection (box set) with the given name.
+// Names differing only in case or whitespace match, an exact name wins an ambiguous match.
+func (c httpClient) FindCollection(ctx context.Context, name string) (string, error) {
+	// create request
+	reqURL := autoscan.JoinURL(c.baseURL, "Items")
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed creating collections request: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	q := url.Values{}
+	q.Add("IncludeItemTypes", "BoxSet")
+	q.Add("Recursive", "true")
+	req.URL.RawQuery = q.Encode()
+
+	// send request
+	res, err := c.do(req)
+	if err != nil {
+		return "", fmt.Errorf("collections: %w", err)
+	}
+
+	defer res.Body.Close()
+
+	// decode response
+	type Response struct {
+		Items []struct {
+			ID   string `json:"Id"`
+			Name string `json:"Name"`
+		} `json:"Items"`
+	}
+
+	resp := new(Response)
+	if err := json.NewDecoder(res.Body).Decode(resp); err != nil {
+		return "", fmt.Errorf("failed decoding collections response: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	matches := make([]string, 0)
+	for _, collection := range resp.Items {
+		if collection.Name == name {
+			return strings.TrimSpace(collection.ID), nil
+		}
+
+		if normalizeName(collection.Name) == normalizeName(name) {
+			matches = append(matches, strings.TrimSpace(collection.ID))
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("%q: collection not found", name)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("%q: collection is ambiguous", name)
+	}
+}
+
+// RefreshItem requests a recursive metadata refresh of the given item.
+func (c httpClient) RefreshItem(ctx context.Context, itemID string) error {
+	q := url.Values{}
+	q.Add("Recursive", "true")
+	q.Add("MetadataRefreshMode", "Default")
+	q.Add("ImageRefreshMode", "Default")
+	q.Add("ReplaceAllMetadata", "false")
+	q.Add("ReplaceAllImages", "false")
+
+	return c.refresh(ctx, itemID, q)
+}
+
+// RefreshMetadata refreshes only the metadata of the item, without scanning its files or children.
+func (c httpClient) RefreshMetadata(ctx context.Context, itemID string) error {
+	q := url.Values{}
+	q.Add("Recursive", "false")
+	q.Add("MetadataRefreshMode", "FullRefresh")
+	q.Add("ImageRefreshMode", "Default")
+	q.Add("ReplaceAllMetadata", "true")
+	q.Add("ReplaceAllImages", "false")
+
+	return c.refresh(ctx, itemID, q)
+}
+
+func (c httpClient) refresh(ctx context.Context, itemID string, q url.Values) error {
+	// create request
+	reqURL := autoscan.JoinURL(c.baseURL, "Items", itemID, "Refresh")
+	req, err := http.NewRequestWithContext(ctx, "POST", reqURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed creating refresh request: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	req.URL.RawQuery = q.Encode()
+
+	// send request
+	res, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("refresh: %w", err)
+	}
+
+	defer res.Body.Close()
+	return nil
+}
+
+// A refreshTask is the library refresh task, CurrentProgressPercentage is only set while it runs.
+type refreshTask struct {
+	State    string  `json:"State"`
+	Progress float64 `json:"CurrentProgressPercentage"`
+}
+
+// RefreshTask returns the library refresh task, its State is for example Running or Idle.
+func (c httpClient) RefreshTask(ctx context.Context) (refreshTask, error) {
+	// create request
+	reqURL := autoscan.JoinURL(c.baseURL, "ScheduledTasks")
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return refreshTask{}, fmt.Errorf("failed creating scheduled tasks request: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	// send request
+	res, err := c.do(req)
+	if err != nil {
+		return refreshTask{}, fmt.Errorf("scheduled tasks: %w", err)
+	}
+
+	defer res.Body.Close()
+
+	// decode response
+	type Response struct {
+		Key string `json:"Key"`
+		refreshTask
+	}
+
+	resp := make([]Response, 0)
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return refreshTask{}, fmt.Errorf("failed decoding scheduled tasks response: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	for _, task := range resp {
+		if task.Key == "RefreshLibrary" {
+			return task.refreshTask, nil
+		}
+	}
+
+	return refreshTask{}, fmt.Errorf("RefreshLibrary: scheduled task not found")
+}
+
+// A scheduledTask is a task of the Jellyfin task scheduler.
+type scheduledTask struct {
+	ID    string `json:"Id"`
+	Name  string `json:"Name"`
+	Key   string `json:"Key"`
+	State string `json:"State"`
+}
+
+// ScheduledTasks returns all scheduled tasks.
+func (c httpClient) ScheduledTasks(ctx context.Context) ([]scheduledTask, error) {
+	// create request
+	reqURL := autoscan.JoinURL(c.baseURL, "ScheduledTasks")
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating scheduled tasks request: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	// send request
+	res, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("scheduled tasks: %w", err)
+	}
+
+	defer res.Body.Close()
+
+	// decode response
+	tasks := make([]scheduledTask, 0)
+	if err := json.NewDecoder(res.Body).Decode(&tasks); err != nil {
+		return nil, fmt.Errorf("failed decoding scheduled tasks response: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	return tasks, nil
+}
+
+// RunTask starts the scheduled task with the given ID.
+func (c httpClient) RunTask(ctx context.Context, taskID string) error {
+	// create request
+	reqURL := autoscan.JoinURL(c.baseURL, "ScheduledTasks", "Running", taskID)
+	req, err := http.NewRequestWithContext(ctx, "POST", reqURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed creating run task request: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	// send request
+	res, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("run task: %w", err)
+	}
+
+	defer res.Body.Close()
+	return nil
+}
+
+// ActiveSessions returns whether any session is playing media which is not paused.
+func (c httpClient) ActiveSessions(ctx context.Context) (bool, error) {
+	// create request
+	reqURL := autoscan.JoinURL(c.baseURL, "Sessions")
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed creating sessions request: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	// send request
+	res, err := c.do(req)
+	if err != nil {
+		return false, fmt.Errorf("sessions: %w", err)
+	}
+
+	defer res.Body.Close()
+
+	// decode response
+	type Response struct {
+		NowPlayingItem *struct {
+			ID string `json:"Id"`
+		} `json:"NowPlayingItem"`
+		PlayState struct {
+			IsPaused bool `json:"IsPaused"`
+		} `json:"PlayState"`
+	}
+
+	resp := make([]Response, 0)
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return false, fmt.Errorf("failed decoding sessions response: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	for _, session := range resp {
+		if session.NowPlayingItem != nil && !session.PlayState.IsPaused {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
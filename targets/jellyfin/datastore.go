@@ -0,0 +1,62 @@
+package jellyfin
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+
+	"github.com/cloudbox/autoscan"
+	"github.com/cloudbox/autoscan/migrate"
+)
+
+// datastore remembers the last seen version of Jellyfin items.
+type datastore struct {
+	*sql.DB
+}
+
+var (
+	//go:embed migrations
+	migrations embed.FS
+)
+
+func newDatastore(db *sql.DB, mg *migrate.Migrator) (*datastore, error) {
+	// migrations
+	if err := mg.Migrate(&migrations, "jellyfin"); err != nil {
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+
+	return &datastore{db}, nil
+}
+
+const sqlGetLastSeen = `SELECT last_seen FROM jellyfin_item WHERE url = ? AND item_id = ?`
+
+// LastSeen returns the last seen version of the item, or an empty string when it was never seen.
+func (store *datastore) LastSeen(url string, itemID string) (string, error) {
+	var lastSeen string
+
+	err := store.QueryRow(sqlGetLastSeen, url, itemID).Scan(&lastSeen)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return "", nil
+	case err != nil:
+		return "", fmt.Errorf("get last seen: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	return lastSeen, nil
+}
+
+const sqlSetLastSeen = `
+INSERT INTO jellyfin_item (url, item_id, last_seen)
+VALUES (?, ?, ?)
+ON CONFLICT (url, item_id) DO UPDATE SET
+	last_seen = excluded.last_seen
+`
+
+func (store *datastore) SetLastSeen(url string, itemID string, lastSeen string) error {
+	if _, err := store.Exec(sqlSetLastSeen, url, itemID, lastSeen); err != nil {
+		return fmt.Errorf("set last seen: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	return nil
+}
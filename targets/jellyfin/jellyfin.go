@@ -1,12 +1,22 @@
 package jellyfin
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"os"
+	"path"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/rs/zerolog"
 
 	"github.com/cloudbox/autoscan"
+	"github.com/cloudbox/autoscan/metrics"
+	"github.com/cloudbox/autoscan/migrate"
 )
 
 // Config rozszerzone o:
@@ -14,132 +24,2693 @@ import (
 // - Library: nazwa biblioteki (np. "Filmy") – używana do pobrania ViewID
 // - PreciseRefresh: jeśli true, zamiast pełnego skanu biblioteki
 //   odświeżamy konkretny element (folder/film) po jego itemId.
+// - WaitForRefresh: po precyzyjnym odświeżeniu czekamy, aż Jellyfin je zakończy
+//   (najdłużej RefreshTimeout).
+// - SkipUnchanged: pomijamy precyzyjne odświeżenie, gdy Etag elementu
+//   nie zmienił się od ostatniego odświeżenia (zapisany w bazie Db).
+// - StrictLibraryMatch: skan bez pasującej biblioteki zwraca błąd
+//   zamiast ostrzeżenia, aby błędny rewrite nie przechodził niezauważony.
+// - TraceHTTP: przy poziomie trace logujemy każde żądanie i odpowiedź API
+//   (z ukrytym tokenem), aby zobaczyć, co faktycznie zwraca Jellyfin.
+// - ResolveSymlinks: przed porównaniem rozwiązujemy dowiązania symboliczne
+//   w ścieżkach bibliotek i skanu (wymaga dostępu do lokalnego systemu plików).
+// - AllowEmptyLibraries: pozwala uruchomić target bez bibliotek
+//   (domyślnie New zwraca błąd, bo żaden skan nie znalazłby biblioteki).
+// - BasicAuthUser/BasicAuthPass: dane HTTP basic auth dla reverse proxy
+//   przed Jellyfin, wysyłane obok tokenu (puste = wyłączone).
+// - MaxMatchDepth: maksymalna głębokość folderu (liczona od ścieżki biblioteki),
+//   dla której szukamy elementu; głębsze foldery od razu skanują bibliotekę.
+// - RefreshWorkers: liczba jednocześnie odświeżanych elementów, gdy folder
+//   obejmuje ich kilka (np. filmy bez własnych podfolderów).
+// - ScanTimeout: maksymalny czas jednego skanu (łącznie z precyzyjnym odświeżeniem);
+//   po jego przekroczeniu procesor anuluje skan i ponawia go później tylko dla tego targetu.
+// - StrictRewrite: skan, którego ścieżki nie zmieniła żadna reguła rewrite, zwraca błąd
+//   zamiast wpisu w logu debug (tylko gdy reguły są ustawione).
+// - LibraryTypes: typy kolekcji bibliotek obsługiwane przez ten target (np. movies, tvshows);
+//   skany innych bibliotek są pomijane. Puste = wszystkie biblioteki.
+// - LibraryMap: prefiks ścieżki (po rewrite) -> ViewID; pasujący prefiks (najdłuższy)
+//   omija wyszukiwanie ViewID po nazwie biblioteki przy precyzyjnym odświeżaniu.
+// - SettleDelay: dodatkowe opóźnienie po osiągnięciu minimum-age, zanim skan trafi do tego targetu,
+//   aby kolejne zmiany w tym samym folderze zdążyły się połączyć (0 = bez opóźnienia).
+// - ConfirmScan: po skanie biblioteki sprawdzamy stan zadania RefreshLibrary, bo Jellyfin
+//   przyjmuje (2xx) także ścieżki spoza bibliotek, niczego nie kolejkując; brak skanu = ostrzeżenie.
+// - LibraryUsers: nazwa biblioteki lub prefiks ścieżki (po rewrite) -> UserID, gdy biblioteki
+//   należą do różnych użytkowników; najdłuższy prefiks ma pierwszeństwo przed nazwą, domyślnie UserID.
+// - Resolver: własny sposób ustalania itemId folderu przy precyzyjnym odświeżaniu (ItemResolver),
+//   ustawiany w kodzie; nil = dopasowanie po ścieżce (Path).
+// - ScanMode: kiedy wysyłamy kosztowny skan całej biblioteki: precise-only (nigdy, skan jest
+//   ponawiany później), precise-then-library lub library-only; puste = według PreciseRefresh.
+// - RefreshInterval: odstęp między sprawdzeniami stanu odświeżania (WaitForRefresh, ConfirmScan),
+//   domyślnie 2s, najmniej 1s; przy WaitForRefresh logujemy też postęp odświeżania.
+// - LazyLibraries: New nie łączy się z Jellyfin, biblioteki pobieramy przy pierwszym skanie
+//   (np. do testów konfiguracji bez dostępnego serwera).
+// - ModeByType: typ kolekcji biblioteki -> precise lub library, np. music: library, gdy precyzyjne
+//   odświeżanie nie sprawdza się dla danej treści; typy spoza mapy według ScanMode/PreciseRefresh.
+// - LibraryScanWorkers: liczba jednocześnie wysyłanych skanów całej biblioteki (fallback), niezależna
+//   od RefreshWorkers; kolejne skany czekają na swoją kolej, domyślnie 1.
+// - FallbackUseLibraryTask: skan biblioteki uruchamia zaplanowane zadanie skanujące tylko tę bibliotekę
+//   (ScheduledTasks, ustalane przy pobraniu bibliotek) zamiast zgłoszenia ścieżki; bez zadania jak dotąd.
+// - RefreshPollInitialDelay: przy WaitForRefresh czekamy tyle przed pierwszym sprawdzeniem stanu,
+//   bo tuż po odświeżeniu Jellyfin często jeszcze nie uruchomił zadania (0 = od razu); wliczane do RefreshTimeout.
+// - RefreshByEvent: zdarzenie skanu (add, upgrade, rename, delete, metadata) -> precise, library, metadata
+//   (tylko metadane elementu, bez skanu plików) lub remove (zgłoszenie usunięcia); zdarzenia spoza mapy jak dotąd.
+// - ExtensionRules: rozszerzenie pliku skanu (Scan.File, np. .srt; * = pozostałe) -> scan (jak dotąd),
+//   metadata (tylko metadane elementu) lub ignore (skan pomijany); skany bez pliku jak dotąd.
+// - CoalesceLibraryScans: nie wysyłamy skanu biblioteki, gdy w Jellyfin trwa już skan (zadanie RefreshLibrary
+//   lub zadanie biblioteki przy FallbackUseLibraryTask); zmianę obejmie trwający skan.
+// - Headers: dodatkowe nagłówki HTTP każdego żądania (np. CF-Access-Client-Id dla Cloudflare Access);
+//   nadpisują token lub User-Agent tylko wtedy, gdy zostały jawnie ustawione.
+// - RefreshGranularity: poziom precyzyjnego odświeżenia seriali: item (element folderu skanu, jak dotąd),
+//   season (sezon odcinka) lub series (cały serial); elementy spoza seriali jak dotąd, puste = item.
+// - MultiMatch: wybór elementów, gdy kilka ma tę samą ścieżkę (zduplikowany import, biblioteka mieszana):
+//   all (odświeżamy wszystkie), first (pierwszy zwrócony przez Jellyfin, domyślnie) lub byType
+//   (pierwszy o typie z MultiMatchTypes, według kolejności listy; bez pasującego typu jak first).
+// - MinPathLength: skan, którego ścieżka po rewrite jest pusta, jest katalogiem głównym (/, C:\)
+//   lub jest krótsza niż ta liczba znaków, zwraca błąd zamiast skanować zbyt wiele; 0 = tylko pusta i główny.
+// - WarmupViewIDs: po pobraniu bibliotek od razu ustalamy i zapamiętujemy ich ViewID, aby pierwsze
+//   precyzyjne odświeżenie po restarcie nie czekało na GetViewID; błąd jednej biblioteki tylko logujemy.
+// - WarmupLibraries: nazwy bibliotek, których ViewID ustalamy przy WarmupViewIDs; puste = wszystkie.
+// - StatFolders: przed dopasowaniem biblioteki sprawdzamy, czy folder skanu (po rewrite) istnieje
+//   (wymaga dostępu do lokalnego systemu plików); brakujący folder skanujemy tylko wtedy, gdy istnieją
+//   wszystkie MountAnchors, w przeciwnym razie skan czeka jak przy ready-path (punkt montowania nie działa).
+// - MountAnchors: pliki lub foldery, których obecność potwierdza działający punkt montowania (StatFolders);
+//   puste = brakujący folder zawsze skanujemy (np. usunięty film).
+// - TrimPrefix, TrimSuffix: stały prefiks (np. katalog kontenera) i sufiks usuwane z folderu skanu
+//   po rewrite, a przed dopasowaniem biblioteki i elementu; prostsza alternatywa dla reguł rewrite.
+// - FallbackWarnRate, FallbackWarnWindow: gdy w oknie FallbackWarnWindow (domyślnie 1h) co najmniej
+//   FallbackWarnRate (domyślnie 0.8) precyzyjnych odświeżeń biblioteki kończy się skanem biblioteki,
+//   logujemy ostrzeżenie (najwyżej raz na okno), bo zwykle oznacza to błędny rewrite, UserID lub bibliotekę;
+//   wartość powyżej 1 wyłącza ostrzeżenie.
+// - DefaultLibrary: biblioteka skanowana w całości, gdy folder skanu nie należy do żadnej biblioteki
+//   (zamiast pominięcia skanu lub błędu StrictLibraryMatch); musi istnieć, puste = jak dotąd.
+// - MaxRetries, RetryBackoff, MaxRetryBackoff: własna polityka ponawiania skanów wstrzymanych dla tego
+//   targetu (np. zdalny, zawodny serwer), zastępująca globalną; wartości 0 = według globalnych ustawień.
+// - StrictLibraryPaths: folder pasuje do biblioteki tylko na granicy katalogu (lokalizacja biblioteki lub folder
+//   w niej); gdy pasuje kilka bibliotek (nakładające się lokalizacje), zostają te o typie z LibraryTypes,
+//   a o pozostałych decyduje AmbiguousLibrary.
+// - AmbiguousLibrary: wybór przy StrictLibraryPaths, gdy nadal pasuje kilka bibliotek: error (skan kończy się
+//   błędem i zostaje odrzucony, domyślnie), longest (najdłuższa, czyli najbardziej szczegółowa lokalizacja)
+//   lub first (pierwsza zwrócona przez Jellyfin, jak bez StrictLibraryPaths).
+// - AdminUserID: użytkownik (np. administrator), którym wyszukujemy element, gdy użytkownik biblioteki
+//   nie widzi biblioteki (brak uprawnień); bez niego precyzyjne odświeżenie kończy się skanem biblioteki.
+//   Brak dostępu logujemy ostrzeżeniem raz na użytkownika i bibliotekę.
+// - PathSeparator: separator ścieżek serwera Jellyfin, / (domyślnie) lub \ (serwer Windows); ścieżki
+//   skanów wysyłamy z tym separatorem. Biblioteki dopasowujemy zawsze po całych segmentach ścieżki,
+//   niezależnie od separatora, końcowego / i zapisu UNC.
+// - QuietHours, QuietTimezone: codzienne przedziały HH:MM-HH:MM (np. 22:00-06:00, także przez północ)
+//   w strefie QuietTimezone (domyślnie lokalnej), w których skany bibliotek (także fallback) czekają na koniec
+//   okna jak przy ready-path; precyzyjne odświeżenia elementów trwają dalej.
+// - RecentRefreshTTL: czas, przez który pomijamy ponowne precyzyjne odświeżenie tego samego itemId,
+//   np. gdy kilka folderów (lub triggerów) prowadzi do jednego serialu. 0 = wyłączone (domyślnie).
+//   Nie dotyczy usunięć ani itemId podanych przez trigger.
 type Config struct {
-	URL            string             `yaml:"url"`
-	Token          string             `yaml:"token"`
-	UserID         string             `yaml:"user_id"`         // NOWE
-	Library        string             `yaml:"library"`         // NOWE (opcjonalne; jeśli puste, wybieramy na podstawie ścieżki)
-	PreciseRefresh bool               `yaml:"precise_refresh"` // NOWE
-	Rewrite        []autoscan.Rewrite `yaml:"rewrite"`
-	Verbosity      string             `yaml:"verbosity"`
+	URL                     string             `yaml:"url"`
+	Token                   string             `yaml:"token"`
+	UserID                  string             `yaml:"user_id"`                    // NOWE
+	Library                 string             `yaml:"library"`                    // NOWE (opcjonalne; jeśli puste, wybieramy na podstawie ścieżki)
+	PreciseRefresh          bool               `yaml:"precise_refresh"`            // NOWE
+	RemoveDeleted           bool               `yaml:"remove_deleted"`             // usuwanie elementów przy skanach usunięcia
+	PauseOnPlayback         bool               `yaml:"pause_on_playback"`          // wstrzymanie skanów podczas odtwarzania
+	MaxDefer                time.Duration      `yaml:"max_defer"`                  // maksymalny czas wstrzymania skanów
+	WaitForRefresh          bool               `yaml:"wait_for_refresh"`           // oczekiwanie na zakończenie odświeżania
+	RefreshTimeout          time.Duration      `yaml:"refresh_timeout"`            // maksymalny czas oczekiwania na odświeżenie
+	SkipUnchanged           bool               `yaml:"skip_unchanged"`             // pomijanie odświeżania niezmienionych elementów
+	StrictLibraryMatch      bool               `yaml:"strict_library_match"`       // błąd zamiast ostrzeżenia bez pasującej biblioteki
+	TraceHTTP               bool               `yaml:"trace_http"`                 // logowanie żądań i odpowiedzi API (poziom trace)
+	ResolveSymlinks         bool               `yaml:"resolve_symlinks"`           // rozwiązywanie dowiązań symbolicznych w ścieżkach
+	AllowEmptyLibraries     bool               `yaml:"allow_empty_libraries"`      // zgoda na serwer bez bibliotek
+	BasicAuthUser           string             `yaml:"basic_auth_user"`            // użytkownik basic auth reverse proxy
+	BasicAuthPass           string             `yaml:"basic_auth_pass"`            // hasło basic auth reverse proxy
+	MaxMatchDepth           int                `yaml:"max_match_depth"`            // maksymalna głębokość dopasowania elementu
+	RefreshWorkers          int                `yaml:"refresh_workers"`            // liczba równoległych odświeżeń elementów
+	ScanTimeout             time.Duration      `yaml:"scan_timeout"`               // maksymalny czas jednego skanu (0 = bez limitu)
+	StrictRewrite           bool               `yaml:"strict_rewrite"`             // błąd, gdy żadna reguła rewrite nie zmieniła ścieżki
+	LibraryTypes            []string           `yaml:"library_types"`              // obsługiwane typy kolekcji bibliotek
+	LibraryMap              map[string]string  `yaml:"library_map"`                // prefiks ścieżki -> ViewID (bez wyszukiwania po nazwie)
+	SettleDelay             time.Duration      `yaml:"settle_delay"`               // opóźnienie wysłania skanu po minimum-age
+	ConfirmScan             bool               `yaml:"confirm_scan"`               // potwierdzenie, że skan biblioteki został zakolejkowany
+	LibraryUsers            map[string]string  `yaml:"library_users"`              // biblioteka lub prefiks ścieżki -> UserID
+	ScanMode                string             `yaml:"scan_mode"`                  // precise-only, precise-then-library lub library-only
+	RefreshInterval         time.Duration      `yaml:"refresh_interval"`           // odstęp między sprawdzeniami stanu odświeżania
+	ModeByType              map[string]string  `yaml:"mode_by_type"`               // typ kolekcji -> precise lub library
+	LazyLibraries           bool               `yaml:"lazy_libraries"`             // pobieranie bibliotek przy pierwszym skanie
+	LibraryScanWorkers      int                `yaml:"library_scan_workers"`       // liczba równoległych skanów całej biblioteki
+	FallbackUseLibraryTask  bool               `yaml:"fallback_use_library_task"`  // skan biblioteki przez jej zaplanowane zadanie
+	RefreshPollInitialDelay time.Duration      `yaml:"refresh_poll_initial_delay"` // opóźnienie pierwszego sprawdzenia stanu odświeżania
+	RefreshByEvent          map[string]string  `yaml:"refresh_by_event"`           // zdarzenie skanu -> precise, library, metadata lub remove
+	CoalesceLibraryScans    bool               `yaml:"coalesce_library_scans"`     // pominięcie skanu biblioteki, gdy trwa już inny
+	ExtensionRules          map[string]string  `yaml:"extension_rules"`            // rozszerzenie pliku -> scan, metadata lub ignore
+	Headers                 map[string]string  `yaml:"headers"`                    // dodatkowe nagłówki HTTP każdego żądania
+	RefreshGranularity      string             `yaml:"refresh_granularity"`        // item, season lub series
+	MultiMatch              string             `yaml:"multi_match"`                // all, first lub byType
+	MultiMatchTypes         []string           `yaml:"multi_match_types"`          // preferowane typy elementów przy byType
+	MinPathLength           int                `yaml:"min_path_length"`            // minimalna długość ścieżki po rewrite
+	WarmupViewIDs           bool               `yaml:"warmup_view_ids"`            // ustalenie ViewID bibliotek przy starcie
+	WarmupLibraries         []string           `yaml:"warmup_libraries"`           // biblioteki do WarmupViewIDs (puste = wszystkie)
+	StatFolders             bool               `yaml:"stat_folders"`               // sprawdzenie, czy folder skanu istnieje
+	MountAnchors            []string           `yaml:"mount_anchors"`              // pliki potwierdzające działający punkt montowania
+	TrimPrefix              string             `yaml:"trim_prefix"`                // prefiks usuwany z folderu skanu po rewrite
+	TrimSuffix              string             `yaml:"trim_suffix"`                // sufiks usuwany z folderu skanu po rewrite
+	FallbackWarnRate        float64            `yaml:"fallback_warn_rate"`         // odsetek fallbacków, od którego ostrzegamy
+	FallbackWarnWindow      time.Duration      `yaml:"fallback_warn_window"`       // okno, w którym liczymy odsetek fallbacków
+	DefaultLibrary          string             `yaml:"default_library"`            // biblioteka dla folderów spoza bibliotek
+	MaxRetries              int                `yaml:"max_retries"`                // liczba ponowień wstrzymanego skanu (0 = globalna)
+	RetryBackoff            time.Duration      `yaml:"retry_backoff"`              // opóźnienie pierwszego ponowienia (0 = globalne)
+	MaxRetryBackoff         time.Duration      `yaml:"max_retry_backoff"`          // maksymalne opóźnienie ponowienia (0 = globalne)
+	StrictLibraryPaths      bool               `yaml:"strict_library_paths"`       // dopasowanie biblioteki na granicy katalogu
+	AmbiguousLibrary        string             `yaml:"ambiguous_library"`          // error, longest lub first
+	AdminUserID             string             `yaml:"admin_user_id"`              // użytkownik bez ograniczeń dostępu do bibliotek
+	PathSeparator           string             `yaml:"path_separator"`             // separator ścieżek serwera: / lub \
+	QuietHours              []string           `yaml:"quiet_hours"`                // przedziały bez skanów bibliotek, np. 22:00-06:00
+	QuietTimezone           string             `yaml:"quiet_timezone"`             // strefa QuietHours (domyślnie lokalna)
+	RecentRefreshTTL        time.Duration      `yaml:"recent_refresh_ttl"`         // pomijanie ponownego odświeżenia itemId (0 = wyłączone)
+	ReadyPath               string             `yaml:"ready-path"`
+	Rewrite                 []autoscan.Rewrite `yaml:"rewrite"`
+	Verbosity               string             `yaml:"verbosity"`
+
+	// Baza danych dla SkipUnchanged, ustawiana przez autoscan (bez niej nic nie jest pomijane).
+	Db *sql.DB           `yaml:"-"`
+	Mg *migrate.Migrator `yaml:"-"`
+
+	// Własne ustalanie itemId (np. z zewnętrznej bazy), domyślnie dopasowanie po ścieżce.
+	Resolver ItemResolver `yaml:"-"`
+}
+
+// ItemResolver ustala itemId elementów Jellyfin do odświeżenia dla folderu skanu (po rewrite),
+// np. na podstawie zewnętrznej bazy, zamiast dopasowania folderu po ścieżce.
+// Brak itemId lub błąd oznacza powrót do skanu całej biblioteki.
+//
+// Domyślnie (Config.Resolver == nil) element jest wyszukiwany po dokładnej ścieżce (Path),
+// a filmy także po folderze. SkipUnchanged działa tylko z domyślnym dopasowaniem,
+// bo własny ItemResolver nie zwraca Etag elementów.
+type ItemResolver interface {
+	ResolveItems(ctx context.Context, library string, folder string) ([]string, error)
 }
 
+const (
+	// domyślny i maksymalny czas oczekiwania na zakończenie odświeżania.
+	defaultRefreshTimeout = 2 * time.Minute
+	maxRefreshTimeout     = 30 * time.Minute
+
+	// domyślna głębokość dopasowania, z zapasem dla typowych struktur (np. serial/sezon).
+	defaultMaxMatchDepth = 8
+
+	// domyślna liczba równoległych odświeżeń, aby nie przeciążać Jellyfin.
+	defaultRefreshWorkers = 4
+
+	// domyślna liczba równoległych skanów całej biblioteki, które są dla Jellyfin bardzo kosztowne.
+	defaultLibraryScanWorkers = 1
+
+	// liczba sprawdzeń stanu RefreshLibrary (co RefreshInterval) przy ConfirmScan.
+	confirmScanPolls = 3
+
+	// co ile procent postępu logujemy oczekiwanie na odświeżenie.
+	progressStep = 10
+
+	// najkrótszy RefreshInterval, aby nie zasypywać Jellyfin zapytaniami.
+	minRefreshInterval = time.Second
+
+	// o ile poziomów w górę szukamy istniejącego elementu usuniętego folderu.
+	maxAncestorSteps = 3
+
+	// domyślny próg i okno ostrzeżenia o częstych fallbackach precyzyjnego odświeżenia.
+	defaultFallbackWarnRate   = 0.8
+	defaultFallbackWarnWindow = time.Hour
+
+	// tyle precyzyjnych odświeżeń biblioteki w oknie potrzeba, zanim ocenimy odsetek fallbacków.
+	minFallbackAttempts = 10
+)
+
+// Tryby ScanMode.
+const (
+	scanModePreciseOnly        = "precise-only"
+	scanModePreciseThenLibrary = "precise-then-library"
+	scanModeLibraryOnly        = "library-only"
+)
+
+// Tryby ModeByType.
+const (
+	typeModePrecise = "precise"
+	typeModeLibrary = "library"
+)
+
+// Reguły ExtensionRules.
+const (
+	extensionScan     = "scan"
+	extensionMetadata = "metadata"
+	extensionIgnore   = "ignore"
+
+	// reguła rozszerzeń spoza mapy.
+	extensionOther = "*"
+)
+
+// Poziomy RefreshGranularity.
+const (
+	granularityItem   = "item"
+	granularitySeason = "season"
+	granularitySeries = "series"
+)
+
+// Tryby MultiMatch.
+const (
+	multiMatchAll    = "all"
+	multiMatchFirst  = "first"
+	multiMatchByType = "byType"
+)
+
+// Wybory AmbiguousLibrary.
+const (
+	ambiguousError   = "error"
+	ambiguousLongest = "longest"
+	ambiguousFirst   = "first"
+)
+
+var now = time.Now
+
+// Separatory PathSeparator.
+const (
+	separatorSlash     = "/"
+	separatorBackslash = `\`
+)
+
+// Strategie RefreshByEvent.
+const (
+	eventRefreshPrecise  = "precise"
+	eventRefreshLibrary  = "library"
+	eventRefreshMetadata = "metadata"
+	eventRefreshRemove   = "remove"
+)
+
+// outOfLibraryScans liczy skany spoza wszystkich bibliotek według pierwszego segmentu ścieżki,
+// co zwykle wskazuje na błędny rewrite lub brakującą bibliotekę.
+var outOfLibraryScans = metrics.Default.NewCounterVec(
+	"jellyfin_out_of_library_total",
+	"Number of scans outside of all Jellyfin libraries, by the top-level path segment.",
+	"segment")
+
+// unsafePaths liczy skany odrzucone, bo ich ścieżka po rewrite była pusta, katalogiem głównym
+// lub zbyt krótka, według powodu.
+var unsafePaths = metrics.Default.NewCounterVec(
+	"jellyfin_unsafe_paths_total",
+	"Number of scans refused because their rewritten path was empty, the root or too short, by reason.",
+	"reason")
+
+// preciseRefreshes liczy precyzyjne odświeżenia według biblioteki i wyniku (precise lub fallback).
+var preciseRefreshes = metrics.Default.NewCounterVec(
+	"jellyfin_precise_refreshes_total",
+	"Number of precise refreshes, by library and whether they refreshed the item or fell back to a library scan.",
+	"library", "result")
+
+// Wyniki precyzyjnego odświeżenia.
+const (
+	resultPrecise  = "precise"
+	resultFallback = "fallback"
+)
+
+// Powody odrzucenia ścieżki po rewrite.
+const (
+	unsafeEmpty = "empty"
+	unsafeRoot  = "root"
+	unsafeShort = "too short"
+)
+
+// refreshInterval to domyślny odstęp między kolejnymi sprawdzeniami stanu odświeżania.
+var refreshInterval = 2 * time.Second
+
 // target przechowuje bieżącą konfigurację i klienta API.
 // Trzymamy całe Config, aby mieć dostęp do UserID/Library/PreciseRefresh.
 type target struct {
 	cfg Config
 
-	libraries []library
+	libraries *libraryCache
+
+	// store przechowuje ostatnio widziany Etag elementów (nil, jeśli SkipUnchanged wyłączone).
+	store *datastore
+
+	// playback wstrzymuje skany, gdy w Jellyfin trwa odtwarzanie (nil, jeśli wyłączone).
+	playback *autoscan.PlaybackGuard
+
+	// libraryScans ogranicza liczbę jednoczesnych skanów całej biblioteki (LibraryScanWorkers).
+	libraryScans chan struct{}
+
+	// outOfLibrary zapamiętuje segmenty ścieżek skanów spoza bibliotek, które już zalogowaliśmy.
+	outOfLibrary *seenSegments
+
+	// noAccess zapamiętuje pary użytkownik i biblioteka bez dostępu, które już zalogowaliśmy.
+	noAccess *seenSegments
+
+	// matched zapamiętuje itemId dopasowanych folderów na potrzeby Inspect.
+	matched *matchedItems
+
+	// views zapamiętuje ViewID bibliotek według użytkownika (tylko przy WarmupViewIDs).
+	views *viewCache
+
+	// fallbacks śledzi odsetek fallbacków precyzyjnych odświeżeń bibliotek (FallbackWarnRate).
+	fallbacks *fallbackWatch
+
+	// quiet wstrzymuje skany bibliotek w QuietHours (nil, jeśli nie ustawiono).
+	quiet *autoscan.QuietHours
+
+	// recent zapamiętuje itemId odświeżone w ciągu RecentRefreshTTL.
+	recent *recentItems
 
 	log     zerolog.Logger
 	rewrite autoscan.Rewriter
 	api     apiClient
 }
 
+// libraryCache przechowuje biblioteki targetu. Przy LazyLibraries pobieramy je dopiero przy pierwszym
+// skanie i ponawiamy przy kolejnych, dopóki się nie uda (np. gdy serwer był niedostępny).
+type libraryCache struct {
+	mu        sync.Mutex
+	libraries []library
+	loaded    bool
+}
+
+// load pobiera biblioteki z Jellyfin i zapamiętuje je.
+func (lc *libraryCache) load(api apiClient, c Config, l zerolog.Logger) error {
+	libraries, err := api.Libraries()
+	if err != nil {
+		return api.redactError(err)
+	}
+
+	// Pusta lista zwykle oznacza token bez uprawnień administratora, błędny serwer
+	// lub brak bibliotek; wtedy każdy skan zostałby po cichu pominięty.
+	if len(libraries) == 0 && !c.AllowEmptyLibraries {
+		return fmt.Errorf("no libraries found: check that the token is an API key or belongs to an administrator, "+
+			"that the server has libraries and that user_id is correct, "+
+			"or set allow_empty_libraries: %w", autoscan.ErrFatal)
+	}
+
+	// Błędna nazwa DefaultLibrary wychodzi na jaw od razu, a nie dopiero przy skanie spoza bibliotek.
+	if c.DefaultLibrary != "" {
+		if _, ok := findLibrary(libraries, c.DefaultLibrary); !ok {
+			return fmt.Errorf("default_library %q: no such library: %w", c.DefaultLibrary, autoscan.ErrFatal)
+		}
+	}
+
+	if c.FallbackUseLibraryTask {
+		if err := resolveLibraryTasks(api, libraries, l); err != nil {
+			return api.redactError(err)
+		}
+	}
+
+	if c.ResolveSymlinks {
+		for _, lib := range libraries {
+			for i, path := range lib.Paths {
+				lib.Paths[i] = withTrailingSlash(resolveSymlinks(path))
+			}
+		}
+	}
+
+	l.Debug().
+		Interface("libraries", libraries).
+		Msg("Retrieved libraries")
+
+	lc.libraries = libraries
+	lc.loaded = true
+	return nil
+}
+
+// resolveLibraryTasks ustala zaplanowane zadanie każdej biblioteki: jedyne zadanie, którego nazwa zawiera
+// nazwę biblioteki. Zadanie RefreshLibrary skanuje cały serwer, więc nigdy nie jest zadaniem biblioteki.
+func resolveLibraryTasks(api apiClient, libraries []library, l zerolog.Logger) error {
+	tasks, err := api.ScheduledTasks(context.Background())
+	if err != nil {
+		return err
+	}
+
+	for i := range libraries {
+		lib := &libraries[i]
+
+		matches := make([]scheduledTask, 0)
+		for _, task := range tasks {
+			if task.Key != "RefreshLibrary" && strings.Contains(normalizeName(task.Name), normalizeName(lib.Name)) {
+				matches = append(matches, task)
+			}
+		}
+
+		switch len(matches) {
+		case 0:
+			l.Warn().Str("library", lib.Name).
+				Msg("No scheduled task found for the library; library scans are sent by path")
+		case 1:
+			lib.TaskID = matches[0].ID
+			l.Debug().Str("library", lib.Name).Str("task", matches[0].Name).Str("taskId", lib.TaskID).
+				Msg("Using the scheduled task of the library for library scans")
+		default:
+			l.Warn().Str("library", lib.Name).Int("tasks", len(matches)).
+				Msg("Several scheduled tasks match the library; library scans are sent by path")
+		}
+	}
+
+	return nil
+}
+
+// loadLibraries pobiera biblioteki, jeśli nie zostały jeszcze pobrane (LazyLibraries).
+func (t target) loadLibraries() error {
+	t.libraries.mu.Lock()
+	defer t.libraries.mu.Unlock()
+
+	if t.libraries.loaded {
+		return nil
+	}
+
+	if err := t.libraries.load(t.api, t.cfg, t.log); err != nil {
+		return err
+	}
+
+	if t.cfg.WarmupViewIDs {
+		t.warmupViews(context.Background(), t.libraries.libraries)
+	}
+	return nil
+}
+
 func New(c Config) (autoscan.Target, error) {
-	l := autoscan.GetLogger(c.Verbosity).With().
+	t, err := newTarget(c, newAPIClient(c, targetLogger(c)))
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// targetLogger zwraca logger targetu i jego klienta API.
+func targetLogger(c Config) zerolog.Logger {
+	return autoscan.GetLogger(c.Verbosity).With().
 		Str("target", "jellyfin").
-		Str("url", c.URL).
+		Str("url", redact(c.URL, c.Token)).
 		Logger()
+}
+
+// newTarget tworzy target korzystający z podanego klienta API; testy mogą podać fałszywego klienta
+// i sprawdzić Scan bez serwera Jellyfin.
+func newTarget(c Config, api apiClient) (*target, error) {
+	l := targetLogger(c)
 
 	rewriter, err := autoscan.NewRewriter(c.Rewrite)
 	if err != nil {
 		return nil, err
 	}
 
-	api := newAPIClient(c.URL, c.Token, l)
+	// ScanMode nadpisuje PreciseRefresh; bez niego zachowanie pozostaje jak dotąd.
+	switch c.ScanMode {
+	case "":
+		c.ScanMode = scanModeLibraryOnly
+		if c.PreciseRefresh {
+			c.ScanMode = scanModePreciseThenLibrary
+		}
+	case scanModePreciseOnly, scanModePreciseThenLibrary, scanModeLibraryOnly:
+		c.PreciseRefresh = c.ScanMode != scanModeLibraryOnly
+	default:
+		return nil, fmt.Errorf("invalid scan_mode: %q, expected one of %s, %s or %s: %w",
+			c.ScanMode, scanModePreciseOnly, scanModePreciseThenLibrary, scanModeLibraryOnly, autoscan.ErrFatal)
+	}
+
+	for collectionType, mode := range c.ModeByType {
+		if mode != typeModePrecise && mode != typeModeLibrary {
+			return nil, fmt.Errorf("invalid mode_by_type of %s: %q, expected %s or %s: %w",
+				collectionType, mode, typeModePrecise, typeModeLibrary, autoscan.ErrFatal)
+		}
+	}
+
+	for event, strategy := range c.RefreshByEvent {
+		switch strategy {
+		case eventRefreshPrecise, eventRefreshLibrary, eventRefreshMetadata, eventRefreshRemove:
+		default:
+			return nil, fmt.Errorf("invalid refresh_by_event of %s: %q, expected one of %s, %s, %s or %s: %w",
+				event, strategy, eventRefreshPrecise, eventRefreshLibrary, eventRefreshMetadata, eventRefreshRemove, autoscan.ErrFatal)
+		}
+	}
 
-	libraries, err := api.Libraries()
+	switch c.MultiMatch {
+	case "":
+		c.MultiMatch = multiMatchFirst
+	case multiMatchAll, multiMatchFirst:
+	case multiMatchByType:
+		if len(c.MultiMatchTypes) == 0 {
+			return nil, fmt.Errorf("multi_match %s requires multi_match_types: %w", multiMatchByType, autoscan.ErrFatal)
+		}
+	default:
+		return nil, fmt.Errorf("invalid multi_match: %q, expected one of %s, %s or %s: %w",
+			c.MultiMatch, multiMatchAll, multiMatchFirst, multiMatchByType, autoscan.ErrFatal)
+	}
+
+	switch c.AmbiguousLibrary {
+	case "":
+		c.AmbiguousLibrary = ambiguousError
+	case ambiguousError, ambiguousLongest, ambiguousFirst:
+	default:
+		return nil, fmt.Errorf("invalid ambiguous_library: %q, expected one of %s, %s or %s: %w",
+			c.AmbiguousLibrary, ambiguousError, ambiguousLongest, ambiguousFirst, autoscan.ErrFatal)
+	}
+
+	switch c.PathSeparator {
+	case "":
+		c.PathSeparator = separatorSlash
+	case separatorSlash, separatorBackslash:
+	default:
+		return nil, fmt.Errorf("invalid path_separator: %q, expected %s or %s: %w",
+			c.PathSeparator, separatorSlash, separatorBackslash, autoscan.ErrFatal)
+	}
+
+	quiet, err := autoscan.NewQuietHours(c.QuietHours, c.QuietTimezone)
 	if err != nil {
+		return nil, fmt.Errorf("invalid quiet_hours: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	switch c.RefreshGranularity {
+	case "":
+		c.RefreshGranularity = granularityItem
+	case granularityItem, granularitySeason, granularitySeries:
+	default:
+		return nil, fmt.Errorf("invalid refresh_granularity: %q, expected one of %s, %s or %s: %w",
+			c.RefreshGranularity, granularityItem, granularitySeason, granularitySeries, autoscan.ErrFatal)
+	}
+
+	rules := make(map[string]string, len(c.ExtensionRules))
+	for ext, rule := range c.ExtensionRules {
+		switch rule {
+		case extensionScan, extensionMetadata, extensionIgnore:
+		default:
+			return nil, fmt.Errorf("invalid extension_rules of %s: %q, expected one of %s, %s or %s: %w",
+				ext, rule, extensionScan, extensionMetadata, extensionIgnore, autoscan.ErrFatal)
+		}
+
+		rules[normalizeExtension(ext)] = rule
+	}
+	c.ExtensionRules = rules
+
+	libraries := &libraryCache{}
+	if c.LazyLibraries {
+		l.Debug().Msg("Retrieving libraries on the first scan")
+	} else if err := libraries.load(api, c, l); err != nil {
 		return nil, err
 	}
 
-	l.Debug().
-		Interface("libraries", libraries).
-		Msg("Retrieved libraries")
+	var playback *autoscan.PlaybackGuard
+	if c.PauseOnPlayback {
+		playback = autoscan.NewPlaybackGuard(api.ActiveSessions, c.MaxDefer, l)
+	}
+
+	var store *datastore
+	if c.SkipUnchanged && c.Db != nil {
+		if store, err = newDatastore(c.Db, c.Mg); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.MaxMatchDepth <= 0 {
+		c.MaxMatchDepth = defaultMaxMatchDepth
+	}
 
-	return &target{
+	if c.RefreshWorkers <= 0 {
+		c.RefreshWorkers = defaultRefreshWorkers
+	}
+
+	if c.LibraryScanWorkers <= 0 {
+		c.LibraryScanWorkers = defaultLibraryScanWorkers
+	}
+
+	switch {
+	case c.RefreshInterval <= 0:
+		c.RefreshInterval = refreshInterval
+	case c.RefreshInterval < minRefreshInterval:
+		c.RefreshInterval = minRefreshInterval
+	}
+
+	switch {
+	case c.RefreshTimeout <= 0:
+		c.RefreshTimeout = defaultRefreshTimeout
+	case c.RefreshTimeout > maxRefreshTimeout:
+		c.RefreshTimeout = maxRefreshTimeout
+	}
+
+	if c.FallbackWarnRate <= 0 {
+		c.FallbackWarnRate = defaultFallbackWarnRate
+	}
+
+	if c.FallbackWarnWindow <= 0 {
+		c.FallbackWarnWindow = defaultFallbackWarnWindow
+	}
+
+	t := &target{
 		cfg: c,
 
-		libraries: libraries,
-		log:       l,
-		rewrite:   rewriter,
-		api:       api,
-	}, nil
+		libraries:    libraries,
+		store:        store,
+		playback:     playback,
+		libraryScans: make(chan struct{}, c.LibraryScanWorkers),
+		outOfLibrary: &seenSegments{seen: make(map[string]bool)},
+		noAccess:     &seenSegments{seen: make(map[string]bool)},
+		matched:      &matchedItems{items: make(map[string]matchedItem)},
+		views:        &viewCache{views: make(map[viewKey]string)},
+		fallbacks:    newFallbackWatch(c.FallbackWarnRate, c.FallbackWarnWindow),
+		quiet:        quiet,
+		recent:       &recentItems{ttl: c.RecentRefreshTTL, refreshed: make(map[string]time.Time)},
+		log:          l,
+		rewrite:      rewriter,
+		api:          api,
+	}
+
+	// Przy LazyLibraries ViewID ustalamy dopiero po pobraniu bibliotek przy pierwszym skanie.
+	if c.WarmupViewIDs && !c.LazyLibraries {
+		t.warmupViews(context.Background(), libraries.libraries)
+	}
+
+	return t, nil
+}
+
+func (t target) String() string {
+	return fmt.Sprintf("jellyfin: %s", t.api.redact(t.cfg.URL))
 }
 
 func (t target) Available() error {
 	return t.api.Available()
 }
 
-func (t target) Scan(scan autoscan.Scan) error {
-	// Przepisz ścieżkę według rewrite (perspektywa Jellyfin).
-	scanFolder := t.rewrite(scan.Folder)
+// SetToken podmienia token klienta API; kolejne żądania używają już nowego tokenu.
+func (t target) SetToken(token string) {
+	if token == "" || token == t.api.token() {
+		return
+	}
+
+	t.api.setToken(token)
+	t.log.Info().Msg("Jellyfin token rotated")
+}
+
+// ScanTimeout ogranicza czas jednego skanu, niezależnie od scan-timeout procesora.
+func (t target) ScanTimeout() time.Duration {
+	return t.cfg.ScanTimeout
+}
+
+// SettleDelay opóźnia wysłanie skanu do tego targetu, liczone od osiągnięcia minimum-age.
+func (t target) SettleDelay() time.Duration {
+	return t.cfg.SettleDelay
+}
+
+// RetryPolicy zastępuje globalną politykę ponawiania skanów wstrzymanych dla tego targetu.
+func (t target) RetryPolicy() autoscan.RetryPolicy {
+	return autoscan.RetryPolicy{
+		MaxRetries: t.cfg.MaxRetries,
+		Backoff:    t.cfg.RetryBackoff,
+		MaxBackoff: t.cfg.MaxRetryBackoff,
+	}
+}
 
-	// Ustal bibliotekę na podstawie ścieżki.
-	lib, err := t.getScanLibrary(scanFolder)
+// Libraries pobiera aktualną listę bibliotek (nazwa, typ kolekcji i ścieżki).
+func (t target) Libraries(ctx context.Context) ([]autoscan.Library, error) {
+	libraries, err := t.api.Libraries()
 	if err != nil {
-		t.log.Warn().
-			Err(err).
-			Msg("No target libraries found")
-		return nil
+		return nil, err
 	}
 
-	l := t.log.With().
-		Str("path", scanFolder).
-		Str("library", lib.Name).
-		Logger()
+	result := make([]autoscan.Library, 0, len(libraries))
+	for _, lib := range libraries {
+		result = append(result, autoscan.Library{
+			Name:  lib.Name,
+			Type:  lib.Type,
+			Paths: lib.Paths,
+		})
+	}
 
-	// Jeśli włączony precyzyjny refresh – najpierw spróbuj odświeżyć
-	// tylko wskazany element po jego itemId (dokładne dopasowanie Path).
-	if t.cfg.PreciseRefresh {
-		l.Trace().Msg("Trying precise Jellyfin refresh by itemId")
+	return result, nil
+}
 
-		// Ustal ViewID biblioteki: jeśli w configu podano Library, użyj jej,
-		// w przeciwnym razie bierz nazwę biblioteki z dopasowania ścieżki.
-		libraryName := t.cfg.Library
-		if strings.TrimSpace(libraryName) == "" {
-			libraryName = lib.Name
+// RefreshLibrary skanuje całą bibliotekę o podanej nazwie (lub wszystkie przy pustej nazwie)
+// niezależnie od precyzyjnego odświeżania, np. do ręcznego uzgodnienia po masowych zmianach plików.
+// Biblioteki są skanowane po kolei, pierwszy błąd przerywa odświeżanie.
+func (t target) RefreshLibrary(ctx context.Context, name string) (refreshed []string, err error) {
+	defer func() { err = t.api.redactError(err) }()
+
+	libraries, err := t.librariesNamed(name)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range libraries {
+		l := t.log.With().Str("library", libraries[i].Name).Logger()
+
+		l.Info().Msg("Full library refresh requested")
+		if err := t.fullLibraryScan(ctx, l, &libraries[i]); err != nil {
+			return refreshed, fmt.Errorf("%s: %w", libraries[i].Name, err)
 		}
 
-		viewID, vErr := t.api.GetViewID(t.cfg.UserID, libraryName)
-		if vErr != nil {
-			l.Warn().Err(vErr).Str("library", libraryName).
-				Msg("Cannot resolve Jellyfin viewId; falling back to library scan")
+		l.Info().Msg("Full library refresh moved to target")
+		refreshed = append(refreshed, libraries[i].Name)
+	}
+
+	return refreshed, nil
+}
+
+// DryRunLibrary opisuje RefreshLibrary: loguje biblioteki, które zostałyby zeskanowane, niczego nie skanując.
+func (t target) DryRunLibrary(_ context.Context, name string) (refreshed []string, err error) {
+	defer func() { err = t.api.redactError(err) }()
+
+	libraries, err := t.librariesNamed(name)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range libraries {
+		l := t.log.With().Str("library", libraries[i].Name).Logger()
+
+		if libraries[i].TaskID != "" {
+			l.Info().Str("taskId", libraries[i].TaskID).Msg("Dry run, library scan task not started (full library refresh)")
 		} else {
-			itemID, fErr := t.api.FindItemIDByPath(t.cfg.UserID, viewID, scanFolder)
-			if fErr != nil {
-				l.Warn().Err(fErr).Str("path", scanFolder).
-					Msg("Cannot match Jellyfin item by exact Path; falling back to library scan")
-			} else if strings.TrimSpace(itemID) != "" {
-				// Odśwież tylko ten element (rekurencyjnie).
-				if rErr := t.api.RefreshItem(itemID); rErr != nil {
-					l.Error().Err(rErr).Str("itemId", itemID).
-						Msg("Jellyfin item refresh failed; falling back to library scan")
-				} else {
-					l.Info().Str("itemId", itemID).
-						Msg("Refreshed Jellyfin item recursively (precise refresh)")
-					return nil
-				}
-			}
+			l.Info().Msg("Dry run, library scan not sent to target (full library refresh)")
 		}
+
+		refreshed = append(refreshed, libraries[i].Name)
 	}
 
-	// Fallback lub tryb klasyczny: wyślij standardowy skan (cała biblioteka).
-	l.Trace().Msg("Sending library scan request (fallback or precise_refresh disabled)")
-	if err := t.api.Scan(scanFolder); err != nil {
-		return err
+	return refreshed, nil
+}
+
+// librariesNamed zwraca bibliotekę o podanej nazwie lub wszystkie biblioteki przy pustej nazwie.
+func (t target) librariesNamed(name string) ([]library, error) {
+	if err := t.loadLibraries(); err != nil {
+		return nil, err
 	}
-	l.Info().Msg("Scan moved to target")
-	return nil
+
+	t.libraries.mu.Lock()
+	libraries := t.libraries.libraries
+	t.libraries.mu.Unlock()
+
+	if name == "" {
+		return libraries, nil
+	}
+
+	lib, ok := findLibrary(libraries, name)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", name, autoscan.ErrUnknownLibrary)
+	}
+
+	return []library{*lib}, nil
 }
 
-// getScanLibrary zwraca bibliotekę, do której należy ścieżka (po rewrite).
-func (t target) getScanLibrary(folder string) (*library, error) {
-	for _, l := range t.libraries {
-		if strings.HasPrefix(folder, l.Path) {
-			return &l, nil
+// Inspect opisuje, jak target obsłuży skan: bibliotekę, itemId (jeśli folder był już dopasowany)
+// i to, czy odświeży element. Korzysta tylko z zapamiętanych bibliotek i dopasowań, bez zapytań do Jellyfin,
+// więc przy LazyLibraries przed pierwszym skanem nie zna bibliotek.
+func (t target) Inspect(scan autoscan.Scan) (autoscan.Inspection, bool) {
+	folder, err := t.rewritePath(scan)
+	if err != nil || t.unsafePath(folder) != "" {
+		return autoscan.Inspection{}, false
+	}
+
+	lib, _, err := t.scanLibrary(scan, folder)
+	if err != nil && !errors.Is(err, autoscan.ErrScanRefused) {
+		if def, ok := t.defaultLibrary(); ok && t.extensionRule(scan) != extensionIgnore {
+			return autoscan.Inspection{Library: def.Name}, true
 		}
 	}
-	return nil, fmt.Errorf("%v: failed determining library", folder)
+	if err != nil || !t.handlesType(lib.Type) || t.extensionRule(scan) == extensionIgnore {
+		return autoscan.Inspection{}, false
+	}
+
+	if scan.CollectionName != "" && !scan.Removed {
+		return autoscan.Inspection{Library: lib.Name, Precise: true}, true
+	}
+
+	if ids := scanItemIDs(scan); len(ids) > 0 && !scan.Removed {
+		return autoscan.Inspection{Library: lib.Name, ItemID: ids[0], Precise: true}, true
+	}
+
+	precise, strategy := t.refreshStrategy(lib, scan)
+	return autoscan.Inspection{
+		Library: lib.Name,
+		ItemID:  t.matched.get(folder),
+		Precise: precise || strategy == eventRefreshMetadata,
+	}, true
+}
+
+func (t target) Scan(ctx context.Context, scan autoscan.Scan) (err error) {
+	// Token nie może trafić do logów procesora ani powiadomień, także w błędach HTTP.
+	defer func() { err = t.api.redactError(err) }()
+
+	// Wstrzymaj skany, dopóki ścieżka gotowości (np. punkt montowania) nie istnieje.
+	if err := autoscan.CheckReadyPath(t.cfg.ReadyPath); err != nil {
+		return err
+	}
+
+	// Wstrzymaj skany, dopóki trwa odtwarzanie (najdłużej max_defer).
+	if err := t.playback.Check(ctx); err != nil {
+		return err
+	}
+
+	// Przepisz ścieżkę według rewrite (perspektywa Jellyfin) i opcjonalnie rozwiąż dowiązania.
+	scanFolder, err := t.rewritePath(scan)
+	if err != nil {
+		return err
+	}
+
+	// Nigdy nie skanujemy pustej ścieżki ani katalogu głównego po błędnym rewrite.
+	if err := t.checkPath(scan, scanFolder); err != nil {
+		return err
+	}
+
+	// Przy StatFolders brakujący folder skanujemy dopiero, gdy punkt montowania działa.
+	if err := t.checkFolder(scan, scanFolder); err != nil {
+		return err
+	}
+
+	// ExtensionRules: zmiana pliku tego typu nie wymaga odświeżenia.
+	if t.extensionRule(scan) == extensionIgnore {
+		t.log.Debug().Str("id", scan.ID).Str("file", scan.File).
+			Msg("File extension ignored by extension_rules; skipping scan")
+		autoscan.ReportRefresh(ctx, autoscan.RefreshSkipped, "")
+		return nil
+	}
+
+	// Trigger podał nazwę kolekcji: odśwież kolekcję (BoxSet) zamiast dopasowania ścieżki.
+	if scan.CollectionName != "" && !scan.Removed {
+		l := t.log.With().
+			Str("id", scan.ID).
+			Str("path", scanFolder).
+			Str("collection", scan.CollectionName).
+			Logger()
+
+		itemID, err := t.api.FindCollection(ctx, scan.CollectionName)
+		if err == nil {
+			err = t.api.RefreshItem(ctx, itemID)
+		}
+		if err == nil {
+			l.Debug().Str("itemId", itemID).Msg("Refreshed Jellyfin collection recursively (name from the trigger)")
+			autoscan.ReportRefresh(ctx, autoscan.RefreshPrecise, itemID)
+
+			if t.cfg.WaitForRefresh {
+				t.waitForRefresh(ctx, l)
+			}
+			return nil
+		}
+
+		l.Warn().Err(err).Msg("Jellyfin collection refresh failed; falling back to path matching")
+	}
+
+	// Trigger podał listę itemId: odśwież wszystkie elementy naraz (bez powtórzeń,
+	// najwyżej RefreshWorkers równolegle), bez dopasowania ścieżki.
+	if len(scan.ItemIDs) > 0 && !scan.Removed {
+		ids := scanItemIDs(scan)
+		l := t.log.With().
+			Str("id", scan.ID).
+			Str("path", scanFolder).
+			Strs("itemIds", ids).
+			Logger()
+
+		items := make([]item, len(ids))
+		for i, id := range ids {
+			items[i] = item{ID: id}
+		}
+
+		_, err := t.refreshItems(ctx, items)
+		if err == nil {
+			l.Debug().Msg("Refreshed Jellyfin items recursively (itemIds from the trigger)")
+			autoscan.ReportRefresh(ctx, autoscan.RefreshPrecise, ids[0])
+
+			if t.cfg.WaitForRefresh {
+				t.waitForRefresh(ctx, l)
+			}
+			return nil
+		}
+
+		l.Warn().Err(err).Msg("Jellyfin item refresh by itemIds failed; falling back to path matching")
+	}
+
+	// Trigger podał itemId: odśwież element od razu, bez dopasowania ścieżki.
+	if scan.ItemID != "" && len(scan.ItemIDs) == 0 && !scan.Removed {
+		l := t.log.With().
+			Str("id", scan.ID).
+			Str("path", scanFolder).
+			Str("itemId", scan.ItemID).
+			Logger()
+
+		err := t.api.RefreshItem(ctx, scan.ItemID)
+		if err == nil {
+			l.Debug().Msg("Refreshed Jellyfin item recursively (itemId from the trigger)")
+			autoscan.ReportRefresh(ctx, autoscan.RefreshPrecise, scan.ItemID)
+
+			if t.cfg.WaitForRefresh {
+				t.waitForRefresh(ctx, l)
+			}
+			return nil
+		}
+
+		l.Warn().Err(err).Msg("Jellyfin item refresh by itemId failed; falling back to path matching")
+	}
+
+	// Przy LazyLibraries pobierz biblioteki przy pierwszym skanie; błąd ponawia skan później.
+	if err := t.loadLibraries(); err != nil {
+		return err
+	}
+
+	// Ustal bibliotekę: wskazaną przez trigger (LibraryHint) lub na podstawie ścieżki.
+	lib, hinted, err := t.scanLibrary(scan, scanFolder)
+	if scan.LibraryHint != "" && !hinted {
+		t.log.Warn().Str("id", scan.ID).Str("hint", scan.LibraryHint).
+			Msg("Library hint does not name a Jellyfin library; falling back to path matching")
+	}
+	if errors.Is(err, autoscan.ErrScanRefused) {
+		return err
+	}
+	if err != nil {
+		// Folder spoza bibliotek: przy DefaultLibrary skanujemy całą bibliotekę domyślną.
+		if def, ok := t.defaultLibrary(); ok {
+			return t.defaultLibraryScan(ctx, scan, scanFolder, def)
+		}
+	}
+	if err != nil && t.cfg.StrictLibraryMatch {
+		return fmt.Errorf("%v: %w", err, autoscan.ErrScanRefused)
+	}
+	if err != nil {
+		t.outOfLibraryScan(scan, scanFolder, err)
+		autoscan.ReportRefresh(ctx, autoscan.RefreshSkipped, "")
+		return nil
+	}
+
+	l := t.log.With().
+		Str("id", scan.ID).
+		Str("path", scanFolder).
+		Str("library", lib.Name).
+		Logger()
+
+	// Biblioteka wskazana przez trigger wyznacza także ViewID, zamiast Library i library_map z configu;
+	// t jest kopią, więc zmiana dotyczy tylko tego skanu.
+	if hinted {
+		l.Debug().Msg("Using the library hint of the trigger")
+		t.cfg.Library = ""
+		t.cfg.LibraryMap = nil
+	}
+
+	// Pomiń biblioteki, których typ obsługuje inny target.
+	if !t.handlesType(lib.Type) {
+		l.Debug().Str("type", lib.Type).Msg("Library type not handled by this target; skipping scan")
+		autoscan.ReportRefresh(ctx, autoscan.RefreshSkipped, "")
+		return nil
+	}
+
+	// RefreshByEvent i ExtensionRules dobierają sposób odświeżenia do zdarzenia i pliku skanu.
+	precise, strategy := t.refreshStrategy(lib, scan)
+
+	// Skan usunięcia: jeśli włączone remove_deleted, zgłoś ścieżkę jako usuniętą,
+	// aby Jellyfin usunął element (bez precyzyjnego odświeżania nieistniejącej ścieżki).
+	if (scan.Removed && t.cfg.RemoveDeleted) || strategy == eventRefreshRemove {
+		l.Trace().Msg("Sending removal request")
+		if err := t.api.Remove(ctx, t.serverPath(scanFolder)); err != nil {
+			return err
+		}
+		l.Debug().Msg("Removal moved to target")
+		autoscan.ReportRefresh(ctx, autoscan.RefreshRemoval, "")
+
+		// Jedno odświeżenie folderu nadrzędnego uzgadnia w Jellyfin wszystkie brakujące elementy;
+		// usunięcia w tym samym folderze procesor łączy w jeden skan.
+		if precise {
+			t.refreshParent(ctx, l, lib, scanFolder)
+		}
+		return nil
+	}
+
+	// Zmiana samych metadanych: odśwież metadane elementu bez skanowania plików,
+	// a bez dopasowanego elementu postępuj jak dla innych zdarzeń.
+	if strategy == eventRefreshMetadata {
+		if itemID, ok := t.refreshMetadata(ctx, l, lib, scanFolder); ok {
+			l.Debug().Str("itemId", itemID).Msg("Refreshed Jellyfin item metadata (refresh_by_event or extension_rules)")
+			autoscan.ReportRefresh(ctx, autoscan.RefreshPrecise, itemID)
+			return nil
+		}
+	}
+
+	// Jeśli włączony precyzyjny refresh – najpierw spróbuj odświeżyć
+	// tylko wskazany element po jego itemId (dokładne dopasowanie Path).
+	// Usunięty folder zwykle nie ma już elementu, więc odświeżamy najbliższy istniejący.
+	if precise {
+		l.Trace().Msg("Trying precise Jellyfin refresh by itemId")
+
+		var res RefreshResult
+		if scan.Removed {
+			res = t.removedRefresh(ctx, l, lib, scanFolder)
+		} else {
+			res = t.preciseRefresh(ctx, l, lib, scanFolder)
+		}
+		t.preciseResult(l, lib, res.Fallback && !res.Unchanged)
+
+		switch {
+		case res.Unchanged:
+			l.Debug().Str("itemId", res.ItemID).Str("itemType", res.ItemType).
+				Msg("Jellyfin item unchanged; skipping precise refresh")
+			autoscan.ReportRefresh(ctx, autoscan.RefreshSkipped, res.ItemID)
+			return nil
+		case res.Recent:
+			l.Debug().Str("itemId", res.ItemID).Str("itemType", res.ItemType).
+				Dur("recent_refresh_ttl", t.cfg.RecentRefreshTTL).
+				Msg("Jellyfin item refreshed recently; skipping precise refresh")
+			autoscan.ReportRefresh(ctx, autoscan.RefreshSkipped, res.ItemID)
+			return nil
+		case !res.Fallback:
+			l.Debug().Str("itemId", res.ItemID).Str("itemType", res.ItemType).Int("items", res.Refreshed).
+				Msg("Refreshed Jellyfin item recursively (precise refresh)")
+			autoscan.ReportRefresh(ctx, autoscan.RefreshPrecise, res.ItemID)
+
+			if t.cfg.WaitForRefresh {
+				t.waitForRefresh(ctx, l)
+			}
+			return nil
+		}
+
+		// Bez skanu biblioteki: skan czeka na ten target i jest ponawiany później.
+		if t.cfg.ScanMode == scanModePreciseOnly {
+			return fmt.Errorf("%s: no Jellyfin item refreshed in %s scan mode: %w",
+				scanFolder, scanModePreciseOnly, autoscan.ErrTargetNotReady)
+		}
+	}
+
+	// W QuietHours skan biblioteki czeka na koniec okna, precyzyjne odświeżenie już się odbyło.
+	if err := t.quietHours(l); err != nil {
+		return fmt.Errorf("%s: %w", scanFolder, err)
+	}
+
+	// Fallback lub tryb klasyczny: wyślij standardowy skan (cała biblioteka),
+	// najwyżej LibraryScanWorkers naraz.
+	release, err := t.acquireLibraryScan(ctx, l)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	refresh := autoscan.RefreshLibrary
+	if precise {
+		refresh = autoscan.RefreshFallback
+	}
+
+	// Trwający skan obejmie także ten folder, więc nie zlecamy kolejnego.
+	if t.cfg.CoalesceLibraryScans && t.libraryScanRunning(ctx, l, lib) {
+		l.Debug().Msg("Library scan already running on target; coalesced into the running scan")
+		autoscan.ReportRefresh(ctx, autoscan.RefreshSkipped, "")
+		return nil
+	}
+
+	// Zadanie biblioteki skanuje tylko ją, także gdy Jellyfin ignoruje zgłoszenie ścieżki.
+	// ConfirmScan sprawdza zadanie RefreshLibrary, więc go tu nie dotyczy.
+	if lib.TaskID != "" {
+		l.Trace().Str("taskId", lib.TaskID).Msg("Starting the scheduled task of the library")
+		if err := t.api.RunTask(ctx, lib.TaskID); err != nil {
+			return err
+		}
+		l.Debug().Str("taskId", lib.TaskID).Msg("Library scan task started on target")
+		autoscan.ReportRefresh(ctx, refresh, "")
+		return nil
+	}
+
+	l.Trace().Msg("Sending library scan request (fallback or precise_refresh disabled)")
+	if err := t.api.Scan(ctx, t.serverPath(scanFolder)); err != nil {
+		return err
+	}
+	l.Debug().Msg("Scan moved to target")
+	autoscan.ReportRefresh(ctx, refresh, "")
+
+	if t.cfg.ConfirmScan {
+		t.confirmScan(ctx, l)
+	}
+	return nil
+}
+
+// DryRun opisuje, jak skan zostałby obsłużony, niczego nie zmieniając w Jellyfin.
+// Przy precyzyjnym odświeżaniu odczytuje jedynie widoki i elementy, aby ustalić itemId.
+func (t target) DryRun(ctx context.Context, scan autoscan.Scan) (err error) {
+	defer func() { err = t.api.redactError(err) }()
+
+	scanFolder, err := t.rewritePath(scan)
+	if err != nil {
+		return err
+	}
+
+	if err := t.checkPath(scan, scanFolder); err != nil {
+		return err
+	}
+
+	if err := t.checkFolder(scan, scanFolder); err != nil {
+		return err
+	}
+
+	if t.extensionRule(scan) == extensionIgnore {
+		t.log.Info().
+			Str("id", scan.ID).
+			Str("file", scan.File).
+			Msg("Dry run, file extension ignored by extension_rules")
+		return nil
+	}
+
+	if scan.CollectionName != "" && !scan.Removed {
+		t.log.Info().
+			Str("id", scan.ID).
+			Str("path", scanFolder).
+			Str("collection", scan.CollectionName).
+			Msg("Dry run, collection not refreshed (name from the trigger)")
+		return nil
+	}
+
+	if ids := scanItemIDs(scan); len(ids) > 0 && !scan.Removed {
+		t.log.Info().
+			Str("id", scan.ID).
+			Str("path", scanFolder).
+			Strs("itemIds", ids).
+			Msg("Dry run, items not refreshed (itemIds from the trigger)")
+		return nil
+	}
+
+	if err := t.loadLibraries(); err != nil {
+		return err
+	}
+
+	lib, _, err := t.scanLibrary(scan, scanFolder)
+	if errors.Is(err, autoscan.ErrScanRefused) {
+		return err
+	}
+	if err != nil {
+		if def, ok := t.defaultLibrary(); ok {
+			t.log.Info().
+				Str("id", scan.ID).
+				Str("path", scanFolder).
+				Str("library", def.Name).
+				Msg("Dry run, folder outside of all libraries, default library not scanned")
+			return nil
+		}
+	}
+	if err != nil && t.cfg.StrictLibraryMatch {
+		return fmt.Errorf("%v: %w", err, autoscan.ErrScanRefused)
+	}
+	if err != nil {
+		t.log.Warn().
+			Err(err).
+			Str("id", scan.ID).
+			Msg("No target libraries found")
+		return nil
+	}
+
+	l := t.log.With().
+		Str("id", scan.ID).
+		Str("path", scanFolder).
+		Str("library", lib.Name).
+		Logger()
+
+	// Pomiń biblioteki, których typ obsługuje inny target.
+	if !t.handlesType(lib.Type) {
+		l.Debug().Str("type", lib.Type).Msg("Library type not handled by this target; skipping scan")
+		return nil
+	}
+
+	precise, strategy := t.refreshStrategy(lib, scan)
+	if (scan.Removed && t.cfg.RemoveDeleted) || strategy == eventRefreshRemove {
+		l.Info().Msg("Dry run, removal not sent to target")
+		return nil
+	}
+
+	if strategy == eventRefreshMetadata {
+		if items := t.findItems(ctx, l, lib, scanFolder); len(items) > 0 {
+			l.Info().Str("itemId", items[0].ID).Msg("Dry run, item metadata not refreshed (refresh_by_event or extension_rules)")
+			return nil
+		}
+	}
+
+	if precise && scan.Removed {
+		if items, folder := t.closestItems(ctx, l, lib, scanFolder); len(items) > 0 {
+			l.Info().Str("itemId", items[0].ID).Str("folder", folder).
+				Msg("Dry run, closest existing item of the removed folder not refreshed")
+			return nil
+		}
+	}
+
+	if precise && !scan.Removed {
+		if items := t.findItems(ctx, l, lib, scanFolder); len(items) > 0 {
+			changed := t.changed(l, items)
+			if len(changed) == 0 {
+				l.Info().Str("itemId", items[0].ID).
+					Msg("Dry run, item unchanged; refresh would be skipped")
+				return nil
+			}
+
+			refresh := uniqueItems(t.granularItems(l, changed))
+			l.Info().Str("itemId", refresh[0].ID).Int("items", len(refresh)).
+				Msg("Dry run, item not refreshed (precise refresh)")
+			return nil
+		}
+	}
+
+	if precise && t.cfg.ScanMode == scanModePreciseOnly {
+		l.Info().Msg("Dry run, no item found; scan would be retried later (precise-only)")
+		return nil
+	}
+
+	if lib.TaskID != "" {
+		l.Info().Str("taskId", lib.TaskID).Msg("Dry run, library scan task not started (fallback or precise_refresh disabled)")
+		return nil
+	}
+
+	l.Info().Msg("Dry run, library scan not sent to target (fallback or precise_refresh disabled)")
+	return nil
+}
+
+// RefreshResult opisuje wynik precyzyjnego odświeżenia jednego skanu.
+type RefreshResult struct {
+	ItemID    string // itemId (pierwszego) dopasowanego elementu (pusty, jeśli nie znaleziono)
+	ItemType  string // typ elementu w Jellyfin, np. Movie lub Series
+	Library   string // biblioteka, w której szukano elementu
+	Unchanged bool   // element nie zmienił się, odświeżenie pominięto (SkipUnchanged)
+	Recent    bool   // elementy odświeżono niedawno, odświeżenie pominięto (RecentRefreshTTL)
+	Fallback  bool   // potrzebny skan całej biblioteki
+	Refreshed int    // liczba odświeżonych elementów
+	Failed    int    // liczba elementów, których odświeżenie się nie powiodło
+}
+
+// preciseRefresh odświeża element o ścieżce folder i zwraca wynik.
+// Przyczyny powrotu do skanu biblioteki są logowane w miejscu wystąpienia.
+func (t target) preciseRefresh(ctx context.Context, l zerolog.Logger, lib *library, folder string) RefreshResult {
+	res := RefreshResult{
+		Library:  lib.Name,
+		Fallback: true,
+	}
+
+	// Wyszukiwanie elementu przegląda całą bibliotekę, więc pomijamy je dla zbyt głębokich folderów.
+	if depth := lib.depth(folder); depth > t.cfg.MaxMatchDepth {
+		l.Debug().Int("depth", depth).Int("max_match_depth", t.cfg.MaxMatchDepth).
+			Msg("Folder exceeds max_match_depth; falling back to library scan")
+		return res
+	}
+
+	items := t.findItems(ctx, l, lib, folder)
+	if len(items) == 0 {
+		return res
+	}
+
+	res.ItemID = items[0].ID
+	res.ItemType = items[0].Type
+	t.matched.set(folder, res.ItemID)
+
+	// Pomiń odświeżenie, jeśli żaden element nie zmienił się od ostatniego razu;
+	// każdy itemId odświeżamy tylko raz.
+	changed := uniqueItems(t.changed(l, items))
+	if len(changed) == 0 {
+		res.Unchanged = true
+		res.Fallback = false
+		return res
+	}
+
+	// Odśwież tylko te elementy (rekurencyjnie), a przy RefreshGranularity ich sezon lub serial.
+	refresh := uniqueItems(t.granularItems(l, changed))
+	if it := t.granularItem(items[0]); it.ID != items[0].ID {
+		res.ItemID = it.ID
+		res.ItemType = it.Type
+	}
+
+	// Pomiń elementy odświeżone niedawno, np. ten sam serial z innego folderu lub triggera.
+	refresh, recent := t.recent.claim(refresh)
+	if len(refresh) == 0 {
+		res.Recent = true
+		res.Fallback = false
+		return res
+	}
+
+	refreshed, err := t.refreshItems(ctx, refresh)
+	for i := range refreshed {
+		t.remember(l, &refreshed[i])
+	}
+	t.recent.release(refresh, refreshed)
+
+	// Etag sezonu lub serialu nie jest znany, więc zapamiętujemy Etag elementów folderu.
+	// Elementy pominiętego sezonu lub serialu odświeżymy przy kolejnym skanie.
+	if err == nil {
+		for i := range changed {
+			if it := t.granularItem(changed[i]); it.ID != changed[i].ID && !recent[it.ID] {
+				t.remember(l, &changed[i])
+			}
+		}
+	}
+
+	res.Refreshed = len(refreshed)
+	res.Failed = len(refresh) - len(refreshed)
+	if err != nil {
+		// Skan biblioteki obejmuje także elementy, których nie udało się odświeżyć.
+		l.Error().Err(err).Str("itemId", res.ItemID).
+			Int("succeeded", res.Refreshed).Int("failed", res.Failed).
+			Msg("Jellyfin item refresh failed; falling back to library scan")
+		return res
+	}
+
+	res.Fallback = false
+	return res
+}
+
+// granularItems zamienia elementy na ich sezon lub serial według RefreshGranularity.
+func (t target) granularItems(l zerolog.Logger, items []item) []item {
+	if t.cfg.RefreshGranularity == granularityItem {
+		return items
+	}
+
+	granular := make([]item, 0, len(items))
+	for _, it := range items {
+		g := t.granularItem(it)
+		if g.ID != it.ID {
+			l.Debug().Str("itemId", it.ID).Str("itemType", it.Type).Str("refreshItemId", g.ID).
+				Str("refresh_granularity", t.cfg.RefreshGranularity).
+				Msg("Refreshing the ancestor of the Jellyfin item")
+		}
+
+		granular = append(granular, g)
+	}
+
+	return granular
+}
+
+// granularItem zwraca element do odświeżenia według RefreshGranularity: sezon odcinka przy season,
+// serial odcinka lub sezonu przy series; pozostałe elementy (np. filmy lub sam serial) bez zmian.
+// Etag sezonu ani serialu nie jest znany, więc zwrócony element go nie ma.
+func (t target) granularItem(it item) item {
+	switch {
+	case t.cfg.RefreshGranularity == granularitySeason && it.SeasonID != "":
+		return item{ID: it.SeasonID, Type: "Season"}
+	case t.cfg.RefreshGranularity == granularitySeries && it.SeriesID != "":
+		return item{ID: it.SeriesID, Type: "Series"}
+	default:
+		return it
+	}
+}
+
+// removedRefresh odświeża najbliższy istniejący element usuniętego folderu (sam folder lub
+// folder nadrzędny), aby Jellyfin usunął brakujące elementy bez skanu całej biblioteki.
+// SkipUnchanged nie dotyczy usunięć: Etag folderu nadrzędnego zmienia się dopiero po odświeżeniu.
+func (t target) removedRefresh(ctx context.Context, l zerolog.Logger, lib *library, folder string) RefreshResult {
+	res := RefreshResult{
+		Library:  lib.Name,
+		Fallback: true,
+	}
+
+	items, closest := t.closestItems(ctx, l, lib, folder)
+	if len(items) == 0 {
+		l.Debug().Int("max_steps", maxAncestorSteps).
+			Msg("No existing Jellyfin item found for the removed folder; falling back to library scan")
+		return res
+	}
+
+	res.ItemID = items[0].ID
+	res.ItemType = items[0].Type
+
+	l.Debug().Str("folder", closest).Str("itemId", res.ItemID).
+		Msg("Refreshing the closest existing Jellyfin item of the removed folder")
+
+	refreshed, err := t.refreshItems(ctx, items)
+	res.Refreshed = len(refreshed)
+	res.Failed = len(items) - len(refreshed)
+	if err != nil {
+		l.Error().Err(err).Str("itemId", res.ItemID).
+			Int("succeeded", res.Refreshed).Int("failed", res.Failed).
+			Msg("Jellyfin item refresh failed; falling back to library scan")
+		return res
+	}
+
+	res.Fallback = false
+	return res
+}
+
+// closestItems zwraca elementy najbliższego folderu, od folder w górę (najwyżej maxAncestorSteps
+// poziomów), który ma element w Jellyfin, oraz ścieżkę tego folderu. Korzenia biblioteki nigdy
+// nie zwraca, bo jego odświeżenie to w praktyce skan całej biblioteki.
+func (t target) closestItems(ctx context.Context, l zerolog.Logger, lib *library, folder string) ([]item, string) {
+	dir := strings.TrimRight(normalizePath(folder), "/")
+	for step := 0; step <= maxAncestorSteps; step++ {
+		depth := lib.depth(dir)
+		if depth == 0 {
+			break
+		}
+
+		if depth <= t.cfg.MaxMatchDepth {
+			if items := uniqueItems(t.findItems(ctx, l, lib, dir)); len(items) > 0 {
+				return items, dir
+			}
+		}
+
+		dir = path.Dir(dir)
+	}
+
+	return nil, ""
+}
+
+// refreshParent odświeża najbliższy istniejący element powyżej usuniętego folderu.
+// Błędy są tylko logowane: usunięcie zostało już zgłoszone do Jellyfin.
+func (t target) refreshParent(ctx context.Context, l zerolog.Logger, lib *library, folder string) {
+	parent := path.Dir(strings.TrimRight(normalizePath(folder), "/"))
+	if lib.depth(parent) == 0 {
+		l.Debug().Msg("Removed folder is at the root of the library; not refreshing its parent")
+		return
+	}
+
+	items, closest := t.closestItems(ctx, l, lib, parent)
+	if len(items) == 0 {
+		return
+	}
+
+	l = l.With().Str("parent", closest).Logger()
+
+	if _, err := t.refreshItems(ctx, items); err != nil {
+		l.Warn().Err(err).Msg("Jellyfin refresh of the parent folder failed")
+		return
+	}
+
+	l.Debug().Str("itemId", items[0].ID).Msg("Refreshed the parent Jellyfin item after the removal")
+}
+
+// Granice matchedItems: dopasowania starsze niż matchedTTL zapominamy, a ponad matchedLimit folderów
+// usuwamy najstarsze, aby pamięć długo działającego procesu nie rosła z każdym skanowanym folderem.
+const (
+	matchedTTL   = 24 * time.Hour
+	matchedLimit = 10000
+)
+
+// matchedItems zapamiętuje itemId ostatnio dopasowanego elementu każdego folderu, w granicach
+// matchedTTL i matchedLimit; dla zapomnianego folderu get zwraca pusty itemId.
+type matchedItems struct {
+	mu    sync.Mutex
+	items map[string]matchedItem
+}
+
+type matchedItem struct {
+	itemID string
+	at     time.Time
+}
+
+func (m *matchedItems) set(folder string, itemID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	at := now()
+	for f, it := range m.items {
+		if at.Sub(it.at) >= matchedTTL {
+			delete(m.items, f)
+		}
+	}
+
+	m.items[normalizePath(folder)] = matchedItem{itemID: itemID, at: at}
+
+	for len(m.items) > matchedLimit {
+		oldest := ""
+		for f, it := range m.items {
+			if oldest == "" || it.at.Before(m.items[oldest].at) {
+				oldest = f
+			}
+		}
+
+		delete(m.items, oldest)
+	}
+}
+
+func (m *matchedItems) get(folder string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	it, ok := m.items[normalizePath(folder)]
+	if !ok || now().Sub(it.at) >= matchedTTL {
+		return ""
+	}
+
+	return it.itemID
+}
+
+// recentItems zapamiętuje czas odświeżenia itemId na ttl (RecentRefreshTTL); przy zerowym ttl niczego nie pomija.
+type recentItems struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	refreshed map[string]time.Time
+}
+
+// claim zwraca elementy do odświeżenia oraz itemId odświeżone w ciągu ttl.
+// Zwrócone elementy od razu uznajemy za odświeżone, aby równoległy skan tego samego elementu ich nie powtórzył.
+func (r *recentItems) claim(items []item) ([]item, map[string]bool) {
+	if r.ttl <= 0 {
+		return items, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	at := now()
+	for id, when := range r.refreshed {
+		if at.Sub(when) >= r.ttl {
+			delete(r.refreshed, id)
+		}
+	}
+
+	claimed := make([]item, 0, len(items))
+	recent := make(map[string]bool)
+	for _, it := range items {
+		if _, ok := r.refreshed[it.ID]; ok {
+			recent[it.ID] = true
+			continue
+		}
+
+		r.refreshed[it.ID] = at
+		claimed = append(claimed, it)
+	}
+
+	return claimed, recent
+}
+
+// release zapomina elementy z claimed, których nie udało się odświeżyć, aby kolejny skan je ponowił.
+func (r *recentItems) release(claimed []item, refreshed []item) {
+	if r.ttl <= 0 || len(claimed) == len(refreshed) {
+		return
+	}
+
+	ok := make(map[string]bool, len(refreshed))
+	for _, it := range refreshed {
+		ok[it.ID] = true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, it := range claimed {
+		if !ok[it.ID] {
+			delete(r.refreshed, it.ID)
+		}
+	}
+}
+
+// viewCache zapamiętuje ViewID bibliotek ustalone przy WarmupViewIDs.
+type viewCache struct {
+	mu    sync.Mutex
+	views map[viewKey]string
+}
+
+type viewKey struct {
+	userID  string
+	library string
+}
+
+func (v *viewCache) set(userID string, library string, viewID string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.views[viewKey{userID: userID, library: library}] = viewID
+}
+
+func (v *viewCache) get(userID string, library string) (string, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	viewID, ok := v.views[viewKey{userID: userID, library: library}]
+	return viewID, ok
+}
+
+// warmupViews ustala i zapamiętuje ViewID bibliotek (WarmupViewIDs, opcjonalnie tylko WarmupLibraries).
+// Biblioteki z library_map pomijamy, a błąd jednej biblioteki nie blokuje pozostałych ani startu.
+func (t target) warmupViews(ctx context.Context, libraries []library) {
+	for _, lib := range libraries {
+		if !t.warmupLibrary(lib.Name) {
+			continue
+		}
+
+		// Tak jak w matchItems: Library z configu zastępuje nazwę biblioteki.
+		libraryName := t.cfg.Library
+		if strings.TrimSpace(libraryName) == "" {
+			libraryName = lib.Name
+		}
+
+		folder := ""
+		if len(lib.Paths) > 0 {
+			folder = lib.Paths[0]
+		}
+
+		if _, ok := t.mappedViewID(folder); ok {
+			continue
+		}
+
+		userID := t.userID(libraryName, folder)
+		if _, ok := t.views.get(userID, libraryName); ok {
+			continue
+		}
+
+		viewID, err := t.api.GetViewID(ctx, userID, libraryName)
+		if err != nil {
+			t.log.Warn().Err(t.api.redactError(err)).Str("library", libraryName).
+				Msg("Cannot resolve Jellyfin viewId during warm-up; resolving it on the first scan")
+			continue
+		}
+
+		t.views.set(userID, libraryName, viewID)
+		t.log.Debug().Str("library", libraryName).Str("viewId", viewID).
+			Msg("Resolved Jellyfin viewId during warm-up")
+	}
+}
+
+// warmupLibrary sprawdza, czy ViewID biblioteki ustalamy przy WarmupViewIDs.
+func (t target) warmupLibrary(name string) bool {
+	if len(t.cfg.WarmupLibraries) == 0 {
+		return true
+	}
+
+	for _, warmup := range t.cfg.WarmupLibraries {
+		if normalizeName(warmup) == normalizeName(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// seenSegments zapamiętuje pierwsze segmenty ścieżek (np. data dla /data/Movies).
+type seenSegments struct {
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+// first sprawdza, czy segment pojawił się po raz pierwszy, i zapamiętuje go.
+func (s *seenSegments) first(segment string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.seen[segment] {
+		return false
+	}
+
+	s.seen[segment] = true
+	return true
+}
+
+// outOfLibraryScan liczy skan spoza wszystkich bibliotek. Ostrzeżenie logujemy tylko przy pierwszym
+// skanie danego segmentu ścieżki, kolejne na poziomie debug, aby nie zalewać logów.
+func (t target) outOfLibraryScan(scan autoscan.Scan, folder string, err error) {
+	segment := topSegment(folder)
+	outOfLibraryScans.Inc(segment)
+
+	l := t.log.With().Str("id", scan.ID).Str("segment", segment).Logger()
+	if t.outOfLibrary.first(segment) {
+		l.Warn().Err(err).Msg("No target libraries found; further scans below this path are logged at debug level")
+		return
+	}
+
+	l.Debug().Err(err).Msg("No target libraries found")
+}
+
+// fallbackWatch liczy precyzyjne odświeżenia każdej biblioteki w przesuwnym oknie,
+// aby ostrzec, gdy większość z nich kończy się skanem biblioteki.
+type fallbackWatch struct {
+	rate   float64
+	window time.Duration
+
+	mu        sync.Mutex
+	libraries map[string]*fallbackWindow
+}
+
+type fallbackWindow struct {
+	attempts []fallbackAttempt
+	warned   time.Time
+}
+
+type fallbackAttempt struct {
+	time     time.Time
+	fallback bool
+}
+
+func newFallbackWatch(rate float64, window time.Duration) *fallbackWatch {
+	return &fallbackWatch{
+		rate:      rate,
+		window:    window,
+		libraries: make(map[string]*fallbackWindow),
+	}
+}
+
+// observe zapisuje wynik precyzyjnego odświeżenia biblioteki i zwraca odsetek fallbacków w oknie,
+// liczbę odświeżeń oraz to, czy należy ostrzec (próg przekroczony, najwyżej raz na okno).
+func (w *fallbackWatch) observe(library string, fallback bool, now time.Time) (float64, int, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	fw, ok := w.libraries[library]
+	if !ok {
+		fw = &fallbackWindow{}
+		w.libraries[library] = fw
+	}
+
+	// odświeżenia spoza okna są posortowane według czasu, więc usuwamy je od początku.
+	start := now.Add(-w.window)
+	expired := 0
+	for expired < len(fw.attempts) && fw.attempts[expired].time.Before(start) {
+		expired++
+	}
+	fw.attempts = append(fw.attempts[expired:], fallbackAttempt{time: now, fallback: fallback})
+
+	fallbacks := 0
+	for _, a := range fw.attempts {
+		if a.fallback {
+			fallbacks++
+		}
+	}
+
+	rate := float64(fallbacks) / float64(len(fw.attempts))
+	if len(fw.attempts) < minFallbackAttempts || rate < w.rate || now.Sub(fw.warned) < w.window {
+		return rate, len(fw.attempts), false
+	}
+
+	fw.warned = now
+	return rate, len(fw.attempts), true
+}
+
+// preciseResult liczy wynik precyzyjnego odświeżenia i ostrzega, gdy w bibliotece przeważają fallbacki.
+func (t target) preciseResult(l zerolog.Logger, lib *library, fallback bool) {
+	result := resultPrecise
+	if fallback {
+		result = resultFallback
+	}
+	preciseRefreshes.Inc(lib.Name, result)
+
+	rate, attempts, warn := t.fallbacks.observe(lib.Name, fallback, now())
+	if !warn {
+		return
+	}
+
+	l.Warn().
+		Float64("rate", rate).
+		Int("attempts", attempts).
+		Dur("window", t.cfg.FallbackWarnWindow).
+		Msg("Most precise refreshes of the library fall back to a library scan; check the rewrite rules, user_id and library of the target")
+}
+
+// topSegment zwraca pierwszy segment ścieżki, np. data dla /data/Movies, a / dla ścieżki bez segmentów.
+func topSegment(folder string) string {
+	for _, segment := range strings.Split(normalizePath(folder), "/") {
+		if segment != "" {
+			return segment
+		}
+	}
+
+	return "/"
+}
+
+// defaultLibraryScan skanuje całą DefaultLibrary, gdy folder skanu nie należy do żadnej biblioteki.
+func (t target) defaultLibraryScan(ctx context.Context, scan autoscan.Scan, folder string, lib *library) error {
+	l := t.log.With().
+		Str("id", scan.ID).
+		Str("path", folder).
+		Str("library", lib.Name).
+		Logger()
+
+	if err := t.quietHours(l); err != nil {
+		return fmt.Errorf("%s: %w", folder, err)
+	}
+
+	l.Debug().Msg("Folder outside of all libraries; scanning the default library")
+
+	if err := t.fullLibraryScan(ctx, l, lib); err != nil {
+		return err
+	}
+
+	l.Debug().Msg("Default library scan moved to target")
+	autoscan.ReportRefresh(ctx, autoscan.RefreshLibrary, "")
+	return nil
+}
+
+// quietHours zwraca ErrTargetNotReady w QuietHours, aby skan biblioteki poczekał na koniec okna.
+func (t target) quietHours(l zerolog.Logger) error {
+	err := t.quiet.Check(now())
+	if err != nil {
+		l.Debug().Err(err).Msg("Quiet hours; deferring the library scan")
+	}
+
+	return err
+}
+
+// fullLibraryScan skanuje całą bibliotekę, najwyżej LibraryScanWorkers naraz:
+// uruchamia zadanie biblioteki (FallbackUseLibraryTask) lub zgłasza Jellyfin każdą jej lokalizację.
+func (t target) fullLibraryScan(ctx context.Context, l zerolog.Logger, lib *library) error {
+	release, err := t.acquireLibraryScan(ctx, l)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if lib.TaskID != "" {
+		return t.api.RunTask(ctx, lib.TaskID)
+	}
+
+	for _, path := range lib.Paths {
+		if err := t.api.Scan(ctx, t.serverPath(strings.TrimSuffix(path, "/"))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// acquireLibraryScan czeka, aż liczba trwających skanów biblioteki spadnie poniżej LibraryScanWorkers,
+// i zwraca funkcję zwalniającą miejsce. Anulowanie kontekstu (np. scan_timeout) przerywa czekanie.
+func (t target) acquireLibraryScan(ctx context.Context, l zerolog.Logger) (func(), error) {
+	release := func() { <-t.libraryScans }
+
+	select {
+	case t.libraryScans <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	l.Debug().Int("library_scan_workers", t.cfg.LibraryScanWorkers).
+		Msg("Waiting for a running library scan to finish")
+
+	select {
+	case t.libraryScans <- struct{}{}:
+		return release, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting for a library scan: %w", ctx.Err())
+	}
+}
+
+// refreshItems odświeża elementy równolegle, najwyżej RefreshWorkers naraz,
+// i zwraca odświeżone elementy oraz zbiorczy błąd pozostałych.
+func (t target) refreshItems(ctx context.Context, items []item) ([]item, error) {
+	errs := make([]error, len(items))
+	workers := make(chan struct{}, t.cfg.RefreshWorkers)
+
+	var wg sync.WaitGroup
+	for i := range items {
+		wg.Add(1)
+		workers <- struct{}{}
+
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-workers }()
+
+			errs[i] = t.api.RefreshItem(ctx, items[i].ID)
+		}(i)
+	}
+
+	wg.Wait()
+
+	refreshed := make([]item, 0, len(items))
+	failed := make([]string, 0)
+	var first error
+	for i, err := range errs {
+		if err == nil {
+			refreshed = append(refreshed, items[i])
+			continue
+		}
+
+		if first == nil {
+			first = err
+		}
+		failed = append(failed, fmt.Sprintf("%v: %v", items[i].ID, err))
+	}
+
+	if first != nil {
+		// Go 1.19 nie łączy wielu błędów, więc opakowujemy pierwszy (np. ErrTargetUnavailable).
+		return refreshed, fmt.Errorf("%d of %d item refreshes failed: %v: %w",
+			len(failed), len(items), strings.Join(failed, "; "), first)
+	}
+
+	return refreshed, nil
+}
+
+// scanItemIDs zwraca itemId podane przez trigger (ItemID i ItemIDs) bez pustych i powtórzonych.
+func scanItemIDs(scan autoscan.Scan) []string {
+	seen := make(map[string]bool)
+	ids := make([]string, 0, len(scan.ItemIDs)+1)
+	for _, id := range append([]string{scan.ItemID}, scan.ItemIDs...) {
+		if id == "" || seen[id] {
+			continue
+		}
+
+		seen[id] = true
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+// uniqueItems usuwa powtórzenia tego samego itemId (np. pliki jednego filmu),
+// aby element nie był odświeżany kilka razy.
+func uniqueItems(items []item) []item {
+	seen := make(map[string]bool)
+	unique := make([]item, 0, len(items))
+	for _, it := range items {
+		if seen[it.ID] {
+			continue
+		}
+
+		seen[it.ID] = true
+		unique = append(unique, it)
+	}
+
+	return unique
+}
+
+// changed zwraca elementy, które zmieniły się od ostatniego odświeżenia.
+func (t target) changed(l zerolog.Logger, items []item) []item {
+	changed := make([]item, 0, len(items))
+	for i := range items {
+		if !t.unchanged(l, &items[i]) {
+			changed = append(changed, items[i])
+		}
+	}
+
+	return changed
+}
+
+// waitForRefresh czeka, aż Jellyfin zakończy odświeżanie lub upłynie RefreshTimeout.
+// Postęp jest logowany co każde pełne progressStep procent, aby długie odświeżanie nie wyglądało na zawieszone.
+// Odświeżanie zostało już zlecone, więc błędy i przekroczenie czasu są tylko logowane.
+func (t target) waitForRefresh(ctx context.Context, l zerolog.Logger) {
+	ctx, cancel := context.WithTimeout(ctx, t.cfg.RefreshTimeout)
+	defer cancel()
+
+	// Daj Jellyfin chwilę na uruchomienie zadania, zanim pierwszy raz sprawdzimy jego stan.
+	if t.cfg.RefreshPollInitialDelay > 0 {
+		select {
+		case <-ctx.Done():
+			l.Warn().Dur("timeout", t.cfg.RefreshTimeout).
+				Msg("Refresh timeout elapsed before checking the Jellyfin refresh; not waiting any longer")
+			return
+		case <-time.After(t.cfg.RefreshPollInitialDelay):
+		}
+	}
+
+	logged := -1
+	for {
+		task, err := t.api.RefreshTask(ctx)
+		if err != nil {
+			l.Warn().Err(err).Msg("Cannot check Jellyfin refresh state; not waiting for refresh")
+			return
+		}
+
+		if task.State != "Running" {
+			l.Debug().Str("state", task.State).Msg("Jellyfin refresh completed")
+			return
+		}
+
+		if step := int(task.Progress) / progressStep; step > logged {
+			logged = step
+			l.Debug().Float64("progress", task.Progress).Msg("Waiting for Jellyfin refresh")
+		}
+
+		select {
+		case <-ctx.Done():
+			l.Warn().
+				Str("state", task.State).
+				Float64("progress", task.Progress).
+				Dur("timeout", t.cfg.RefreshTimeout).
+				Msg("Jellyfin refresh still running; not waiting any longer")
+			return
+		case <-time.After(t.cfg.RefreshInterval):
+		}
+	}
+}
+
+// libraryScanRunning sprawdza, czy trwa zadanie biblioteki (TaskID) lub RefreshLibrary.
+// Błąd sprawdzenia jest tylko logowany, skan biblioteki jest wtedy wysyłany jak zwykle.
+func (t target) libraryScanRunning(ctx context.Context, l zerolog.Logger, lib *library) bool {
+	if lib.TaskID == "" {
+		task, err := t.api.RefreshTask(ctx)
+		if err != nil {
+			l.Warn().Err(err).Msg("Cannot check Jellyfin refresh state; sending the library scan")
+			return false
+		}
+
+		return task.State == "Running"
+	}
+
+	tasks, err := t.api.ScheduledTasks(ctx)
+	if err != nil {
+		l.Warn().Err(err).Msg("Cannot check Jellyfin scheduled tasks; sending the library scan")
+		return false
+	}
+
+	for _, task := range tasks {
+		if task.ID == lib.TaskID {
+			return task.State == "Running"
+		}
+	}
+
+	return false
+}
+
+// confirmScan sprawdza, czy Jellyfin faktycznie uruchomił skan biblioteki po jego przyjęciu.
+// Nie zwraca błędu: skan został wysłany, ostrzeżenie wskazuje jedynie na ścieżkę spoza bibliotek.
+func (t target) confirmScan(ctx context.Context, l zerolog.Logger) {
+	for i := 0; i < confirmScanPolls; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(t.cfg.RefreshInterval):
+			}
+		}
+
+		task, err := t.api.RefreshTask(ctx)
+		if err != nil {
+			l.Warn().Err(err).Msg("Cannot check Jellyfin refresh state; library scan not confirmed")
+			return
+		}
+
+		if task.State == "Running" {
+			l.Debug().Msg("Jellyfin confirmed the library scan")
+			return
+		}
+	}
+
+	l.Warn().Msg("Jellyfin accepted the library scan but did not start it; check that the folder is within a Jellyfin library")
+}
+
+// unchanged sprawdza, czy Etag elementu jest taki sam jak przy ostatnim odświeżeniu.
+// Błędy bazy danych są tylko logowane, element jest wtedy odświeżany.
+func (t target) unchanged(l zerolog.Logger, it *item) bool {
+	if t.store == nil || it.Etag == "" {
+		return false
+	}
+
+	lastSeen, err := t.store.LastSeen(t.cfg.URL, it.ID)
+	if err != nil {
+		l.Warn().Err(err).Str("itemId", it.ID).Msg("Cannot retrieve last seen Jellyfin item")
+		return false
+	}
+
+	return lastSeen == it.Etag
+}
+
+// remember zapisuje Etag odświeżonego elementu.
+func (t target) remember(l zerolog.Logger, it *item) {
+	if t.store == nil || it.Etag == "" {
+		return
+	}
+
+	if err := t.store.SetLastSeen(t.cfg.URL, it.ID, it.Etag); err != nil {
+		l.Warn().Err(err).Str("itemId", it.ID).Msg("Cannot store last seen Jellyfin item")
+	}
+}
+
+// findItems zwraca elementy folderu według Config.Resolver, a domyślnie według ścieżki.
+// Pusty wynik oznacza powrót do skanu całej biblioteki.
+func (t target) findItems(ctx context.Context, l zerolog.Logger, lib *library, folder string) []item {
+	if t.cfg.Resolver == nil {
+		return t.matchItems(ctx, l, lib, folder)
+	}
+
+	ids, err := t.cfg.Resolver.ResolveItems(ctx, lib.Name, folder)
+	if err != nil {
+		l.Warn().Err(err).Str("path", folder).
+			Msg("Cannot resolve Jellyfin item; falling back to library scan")
+		return nil
+	}
+
+	items := make([]item, 0, len(ids))
+	for _, id := range ids {
+		if id != "" {
+			items = append(items, item{ID: id})
+		}
+	}
+
+	if len(items) == 0 {
+		l.Warn().Str("path", folder).
+			Msg("Resolver returned no Jellyfin item; falling back to library scan")
+		return nil
+	}
+
+	l.Debug().Str("itemId", items[0].ID).Int("items", len(items)).
+		Msg("Resolved Jellyfin item by the resolver")
+	return items
+}
+
+// matchItems zwraca element o dokładnie tej ścieżce (Path) lub filmy w tym folderze.
+func (t target) matchItems(ctx context.Context, l zerolog.Logger, lib *library, folder string) []item {
+	// Ustal ViewID biblioteki: jeśli w configu podano Library, użyj jej,
+	// w przeciwnym razie bierz nazwę biblioteki z dopasowania ścieżki.
+	libraryName := t.cfg.Library
+	if strings.TrimSpace(libraryName) == "" {
+		libraryName = lib.Name
+	}
+
+	userID := t.userID(libraryName, folder)
+	if userID != t.cfg.UserID {
+		l = l.With().Str("userId", userID).Logger()
+		l.Debug().Msg("Using the userId of library_users")
+	}
+
+	viewID, ok := t.mappedViewID(folder)
+	if ok {
+		l.Debug().Str("viewId", viewID).Msg("Using the viewId of library_map")
+	} else if viewID, ok = t.views.get(userID, libraryName); ok {
+		l.Debug().Str("viewId", viewID).Msg("Using the cached viewId")
+	} else {
+		var err error
+		viewID, err = t.api.GetViewID(ctx, userID, libraryName)
+		if errors.Is(err, errViewNotFound) && t.knownLibrary(libraryName) {
+			var accessUserID string
+			accessUserID, viewID, err = t.noViewAccess(ctx, l, userID, libraryName, err)
+			if accessUserID != userID {
+				userID = accessUserID
+				l = l.With().Str("userId", userID).Logger()
+			}
+		}
+		if err != nil {
+			l.Warn().Err(err).Str("library", libraryName).
+				Msg("Cannot resolve Jellyfin viewId; falling back to library scan")
+			return nil
+		}
+
+		if t.cfg.WarmupViewIDs {
+			t.views.set(userID, libraryName, viewID)
+		}
+	}
+
+	matches, err := t.api.FindItemsByPath(ctx, userID, viewID, folder)
+	if err == nil {
+		return t.multiMatch(l, matches)
+	}
+
+	if lib.Type == "movies" {
+		// Film (także z wieloma wersjami) nie jest folderem: jego Path wskazuje plik
+		// w folderze filmu, więc wszystkie wersje należą do jednego elementu.
+		movies, merr := t.api.FindMoviesByFolder(ctx, userID, viewID, folder)
+		if merr == nil {
+			l.Debug().Str("itemId", movies[0].ID).Int("items", len(movies)).
+				Msg("Matched Jellyfin movie by its folder")
+			return movies
+		}
+
+		err = merr
+	}
+
+	l.Warn().Err(err).Str("path", folder).
+		Msg("Cannot match Jellyfin item by exact Path; falling back to library scan")
+	return nil
+}
+
+// knownLibrary sprawdza, czy Jellyfin zwrócił bibliotekę o tej nazwie.
+func (t target) knownLibrary(name string) bool {
+	t.libraries.mu.Lock()
+	libraries := t.libraries.libraries
+	t.libraries.mu.Unlock()
+
+	_, ok := findLibrary(libraries, name)
+	return ok
+}
+
+// noViewAccess obsługuje bibliotekę, której użytkownik nie widzi, choć istnieje (brak uprawnień):
+// ostrzega raz na użytkownika i bibliotekę, a przy AdminUserID ustala ViewID jako ten użytkownik.
+// Zwraca użytkownika do dalszych zapytań i ViewID lub błąd, gdy nie ma kim wyszukać elementu.
+func (t target) noViewAccess(ctx context.Context, l zerolog.Logger, userID string, libraryName string, err error) (string, string, error) {
+	if t.noAccess.first(userID + "/" + libraryName) {
+		l.Warn().Err(err).Str("userId", userID).Str("library", libraryName).
+			Msg("User cannot see the Jellyfin library; grant it access to the library or set admin_user_id")
+	}
+
+	if t.cfg.AdminUserID == "" || t.cfg.AdminUserID == userID {
+		return userID, "", err
+	}
+
+	viewID, err := t.api.GetViewID(ctx, t.cfg.AdminUserID, libraryName)
+	if err != nil {
+		return userID, "", err
+	}
+
+	l.Debug().Str("userId", t.cfg.AdminUserID).Str("library", libraryName).
+		Msg("Using the admin_user_id for the library")
+	return t.cfg.AdminUserID, viewID, nil
+}
+
+// multiMatch wybiera elementy do odświeżenia, gdy kilka elementów ma tę samą ścieżkę
+// (np. zduplikowany import lub biblioteka mieszana), według MultiMatch: all (wszystkie),
+// first (pierwszy zwrócony przez Jellyfin) lub byType (pierwszy o najwcześniejszym typie z MultiMatchTypes).
+func (t target) multiMatch(l zerolog.Logger, matches []item) []item {
+	items := make([]item, 0, len(matches))
+	for _, it := range matches {
+		if it.ID != "" {
+			items = append(items, it)
+		}
+	}
+
+	if len(items) < 2 {
+		return items
+	}
+
+	l.Debug().Int("matches", len(items)).Str("multi_match", t.cfg.MultiMatch).
+		Msg("Several Jellyfin items share the path of the folder")
+
+	switch t.cfg.MultiMatch {
+	case multiMatchAll:
+		return items
+	case multiMatchByType:
+		for _, itemType := range t.cfg.MultiMatchTypes {
+			for _, it := range items {
+				if strings.EqualFold(it.Type, itemType) {
+					return []item{it}
+				}
+			}
+		}
+	}
+
+	return items[:1]
+}
+
+// mappedViewID zwraca ViewID najdłuższego prefiksu LibraryMap, który obejmuje folder.
+func (t target) mappedViewID(folder string) (string, bool) {
+	return longestPrefix(t.cfg.LibraryMap, folder)
+}
+
+// userID zwraca użytkownika biblioteki według LibraryUsers: najpierw najdłuższy prefiks
+// ścieżki, potem nazwa biblioteki, a bez nadpisania globalne UserID.
+func (t target) userID(libraryName string, folder string) string {
+	if userID, ok := longestPrefix(t.cfg.LibraryUsers, folder); ok {
+		return userID
+	}
+
+	if userID, ok := t.cfg.LibraryUsers[libraryName]; ok {
+		return userID
+	}
+
+	return t.cfg.UserID
+}
+
+// longestPrefix zwraca wartość najdłuższego prefiksu ścieżki z m, który obejmuje folder.
+// Klucze niebędące ścieżkami (np. nazwy bibliotek) nigdy nie pasują.
+func longestPrefix(m map[string]string, folder string) (string, bool) {
+	value, longest, found := "", -1, false
+	for prefix, v := range m {
+		if !strings.Contains(normalizePath(prefix), "/") {
+			continue
+		}
+
+		if n := len(pathSegments(prefix)); withinPath(folder, prefix) && n > longest {
+			value, longest, found = v, n, true
+		}
+	}
+
+	return value, found
+}
+
+// precise sprawdza, czy skany biblioteki odświeżają element (ModeByType dla typu kolekcji,
+// a bez wpisu PreciseRefresh), czy od razu skanują bibliotekę.
+func (t target) precise(lib *library) bool {
+	for collectionType, mode := range t.cfg.ModeByType {
+		if strings.EqualFold(collectionType, lib.Type) {
+			return mode == typeModePrecise
+		}
+	}
+
+	return t.cfg.PreciseRefresh
+}
+
+// eventRefresh zwraca strategię RefreshByEvent dla zdarzenia skanu (pustą bez wpisu) oraz to,
+// czy skan odświeża element: precise i library nadpisują ModeByType/PreciseRefresh biblioteki.
+func (t target) eventRefresh(lib *library, scan autoscan.Scan) (bool, string) {
+	strategy := ""
+	for event, s := range t.cfg.RefreshByEvent {
+		if scan.Event != "" && strings.EqualFold(event, scan.Event) {
+			strategy = s
+			break
+		}
+	}
+
+	switch strategy {
+	case eventRefreshPrecise:
+		return true, strategy
+	case eventRefreshLibrary:
+		return false, strategy
+	default:
+		return t.precise(lib), strategy
+	}
+}
+
+// refreshStrategy uzupełnia eventRefresh o ExtensionRules: plik z regułą metadata odświeża tylko metadane,
+// chyba że skan jest usunięciem.
+func (t target) refreshStrategy(lib *library, scan autoscan.Scan) (bool, string) {
+	precise, strategy := t.eventRefresh(lib, scan)
+	if strategy != eventRefreshRemove && !scan.Removed && t.extensionRule(scan) == extensionMetadata {
+		strategy = eventRefreshMetadata
+	}
+
+	return precise, strategy
+}
+
+// extensionRule zwraca regułę ExtensionRules dla rozszerzenia Scan.File; skany bez pliku zawsze skanujemy.
+func (t target) extensionRule(scan autoscan.Scan) string {
+	if scan.File == "" || len(t.cfg.ExtensionRules) == 0 {
+		return extensionScan
+	}
+
+	if rule, ok := t.cfg.ExtensionRules[normalizeExtension(path.Ext(scan.File))]; ok {
+		return rule
+	}
+
+	if rule, ok := t.cfg.ExtensionRules[extensionOther]; ok {
+		return rule
+	}
+
+	return extensionScan
+}
+
+// normalizeExtension zwraca rozszerzenie małymi literami z kropką, np. .srt dla SRT.
+func normalizeExtension(ext string) string {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if ext == "" || ext == extensionOther || strings.HasPrefix(ext, ".") {
+		return ext
+	}
+
+	return "." + ext
+}
+
+// refreshMetadata odświeża tylko metadane elementów folderu i zwraca itemId pierwszego z nich.
+// Brak elementu lub błąd oznacza odświeżenie jak dla innych zdarzeń.
+func (t target) refreshMetadata(ctx context.Context, l zerolog.Logger, lib *library, folder string) (string, bool) {
+	items := uniqueItems(t.findItems(ctx, l, lib, folder))
+	if len(items) == 0 {
+		return "", false
+	}
+	t.matched.set(folder, items[0].ID)
+
+	for _, it := range items {
+		if err := t.api.RefreshMetadata(ctx, it.ID); err != nil {
+			l.Warn().Err(err).Str("itemId", it.ID).
+				Msg("Jellyfin metadata refresh failed; refreshing the folder instead")
+			return "", false
+		}
+	}
+
+	return items[0].ID, true
+}
+
+// handlesType sprawdza, czy typ kolekcji biblioteki jest na liście LibraryTypes (pusta = wszystkie).
+func (t target) handlesType(collectionType string) bool {
+	if len(t.cfg.LibraryTypes) == 0 {
+		return true
+	}
+
+	for _, allowed := range t.cfg.LibraryTypes {
+		if strings.EqualFold(allowed, collectionType) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// rewritePath przepisuje folder skanu według rewrite, usuwa TrimPrefix i TrimSuffix
+// i rozwiązuje dowiązania (resolve).
+// Niezmieniona ścieżka przy ustawionych regułach zwykle oznacza, że żadna reguła nie pasuje.
+func (t target) rewritePath(scan autoscan.Scan) (string, error) {
+	folder := t.rewrite(scan.Folder)
+	if folder == scan.Folder && len(t.cfg.Rewrite) > 0 {
+		if t.cfg.StrictRewrite {
+			return "", fmt.Errorf("%v: no rewrite rule matched: %w", scan.Folder, autoscan.ErrScanRefused)
+		}
+
+		t.log.Debug().
+			Str("id", scan.ID).
+			Str("path", scan.Folder).
+			Msg("No rewrite rule matched; using the scan folder as is")
+	}
+
+	return t.resolve(t.trim(folder)), nil
+}
+
+// trim usuwa TrimPrefix i TrimSuffix z folderu; ścieżka bezwzględna pozostaje bezwzględna,
+// także gdy prefiks kończy się separatorem (np. /docker/).
+func (t target) trim(folder string) string {
+	trimmed := strings.TrimSuffix(strings.TrimPrefix(folder, t.cfg.TrimPrefix), t.cfg.TrimSuffix)
+	if trimmed != "" && strings.HasPrefix(folder, "/") && !strings.HasPrefix(trimmed, "/") {
+		trimmed = "/" + trimmed
+	}
+
+	return trimmed
+}
+
+// unsafePath zwraca powód, dla którego ścieżki po rewrite nie wolno skanować,
+// lub pusty ciąg dla bezpiecznej ścieżki.
+func (t target) unsafePath(folder string) string {
+	trimmed := strings.TrimRight(normalizePath(strings.TrimSpace(folder)), "/")
+
+	switch {
+	case strings.TrimSpace(folder) == "":
+		return unsafeEmpty
+	case trimmed == "" || trimmed == "." || (len(trimmed) == 2 && trimmed[1] == ':'):
+		// katalog główny, także dysku Windows (C:\ po usunięciu końcowego separatora)
+		return unsafeRoot
+	case len(trimmed) < t.cfg.MinPathLength:
+		return unsafeShort
+	}
+
+	return ""
+}
+
+// checkPath odrzuca skan, którego ścieżka po rewrite jest pusta, katalogiem głównym lub zbyt krótka.
+// Taki skan zwykle wynika z błędnej reguły rewrite; procesor, jak przy StrictRewrite, usuwa go z kolejki
+// tego targetu, a pozostałe targety skanują dalej.
+func (t target) checkPath(scan autoscan.Scan, folder string) error {
+	reason := t.unsafePath(folder)
+	if reason == "" {
+		return nil
+	}
+
+	unsafePaths.Inc(reason)
+	return fmt.Errorf("%q: rewritten path of %v is %s: %w", folder, scan.Folder, reason, autoscan.ErrScanRefused)
+}
+
+// checkFolder przy StatFolders sprawdza, czy folder skanu istnieje. Brak folderu przy brakującym
+// pliku z MountAnchors oznacza niedziałający punkt montowania: zwracamy ErrTargetNotReady,
+// aby skan poczekał, zamiast zgłaszać Jellyfin ścieżkę, która tylko chwilowo nie istnieje.
+func (t target) checkFolder(scan autoscan.Scan, folder string) error {
+	if !t.cfg.StatFolders {
+		return nil
+	}
+
+	if _, err := os.Stat(folder); err == nil {
+		return nil
+	}
+
+	for _, anchor := range t.cfg.MountAnchors {
+		if _, err := os.Stat(anchor); err != nil {
+			return fmt.Errorf("%v: folder does not exist and mount anchor %v is unavailable: %w",
+				folder, anchor, autoscan.ErrTargetNotReady)
+		}
+	}
+
+	t.log.Debug().
+		Str("id", scan.ID).
+		Str("path", folder).
+		Msg("Scan folder does not exist, but the mount is up; scanning anyway")
+	return nil
+}
+
+// resolve rozwiązuje dowiązania symboliczne w ścieżce, jeśli włączone ResolveSymlinks.
+func (t target) resolve(path string) string {
+	if !t.cfg.ResolveSymlinks {
+		return path
+	}
+
+	return resolveSymlinks(path)
+}
+
+// resolveSymlinks zwraca rzeczywistą ścieżkę, a gdy jej ustalenie się nie powiedzie
+// (np. ścieżka usuniętego pliku), ścieżkę bez zmian.
+func resolveSymlinks(path string) string {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return path
+	}
+
+	return resolved
+}
+
+// normalizePath zamienia separatory Windows (\) na /, aby ścieżki sieciowe
+// (UNC, np. \\server\share\media) dało się porównać; prefiks UNC zostaje zachowany jako //.
+func normalizePath(path string) string {
+	if !strings.Contains(path, `\`) {
+		return path
+	}
+
+	unc := strings.HasPrefix(path, `\\`)
+
+	path = strings.ReplaceAll(path, `\`, "/")
+	for strings.Contains(path, "//") {
+		path = strings.ReplaceAll(path, "//", "/")
+	}
+
+	if unc {
+		path = "/" + path
+	}
+
+	return path
+}
+
+// pathSegments dzieli ścieżkę (po normalizePath) na segmenty, pomijając puste, np. z podwójnego lub końcowego /.
+// Ścieżka UNC zaczyna się od segmentu //, więc nie pasuje do ścieżki lokalnej o tych samych segmentach.
+func pathSegments(path string) []string {
+	path = normalizePath(path)
+
+	segments := make([]string, 0, strings.Count(path, "/")+1)
+	if strings.HasPrefix(path, "//") {
+		segments = append(segments, "//")
+	}
+
+	for _, segment := range strings.Split(path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+
+	return segments
+}
+
+// withinPath sprawdza, czy folder to root lub leży w root, porównując całe segmenty ścieżek:
+// /data/Movies pasuje do /data/Movies/ i /data/Movies/Parasite, ale nie do /data/Movies 4K.
+func withinPath(folder string, root string) bool {
+	folderSegments, rootSegments := pathSegments(folder), pathSegments(root)
+	if len(rootSegments) > len(folderSegments) {
+		return false
+	}
+
+	for i, segment := range rootSegments {
+		if folderSegments[i] != segment {
+			return false
+		}
+	}
+
+	return true
+}
+
+// serverPath zapisuje ścieżkę z separatorem serwera Jellyfin (PathSeparator).
+func (t target) serverPath(path string) string {
+	if t.cfg.PathSeparator != separatorBackslash {
+		return path
+	}
+
+	return strings.ReplaceAll(normalizePath(path), "/", separatorBackslash)
+}
+
+func withTrailingSlash(path string) string {
+	if strings.HasSuffix(path, "/") {
+		return path
+	}
+
+	return path + "/"
+}
+
+// scanLibrary zwraca bibliotekę skanu: wskazaną przez trigger (Scan.LibraryHint, bez względu na wielkość
+// liter i odstępy), a gdy takiej nie ma, bibliotekę ścieżki. hinted mówi, czy użyto wskazania triggera.
+func (t target) scanLibrary(scan autoscan.Scan, folder string) (lib *library, hinted bool, err error) {
+	t.libraries.mu.Lock()
+	libraries := t.libraries.libraries
+	t.libraries.mu.Unlock()
+
+	if scan.LibraryHint != "" {
+		if lib, ok := findLibrary(libraries, scan.LibraryHint); ok {
+			return lib, true, nil
+		}
+	}
+
+	lib, err = t.getScanLibrary(folder)
+	return lib, false, err
+}
+
+// defaultLibrary zwraca DefaultLibrary dla folderu spoza bibliotek lub false, gdy nie jest ustawiona.
+func (t target) defaultLibrary() (*library, bool) {
+	if t.cfg.DefaultLibrary == "" {
+		return nil, false
+	}
+
+	t.libraries.mu.Lock()
+	libraries := t.libraries.libraries
+	t.libraries.mu.Unlock()
+
+	return findLibrary(libraries, t.cfg.DefaultLibrary)
+}
+
+// findLibrary zwraca bibliotekę o podanej nazwie; wielkość liter i odstępy nie mają znaczenia.
+func findLibrary(libraries []library, name string) (*library, bool) {
+	for i := range libraries {
+		if normalizeName(libraries[i].Name) == normalizeName(name) {
+			lib := libraries[i]
+			return &lib, true
+		}
+	}
+
+	return nil, false
+}
+
+// getScanLibrary zwraca bibliotekę, do której należy ścieżka (po rewrite).
+// Biblioteka może obejmować kilka lokalizacji, pasuje dowolna z nich.
+func (t target) getScanLibrary(folder string) (*library, error) {
+	t.libraries.mu.Lock()
+	libraries := t.libraries.libraries
+	t.libraries.mu.Unlock()
+
+	folder = normalizePath(folder)
+	if t.cfg.StrictLibraryPaths {
+		return t.strictScanLibrary(libraries, folder)
+	}
+
+	for _, l := range libraries {
+		for _, path := range l.Paths {
+			if withinPath(folder, path) {
+				return &l, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%v: failed determining library", folder)
+}
+
+// libraryMatch to biblioteka pasująca do folderu i liczba segmentów jej najdłuższej pasującej lokalizacji.
+type libraryMatch struct {
+	lib    library
+	length int
+}
+
+// strictScanLibrary dopasowuje folder przy StrictLibraryPaths: tylko na granicy katalogu, a spośród kilku
+// pasujących bibliotek wybiera tę o typie z LibraryTypes lub według AmbiguousLibrary.
+// Niejednoznaczne dopasowanie przy AmbiguousLibrary error odrzuca skan (ErrScanRefused), aby np. plik 4K
+// nie odświeżył biblioteki HD o nakładającej się lokalizacji.
+func (t target) strictScanLibrary(libraries []library, folder string) (*library, error) {
+	matches := make([]libraryMatch, 0)
+	for _, l := range libraries {
+		length, found := 0, false
+		for _, path := range l.Paths {
+			if n := len(pathSegments(path)); withinPath(folder, path) && (!found || n > length) {
+				length, found = n, true
+			}
+		}
+
+		if found {
+			matches = append(matches, libraryMatch{lib: l, length: length})
+		}
+	}
+
+	// Typ kolekcji rozstrzyga między bibliotekami o nakładających się lokalizacjach.
+	if len(matches) > 1 {
+		handled := make([]libraryMatch, 0, len(matches))
+		for _, m := range matches {
+			if t.handlesType(m.lib.Type) {
+				handled = append(handled, m)
+			}
+		}
+
+		if len(handled) > 0 {
+			matches = handled
+		}
+	}
+
+	switch {
+	case len(matches) == 0:
+		return nil, fmt.Errorf("%v: failed determining library", folder)
+	case len(matches) == 1 || t.cfg.AmbiguousLibrary == ambiguousFirst:
+		return &matches[0].lib, nil
+	case t.cfg.AmbiguousLibrary == ambiguousLongest:
+		longest := matches[0]
+		for _, m := range matches[1:] {
+			if m.length > longest.length {
+				longest = m
+			}
+		}
+		return &longest.lib, nil
+	}
+
+	names := make([]string, 0, len(matches))
+	for _, m := range matches {
+		names = append(names, m.lib.Name)
+	}
+
+	return nil, fmt.Errorf("%v: ambiguous library, matches %s: %w", folder, strings.Join(names, ", "), autoscan.ErrScanRefused)
 }
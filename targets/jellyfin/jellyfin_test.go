@@ -0,0 +1,4485 @@
+package jellyfin
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cloudbox/autoscan"
+	"github.com/cloudbox/autoscan/migrate"
+
+	// sqlite3 driver
+	_ "modernc.org/sqlite"
+)
+
+type server struct {
+	// token expected by the server, token when empty
+	token string
+
+	folders  string
+	sessions string
+	views    string
+	items    string
+	movies   string
+
+	// views served to the users, by user ID, instead of views
+	userViews map[string]string
+
+	// collections (box sets) served by the items query without a user
+	collections string
+
+	// scheduled tasks, by default only the RefreshLibrary task.
+	tasks string
+
+	// states and progress of the RefreshLibrary task, one per request, the last one repeats.
+	states   []string
+	progress []float64
+	polls    int
+	polled   []time.Time
+
+	// refreshes take delay, items within failures fail to refresh.
+	delay      time.Duration
+	failures   []string
+	active     int
+	concurrent int
+
+	// ParentId of every item request
+	parents []string
+
+	// user of every views and items request, other users are served as user
+	users []string
+
+	// number of views requests
+	viewRequests int
+
+	// Recursive query of every item refresh
+	recursive []string
+
+	lock     sync.Mutex
+	requests []string
+}
+
+func (s *server) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	token := s.token
+	s.lock.Unlock()
+	if token == "" {
+		token = "token"
+	}
+
+	if r.Header.Get("X-Emby-Token") != token {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	path, user := r.URL.Path, ""
+	if parts := strings.SplitN(path, "/", 4); len(parts) == 4 && parts[1] == "Users" && parts[2] != "" {
+		s.lock.Lock()
+		s.users = append(s.users, parts[2])
+		s.lock.Unlock()
+
+		path, user = "/Users/user/"+parts[3], parts[2]
+	}
+
+	switch path {
+	case "/Library/VirtualFolders":
+		if s.folders != "" {
+			_, _ = rw.Write([]byte(s.folders))
+			return
+		}
+
+		_, _ = rw.Write([]byte(`[{"Name": "Movies", "Locations": ["/data/Movies"], "CollectionType": "movies", "ItemId": "f137a2dd21bbc1b99aa5c0f6bf02a805"}]`))
+		return
+	case "/Sessions":
+		_, _ = rw.Write([]byte(s.sessions))
+		return
+	case "/Users/user/Views":
+		s.lock.Lock()
+		s.viewRequests++
+		s.lock.Unlock()
+
+		if views, ok := s.userViews[user]; ok {
+			_, _ = rw.Write([]byte(views))
+			return
+		}
+
+		if s.views != "" {
+			_, _ = rw.Write([]byte(s.views))
+			return
+		}
+
+		_, _ = rw.Write([]byte(`{"Items": [{"Id": "view", "Name": "Movies"}]}`))
+		return
+	case "/Users/user/Items":
+		s.lock.Lock()
+		s.parents = append(s.parents, r.URL.Query().Get("ParentId"))
+		s.lock.Unlock()
+
+		if r.URL.Query().Get("IncludeItemTypes") == "Movie" {
+			_, _ = rw.Write([]byte(s.movies))
+			return
+		}
+
+		if s.items != "" {
+			_, _ = rw.Write([]byte(s.items))
+			return
+		}
+
+		_, _ = rw.Write([]byte(`{"Items": [{"Id": "parasite", "Path": "/data/Movies/Parasite (2019)"}]}`))
+		return
+	case "/Items":
+		if r.URL.Query().Get("IncludeItemTypes") == "BoxSet" {
+			_, _ = rw.Write([]byte(s.collections))
+			return
+		}
+	case "/ScheduledTasks":
+		if s.tasks != "" {
+			_, _ = rw.Write([]byte(s.tasks))
+			return
+		}
+
+		s.lock.Lock()
+		state := s.states[len(s.states)-1]
+		if s.polls < len(s.states) {
+			state = s.states[s.polls]
+		}
+		progress := 0.0
+		if len(s.progress) > 0 {
+			progress = s.progress[len(s.progress)-1]
+			if s.polls < len(s.progress) {
+				progress = s.progress[s.polls]
+			}
+		}
+		s.polls++
+		s.polled = append(s.polled, time.Now())
+		s.lock.Unlock()
+
+		_, _ = fmt.Fprintf(rw, `[{"Name": "Scan Media Library", "Key": "RefreshLibrary", "State": %q, "CurrentProgressPercentage": %v}]`, state, progress)
+		return
+	}
+
+	s.lock.Lock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	if strings.HasSuffix(r.URL.Path, "/Refresh") {
+		s.recursive = append(s.recursive, r.URL.Query().Get("Recursive"))
+	}
+	s.active++
+	if s.active > s.concurrent {
+		s.concurrent = s.active
+	}
+	s.lock.Unlock()
+
+	time.Sleep(s.delay)
+
+	s.lock.Lock()
+	s.active--
+	s.lock.Unlock()
+
+	for _, id := range s.failures {
+		if r.URL.Path == "/Items/"+id+"/Refresh" {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// fakeAPI is an apiClient without a Jellyfin server. The items are found by their path
+// and the views by the name of their library, every refresh and scan is recorded.
+type fakeAPI struct {
+	libraries []library
+	views     map[string]string
+	items     map[string][]item
+
+	// errors of the refreshes of these items and of every library scan.
+	failures map[string]error
+	scanErr  error
+
+	lock  sync.Mutex
+	calls []string
+}
+
+var errFake = errors.New("fake failure")
+
+func (f *fakeAPI) record(call string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.calls = append(f.calls, call)
+}
+
+func (f *fakeAPI) Available() error {
+	return nil
+}
+
+func (f *fakeAPI) Libraries() ([]library, error) {
+	return f.libraries, nil
+}
+
+func (f *fakeAPI) Scan(_ context.Context, path string) error {
+	f.record("Scan " + path)
+	return f.scanErr
+}
+
+func (f *fakeAPI) Remove(_ context.Context, path string) error {
+	f.record("Remove " + path)
+	return f.scanErr
+}
+
+func (f *fakeAPI) GetViewID(_ context.Context, _ string, libraryName string) (string, error) {
+	viewID, ok := f.views[libraryName]
+	if !ok {
+		return "", fmt.Errorf("%q: %w", libraryName, errViewNotFound)
+	}
+
+	return viewID, nil
+}
+
+func (f *fakeAPI) FindItemsByPath(_ context.Context, _ string, _ string, path string) ([]item, error) {
+	items, ok := f.items[path]
+	if !ok {
+		return nil, fmt.Errorf("%v: item not found", path)
+	}
+
+	return items, nil
+}
+
+func (f *fakeAPI) FindMoviesByFolder(_ context.Context, _ string, _ string, folder string) ([]item, error) {
+	return nil, fmt.Errorf("%v: no movies found", folder)
+}
+
+func (f *fakeAPI) FindCollection(_ context.Context, name string) (string, error) {
+	return "", fmt.Errorf("%q: collection not found", name)
+}
+
+func (f *fakeAPI) RefreshItem(_ context.Context, itemID string) error {
+	f.record("RefreshItem " + itemID)
+	return f.failures[itemID]
+}
+
+func (f *fakeAPI) RefreshMetadata(_ context.Context, itemID string) error {
+	f.record("RefreshMetadata " + itemID)
+	return f.failures[itemID]
+}
+
+func (f *fakeAPI) RefreshTask(context.Context) (refreshTask, error) {
+	return refreshTask{State: "Idle"}, nil
+}
+
+func (f *fakeAPI) ScheduledTasks(context.Context) ([]scheduledTask, error) {
+	return nil, nil
+}
+
+func (f *fakeAPI) RunTask(_ context.Context, taskID string) error {
+	f.record("RunTask " + taskID)
+	return f.scanErr
+}
+
+func (f *fakeAPI) ActiveSessions(context.Context) (bool, error) {
+	return false, nil
+}
+
+func (f *fakeAPI) token() string {
+	return "token"
+}
+
+func (f *fakeAPI) setToken(string) {}
+
+func (f *fakeAPI) redact(s string) string {
+	return s
+}
+
+func (f *fakeAPI) redactError(err error) error {
+	return err
+}
+
+func TestScanWithFakeAPI(t *testing.T) {
+	type Test struct {
+		Name     string
+		Config   Config
+		Scan     autoscan.Scan
+		Failures map[string]error
+		ScanErr  error
+		Views    map[string]string
+		WantErr  error
+		Calls    []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:   "Refreshes the matching item",
+			Config: Config{PreciseRefresh: true},
+			Scan:   autoscan.Scan{Folder: "/data/Movies/Parasite (2019)"},
+			Calls:  []string{"RefreshItem parasite"},
+		},
+		{
+			Name:   "Falls back to a library scan without a matching item",
+			Config: Config{PreciseRefresh: true},
+			Scan:   autoscan.Scan{Folder: "/data/Movies/Joker (2019)"},
+			Calls:  []string{"Scan /data/Movies/Joker (2019)"},
+		},
+		{
+			Name:     "Falls back to a library scan when the refresh fails",
+			Config:   Config{PreciseRefresh: true},
+			Scan:     autoscan.Scan{Folder: "/data/Movies/Parasite (2019)"},
+			Failures: map[string]error{"parasite": errFake},
+			Calls:    []string{"RefreshItem parasite", "Scan /data/Movies/Parasite (2019)"},
+		},
+		{
+			Name:   "Falls back to a library scan without a view of the library",
+			Config: Config{PreciseRefresh: true},
+			Scan:   autoscan.Scan{Folder: "/data/Movies/Parasite (2019)"},
+			Views:  map[string]string{},
+			Calls:  []string{"Scan /data/Movies/Parasite (2019)"},
+		},
+		{
+			Name:  "Scans the library without precise refreshes",
+			Scan:  autoscan.Scan{Folder: "/data/TV/Westworld/Season 1"},
+			Calls: []string{"Scan /data/TV/Westworld/Season 1"},
+		},
+		{
+			Name:   "Refreshes the items of the trigger",
+			Config: Config{PreciseRefresh: true, RefreshWorkers: 1},
+			Scan:   autoscan.Scan{Folder: "/data/TV/Westworld", ItemIDs: []string{"westworld-s1", "westworld-s2"}},
+			Calls:  []string{"RefreshItem westworld-s1", "RefreshItem westworld-s2"},
+		},
+		{
+			Name: "Skips folders outside of all libraries",
+			Scan: autoscan.Scan{Folder: "/downloads/Parasite (2019)"},
+		},
+		{
+			Name:    "Returns the errors of library scans",
+			Scan:    autoscan.Scan{Folder: "/data/Movies/Parasite (2019)"},
+			ScanErr: errFake,
+			WantErr: errFake,
+			Calls:   []string{"Scan /data/Movies/Parasite (2019)"},
+		},
+		{
+			Name:    "Strict library matches refuse ambiguous libraries",
+			Config:  Config{StrictLibraryPaths: true},
+			Scan:    autoscan.Scan{Folder: "/data/Anime/Akira (1988)"},
+			WantErr: autoscan.ErrScanRefused,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			views := tc.Views
+			if views == nil {
+				views = map[string]string{"Movies": "movies", "TV": "tv"}
+			}
+
+			api := &fakeAPI{
+				libraries: []library{
+					{Name: "Movies", Type: "movies", Paths: []string{"/data/Movies/"}},
+					{Name: "TV", Type: "tvshows", Paths: []string{"/data/TV/", "/data/Anime/"}},
+					{Name: "Anime", Type: "tvshows", Paths: []string{"/data/Anime/"}},
+				},
+				views: views,
+				items: map[string][]item{
+					"/data/Movies/Parasite (2019)": {{ID: "parasite", Type: "Movie"}},
+				},
+				failures: tc.Failures,
+				scanErr:  tc.ScanErr,
+			}
+
+			c := tc.Config
+			c.URL = "http://jellyfin:8096"
+			c.UserID = "user"
+
+			target, err := newTarget(c, api)
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			err = target.Scan(context.Background(), tc.Scan)
+			if !errors.Is(err, tc.WantErr) {
+				t.Errorf("Errors do not match: %v vs %v", err, tc.WantErr)
+			}
+
+			if !reflect.DeepEqual(api.calls, tc.Calls) {
+				t.Errorf("Calls do not match: %v vs %v", api.calls, tc.Calls)
+			}
+		})
+	}
+}
+
+func TestRecentRefreshes(t *testing.T) {
+	type Test struct {
+		Name     string
+		TTL      time.Duration
+		Elapsed  time.Duration
+		Failures map[string]error
+		Calls    []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:  "Skips an item refreshed within the TTL",
+			TTL:   time.Minute,
+			Calls: []string{"RefreshItem parasite"},
+		},
+		{
+			Name:    "Refreshes the item again once the TTL passed",
+			TTL:     time.Minute,
+			Elapsed: time.Minute,
+			Calls:   []string{"RefreshItem parasite", "RefreshItem parasite"},
+		},
+		{
+			Name:  "Refreshes the item every time without a TTL",
+			Calls: []string{"RefreshItem parasite", "RefreshItem parasite"},
+		},
+		{
+			Name:     "Retries an item which failed to refresh",
+			TTL:      time.Minute,
+			Failures: map[string]error{"parasite": errFake},
+			Calls: []string{
+				"RefreshItem parasite", "Scan /data/Movies/Parasite (2019)",
+				"RefreshItem parasite", "Scan /data/Movies/Gisaengchung (2019)",
+			},
+		},
+	}
+
+	defer func() { now = time.Now }()
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			at := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+			now = func() time.Time { return at }
+
+			// both folders resolve to the same item, e.g. a renamed folder and its original
+			api := &fakeAPI{
+				libraries: []library{{Name: "Movies", Type: "movies", Paths: []string{"/data/Movies/"}}},
+				views:     map[string]string{"Movies": "movies"},
+				items: map[string][]item{
+					"/data/Movies/Parasite (2019)":     {{ID: "parasite", Type: "Movie"}},
+					"/data/Movies/Gisaengchung (2019)": {{ID: "parasite", Type: "Movie"}},
+				},
+				failures: tc.Failures,
+			}
+
+			target, err := newTarget(Config{
+				URL:              "http://jellyfin:8096",
+				UserID:           "user",
+				PreciseRefresh:   true,
+				RecentRefreshTTL: tc.TTL,
+			}, api)
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			if err := target.Scan(context.Background(), autoscan.Scan{Folder: "/data/Movies/Parasite (2019)"}); err != nil {
+				t.Fatal(err)
+			}
+
+			at = at.Add(tc.Elapsed)
+			if err := target.Scan(context.Background(), autoscan.Scan{Folder: "/data/Movies/Gisaengchung (2019)"}); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(api.calls, tc.Calls) {
+				t.Errorf("Calls do not match: %v vs %v", api.calls, tc.Calls)
+			}
+		})
+	}
+}
+
+func TestQuietHoursDeferLibraryScans(t *testing.T) {
+	type Test struct {
+		Name    string
+		Now     string
+		Folder  string
+		WantErr error
+		Calls   []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:    "Defers fallbacks within the quiet hours",
+			Now:     "2026-03-10T23:00:00Z",
+			Folder:  "/data/Movies/Joker (2019)",
+			WantErr: autoscan.ErrTargetNotReady,
+		},
+		{
+			Name:   "Refreshes items within the quiet hours",
+			Now:    "2026-03-10T23:00:00Z",
+			Folder: "/data/Movies/Parasite (2019)",
+			Calls:  []string{"RefreshItem parasite"},
+		},
+		{
+			Name:   "Scans the library outside of the quiet hours",
+			Now:    "2026-03-11T06:00:00Z",
+			Folder: "/data/Movies/Joker (2019)",
+			Calls:  []string{"Scan /data/Movies/Joker (2019)"},
+		},
+		{
+			Name:    "Defers default library scans within the quiet hours",
+			Now:     "2026-03-11T05:59:00Z",
+			Folder:  "/downloads/Joker (2019)",
+			WantErr: autoscan.ErrTargetNotReady,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			at, err := time.Parse(time.RFC3339, tc.Now)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			now = func() time.Time { return at }
+			defer func() { now = time.Now }()
+
+			api := &fakeAPI{
+				libraries: []library{{Name: "Movies", Type: "movies", Paths: []string{"/data/Movies/"}}},
+				views:     map[string]string{"Movies": "movies"},
+				items: map[string][]item{
+					"/data/Movies/Parasite (2019)": {{ID: "parasite", Type: "Movie"}},
+				},
+			}
+
+			target, err := newTarget(Config{
+				URL:            "http://jellyfin:8096",
+				UserID:         "user",
+				PreciseRefresh: true,
+				DefaultLibrary: "Movies",
+				QuietHours:     []string{"22:00-06:00"},
+				QuietTimezone:  "UTC",
+			}, api)
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			err = target.Scan(context.Background(), autoscan.Scan{Folder: tc.Folder})
+			if !errors.Is(err, tc.WantErr) {
+				t.Errorf("Errors do not match: %v vs %v", err, tc.WantErr)
+			}
+
+			if !reflect.DeepEqual(api.calls, tc.Calls) {
+				t.Errorf("Calls do not match: %v vs %v", api.calls, tc.Calls)
+			}
+		})
+	}
+
+	t.Run("Rejects invalid quiet hours", func(t *testing.T) {
+		_, err := newTarget(Config{URL: "http://jellyfin:8096", QuietHours: []string{"night"}}, &fakeAPI{})
+		if !errors.Is(err, autoscan.ErrFatal) {
+			t.Errorf("Errors do not match: %v vs %v", err, autoscan.ErrFatal)
+		}
+	})
+}
+
+func TestPauseOnPlayback(t *testing.T) {
+	type Test struct {
+		Name     string
+		Sessions string
+		WantErr  error
+		Requests []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:     "Defers scans while playing",
+			Sessions: `[{"Id": "1", "UserName": "jan", "NowPlayingItem": {"Id": "9fa3b8c2", "Name": "Parasite"}, "PlayState": {"IsPaused": false}}]`,
+			WantErr:  autoscan.ErrTargetNotReady,
+		},
+		{
+			Name:     "Scans while playback is paused",
+			Sessions: `[{"Id": "1", "UserName": "jan", "NowPlayingItem": {"Id": "9fa3b8c2", "Name": "Parasite"}, "PlayState": {"IsPaused": true}}]`,
+			Requests: []string{"POST /Library/Media/Updated"},
+		},
+		{
+			Name:     "Scans while idle",
+			Sessions: `[{"Id": "1", "UserName": "jan", "PlayState": {"IsPaused": false}}]`,
+			Requests: []string{"POST /Library/Media/Updated"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{sessions: tc.Sessions}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			target, err := New(Config{
+				URL:             ts.URL,
+				Token:           "token",
+				PauseOnPlayback: true,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			err = target.Scan(context.Background(), autoscan.Scan{Folder: "/data/Movies/Parasite (2019)"})
+			if !errors.Is(err, tc.WantErr) {
+				t.Errorf("Errors do not match: %v vs %v", err, tc.WantErr)
+			}
+
+			if !reflect.DeepEqual(s.requests, tc.Requests) {
+				t.Logf("want: %v", tc.Requests)
+				t.Logf("got:  %v", s.requests)
+				t.Errorf("Requests do not match")
+			}
+		})
+	}
+}
+
+func TestLibraries(t *testing.T) {
+	s := &server{
+		folders: `[
+			{"Name": "Movies", "Locations": ["/data/Movies", "/data/Movies 4K/"], "CollectionType": "movies"},
+			{"Name": "Music", "Locations": ["/data/Music"], "CollectionType": "music"},
+			{"Name": "Mixed", "Locations": ["/data/Mixed"]}
+		]`,
+	}
+
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	target, err := New(Config{
+		URL:   ts.URL,
+		Token: "token",
+	})
+	if err != nil {
+		t.Fatalf("Could not create Jellyfin Target: %v", err)
+	}
+
+	libraries, err := target.(autoscan.LibraryLister).Libraries(context.Background())
+	if err != nil {
+		t.Fatalf("Could not list libraries: %v", err)
+	}
+
+	want := []autoscan.Library{
+		{Name: "Movies", Type: "movies", Paths: []string{"/data/Movies/", "/data/Movies 4K/"}},
+		{Name: "Music", Type: "music", Paths: []string{"/data/Music/"}},
+		{Name: "Mixed", Paths: []string{"/data/Mixed/"}},
+	}
+
+	if !reflect.DeepEqual(libraries, want) {
+		t.Logf("want: %v", want)
+		t.Logf("got:  %v", libraries)
+		t.Errorf("Libraries do not match")
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	type Test struct {
+		Name   string
+		Config Config
+		Scan   autoscan.Scan
+	}
+
+	var testCases = []Test{
+		{
+			Name:   "Precise refresh",
+			Config: Config{UserID: "user", PreciseRefresh: true},
+			Scan:   autoscan.Scan{Folder: "/data/Movies/Parasite (2019)"},
+		},
+		{
+			Name:   "Fallback to a library scan",
+			Config: Config{UserID: "user", PreciseRefresh: true},
+			Scan:   autoscan.Scan{Folder: "/data/Movies/Interstellar (2014)"},
+		},
+		{
+			Name:   "Library scan",
+			Config: Config{},
+			Scan:   autoscan.Scan{Folder: "/data/Movies/Parasite (2019)"},
+		},
+		{
+			Name:   "Removal",
+			Config: Config{RemoveDeleted: true},
+			Scan:   autoscan.Scan{Folder: "/data/Movies/Parasite (2019)", Removed: true},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			tc.Config.URL = ts.URL
+			tc.Config.Token = "token"
+
+			target, err := New(tc.Config)
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			if err := autoscan.DryRun(target).Scan(context.Background(), tc.Scan); err != nil {
+				t.Fatalf("Dry run failed: %v", err)
+			}
+
+			if len(s.requests) > 0 {
+				t.Errorf("Requests were sent in dry run: %v", s.requests)
+			}
+		})
+	}
+}
+
+func TestRefreshParent(t *testing.T) {
+	type Test struct {
+		Name     string
+		Precise  bool
+		Folder   string
+		Requests []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:     "Refreshes the parent of the removed folder",
+			Precise:  true,
+			Folder:   "/data/Movies/Collection/Parasite (2019)",
+			Requests: []string{"POST /Library/Media/Updated", "POST /Items/collection/Refresh"},
+		},
+		{
+			Name:     "Does not refresh the library of the removed folder",
+			Precise:  true,
+			Folder:   "/data/Movies/Parasite (2019)",
+			Requests: []string{"POST /Library/Media/Updated"},
+		},
+		{
+			Name:     "Does not refresh the parent without precise refresh",
+			Folder:   "/data/Movies/Collection/Parasite (2019)",
+			Requests: []string{"POST /Library/Media/Updated"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{items: `{"Items": [{"Id": "collection", "Path": "/data/Movies/Collection"}]}`}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			target, err := New(Config{
+				URL:            ts.URL,
+				Token:          "token",
+				UserID:         "user",
+				PreciseRefresh: tc.Precise,
+				RemoveDeleted:  true,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			if err := target.Scan(context.Background(), autoscan.Scan{Folder: tc.Folder, Removed: true}); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(s.requests, tc.Requests) {
+				t.Errorf("Requests do not match: %v vs %v", s.requests, tc.Requests)
+			}
+		})
+	}
+}
+
+func TestRefreshClosestAncestor(t *testing.T) {
+	type Test struct {
+		Name     string
+		Folder   string
+		Requests []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:     "Refreshes the existing parent of a deleted leaf",
+			Folder:   "/data/Movies/Collection/Parasite (2019)",
+			Requests: []string{"POST /Items/collection/Refresh"},
+		},
+		{
+			Name:     "Walks up to the closest existing ancestor",
+			Folder:   "/data/Movies/Collection/Parasite (2019)/Extras/Interviews",
+			Requests: []string{"POST /Items/collection/Refresh"},
+		},
+		{
+			Name:     "Stops walking up after the maximum steps",
+			Folder:   "/data/Movies/Collection/Parasite (2019)/Extras/Interviews/Cast",
+			Requests: []string{"POST /Library/Media/Updated"},
+		},
+		{
+			Name:     "Never refreshes the library root",
+			Folder:   "/data/Movies/Parasite (2019)",
+			Requests: []string{"POST /Library/Media/Updated"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{items: `{"Items": [{"Id": "collection", "Path": "/data/Movies/Collection"}]}`}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			target, err := New(Config{
+				URL:            ts.URL,
+				Token:          "token",
+				UserID:         "user",
+				PreciseRefresh: true,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			if err := target.Scan(context.Background(), autoscan.Scan{Folder: tc.Folder, Removed: true}); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(s.requests, tc.Requests) {
+				t.Errorf("Requests do not match: %v vs %v", s.requests, tc.Requests)
+			}
+		})
+	}
+}
+
+func TestWaitForRefresh(t *testing.T) {
+	type Test struct {
+		Name   string
+		Config Config
+		States []string
+		Polls  int
+	}
+
+	var testCases = []Test{
+		{
+			Name:   "Waits until the refresh is idle",
+			Config: Config{WaitForRefresh: true},
+			States: []string{"Running", "Running", "Idle"},
+			Polls:  3,
+		},
+		{
+			Name:   "Stops waiting after the timeout",
+			Config: Config{WaitForRefresh: true, RefreshTimeout: 50 * time.Millisecond},
+			States: []string{"Running"},
+		},
+		{
+			Name:   "Does not wait by default",
+			States: []string{"Running"},
+			Polls:  0,
+		},
+	}
+
+	interval := refreshInterval
+	refreshInterval = 10 * time.Millisecond
+	defer func() {
+		refreshInterval = interval
+	}()
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{states: tc.States}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			tc.Config.URL = ts.URL
+			tc.Config.Token = "token"
+			tc.Config.UserID = "user"
+			tc.Config.PreciseRefresh = true
+
+			target, err := New(tc.Config)
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			start := time.Now()
+			if err := target.Scan(context.Background(), autoscan.Scan{Folder: "/data/Movies/Parasite (2019)"}); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			if want := []string{"POST /Items/parasite/Refresh"}; !reflect.DeepEqual(s.requests, want) {
+				t.Errorf("Requests do not match: %v vs %v", s.requests, want)
+			}
+
+			// the timeout case keeps polling until the timeout elapses
+			if tc.Config.RefreshTimeout > 0 {
+				if elapsed := time.Since(start); elapsed < tc.Config.RefreshTimeout {
+					t.Errorf("Stopped waiting before the timeout: %v", elapsed)
+				}
+
+				if s.polls < 2 {
+					t.Errorf("Refresh state was not polled repeatedly: %d", s.polls)
+				}
+				return
+			}
+
+			if s.polls != tc.Polls {
+				t.Errorf("Polls do not match: %d vs %d", s.polls, tc.Polls)
+			}
+		})
+	}
+}
+
+func TestRefreshProgress(t *testing.T) {
+	interval := refreshInterval
+	refreshInterval = 10 * time.Millisecond
+	defer func() {
+		refreshInterval = interval
+	}()
+
+	s := &server{
+		states:   []string{"Running", "Running", "Running", "Running", "Idle"},
+		progress: []float64{5, 25.5, 27, 60, 0},
+	}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	tp, err := New(Config{URL: ts.URL, Token: "token", UserID: "user", PreciseRefresh: true, WaitForRefresh: true})
+	if err != nil {
+		t.Fatalf("Could not create Jellyfin Target: %v", err)
+	}
+
+	var logs bytes.Buffer
+	jt := tp.(*target)
+	jt.log = zerolog.New(&logs)
+
+	if err := jt.Scan(context.Background(), autoscan.Scan{Folder: "/data/Movies/Parasite (2019)"}); err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	progress := make([]float64, 0)
+	completed := false
+	decoder := json.NewDecoder(&logs)
+	for decoder.More() {
+		var line struct {
+			Message  string  `json:"message"`
+			Progress float64 `json:"progress"`
+		}
+
+		if err := decoder.Decode(&line); err != nil {
+			t.Fatal(err)
+		}
+
+		switch line.Message {
+		case "Waiting for Jellyfin refresh":
+			progress = append(progress, line.Progress)
+		case "Jellyfin refresh completed":
+			completed = true
+		}
+	}
+
+	// progress within the same step of 10 percent is not logged again
+	if want := []float64{5, 25.5, 60}; !reflect.DeepEqual(progress, want) {
+		t.Errorf("Logged progress does not match: %v vs %v", progress, want)
+	}
+
+	if !completed {
+		t.Errorf("Completion was not logged: %s", logs.String())
+	}
+}
+
+func TestRefreshPollInitialDelay(t *testing.T) {
+	interval := refreshInterval
+	refreshInterval = 10 * time.Millisecond
+	defer func() {
+		refreshInterval = interval
+	}()
+
+	s := &server{states: []string{"Running", "Idle"}}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	delay := 100 * time.Millisecond
+	target, err := New(Config{
+		URL:                     ts.URL,
+		Token:                   "token",
+		UserID:                  "user",
+		PreciseRefresh:          true,
+		WaitForRefresh:          true,
+		RefreshPollInitialDelay: delay,
+	})
+	if err != nil {
+		t.Fatalf("Could not create Jellyfin Target: %v", err)
+	}
+
+	start := time.Now()
+	if err := target.Scan(context.Background(), autoscan.Scan{Folder: "/data/Movies/Parasite (2019)"}); err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	if len(s.polled) != 2 {
+		t.Fatalf("Refresh state was not polled until idle: %d polls", len(s.polled))
+	}
+
+	if first := s.polled[0].Sub(start); first < delay {
+		t.Errorf("First poll did not wait for the initial delay: %v", first)
+	}
+
+	// the following polls use the refresh interval
+	if next := s.polled[1].Sub(s.polled[0]); next >= delay {
+		t.Errorf("Second poll waited for the initial delay again: %v", next)
+	}
+}
+
+func TestConfirmScan(t *testing.T) {
+	type Test struct {
+		Name    string
+		Confirm bool
+		States  []string
+		Polls   int
+		WantLog bool
+	}
+
+	var testCases = []Test{
+		{
+			Name:    "Library scan was started",
+			Confirm: true,
+			States:  []string{"Idle", "Running"},
+			Polls:   2,
+		},
+		{
+			Name:    "Library scan was silently ignored",
+			Confirm: true,
+			States:  []string{"Idle"},
+			Polls:   confirmScanPolls,
+			WantLog: true,
+		},
+		{
+			Name:   "Does not confirm by default",
+			States: []string{"Idle"},
+		},
+	}
+
+	interval := refreshInterval
+	refreshInterval = 10 * time.Millisecond
+	defer func() {
+		refreshInterval = interval
+	}()
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{states: tc.States}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			tp, err := New(Config{URL: ts.URL, Token: "token", ConfirmScan: tc.Confirm})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			var logs bytes.Buffer
+			jt := tp.(*target)
+			jt.log = zerolog.New(&logs).Level(zerolog.DebugLevel)
+
+			if err := jt.Scan(context.Background(), autoscan.Scan{Folder: "/data/Movies/Parasite (2019)"}); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			if want := []string{"POST /Library/Media/Updated"}; !reflect.DeepEqual(s.requests, want) {
+				t.Errorf("Requests do not match: %v vs %v", s.requests, want)
+			}
+
+			if s.polls != tc.Polls {
+				t.Errorf("Polls do not match: %d vs %d", s.polls, tc.Polls)
+			}
+
+			if logged := strings.Contains(logs.String(), "did not start it"); logged != tc.WantLog {
+				t.Errorf("Logging does not match: %v vs %v: %s", logged, tc.WantLog, logs.String())
+			}
+		})
+	}
+}
+
+func TestSkipUnchanged(t *testing.T) {
+	type Given struct {
+		LastSeen string
+		Etag     string
+	}
+
+	type Expected struct {
+		Requests []string
+		LastSeen string
+	}
+
+	type Test struct {
+		Name     string
+		Given    Given
+		Expected Expected
+	}
+
+	var testCases = []Test{
+		{
+			"Refreshes a changed item",
+			Given{
+				LastSeen: "6d5f1a",
+				Etag:     "b0c2e4",
+			},
+			Expected{
+				Requests: []string{"POST /Items/parasite/Refresh"},
+				LastSeen: "b0c2e4",
+			},
+		},
+		{
+			"Refreshes an item which was never seen",
+			Given{
+				Etag: "b0c2e4",
+			},
+			Expected{
+				Requests: []string{"POST /Items/parasite/Refresh"},
+				LastSeen: "b0c2e4",
+			},
+		},
+		{
+			"Skips an unchanged item",
+			Given{
+				LastSeen: "b0c2e4",
+				Etag:     "b0c2e4",
+			},
+			Expected{
+				LastSeen: "b0c2e4",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{
+				items: fmt.Sprintf(`{"Items": [{"Id": "parasite", "Path": "/data/Movies/Parasite (2019)", "Etag": %q}]}`, tc.Given.Etag),
+			}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			db, err := sql.Open("sqlite", ":memory:")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			db.SetMaxOpenConns(1)
+
+			mg, err := migrate.New(db, "migrations")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			store, err := newDatastore(db, mg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.Given.LastSeen != "" {
+				if err := store.SetLastSeen(ts.URL, "parasite", tc.Given.LastSeen); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			target, err := New(Config{
+				URL:            ts.URL,
+				Token:          "token",
+				UserID:         "user",
+				PreciseRefresh: true,
+				SkipUnchanged:  true,
+				Db:             db,
+				Mg:             mg,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			if err := target.Scan(context.Background(), autoscan.Scan{Folder: "/data/Movies/Parasite (2019)"}); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(s.requests, tc.Expected.Requests) {
+				t.Errorf("Requests do not match: %v vs %v", s.requests, tc.Expected.Requests)
+			}
+
+			lastSeen, err := store.LastSeen(ts.URL, "parasite")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if lastSeen != tc.Expected.LastSeen {
+				t.Errorf("Last seen does not match: %s vs %s", lastSeen, tc.Expected.LastSeen)
+			}
+		})
+	}
+}
+
+func TestStrictLibraryMatch(t *testing.T) {
+	type Test struct {
+		Name    string
+		Strict  bool
+		WantErr error
+	}
+
+	var testCases = []Test{
+		{
+			Name: "Drops the scan by default",
+		},
+		{
+			Name:    "Refuses the scan in strict mode",
+			Strict:  true,
+			WantErr: autoscan.ErrScanRefused,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			target, err := New(Config{
+				URL:                ts.URL,
+				Token:              "token",
+				StrictLibraryMatch: tc.Strict,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			err = target.Scan(context.Background(), autoscan.Scan{Folder: "/mnt/unionfs/Media/Movies/Parasite (2019)"})
+			if !errors.Is(err, tc.WantErr) {
+				t.Errorf("Errors do not match: %v vs %v", err, tc.WantErr)
+			}
+
+			if len(s.requests) > 0 {
+				t.Errorf("Requests were sent without a matching library: %v", s.requests)
+			}
+		})
+	}
+}
+
+func TestPreciseRefresh(t *testing.T) {
+	type Test struct {
+		Name     string
+		Folder   string
+		Expected RefreshResult
+	}
+
+	var testCases = []Test{
+		{
+			Name:   "Matched item",
+			Folder: "/data/Movies/Parasite (2019)",
+			Expected: RefreshResult{
+				ItemID:    "parasite",
+				ItemType:  "Movie",
+				Library:   "Movies",
+				Refreshed: 1,
+			},
+		},
+		{
+			Name:   "Unmatched item",
+			Folder: "/data/Movies/Interstellar (2014)",
+			Expected: RefreshResult{
+				Library:  "Movies",
+				Fallback: true,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{
+				items: `{"Items": [{"Id": "parasite", "Type": "Movie", "Path": "/data/Movies/Parasite (2019)"}]}`,
+			}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			tp, err := New(Config{
+				URL:            ts.URL,
+				Token:          "token",
+				UserID:         "user",
+				PreciseRefresh: true,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			jt := tp.(*target)
+			lib, err := jt.getScanLibrary(tc.Folder)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res := jt.preciseRefresh(context.Background(), jt.log, lib, tc.Folder)
+			if !reflect.DeepEqual(res, tc.Expected) {
+				t.Errorf("Results do not match: %+v vs %+v", res, tc.Expected)
+			}
+		})
+	}
+}
+
+func TestTraceHTTP(t *testing.T) {
+	const token = "a8f5f167f44f4964e6c998dee827110c"
+
+	// the server echoes the token, as some Jellyfin responses do
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(rw, `{"AccessToken": %q}`, r.Header.Get("X-Emby-Token"))
+	}))
+	defer ts.Close()
+
+	var logs bytes.Buffer
+	api := newAPIClient(Config{URL: ts.URL, Token: token, TraceHTTP: true}, zerolog.New(&logs).Level(zerolog.TraceLevel))
+
+	if err := api.Available(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(logs.String(), "Received response") || !strings.Contains(logs.String(), redacted) {
+		t.Errorf("Response was not traced: %s", logs.String())
+	}
+
+	if strings.Contains(logs.String(), token) {
+		t.Errorf("Token was not redacted: %s", logs.String())
+	}
+}
+
+func TestRedactError(t *testing.T) {
+	const token = "a8f5f167f44f4964e6c998dee827110c"
+
+	type Test struct {
+		Name     string
+		Token    string
+		Err      error
+		Expected string
+	}
+
+	var testCases = []Test{
+		{
+			Name:     "Token within the error is redacted",
+			Token:    token,
+			Err:      fmt.Errorf(`Get "http://jellyfin/Items?api_key=%s": EOF: %w`, token, autoscan.ErrTargetUnavailable),
+			Expected: `Get "http://jellyfin/Items?api_key=***": EOF: target unavailable`,
+		},
+		{
+			Name:     "Error without the token is unchanged",
+			Token:    token,
+			Err:      fmt.Errorf("502 Bad Gateway: %w", autoscan.ErrTargetUnavailable),
+			Expected: "502 Bad Gateway: target unavailable",
+		},
+		{
+			Name:     "Nothing is redacted without a token",
+			Err:      fmt.Errorf("502 Bad Gateway: %w", autoscan.ErrTargetUnavailable),
+			Expected: "502 Bad Gateway: target unavailable",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			err := redactError(tc.Err, tc.Token)
+			if err.Error() != tc.Expected {
+				t.Errorf("Errors do not match: %q vs %q", err.Error(), tc.Expected)
+			}
+
+			if !errors.Is(err, autoscan.ErrTargetUnavailable) {
+				t.Errorf("Redacted error does not wrap the original error: %v", err)
+			}
+		})
+	}
+
+	if err := redactError(nil, token); err != nil {
+		t.Errorf("Nil error was not kept: %v", err)
+	}
+}
+
+func TestRedirect(t *testing.T) {
+	type Test struct {
+		Name    string
+		Hops    int
+		WantErr bool
+	}
+
+	var testCases = []Test{
+		{
+			Name: "Follows a redirect with the token",
+			Hops: 1,
+		},
+		{
+			Name: "Follows multiple redirects",
+			Hops: 3,
+		},
+		{
+			Name:    "Stops after too many redirects",
+			Hops:    maxRedirects + 1,
+			WantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			// the proxy redirects until all hops are taken and then sends the request to Jellyfin
+			var hops int
+			proxy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				if hops < tc.Hops-1 {
+					hops++
+					http.Redirect(rw, r, r.URL.Path, http.StatusFound)
+					return
+				}
+
+				http.Redirect(rw, r, ts.URL+r.URL.Path, http.StatusFound)
+			}))
+			defer proxy.Close()
+
+			var logs bytes.Buffer
+			api := newAPIClient(Config{URL: proxy.URL, Token: "token"}, zerolog.New(&logs))
+
+			err := api.Available()
+			if (err != nil) != tc.WantErr {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !strings.Contains(logs.String(), "Jellyfin redirected the request") {
+				t.Errorf("Redirect was not logged: %s", logs.String())
+			}
+		})
+	}
+}
+
+func TestSetToken(t *testing.T) {
+	s := &server{
+		folders: `[{"Name": "Movies", "Locations": ["/data/Movies"], "CollectionType": "movies"}]`,
+	}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	tp, err := New(Config{URL: ts.URL, Token: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Jellyfin only accepts the rotated token from now on
+	s.lock.Lock()
+	s.token = "rotated"
+	s.lock.Unlock()
+
+	scan := autoscan.Scan{Folder: "/data/Movies/Interstellar (2014)"}
+	if err := tp.Scan(context.Background(), scan); !errors.Is(err, autoscan.ErrFatal) {
+		t.Fatalf("Scan with the previous token did not fail: %v", err)
+	}
+
+	tp.(autoscan.TokenRotator).SetToken("rotated")
+	if err := tp.Scan(context.Background(), scan); err != nil {
+		t.Fatalf("Scan with the rotated token failed: %v", err)
+	}
+
+	want := []string{"POST /Library/Media/Updated"}
+	if !reflect.DeepEqual(s.requests, want) {
+		t.Errorf("Requests do not match: %v vs %v", s.requests, want)
+	}
+
+	api := tp.(*target).api
+	msg := api.redact("token rotated")
+	if msg != redacted+" "+redacted {
+		t.Errorf("Tokens were not redacted: %s", msg)
+	}
+}
+
+func TestResolveSymlinks(t *testing.T) {
+	type Test struct {
+		Name     string
+		Resolve  bool
+		Requests []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:     "Matches the item by its real path",
+			Resolve:  true,
+			Requests: []string{"POST /Items/parasite/Refresh"},
+		},
+		{
+			Name:     "Falls back to a library scan without resolving",
+			Requests: []string{"POST /Library/Media/Updated"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			dir, err := filepath.EvalSymlinks(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the library links to the folder in which Jellyfin stores the real paths
+			media := filepath.Join(dir, "media")
+			link := filepath.Join(dir, "Movies")
+			if err := os.MkdirAll(filepath.Join(media, "Parasite (2019)"), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := os.Symlink(media, link); err != nil {
+				t.Fatal(err)
+			}
+
+			s := &server{
+				folders: fmt.Sprintf(`[{"Name": "Movies", "Locations": [%q], "CollectionType": "movies"}]`, link),
+				items:   fmt.Sprintf(`{"Items": [{"Id": "parasite", "Path": %q}]}`, filepath.Join(media, "Parasite (2019)")),
+			}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			target, err := New(Config{
+				URL:             ts.URL,
+				Token:           "token",
+				UserID:          "user",
+				PreciseRefresh:  true,
+				ResolveSymlinks: tc.Resolve,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			if err := target.Scan(context.Background(), autoscan.Scan{Folder: filepath.Join(link, "Parasite (2019)")}); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(s.requests, tc.Requests) {
+				t.Errorf("Requests do not match: %v vs %v", s.requests, tc.Requests)
+			}
+		})
+	}
+}
+
+func TestMultipleLocations(t *testing.T) {
+	s := &server{
+		folders: `[{"Name": "Movies", "Locations": ["/data/Movies", "/data/Movies 4K"], "CollectionType": "movies"}]`,
+		items:   `{"Items": [{"Id": "parasite", "Path": "/data/Movies 4K/Parasite (2019)"}]}`,
+	}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	target, err := New(Config{
+		URL:            ts.URL,
+		Token:          "token",
+		UserID:         "user",
+		PreciseRefresh: true,
+	})
+	if err != nil {
+		t.Fatalf("Could not create Jellyfin Target: %v", err)
+	}
+
+	if err := target.Scan(context.Background(), autoscan.Scan{Folder: "/data/Movies 4K/Parasite (2019)"}); err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	if want := []string{"POST /Items/parasite/Refresh"}; !reflect.DeepEqual(s.requests, want) {
+		t.Errorf("Requests do not match: %v vs %v", s.requests, want)
+	}
+}
+
+func TestEmptyLibraries(t *testing.T) {
+	type Test struct {
+		Name    string
+		Allow   bool
+		WantErr error
+	}
+
+	var testCases = []Test{
+		{
+			Name:    "Fails without libraries",
+			WantErr: autoscan.ErrFatal,
+		},
+		{
+			Name:  "Allows an intentionally empty server",
+			Allow: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			ts := httptest.NewServer(&server{folders: `[]`})
+			defer ts.Close()
+
+			_, err := New(Config{
+				URL:                 ts.URL,
+				Token:               "token",
+				AllowEmptyLibraries: tc.Allow,
+			})
+			if !errors.Is(err, tc.WantErr) {
+				t.Errorf("Errors do not match: %v vs %v", err, tc.WantErr)
+			}
+		})
+	}
+}
+
+func TestUNCPaths(t *testing.T) {
+	type Test struct {
+		Name     string
+		Folder   string
+		Requests []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:     "Matches a UNC folder",
+			Folder:   `\\server\share\media\Parasite (2019)`,
+			Requests: []string{"POST /Items/parasite/Refresh"},
+		},
+		{
+			Name:     "Matches a UNC folder with forward slashes",
+			Folder:   `\\server\share\media/Parasite (2019)/`,
+			Requests: []string{"POST /Items/parasite/Refresh"},
+		},
+		{
+			Name:   "Keeps the UNC prefix",
+			Folder: `/server/share/media/Parasite (2019)`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{
+				folders: `[{"Name": "Movies", "Locations": ["\\\\server\\share\\media"], "CollectionType": "movies"}]`,
+				items:   `{"Items": [{"Id": "parasite", "Path": "\\\\server\\share\\media\\Parasite (2019)"}]}`,
+			}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			target, err := New(Config{
+				URL:            ts.URL,
+				Token:          "token",
+				UserID:         "user",
+				PreciseRefresh: true,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			if err := target.Scan(context.Background(), autoscan.Scan{Folder: tc.Folder}); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(s.requests, tc.Requests) {
+				t.Errorf("Requests do not match: %v vs %v", s.requests, tc.Requests)
+			}
+		})
+	}
+}
+
+func TestWithinPath(t *testing.T) {
+	type Test struct {
+		Name   string
+		Folder string
+		Root   string
+		Within bool
+		Depth  int
+	}
+
+	var testCases = []Test{
+		{Name: "Folder below the root", Folder: "/data/Movies/Parasite (2019)", Root: "/data/Movies/", Within: true, Depth: 1},
+		{Name: "Root itself", Folder: "/data/Movies", Root: "/data/Movies/", Within: true},
+		{Name: "Root with a trailing slash", Folder: "/data/Movies/", Root: "/data/Movies", Within: true},
+		{Name: "Sibling sharing the prefix", Folder: "/data/Movies 4K/Parasite (2019)", Root: "/data/Movies/"},
+		{Name: "Sibling without trailing slashes", Folder: "/data/Movies4K", Root: "/data/Movies"},
+		{Name: "Parent of the root", Folder: "/data", Root: "/data/Movies/"},
+		{Name: "Duplicate slashes", Folder: "/data//Movies/Season 1//Episode 1", Root: "/data/Movies/", Within: true, Depth: 2},
+		{Name: "Windows separators", Folder: `D:\Media\Movies\Parasite (2019)`, Root: "D:/Media/Movies/", Within: true, Depth: 1},
+		{Name: "Mixed separators", Folder: `D:\Media/Movies\Parasite (2019)\`, Root: `D:\Media\Movies`, Within: true, Depth: 1},
+		{Name: "Windows sibling", Folder: `D:\Media\Movies 4K`, Root: `D:\Media\Movies`},
+		{Name: "UNC folder", Folder: `\\server\share\media\Parasite (2019)`, Root: "//server/share/media/", Within: true, Depth: 1},
+		{Name: "UNC root of a local folder", Folder: "/server/share/media/Parasite (2019)", Root: `\\server\share\media`},
+		{Name: "Local root of a UNC folder", Folder: `\\server\share\media\Parasite (2019)`, Root: "/server/share/media"},
+		{Name: "Filesystem root", Folder: "/data/Movies", Root: "/", Within: true, Depth: 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			if within := withinPath(tc.Folder, tc.Root); within != tc.Within {
+				t.Errorf("Within path does not match: %v vs %v", within, tc.Within)
+			}
+
+			lib := library{Paths: []string{withTrailingSlash(normalizePath(tc.Root))}}
+			if depth := lib.depth(tc.Folder); depth != tc.Depth {
+				t.Errorf("Depth does not match: %d vs %d", depth, tc.Depth)
+			}
+		})
+	}
+}
+
+func TestPathSeparator(t *testing.T) {
+	type Test struct {
+		Name      string
+		Separator string
+		Folder    string
+		Calls     []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:   "Scans with slashes by default",
+			Folder: "D:/Media/Movies/Parasite (2019)",
+			Calls:  []string{"Scan D:/Media/Movies/Parasite (2019)"},
+		},
+		{
+			Name:      "Scans with the backslashes of the server",
+			Separator: `\`,
+			Folder:    "D:/Media/Movies/Parasite (2019)",
+			Calls:     []string{`Scan D:\Media\Movies\Parasite (2019)`},
+		},
+		{
+			Name:      "Keeps the UNC prefix of the server",
+			Separator: `\`,
+			Folder:    "//server/share/Movies/Parasite (2019)",
+			Calls:     []string{`Scan \\server\share\Movies\Parasite (2019)`},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			api := &fakeAPI{
+				libraries: []library{
+					{Name: "Movies", Type: "movies", Paths: []string{"D:/Media/Movies/", "//server/share/Movies/"}},
+				},
+			}
+
+			target, err := newTarget(Config{URL: "http://jellyfin:8096", PathSeparator: tc.Separator}, api)
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			if err := target.Scan(context.Background(), autoscan.Scan{Folder: tc.Folder}); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(api.calls, tc.Calls) {
+				t.Errorf("Calls do not match: %v vs %v", api.calls, tc.Calls)
+			}
+		})
+	}
+
+	t.Run("Rejects other separators", func(t *testing.T) {
+		_, err := newTarget(Config{URL: "http://jellyfin:8096", PathSeparator: ":"}, &fakeAPI{})
+		if !errors.Is(err, autoscan.ErrFatal) {
+			t.Errorf("Errors do not match: %v vs %v", err, autoscan.ErrFatal)
+		}
+	})
+}
+
+func TestRequestLatency(t *testing.T) {
+	ts := httptest.NewServer(&server{})
+	defer ts.Close()
+
+	var logs bytes.Buffer
+	api := newAPIClient(Config{URL: ts.URL, Token: "token"}, zerolog.New(&logs).Level(zerolog.DebugLevel))
+
+	if _, err := api.Libraries(); err != nil {
+		t.Fatal(err)
+	}
+
+	var line struct {
+		Message  string  `json:"message"`
+		Endpoint string  `json:"endpoint"`
+		Status   int     `json:"status"`
+		Latency  float64 `json:"latency"`
+	}
+
+	if err := json.Unmarshal(logs.Bytes(), &line); err != nil {
+		t.Fatalf("Could not decode log line: %v: %s", err, logs.String())
+	}
+
+	if line.Message != "Request completed" || line.Endpoint != "/Library/VirtualFolders" || line.Status != 200 || line.Latency <= 0 {
+		t.Errorf("Latency was not logged: %s", logs.String())
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	type Test struct {
+		Name     string
+		User     string
+		Pass     string
+		WantAuth bool
+	}
+
+	var testCases = []Test{
+		{
+			Name:     "Sends basic auth alongside the token",
+			User:     "proxy",
+			Pass:     "secret",
+			WantAuth: true,
+		},
+		{
+			Name: "Sends no basic auth when unset",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{}
+			ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				user, pass, ok := r.BasicAuth()
+				if ok != tc.WantAuth || user != tc.User || pass != tc.Pass {
+					t.Errorf("Basic auth does not match: %s:%s vs %s:%s", user, pass, tc.User, tc.Pass)
+				}
+
+				s.ServeHTTP(rw, r)
+			}))
+			defer ts.Close()
+
+			target, err := New(Config{
+				URL:           ts.URL,
+				Token:         "token",
+				BasicAuthUser: tc.User,
+				BasicAuthPass: tc.Pass,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			if err := target.Scan(context.Background(), autoscan.Scan{Folder: "/data/Movies/Parasite (2019)"}); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			if want := []string{"POST /Library/Media/Updated"}; !reflect.DeepEqual(s.requests, want) {
+				t.Errorf("Requests do not match: %v vs %v", s.requests, want)
+			}
+		})
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	type Test struct {
+		Name      string
+		Headers   map[string]string
+		WantToken string
+		WantAgent string
+		Want      map[string]string
+	}
+
+	var testCases = []Test{
+		{
+			Name: "Sends the configured headers alongside the token",
+			Headers: map[string]string{
+				"CF-Access-Client-Id":     "client.access",
+				"cf-access-client-secret": "secret",
+			},
+			WantToken: "token",
+			WantAgent: "Go-http-client/1.1",
+			Want: map[string]string{
+				"CF-Access-Client-Id":     "client.access",
+				"CF-Access-Client-Secret": "secret",
+			},
+		},
+		{
+			Name: "Replaces the token and the user agent when set explicitly",
+			Headers: map[string]string{
+				"X-Emby-Token": "token",
+				"User-Agent":   "autoscan",
+			},
+			WantToken: "token",
+			WantAgent: "autoscan",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{}
+			ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				if token := r.Header.Get("X-Emby-Token"); token != tc.WantToken {
+					t.Errorf("Token does not match: %s vs %s", token, tc.WantToken)
+				}
+
+				if agent := r.UserAgent(); agent != tc.WantAgent {
+					t.Errorf("User agent does not match: %s vs %s", agent, tc.WantAgent)
+				}
+
+				for name, want := range tc.Want {
+					if value := r.Header.Get(name); value != want {
+						t.Errorf("Header %s does not match: %s vs %s", name, value, want)
+					}
+				}
+
+				s.ServeHTTP(rw, r)
+			}))
+			defer ts.Close()
+
+			token := "token"
+			if _, ok := tc.Headers["X-Emby-Token"]; ok {
+				token = "ignored"
+			}
+
+			target, err := New(Config{URL: ts.URL, Token: token, Headers: tc.Headers})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			if err := target.Scan(context.Background(), autoscan.Scan{Folder: "/data/Movies/Parasite (2019)"}); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestMultiVersionMovie(t *testing.T) {
+	type Test struct {
+		Name     string
+		Folder   string
+		Requests []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:     "Refreshes the movie owning the folder",
+			Folder:   "/data/Movies/Parasite (2019)",
+			Requests: []string{"POST /Items/parasite/Refresh"},
+		},
+		{
+			Name:     "Falls back to a library scan without a movie",
+			Folder:   "/data/Movies/Interstellar (2014)",
+			Requests: []string{"POST /Library/Media/Updated"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			// all versions of Parasite belong to a single movie, which is not a folder
+			s := &server{
+				items: `{"Items": [{"Id": "movies", "Path": "/data/Movies"}]}`,
+				movies: `{"Items": [
+					{"Id": "parasite", "Type": "Movie", "Path": "/data/Movies/Parasite (2019)/Parasite (2019) - 2160p.mkv"},
+					{"Id": "joker", "Type": "Movie", "Path": "/data/Movies/Joker (2019)/Joker (2019) - 1080p.mkv"}
+				]}`,
+			}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			target, err := New(Config{
+				URL:            ts.URL,
+				Token:          "token",
+				UserID:         "user",
+				PreciseRefresh: true,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			if err := target.Scan(context.Background(), autoscan.Scan{Folder: tc.Folder}); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(s.requests, tc.Requests) {
+				t.Errorf("Requests do not match: %v vs %v", s.requests, tc.Requests)
+			}
+		})
+	}
+}
+
+func TestMaxMatchDepth(t *testing.T) {
+	type Test struct {
+		Name     string
+		Depth    int
+		Requests []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:     "Refreshes the item within the depth",
+			Depth:    2,
+			Requests: []string{"POST /Items/extras/Refresh"},
+		},
+		{
+			Name:     "Falls back to a library scan beyond the depth",
+			Depth:    1,
+			Requests: []string{"POST /Library/Media/Updated"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{
+				items: `{"Items": [{"Id": "extras", "Path": "/data/Movies/Parasite (2019)/Extras"}]}`,
+			}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			target, err := New(Config{
+				URL:            ts.URL,
+				Token:          "token",
+				UserID:         "user",
+				PreciseRefresh: true,
+				MaxMatchDepth:  tc.Depth,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			if err := target.Scan(context.Background(), autoscan.Scan{Folder: "/data/Movies/Parasite (2019)/Extras"}); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(s.requests, tc.Requests) {
+				t.Errorf("Requests do not match: %v vs %v", s.requests, tc.Requests)
+			}
+		})
+	}
+}
+
+func TestRefreshGranularity(t *testing.T) {
+	type Test struct {
+		Name        string
+		Granularity string
+		Items       string
+		Requests    []string
+	}
+
+	episode := `{"Items": [{"Id": "episode", "Type": "Episode", "Path": "/data/Movies/Westworld/Season 1", "SeasonId": "season", "SeriesId": "series"}]}`
+	season := `{"Items": [{"Id": "season", "Type": "Season", "Path": "/data/Movies/Westworld/Season 1", "SeriesId": "series"}]}`
+
+	var testCases = []Test{
+		{
+			Name:     "Refreshes the item by default",
+			Items:    episode,
+			Requests: []string{"POST /Items/episode/Refresh"},
+		},
+		{
+			Name:        "Refreshes the item",
+			Granularity: "item",
+			Items:       episode,
+			Requests:    []string{"POST /Items/episode/Refresh"},
+		},
+		{
+			Name:        "Refreshes the season of an episode",
+			Granularity: "season",
+			Items:       episode,
+			Requests:    []string{"POST /Items/season/Refresh"},
+		},
+		{
+			Name:        "Refreshes a season itself",
+			Granularity: "season",
+			Items:       season,
+			Requests:    []string{"POST /Items/season/Refresh"},
+		},
+		{
+			Name:        "Refreshes the series of an episode",
+			Granularity: "series",
+			Items:       episode,
+			Requests:    []string{"POST /Items/series/Refresh"},
+		},
+		{
+			Name:        "Refreshes the series of a season",
+			Granularity: "series",
+			Items:       season,
+			Requests:    []string{"POST /Items/series/Refresh"},
+		},
+		{
+			Name:        "Refreshes items outside of a series as before",
+			Granularity: "series",
+			Requests:    []string{"POST /Items/parasite/Refresh"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{items: tc.Items}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			target, err := New(Config{
+				URL:                ts.URL,
+				Token:              "token",
+				UserID:             "user",
+				PreciseRefresh:     true,
+				RefreshGranularity: tc.Granularity,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			folder := "/data/Movies/Westworld/Season 1"
+			if tc.Items == "" {
+				folder = "/data/Movies/Parasite (2019)"
+			}
+
+			if err := target.Scan(context.Background(), autoscan.Scan{Folder: folder}); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(s.requests, tc.Requests) {
+				t.Errorf("Requests do not match: %v vs %v", s.requests, tc.Requests)
+			}
+		})
+	}
+
+	t.Run("Fails on an unknown granularity", func(t *testing.T) {
+		s := &server{}
+		ts := httptest.NewServer(s)
+		defer ts.Close()
+
+		_, err := New(Config{URL: ts.URL, Token: "token", RefreshGranularity: "episode"})
+		if !errors.Is(err, autoscan.ErrFatal) {
+			t.Errorf("Unknown granularity did not fail: %v", err)
+		}
+	})
+}
+
+func TestMultiMatch(t *testing.T) {
+	type Test struct {
+		Name     string
+		Mode     string
+		Types    []string
+		Requests []string
+		WantErr  bool
+	}
+
+	var testCases = []Test{
+		{
+			Name:     "Refreshes the first match by default",
+			Requests: []string{"POST /Items/imported/Refresh"},
+		},
+		{
+			Name:     "Refreshes the first match",
+			Mode:     "first",
+			Requests: []string{"POST /Items/imported/Refresh"},
+		},
+		{
+			Name:     "Refreshes all matches",
+			Mode:     "all",
+			Requests: []string{"POST /Items/duplicate/Refresh", "POST /Items/imported/Refresh"},
+		},
+		{
+			Name:     "Refreshes the match of the preferred type",
+			Mode:     "byType",
+			Types:    []string{"boxset", "Movie"},
+			Requests: []string{"POST /Items/duplicate/Refresh"},
+		},
+		{
+			Name:     "Refreshes the first match without a preferred type",
+			Mode:     "byType",
+			Types:    []string{"BoxSet"},
+			Requests: []string{"POST /Items/imported/Refresh"},
+		},
+		{
+			Name:    "Fails without preferred types",
+			Mode:    "byType",
+			WantErr: true,
+		},
+		{
+			Name:    "Fails on an unknown mode",
+			Mode:    "random",
+			WantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{items: `{"Items": [
+				{"Id": "other", "Type": "Folder", "Path": "/data/Movies/Joker (2019)"},
+				{"Id": "imported", "Type": "Folder", "Path": "/data/Movies/Parasite (2019)"},
+				{"Id": "duplicate", "Type": "Movie", "Path": "/data/Movies/Parasite (2019)/"}
+			]}`}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			target, err := New(Config{
+				URL:             ts.URL,
+				Token:           "token",
+				UserID:          "user",
+				PreciseRefresh:  true,
+				MultiMatch:      tc.Mode,
+				MultiMatchTypes: tc.Types,
+			})
+			if tc.WantErr {
+				if !errors.Is(err, autoscan.ErrFatal) {
+					t.Fatalf("Invalid multi_match did not fail: %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			if err := target.Scan(context.Background(), autoscan.Scan{Folder: "/data/Movies/Parasite (2019)"}); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			// the matches are refreshed concurrently
+			sort.Strings(s.requests)
+			if !reflect.DeepEqual(s.requests, tc.Requests) {
+				t.Errorf("Requests do not match: %v vs %v", s.requests, tc.Requests)
+			}
+		})
+	}
+}
+
+func TestLibraryScanWorkers(t *testing.T) {
+	type Test struct {
+		Name    string
+		Workers int
+		Want    int
+	}
+
+	var testCases = []Test{
+		{
+			Name: "Sends one library scan at a time by default",
+			Want: 1,
+		},
+		{
+			Name:    "Sends at most library_scan_workers library scans",
+			Workers: 2,
+			Want:    2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			// no item matches, so every scan falls back to a library scan
+			s := &server{items: `{"Items": []}`, delay: 20 * time.Millisecond}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			target, err := New(Config{
+				URL:                ts.URL,
+				Token:              "token",
+				UserID:             "user",
+				PreciseRefresh:     true,
+				LibraryScanWorkers: tc.Workers,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			var wg sync.WaitGroup
+			for i := 0; i < 6; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+
+					folder := fmt.Sprintf("/data/Movies/Movie %d", i)
+					if err := target.Scan(context.Background(), autoscan.Scan{Folder: folder}); err != nil {
+						t.Errorf("Scan failed: %v", err)
+					}
+				}(i)
+			}
+			wg.Wait()
+
+			if len(s.requests) != 6 {
+				t.Errorf("Not all library scans were sent: %v", s.requests)
+			}
+
+			if s.concurrent != tc.Want {
+				t.Errorf("Concurrent library scans do not match: %d vs %d", s.concurrent, tc.Want)
+			}
+		})
+	}
+}
+
+func TestFallbackUseLibraryTask(t *testing.T) {
+	type Test struct {
+		Name     string
+		Enabled  bool
+		Tasks    string
+		Requests []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:     "Starts the scheduled task of the library",
+			Enabled:  true,
+			Tasks:    `[{"Id": "refresh", "Name": "Scan Media Library", "Key": "RefreshLibrary"}, {"Id": "movies", "Name": "Scan Movies", "Key": "ScanMovies"}]`,
+			Requests: []string{"POST /ScheduledTasks/Running/movies"},
+		},
+		{
+			Name:     "Scans by path without a task of the library",
+			Enabled:  true,
+			Tasks:    `[{"Id": "refresh", "Name": "Scan Media Library", "Key": "RefreshLibrary"}]`,
+			Requests: []string{"POST /Library/Media/Updated"},
+		},
+		{
+			Name:     "Scans by path when several tasks match the library",
+			Enabled:  true,
+			Tasks:    `[{"Id": "movies", "Name": "Scan Movies", "Key": "ScanMovies"}, {"Id": "trailers", "Name": "Movies trailers", "Key": "MovieTrailers"}]`,
+			Requests: []string{"POST /Library/Media/Updated"},
+		},
+		{
+			Name:     "Scans by path by default",
+			Tasks:    `[{"Id": "movies", "Name": "Scan Movies", "Key": "ScanMovies"}]`,
+			Requests: []string{"POST /Library/Media/Updated"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{tasks: tc.Tasks}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			target, err := New(Config{
+				URL:                    ts.URL,
+				Token:                  "token",
+				FallbackUseLibraryTask: tc.Enabled,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			// the task is resolved once, at startup
+			s.tasks = "[]"
+
+			for i := 0; i < 2; i++ {
+				if err := target.Scan(context.Background(), autoscan.Scan{Folder: "/data/Movies/Parasite (2019)"}); err != nil {
+					t.Fatalf("Scan failed: %v", err)
+				}
+			}
+
+			want := append(tc.Requests, tc.Requests...)
+			if !reflect.DeepEqual(s.requests, want) {
+				t.Errorf("Requests do not match: %v vs %v", s.requests, want)
+			}
+		})
+	}
+}
+
+func TestCoalesceLibraryScans(t *testing.T) {
+	type Test struct {
+		Name     string
+		Enabled  bool
+		State    string
+		Tasks    string
+		Requests []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:     "Skips the library scan while a scan is running",
+			Enabled:  true,
+			State:    "Running",
+			Requests: nil,
+		},
+		{
+			Name:     "Sends the library scan while Jellyfin is idle",
+			Enabled:  true,
+			State:    "Idle",
+			Requests: []string{"POST /Library/Media/Updated"},
+		},
+		{
+			Name:     "Skips the task of the library while it is running",
+			Enabled:  true,
+			Tasks:    `[{"Id": "movies", "Name": "Scan Movies", "Key": "ScanMovies", "State": "Running"}]`,
+			Requests: nil,
+		},
+		{
+			Name:     "Starts the task of the library while it is idle",
+			Enabled:  true,
+			Tasks:    `[{"Id": "movies", "Name": "Scan Movies", "Key": "ScanMovies", "State": "Idle"}]`,
+			Requests: []string{"POST /ScheduledTasks/Running/movies"},
+		},
+		{
+			Name:     "Sends the library scan while a scan is running when disabled",
+			State:    "Running",
+			Requests: []string{"POST /Library/Media/Updated"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{states: []string{tc.State}, tasks: tc.Tasks}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			target, err := New(Config{
+				URL:                    ts.URL,
+				Token:                  "token",
+				CoalesceLibraryScans:   tc.Enabled,
+				FallbackUseLibraryTask: tc.Tasks != "",
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			ctx, report := autoscan.WithRefreshReport(context.Background())
+			if err := target.Scan(ctx, autoscan.Scan{Folder: "/data/Movies/Interstellar (2014)"}); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(s.requests, tc.Requests) {
+				t.Errorf("Requests do not match: %v vs %v", s.requests, tc.Requests)
+			}
+
+			refresh, _ := report()
+			if coalesced := refresh == autoscan.RefreshSkipped; coalesced != (tc.Requests == nil) {
+				t.Errorf("Reported refresh does not match: %s", refresh)
+			}
+		})
+	}
+}
+
+func TestOutOfLibrary(t *testing.T) {
+	s := &server{}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	tp, err := New(Config{URL: ts.URL, Token: "token"})
+	if err != nil {
+		t.Fatalf("Could not create Jellyfin Target: %v", err)
+	}
+
+	var logs bytes.Buffer
+	jt := tp.(*target)
+	jt.log = zerolog.New(&logs)
+
+	before := outOfLibraryScans.Value("downloads")
+	folders := []string{"/downloads/Parasite (2019)", "/downloads/Tenet (2020)", "/mnt/TV/Westworld"}
+	for _, folder := range folders {
+		if err := jt.Scan(context.Background(), autoscan.Scan{Folder: folder}); err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+	}
+
+	if got := outOfLibraryScans.Value("downloads") - before; got != 2 {
+		t.Errorf("Out of library scans do not match: %d vs 2", got)
+	}
+
+	levels := make(map[string][]string)
+	decoder := json.NewDecoder(&logs)
+	for decoder.More() {
+		var line struct {
+			Level   string `json:"level"`
+			Segment string `json:"segment"`
+		}
+
+		if err := decoder.Decode(&line); err != nil {
+			t.Fatal(err)
+		}
+
+		levels[line.Segment] = append(levels[line.Segment], line.Level)
+	}
+
+	// only the first scan of a segment is logged as a warning
+	want := map[string][]string{
+		"downloads": {"warn", "debug"},
+		"mnt":       {"warn"},
+	}
+
+	if !reflect.DeepEqual(levels, want) {
+		t.Errorf("Log levels do not match: %v vs %v", levels, want)
+	}
+
+	if len(s.requests) != 0 {
+		t.Errorf("Scans outside of the libraries were sent: %v", s.requests)
+	}
+}
+
+func TestRefreshByEvent(t *testing.T) {
+	type Test struct {
+		Name      string
+		Config    Config
+		Event     string
+		Requests  []string
+		Recursive []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:      "Refreshes only the metadata on metadata events",
+			Config:    Config{RefreshByEvent: map[string]string{"metadata": "metadata"}},
+			Event:     autoscan.EventMetadata,
+			Requests:  []string{"POST /Items/parasite/Refresh"},
+			Recursive: []string{"false"},
+		},
+		{
+			Name:     "Scans the library on add events",
+			Config:   Config{PreciseRefresh: true, RefreshByEvent: map[string]string{"add": "library"}},
+			Event:    autoscan.EventAdd,
+			Requests: []string{"POST /Library/Media/Updated"},
+		},
+		{
+			Name:      "Refreshes the item on upgrade events",
+			Config:    Config{RefreshByEvent: map[string]string{"Upgrade": "precise"}},
+			Event:     autoscan.EventUpgrade,
+			Requests:  []string{"POST /Items/parasite/Refresh"},
+			Recursive: []string{"true"},
+		},
+		{
+			Name:      "Keeps the current behaviour for other events",
+			Config:    Config{PreciseRefresh: true, RefreshByEvent: map[string]string{"metadata": "metadata"}},
+			Event:     autoscan.EventAdd,
+			Requests:  []string{"POST /Items/parasite/Refresh"},
+			Recursive: []string{"true"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			tc.Config.URL = ts.URL
+			tc.Config.Token = "token"
+			tc.Config.UserID = "user"
+
+			target, err := New(tc.Config)
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			if err := target.Scan(context.Background(), autoscan.Scan{Folder: "/data/Movies/Parasite (2019)", Event: tc.Event}); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(s.requests, tc.Requests) {
+				t.Errorf("Requests do not match: %v vs %v", s.requests, tc.Requests)
+			}
+
+			if !reflect.DeepEqual(s.recursive, tc.Recursive) {
+				t.Errorf("Recursive refreshes do not match: %v vs %v", s.recursive, tc.Recursive)
+			}
+		})
+	}
+
+	_, err := New(Config{URL: "http://localhost", RefreshByEvent: map[string]string{"add": "full"}, LazyLibraries: true})
+	if !errors.Is(err, autoscan.ErrFatal) {
+		t.Errorf("Invalid strategy was not rejected: %v", err)
+	}
+}
+
+func TestExtensionRules(t *testing.T) {
+	type Test struct {
+		Name      string
+		File      string
+		Requests  []string
+		Recursive []string
+	}
+
+	folder := "/data/Movies/Parasite (2019)"
+	rules := map[string]string{"SRT": "metadata", ".nfo": "ignore", ".mkv": "scan", "*": "ignore"}
+
+	var testCases = []Test{
+		{
+			Name:      "Refreshes only the metadata for subtitles",
+			File:      folder + "/Parasite.en.srt",
+			Requests:  []string{"POST /Items/parasite/Refresh"},
+			Recursive: []string{"false"},
+		},
+		{
+			Name:      "Refreshes the item for video files",
+			File:      folder + "/Parasite.mkv",
+			Requests:  []string{"POST /Items/parasite/Refresh"},
+			Recursive: []string{"true"},
+		},
+		{
+			Name: "Skips ignored extensions",
+			File: folder + "/movie.nfo",
+		},
+		{
+			Name: "Applies the rule of other extensions",
+			File: folder + "/Parasite.jpg",
+		},
+		{
+			Name:      "Scans without a file as usual",
+			Requests:  []string{"POST /Items/parasite/Refresh"},
+			Recursive: []string{"true"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			target, err := New(Config{
+				URL:            ts.URL,
+				Token:          "token",
+				UserID:         "user",
+				PreciseRefresh: true,
+				ExtensionRules: rules,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			if err := target.Scan(context.Background(), autoscan.Scan{Folder: folder, File: tc.File}); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(s.requests, tc.Requests) {
+				t.Errorf("Requests do not match: %v vs %v", s.requests, tc.Requests)
+			}
+
+			if !reflect.DeepEqual(s.recursive, tc.Recursive) {
+				t.Errorf("Recursive refreshes do not match: %v vs %v", s.recursive, tc.Recursive)
+			}
+		})
+	}
+
+	_, err := New(Config{URL: "http://localhost", ExtensionRules: map[string]string{".srt": "skip"}, LazyLibraries: true})
+	if !errors.Is(err, autoscan.ErrFatal) {
+		t.Errorf("Invalid rule was not rejected: %v", err)
+	}
+}
+
+func TestRefreshWorkers(t *testing.T) {
+	type Test struct {
+		Name     string
+		Failures []string
+		Expected RefreshResult
+		Requests []string
+	}
+
+	refreshes := []string{
+		"POST /Items/joker/Refresh",
+		"POST /Items/parasite/Refresh",
+		"POST /Items/tenet/Refresh",
+		"POST /Items/up/Refresh",
+		"POST /Items/wall-e/Refresh",
+	}
+
+	var testCases = []Test{
+		{
+			Name: "Refreshes all movies of the folder",
+			Expected: RefreshResult{
+				ItemID:    "parasite",
+				ItemType:  "Movie",
+				Library:   "Movies",
+				Refreshed: 5,
+			},
+			Requests: refreshes,
+		},
+		{
+			Name:     "Falls back to a library scan when refreshes fail",
+			Failures: []string{"tenet", "up"},
+			Expected: RefreshResult{
+				ItemID:    "parasite",
+				ItemType:  "Movie",
+				Library:   "Movies",
+				Fallback:  true,
+				Refreshed: 3,
+				Failed:    2,
+			},
+			Requests: refreshes,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			// the movies do not have a folder of their own
+			s := &server{
+				items: `{"Items": []}`,
+				movies: `{"Items": [
+					{"Id": "parasite", "Type": "Movie", "Path": "/data/Movies/Favourites/Parasite (2019).mkv"},
+					{"Id": "joker", "Type": "Movie", "Path": "/data/Movies/Favourites/Joker (2019).mkv"},
+					{"Id": "tenet", "Type": "Movie", "Path": "/data/Movies/Favourites/Tenet (2020).mkv"},
+					{"Id": "up", "Type": "Movie", "Path": "/data/Movies/Favourites/Up (2009).mkv"},
+					{"Id": "wall-e", "Type": "Movie", "Path": "/data/Movies/Favourites/WALL-E (2008).mkv"}
+				]}`,
+				delay:    20 * time.Millisecond,
+				failures: tc.Failures,
+			}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			tp, err := New(Config{
+				URL:            ts.URL,
+				Token:          "token",
+				UserID:         "user",
+				PreciseRefresh: true,
+				RefreshWorkers: 2,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			jt := tp.(*target)
+			lib, err := jt.getScanLibrary("/data/Movies/Favourites")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res := jt.preciseRefresh(context.Background(), jt.log, lib, "/data/Movies/Favourites")
+			if !reflect.DeepEqual(res, tc.Expected) {
+				t.Errorf("Results do not match: %+v vs %+v", res, tc.Expected)
+			}
+
+			sort.Strings(s.requests)
+			if !reflect.DeepEqual(s.requests, tc.Requests) {
+				t.Errorf("Requests do not match: %v vs %v", s.requests, tc.Requests)
+			}
+
+			if s.concurrent != 2 {
+				t.Errorf("Concurrent refreshes do not match: %d vs %d", s.concurrent, 2)
+			}
+		})
+	}
+}
+
+func TestGetViewID(t *testing.T) {
+	type Test struct {
+		Name    string
+		Library string
+		Views   string
+		ViewID  string
+		WantErr string
+	}
+
+	var testCases = []Test{
+		{
+			Name:    "Matches the name regardless of case",
+			Library: "movies",
+			Views:   `{"Items": [{"Id": "shows", "Name": "TV Shows"}, {"Id": "movies", "Name": "Movies"}]}`,
+			ViewID:  "movies",
+		},
+		{
+			Name:    "Matches the name regardless of whitespace",
+			Library: " Movies  4K ",
+			Views:   `{"Items": [{"Id": "movies", "Name": "Movies"}, {"Id": "uhd", "Name": "Movies 4K"}]}`,
+			ViewID:  "uhd",
+		},
+		{
+			Name:    "Prefers the exact name",
+			Library: "Movies",
+			Views:   `{"Items": [{"Id": "lower", "Name": "movies"}, {"Id": "exact", "Name": "Movies"}]}`,
+			ViewID:  "exact",
+		},
+		{
+			Name:    "Lists the views without a match",
+			Library: "Films",
+			Views:   `{"Items": [{"Id": "shows", "Name": "TV Shows"}, {"Id": "movies", "Name": "Movies"}]}`,
+			WantErr: `"Films": view not found, available views: "TV Shows", "Movies"`,
+		},
+		{
+			Name:    "Lists the views of an ambiguous match",
+			Library: "Movies",
+			Views:   `{"Items": [{"Id": "lower", "Name": "movies"}, {"Id": "upper", "Name": "MOVIES"}]}`,
+			WantErr: `"Movies": view is ambiguous, available views: "movies", "MOVIES"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			ts := httptest.NewServer(&server{views: tc.Views})
+			defer ts.Close()
+
+			api := newAPIClient(Config{URL: ts.URL, Token: "token"}, zerolog.Nop())
+
+			viewID, err := api.GetViewID(context.Background(), "user", tc.Library)
+			if tc.WantErr != "" {
+				if err == nil || err.Error() != tc.WantErr {
+					t.Fatalf("Errors do not match: %v vs %v", err, tc.WantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if viewID != tc.ViewID {
+				t.Errorf("View IDs do not match: %s vs %s", viewID, tc.ViewID)
+			}
+		})
+	}
+}
+
+func TestRewriteMatch(t *testing.T) {
+	type Test struct {
+		Name    string
+		Folder  string
+		Strict  bool
+		WantLog bool
+		WantErr error
+	}
+
+	var testCases = []Test{
+		{
+			Name:   "Matched rewrite is not logged",
+			Folder: "/mnt/unionfs/Media/Movies/Parasite (2019)",
+		},
+		{
+			Name:    "Unmatched rewrite is logged",
+			Folder:  "/mnt/local/Movies/Parasite (2019)",
+			WantLog: true,
+		},
+		{
+			Name:    "Unmatched rewrite is refused in strict mode",
+			Folder:  "/mnt/local/Movies/Parasite (2019)",
+			Strict:  true,
+			WantErr: autoscan.ErrScanRefused,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			ts := httptest.NewServer(&server{})
+			defer ts.Close()
+
+			tp, err := New(Config{
+				URL:   ts.URL,
+				Token: "token",
+				Rewrite: []autoscan.Rewrite{{
+					From: "^/mnt/unionfs/Media/",
+					To:   "/data/",
+				}},
+				StrictRewrite: tc.Strict,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			var logs bytes.Buffer
+			jt := tp.(*target)
+			jt.log = zerolog.New(&logs).Level(zerolog.DebugLevel)
+
+			_, err = jt.rewritePath(autoscan.Scan{Folder: tc.Folder})
+			if !errors.Is(err, tc.WantErr) {
+				t.Fatalf("Errors do not match: %v vs %v", err, tc.WantErr)
+			}
+
+			if logged := strings.Contains(logs.String(), "No rewrite rule matched"); logged != tc.WantLog {
+				t.Errorf("Logging does not match: %v vs %v: %s", logged, tc.WantLog, logs.String())
+			}
+		})
+	}
+}
+
+func TestUnsafePaths(t *testing.T) {
+	type Test struct {
+		Name          string
+		Folder        string
+		MinPathLength int
+		WantReason    string
+	}
+
+	var testCases = []Test{
+		{
+			Name:       "Rewrite to the root is refused",
+			Folder:     "/mnt/unionfs/Root/Movies",
+			WantReason: unsafeRoot,
+		},
+		{
+			Name:       "Rewrite to an empty path is refused",
+			Folder:     "/mnt/unionfs/Empty",
+			WantReason: unsafeEmpty,
+		},
+		{
+			Name:          "Rewrite shorter than the minimum length is refused",
+			Folder:        "/mnt/unionfs/Media/Movies",
+			MinPathLength: 16,
+			WantReason:    unsafeShort,
+		},
+		{
+			Name:          "Rewrite within a library is scanned",
+			Folder:        "/mnt/unionfs/Media/Movies/Parasite (2019)",
+			MinPathLength: 16,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			target, err := New(Config{
+				URL:   ts.URL,
+				Token: "token",
+				Rewrite: []autoscan.Rewrite{
+					{From: "^/mnt/unionfs/Empty$", To: ""},
+					{From: "^/mnt/unionfs/Root/.*", To: "/"},
+					{From: "^/mnt/unionfs/Media/", To: "/data/"},
+				},
+				MinPathLength: tc.MinPathLength,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			before := unsafePaths.Value(tc.WantReason)
+			err = target.Scan(context.Background(), autoscan.Scan{Folder: tc.Folder})
+
+			if tc.WantReason == "" {
+				if err != nil {
+					t.Fatalf("Scan failed: %v", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, autoscan.ErrScanRefused) {
+				t.Fatalf("Errors do not match: %v vs %v", err, autoscan.ErrScanRefused)
+			}
+
+			if len(s.requests) != 0 {
+				t.Errorf("Refused scan sent requests: %v", s.requests)
+			}
+
+			if got := unsafePaths.Value(tc.WantReason) - before; got != 1 {
+				t.Errorf("Refused scans do not match: %d vs %d", got, 1)
+			}
+		})
+	}
+}
+
+func TestTrimPath(t *testing.T) {
+	type Test struct {
+		Name       string
+		Folder     string
+		Rewrite    []autoscan.Rewrite
+		TrimPrefix string
+		TrimSuffix string
+		Requests   []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:       "Prefix is trimmed before matching the library",
+			Folder:     "/docker/data/Movies/Parasite (2019)",
+			TrimPrefix: "/docker",
+			Requests:   []string{"POST /Items/parasite/Refresh"},
+		},
+		{
+			Name:       "Prefix with a trailing separator keeps the path absolute",
+			Folder:     "/docker/data/Movies/Parasite (2019)",
+			TrimPrefix: "/docker/",
+			Requests:   []string{"POST /Items/parasite/Refresh"},
+		},
+		{
+			Name:       "Suffix is trimmed before matching the item",
+			Folder:     "/data/Movies/Parasite (2019)/.partial",
+			TrimSuffix: "/.partial",
+			Requests:   []string{"POST /Items/parasite/Refresh"},
+		},
+		{
+			Name:       "Trimming applies after the rewrite",
+			Folder:     "/mnt/unionfs/Movies/Parasite (2019)",
+			Rewrite:    []autoscan.Rewrite{{From: "^/mnt/unionfs/", To: "/docker/data/"}},
+			TrimPrefix: "/docker",
+			Requests:   []string{"POST /Items/parasite/Refresh"},
+		},
+		{
+			Name:   "Untrimmed folders are outside of the libraries",
+			Folder: "/docker/data/Movies/Parasite (2019)",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			target, err := New(Config{
+				URL:            ts.URL,
+				Token:          "token",
+				UserID:         "user",
+				PreciseRefresh: true,
+				Rewrite:        tc.Rewrite,
+				TrimPrefix:     tc.TrimPrefix,
+				TrimSuffix:     tc.TrimSuffix,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			if err := target.Scan(context.Background(), autoscan.Scan{Folder: tc.Folder}); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(s.requests, tc.Requests) {
+				t.Errorf("Requests do not match: %v vs %v", s.requests, tc.Requests)
+			}
+		})
+	}
+}
+
+func TestNoLibraryAccess(t *testing.T) {
+	type Test struct {
+		Name        string
+		Library     string
+		AdminUserID string
+		Requests    []string
+		Users       []string
+		Warnings    int
+	}
+
+	var testCases = []Test{
+		{
+			Name:     "Warns once and falls back without an admin user",
+			Requests: []string{"POST /Library/Media/Updated", "POST /Library/Media/Updated"},
+			Users:    []string{"user", "user"},
+			Warnings: 1,
+		},
+		{
+			Name:        "Matches the item as the admin user",
+			AdminUserID: "admin",
+			Requests:    []string{"POST /Items/parasite/Refresh", "POST /Items/parasite/Refresh"},
+			Users:       []string{"user", "admin", "admin", "user", "admin", "admin"},
+			Warnings:    1,
+		},
+		{
+			Name:        "Unknown libraries are not reported as inaccessible",
+			Library:     "Films",
+			AdminUserID: "admin",
+			Requests:    []string{"POST /Library/Media/Updated", "POST /Library/Media/Updated"},
+			Users:       []string{"user", "user"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{userViews: map[string]string{"user": `{"Items": []}`}}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			tp, err := New(Config{
+				URL:            ts.URL,
+				Token:          "token",
+				UserID:         "user",
+				Library:        tc.Library,
+				AdminUserID:    tc.AdminUserID,
+				PreciseRefresh: true,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			var logs bytes.Buffer
+			jt := tp.(*target)
+			jt.log = zerolog.New(&logs)
+
+			for i := 0; i < 2; i++ {
+				if err := jt.Scan(context.Background(), autoscan.Scan{Folder: "/data/Movies/Parasite (2019)"}); err != nil {
+					t.Fatalf("Scan failed: %v", err)
+				}
+			}
+
+			if !reflect.DeepEqual(s.requests, tc.Requests) {
+				t.Errorf("Requests do not match: %v vs %v", s.requests, tc.Requests)
+			}
+
+			if !reflect.DeepEqual(s.users, tc.Users) {
+				t.Errorf("Users do not match: %v vs %v", s.users, tc.Users)
+			}
+
+			warnings := 0
+			decoder := json.NewDecoder(&logs)
+			for decoder.More() {
+				var line struct {
+					Message string `json:"message"`
+					UserID  string `json:"userId"`
+					Library string `json:"library"`
+				}
+
+				if err := decoder.Decode(&line); err != nil {
+					t.Fatal(err)
+				}
+
+				if !strings.HasPrefix(line.Message, "User cannot see the Jellyfin library") {
+					continue
+				}
+
+				warnings++
+				if line.UserID != "user" || line.Library != "Movies" {
+					t.Errorf("Warning does not match: %+v", line)
+				}
+			}
+
+			if warnings != tc.Warnings {
+				t.Errorf("Warnings do not match: %d vs %d", warnings, tc.Warnings)
+			}
+		})
+	}
+}
+
+func TestFallbackWarning(t *testing.T) {
+	type Test struct {
+		Name      string
+		Items     string
+		Rate      float64
+		Fallbacks int
+		Warnings  int
+	}
+
+	var testCases = []Test{
+		{
+			Name:      "Warns once per window when most refreshes fall back",
+			Items:     `{"Items": []}`,
+			Fallbacks: 12,
+			Warnings:  1,
+		},
+		{
+			Name: "Refreshed items do not warn",
+		},
+		{
+			Name:      "Rates above one disable the warning",
+			Items:     `{"Items": []}`,
+			Rate:      1.1,
+			Fallbacks: 12,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{items: tc.Items}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			tp, err := New(Config{
+				URL:              ts.URL,
+				Token:            "token",
+				UserID:           "user",
+				PreciseRefresh:   true,
+				FallbackWarnRate: tc.Rate,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			var logs bytes.Buffer
+			jt := tp.(*target)
+			jt.log = zerolog.New(&logs)
+
+			before := preciseRefreshes.Value("Movies", resultFallback)
+			for i := 0; i < 12; i++ {
+				if err := jt.Scan(context.Background(), autoscan.Scan{Folder: "/data/Movies/Parasite (2019)"}); err != nil {
+					t.Fatalf("Scan failed: %v", err)
+				}
+			}
+
+			if got := int(preciseRefreshes.Value("Movies", resultFallback) - before); got != tc.Fallbacks {
+				t.Errorf("Fallbacks do not match: %d vs %d", got, tc.Fallbacks)
+			}
+
+			warnings := 0
+			decoder := json.NewDecoder(&logs)
+			for decoder.More() {
+				var line struct {
+					Message  string  `json:"message"`
+					Rate     float64 `json:"rate"`
+					Attempts int     `json:"attempts"`
+				}
+
+				if err := decoder.Decode(&line); err != nil {
+					t.Fatal(err)
+				}
+
+				if !strings.HasPrefix(line.Message, "Most precise refreshes of the library fall back") {
+					continue
+				}
+
+				warnings++
+				if line.Rate != 1 || line.Attempts != minFallbackAttempts {
+					t.Errorf("Warning does not match: %+v", line)
+				}
+			}
+
+			if warnings != tc.Warnings {
+				t.Errorf("Warnings do not match: %d vs %d", warnings, tc.Warnings)
+			}
+		})
+	}
+}
+
+func TestDefaultLibrary(t *testing.T) {
+	type Test struct {
+		Name           string
+		Folder         string
+		DefaultLibrary string
+		Requests       []string
+	}
+
+	folders := `[
+		{"Name": "Movies", "Locations": ["/data/Movies"], "CollectionType": "movies"},
+		{"Name": "TV", "Locations": ["/data/TV", "/data/Anime"], "CollectionType": "tvshows"}
+	]`
+
+	var testCases = []Test{
+		{
+			Name:           "Matched folders use their library",
+			Folder:         "/data/Movies/Parasite (2019)",
+			DefaultLibrary: "tv",
+			Requests:       []string{"POST /Items/parasite/Refresh"},
+		},
+		{
+			Name:           "Unmatched folders scan all locations of the default library",
+			Folder:         "/downloads/Parasite (2019)",
+			DefaultLibrary: "tv",
+			Requests:       []string{"POST /Library/Media/Updated", "POST /Library/Media/Updated"},
+		},
+		{
+			Name:   "Unmatched folders are skipped by default",
+			Folder: "/downloads/Parasite (2019)",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{folders: folders}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			target, err := New(Config{
+				URL:            ts.URL,
+				Token:          "token",
+				UserID:         "user",
+				PreciseRefresh: true,
+				DefaultLibrary: tc.DefaultLibrary,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			if err := target.Scan(context.Background(), autoscan.Scan{Folder: tc.Folder}); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(s.requests, tc.Requests) {
+				t.Errorf("Requests do not match: %v vs %v", s.requests, tc.Requests)
+			}
+		})
+	}
+
+	t.Run("Unknown default libraries fail at startup", func(t *testing.T) {
+		ts := httptest.NewServer(&server{folders: folders})
+		defer ts.Close()
+
+		_, err := New(Config{URL: ts.URL, Token: "token", UserID: "user", DefaultLibrary: "Music"})
+		if !errors.Is(err, autoscan.ErrFatal) {
+			t.Errorf("Errors do not match: %v vs %v", err, autoscan.ErrFatal)
+		}
+	})
+}
+
+func TestRefreshLibrary(t *testing.T) {
+	type Test struct {
+		Name      string
+		Library   string
+		DryRun    bool
+		Refreshed []string
+		Requests  []string
+		Err       error
+	}
+
+	folders := `[
+		{"Name": "Movies", "Locations": ["/data/Movies"], "CollectionType": "movies"},
+		{"Name": "TV", "Locations": ["/data/TV", "/data/Anime"], "CollectionType": "tvshows"}
+	]`
+
+	var testCases = []Test{
+		{
+			Name:      "Scans all locations of the named library",
+			Library:   "tv",
+			Refreshed: []string{"TV"},
+			Requests:  []string{"POST /Library/Media/Updated", "POST /Library/Media/Updated"},
+		},
+		{
+			Name:      "Scans all libraries without a name",
+			Refreshed: []string{"Movies", "TV"},
+			Requests:  []string{"POST /Library/Media/Updated", "POST /Library/Media/Updated", "POST /Library/Media/Updated"},
+		},
+		{
+			Name:    "Unknown libraries are not scanned",
+			Library: "Music",
+			Err:     autoscan.ErrUnknownLibrary,
+		},
+		{
+			Name:      "Dry runs scan nothing",
+			Library:   "tv",
+			DryRun:    true,
+			Refreshed: []string{"TV"},
+		},
+		{
+			Name:    "Dry runs do not know unknown libraries",
+			Library: "Music",
+			DryRun:  true,
+			Err:     autoscan.ErrUnknownLibrary,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{folders: folders}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			target, err := New(Config{
+				URL:            ts.URL,
+				Token:          "token",
+				UserID:         "user",
+				PreciseRefresh: true,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			if tc.DryRun {
+				target = autoscan.DryRun(target)
+			}
+
+			refreshed, err := target.(autoscan.LibraryRefresher).RefreshLibrary(context.Background(), tc.Library)
+			if !errors.Is(err, tc.Err) {
+				t.Fatalf("Errors do not match: %v vs %v", err, tc.Err)
+			}
+
+			if !reflect.DeepEqual(refreshed, tc.Refreshed) {
+				t.Errorf("Refreshed libraries do not match: %v vs %v", refreshed, tc.Refreshed)
+			}
+
+			if !reflect.DeepEqual(s.requests, tc.Requests) {
+				t.Errorf("Requests do not match: %v vs %v", s.requests, tc.Requests)
+			}
+		})
+	}
+}
+
+func TestItemIDFromTrigger(t *testing.T) {
+	type Test struct {
+		Name     string
+		Scan     autoscan.Scan
+		Failures []string
+		Requests []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:     "Refreshes the item without matching the folder",
+			Scan:     autoscan.Scan{Folder: "/data/Movies/Joker (2019)", ItemID: "joker"},
+			Requests: []string{"POST /Items/joker/Refresh"},
+		},
+		{
+			Name:     "Falls back to the folder when the refresh fails",
+			Scan:     autoscan.Scan{Folder: "/data/Movies/Joker (2019)", ItemID: "joker"},
+			Failures: []string{"joker"},
+			Requests: []string{"POST /Items/joker/Refresh", "POST /Library/Media/Updated"},
+		},
+		{
+			Name:     "Matches the folder without an item",
+			Scan:     autoscan.Scan{Folder: "/data/Movies/Parasite (2019)"},
+			Requests: []string{"POST /Items/parasite/Refresh"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{failures: tc.Failures}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			target, err := New(Config{
+				URL:            ts.URL,
+				Token:          "token",
+				UserID:         "user",
+				PreciseRefresh: true,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			if err := target.Scan(context.Background(), tc.Scan); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(s.requests, tc.Requests) {
+				t.Errorf("Requests do not match: %v vs %v", s.requests, tc.Requests)
+			}
+		})
+	}
+}
+
+func TestStatFolders(t *testing.T) {
+	type Test struct {
+		Name        string
+		Folder      string
+		StatFolders bool
+		Anchor      string
+		WantErr     error
+	}
+
+	var testCases = []Test{
+		{
+			Name:        "Existing folders are scanned",
+			Folder:      "Parasite (2019)",
+			StatFolders: true,
+			Anchor:      "mounted",
+		},
+		{
+			Name:        "Missing folders are scanned when the mount is up",
+			Folder:      "Joker (2019)",
+			StatFolders: true,
+			Anchor:      "mounted",
+		},
+		{
+			Name:        "Missing folders are held when the mount is down",
+			Folder:      "Joker (2019)",
+			StatFolders: true,
+			Anchor:      "unmounted",
+			WantErr:     autoscan.ErrTargetNotReady,
+		},
+		{
+			Name:   "Missing folders are scanned by default",
+			Folder: "Joker (2019)",
+			Anchor: "unmounted",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			root := t.TempDir()
+			media := filepath.Join(root, "Movies")
+			if err := os.MkdirAll(filepath.Join(media, "Parasite (2019)"), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := os.WriteFile(filepath.Join(root, "mounted"), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			s := &server{
+				folders: fmt.Sprintf(`[{"Name": "Movies", "Locations": [%q], "CollectionType": "movies"}]`, media),
+				items:   `{"Items": []}`,
+			}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			target, err := New(Config{
+				URL:            ts.URL,
+				Token:          "token",
+				UserID:         "user",
+				PreciseRefresh: true,
+				StatFolders:    tc.StatFolders,
+				MountAnchors:   []string{filepath.Join(root, tc.Anchor)},
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			err = target.Scan(context.Background(), autoscan.Scan{Folder: filepath.Join(media, tc.Folder)})
+			if !errors.Is(err, tc.WantErr) {
+				t.Fatalf("Errors do not match: %v vs %v", err, tc.WantErr)
+			}
+
+			if scanned := len(s.requests) > 0; scanned != (tc.WantErr == nil) {
+				t.Errorf("Scanned does not match: %v vs %v (requests: %v)", scanned, tc.WantErr == nil, s.requests)
+			}
+		})
+	}
+}
+
+func TestCollectionFromTrigger(t *testing.T) {
+	type Test struct {
+		Name     string
+		Scan     autoscan.Scan
+		Failures []string
+		Requests []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:     "Refreshes the collection without matching the folder",
+			Scan:     autoscan.Scan{Folder: "/data/Movies/Parasite (2019)", CollectionName: "Bong Joon-ho"},
+			Requests: []string{"POST /Items/bong/Refresh"},
+		},
+		{
+			Name:     "Names differing in case match",
+			Scan:     autoscan.Scan{Folder: "/data/Movies/Parasite (2019)", CollectionName: "bong  joon-ho"},
+			Requests: []string{"POST /Items/bong/Refresh"},
+		},
+		{
+			Name:     "Falls back to the folder when the collection is not found",
+			Scan:     autoscan.Scan{Folder: "/data/Movies/Parasite (2019)", CollectionName: "Pixar"},
+			Requests: []string{"POST /Items/parasite/Refresh"},
+		},
+		{
+			Name:     "Falls back to the folder when the refresh fails",
+			Scan:     autoscan.Scan{Folder: "/data/Movies/Parasite (2019)", CollectionName: "Bong Joon-ho"},
+			Failures: []string{"bong"},
+			Requests: []string{"POST /Items/bong/Refresh", "POST /Items/parasite/Refresh"},
+		},
+		{
+			Name:     "Removed folders are matched by path",
+			Scan:     autoscan.Scan{Folder: "/data/Movies/Parasite (2019)", CollectionName: "Bong Joon-ho", Removed: true},
+			Requests: []string{"POST /Items/parasite/Refresh"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{
+				failures:    tc.Failures,
+				collections: `{"Items": [{"Id": "marvel", "Name": "Marvel"}, {"Id": "bong", "Name": "Bong Joon-ho"}]}`,
+			}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			target, err := New(Config{
+				URL:            ts.URL,
+				Token:          "token",
+				UserID:         "user",
+				PreciseRefresh: true,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			if err := target.Scan(context.Background(), tc.Scan); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(s.requests, tc.Requests) {
+				t.Errorf("Requests do not match: %v vs %v", s.requests, tc.Requests)
+			}
+		})
+	}
+}
+
+func TestItemIDsFromTrigger(t *testing.T) {
+	type Test struct {
+		Name       string
+		Scan       autoscan.Scan
+		Failures   []string
+		Requests   []string
+		Concurrent int
+	}
+
+	var testCases = []Test{
+		{
+			Name: "Refreshes all items without matching the folder",
+			Scan: autoscan.Scan{
+				Folder:  "/data/Movies/Parasite (2019)",
+				ItemIDs: []string{"joker", "tenet", "up", "wall-e"},
+				ItemID:  "parasite",
+			},
+			Requests: []string{
+				"POST /Items/joker/Refresh",
+				"POST /Items/parasite/Refresh",
+				"POST /Items/tenet/Refresh",
+				"POST /Items/up/Refresh",
+				"POST /Items/wall-e/Refresh",
+			},
+			Concurrent: 2,
+		},
+		{
+			Name: "Refreshes every item once",
+			Scan: autoscan.Scan{
+				Folder:  "/data/Movies/Parasite (2019)",
+				ItemIDs: []string{"joker", "tenet", "joker", "", "tenet"},
+				ItemID:  "tenet",
+			},
+			Requests: []string{
+				"POST /Items/joker/Refresh",
+				"POST /Items/tenet/Refresh",
+			},
+			Concurrent: 2,
+		},
+		{
+			Name:     "Falls back to the folder when a refresh fails",
+			Scan:     autoscan.Scan{Folder: "/data/Movies/Parasite (2019)", ItemIDs: []string{"joker", "tenet"}},
+			Failures: []string{"tenet"},
+			Requests: []string{
+				"POST /Items/joker/Refresh",
+				"POST /Items/parasite/Refresh",
+				"POST /Items/tenet/Refresh",
+			},
+			Concurrent: 2,
+		},
+		{
+			Name:       "Removed folders are matched by path",
+			Scan:       autoscan.Scan{Folder: "/data/Movies/Parasite (2019)", ItemIDs: []string{"joker", "tenet"}, Removed: true},
+			Requests:   []string{"POST /Items/parasite/Refresh"},
+			Concurrent: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{delay: 20 * time.Millisecond, failures: tc.Failures}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			target, err := New(Config{
+				URL:            ts.URL,
+				Token:          "token",
+				UserID:         "user",
+				PreciseRefresh: true,
+				RefreshWorkers: 2,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			if err := target.Scan(context.Background(), tc.Scan); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			sort.Strings(s.requests)
+			if !reflect.DeepEqual(s.requests, tc.Requests) {
+				t.Errorf("Requests do not match: %v vs %v", s.requests, tc.Requests)
+			}
+
+			if s.concurrent != tc.Concurrent {
+				t.Errorf("Concurrent refreshes do not match: %d vs %d", s.concurrent, tc.Concurrent)
+			}
+		})
+	}
+}
+
+func TestWarmupViewIDs(t *testing.T) {
+	type Test struct {
+		Name      string
+		Warmup    bool
+		Libraries []string
+		Views     string
+		WantViews map[string]string
+	}
+
+	folders := `[
+		{"Name": "Movies", "Locations": ["/data/Movies"], "CollectionType": "movies"},
+		{"Name": "TV", "Locations": ["/data/TV"], "CollectionType": "tvshows"}
+	]`
+
+	var testCases = []Test{
+		{
+			Name:      "Caches the viewIds of all libraries",
+			Warmup:    true,
+			Views:     `{"Items": [{"Id": "movies", "Name": "Movies"}, {"Id": "tv", "Name": "TV"}]}`,
+			WantViews: map[string]string{"Movies": "movies", "TV": "tv"},
+		},
+		{
+			Name:      "Caches the viewIds of the configured libraries",
+			Warmup:    true,
+			Libraries: []string{"tv"},
+			Views:     `{"Items": [{"Id": "movies", "Name": "Movies"}, {"Id": "tv", "Name": "TV"}]}`,
+			WantViews: map[string]string{"TV": "tv"},
+		},
+		{
+			Name:      "Skips the libraries without a view",
+			Warmup:    true,
+			Views:     `{"Items": [{"Id": "movies", "Name": "Movies"}]}`,
+			WantViews: map[string]string{"Movies": "movies"},
+		},
+		{
+			Name:      "Does not resolve the viewIds by default",
+			Views:     `{"Items": [{"Id": "movies", "Name": "Movies"}, {"Id": "tv", "Name": "TV"}]}`,
+			WantViews: map[string]string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{folders: folders, views: tc.Views}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			tp, err := New(Config{
+				URL:             ts.URL,
+				Token:           "token",
+				UserID:          "user",
+				PreciseRefresh:  true,
+				WarmupViewIDs:   tc.Warmup,
+				WarmupLibraries: tc.Libraries,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			jt := tp.(*target)
+			views := make(map[string]string)
+			for key, viewID := range jt.views.views {
+				views[key.library] = viewID
+			}
+
+			if !reflect.DeepEqual(views, tc.WantViews) {
+				t.Errorf("Cached viewIds do not match: %v vs %v", views, tc.WantViews)
+			}
+
+			if _, ok := tc.WantViews["Movies"]; !ok {
+				return
+			}
+
+			// the first precise refresh uses the cached viewId
+			requests := s.viewRequests
+			if err := tp.Scan(context.Background(), autoscan.Scan{Folder: "/data/Movies/Parasite (2019)"}); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			if s.viewRequests != requests {
+				t.Errorf("Precise refresh requested the views: %d vs %d", s.viewRequests, requests)
+			}
+
+			if want := []string{"POST /Items/parasite/Refresh"}; !reflect.DeepEqual(s.requests, want) {
+				t.Errorf("Requests do not match: %v vs %v", s.requests, want)
+			}
+		})
+	}
+}
+
+func TestStrictLibraryPaths(t *testing.T) {
+	type Test struct {
+		Name         string
+		Folder       string
+		Ambiguous    string
+		LibraryTypes []string
+		WantLibrary  string
+		WantErr      error
+		NoLibrary    bool
+	}
+
+	folders := `[
+		{"Name": "Movies", "Locations": ["/data/Movies"], "CollectionType": "movies"},
+		{"Name": "Movies 4K", "Locations": ["/data/Movies/4K"], "CollectionType": "movies"},
+		{"Name": "Home Videos", "Locations": ["/data/Movies/Home"], "CollectionType": "homevideos"}
+	]`
+
+	var testCases = []Test{
+		{
+			Name:        "Library locations match themselves",
+			Folder:      "/data/Movies",
+			WantLibrary: "Movies",
+		},
+		{
+			Name:        "A single matching library is used",
+			Folder:      "/data/Movies/Parasite (2019)",
+			WantLibrary: "Movies",
+		},
+		{
+			Name:      "Folders only match at a directory boundary",
+			Folder:    "/data/Movies Extra/Parasite (2019)",
+			NoLibrary: true,
+		},
+		{
+			Name:    "Ambiguous libraries are refused by default",
+			Folder:  "/data/Movies/4K/Parasite (2019)",
+			WantErr: autoscan.ErrScanRefused,
+		},
+		{
+			Name:        "Ambiguous libraries resolve to the longest location",
+			Folder:      "/data/Movies/4K/Parasite (2019)",
+			Ambiguous:   "longest",
+			WantLibrary: "Movies 4K",
+		},
+		{
+			Name:        "Ambiguous libraries resolve to the first library",
+			Folder:      "/data/Movies/4K/Parasite (2019)",
+			Ambiguous:   "first",
+			WantLibrary: "Movies",
+		},
+		{
+			Name:         "Collection types resolve overlapping libraries",
+			Folder:       "/data/Movies/Home/Birthday (2020)",
+			LibraryTypes: []string{"homevideos"},
+			WantLibrary:  "Home Videos",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			ts := httptest.NewServer(&server{folders: folders})
+			defer ts.Close()
+
+			tp, err := New(Config{
+				URL:                ts.URL,
+				Token:              "token",
+				UserID:             "user",
+				StrictLibraryPaths: true,
+				AmbiguousLibrary:   tc.Ambiguous,
+				LibraryTypes:       tc.LibraryTypes,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			lib, err := tp.(*target).getScanLibrary(tc.Folder)
+			switch {
+			case tc.NoLibrary:
+				if err == nil || errors.Is(err, autoscan.ErrScanRefused) {
+					t.Fatalf("Errors do not match: %v vs no library", err)
+				}
+			case tc.WantErr != nil:
+				if !errors.Is(err, tc.WantErr) {
+					t.Fatalf("Errors do not match: %v vs %v", err, tc.WantErr)
+				}
+			case err != nil:
+				t.Fatal(err)
+			case lib.Name != tc.WantLibrary:
+				t.Errorf("Libraries do not match: %v vs %v", lib.Name, tc.WantLibrary)
+			}
+		})
+	}
+
+	t.Run("Invalid choices fail at startup", func(t *testing.T) {
+		_, err := New(Config{URL: "http://localhost", Token: "token", LazyLibraries: true, AmbiguousLibrary: "random"})
+		if !errors.Is(err, autoscan.ErrFatal) {
+			t.Errorf("Errors do not match: %v vs %v", err, autoscan.ErrFatal)
+		}
+	})
+}
+
+func TestLibraryHint(t *testing.T) {
+	type Test struct {
+		Name        string
+		Hint        string
+		WantParents []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:        "Hinted scan uses the view of the hinted library",
+			Hint:        "movies 4k",
+			WantParents: []string{"view4k"},
+		},
+		{
+			Name:        "Unhinted scan matches the library by path",
+			WantParents: []string{"view"},
+		},
+		{
+			Name:        "Unknown hint falls back to matching by path",
+			Hint:        "Movies 8K",
+			WantParents: []string{"view"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{
+				folders: `[
+					{"Name": "Movies", "Locations": ["/data/Movies"], "CollectionType": "movies"},
+					{"Name": "Movies 4K", "Locations": ["/data/Movies"], "CollectionType": "movies"}
+				]`,
+				views: `{"Items": [{"Id": "view", "Name": "Movies"}, {"Id": "view4k", "Name": "Movies 4K"}]}`,
+			}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			target, err := New(Config{
+				URL:            ts.URL,
+				Token:          "token",
+				UserID:         "user",
+				PreciseRefresh: true,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			scan := autoscan.Scan{Folder: "/data/Movies/Parasite (2019)", LibraryHint: tc.Hint}
+			if err := target.Scan(context.Background(), scan); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(s.parents, tc.WantParents) {
+				t.Errorf("Views do not match: %v vs %v", s.parents, tc.WantParents)
+			}
+
+			if want := []string{"POST /Items/parasite/Refresh"}; !reflect.DeepEqual(s.requests, want) {
+				t.Errorf("Requests do not match: %v vs %v", s.requests, want)
+			}
+		})
+	}
+}
+
+func TestLibraryTypes(t *testing.T) {
+	type Test struct {
+		Name     string
+		Types    []string
+		Folder   string
+		Requests []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:     "Scans libraries of an allowed type",
+			Types:    []string{"Movies"},
+			Folder:   "/data/Movies/Parasite (2019)",
+			Requests: []string{"POST /Library/Media/Updated"},
+		},
+		{
+			Name:   "Skips libraries of other types",
+			Types:  []string{"movies"},
+			Folder: "/data/TV/Chernobyl",
+		},
+		{
+			Name:     "Scans all libraries without types",
+			Folder:   "/data/TV/Chernobyl",
+			Requests: []string{"POST /Library/Media/Updated"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{
+				folders: `[
+					{"Name": "Movies", "Locations": ["/data/Movies"], "CollectionType": "movies"},
+					{"Name": "TV", "Locations": ["/data/TV"], "CollectionType": "tvshows"}
+				]`,
+			}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			target, err := New(Config{
+				URL:          ts.URL,
+				Token:        "token",
+				LibraryTypes: tc.Types,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			if err := target.Scan(context.Background(), autoscan.Scan{Folder: tc.Folder}); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(s.requests, tc.Requests) {
+				t.Errorf("Requests do not match: %v vs %v", s.requests, tc.Requests)
+			}
+		})
+	}
+}
+
+func TestPartialLibraries(t *testing.T) {
+	type Test struct {
+		Name      string
+		Folders   string
+		Libraries []library
+		WantErr   error
+	}
+
+	var testCases = []Test{
+		{
+			Name: "Skips the libraries which cannot be decoded",
+			Folders: `[
+				{"Name": "Movies", "Locations": ["/data/Movies"], "CollectionType": "movies"},
+				{"Name": "TV", "Locations": "/data/TV", "CollectionType": "tvshows"}
+			]`,
+			Libraries: []library{{Name: "Movies", Type: "movies", Paths: []string{"/data/Movies/"}}},
+		},
+		{
+			Name:      "Skips empty locations",
+			Folders:   `[{"Name": "Movies", "Locations": ["", "/data/Movies"], "CollectionType": "movies"}]`,
+			Libraries: []library{{Name: "Movies", Type: "movies", Paths: []string{"/data/Movies/"}}},
+		},
+		{
+			Name:    "Fails when no library can be decoded",
+			Folders: `[{"Name": "TV", "Locations": "/data/TV", "CollectionType": "tvshows"}]`,
+			WantErr: autoscan.ErrFatal,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			ts := httptest.NewServer(&server{folders: tc.Folders})
+			defer ts.Close()
+
+			var logs bytes.Buffer
+			api := newAPIClient(Config{URL: ts.URL, Token: "token"}, zerolog.New(&logs))
+
+			libraries, err := api.Libraries()
+			if !errors.Is(err, tc.WantErr) {
+				t.Fatalf("Errors do not match: %v vs %v", err, tc.WantErr)
+			}
+
+			if !reflect.DeepEqual(libraries, tc.Libraries) {
+				t.Errorf("Libraries do not match: %+v vs %+v", libraries, tc.Libraries)
+			}
+
+			if tc.WantErr == nil && !strings.Contains(logs.String(), `"level":"warn"`) {
+				t.Errorf("Skipped library was not logged: %s", logs.String())
+			}
+		})
+	}
+}
+
+func TestUniqueItems(t *testing.T) {
+	// both files of the movie resolve to the same item
+	s := &server{
+		items: `{"Items": []}`,
+		movies: `{"Items": [
+			{"Id": "parasite", "Type": "Movie", "Path": "/data/Movies/Parasite (2019)/Parasite (2019) - 1080p.mkv"},
+			{"Id": "parasite", "Type": "Movie", "Path": "/data/Movies/Parasite (2019)/Parasite (2019) - 2160p.mkv"}
+		]}`,
+	}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	target, err := New(Config{
+		URL:            ts.URL,
+		Token:          "token",
+		UserID:         "user",
+		PreciseRefresh: true,
+	})
+	if err != nil {
+		t.Fatalf("Could not create Jellyfin Target: %v", err)
+	}
+
+	if err := target.Scan(context.Background(), autoscan.Scan{Folder: "/data/Movies/Parasite (2019)"}); err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	want := []string{"POST /Items/parasite/Refresh"}
+	if !reflect.DeepEqual(s.requests, want) {
+		t.Errorf("Requests do not match: %v vs %v", s.requests, want)
+	}
+}
+
+func TestLibraryMap(t *testing.T) {
+	type Test struct {
+		Name    string
+		Folder  string
+		Parents []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:    "Uses the view of the longest mapped prefix",
+			Folder:  "/data/Movies/4K/Parasite (2019)",
+			Parents: []string{"uhd"},
+		},
+		{
+			Name:    "Uses the view of a mapped prefix",
+			Folder:  "/data/Movies/Parasite (2019)",
+			Parents: []string{"mapped"},
+		},
+		{
+			Name:    "Resolves the view by name without a mapped prefix",
+			Folder:  "/data/Movies4K/Parasite (2019)",
+			Parents: []string{"view"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{
+				folders: `[{"Name": "Movies", "Locations": ["/data/Movies", "/data/Movies4K"], "CollectionType": "movies"}]`,
+				items:   fmt.Sprintf(`{"Items": [{"Id": "parasite", "Path": %q}]}`, tc.Folder),
+			}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			target, err := New(Config{
+				URL:            ts.URL,
+				Token:          "token",
+				UserID:         "user",
+				PreciseRefresh: true,
+				LibraryMap: map[string]string{
+					"/data/Movies":    "mapped",
+					"/data/Movies/4K": "uhd",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			if err := target.Scan(context.Background(), autoscan.Scan{Folder: tc.Folder}); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(s.parents, tc.Parents) {
+				t.Errorf("Views do not match: %v vs %v", s.parents, tc.Parents)
+			}
+		})
+	}
+}
+
+func TestLibraryUsers(t *testing.T) {
+	type Test struct {
+		Name   string
+		Folder string
+		Users  []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:   "Uses the user of the longest matching folder",
+			Folder: "/data/Movies/Kids/Frozen (2013)",
+			Users:  []string{"kid", "kid"},
+		},
+		{
+			Name:   "Uses the user of the library",
+			Folder: "/data/Movies/Parasite (2019)",
+			Users:  []string{"owner", "owner"},
+		},
+		{
+			Name:   "Falls back to the user of the target",
+			Folder: "/data/Shows/Chernobyl",
+			Users:  []string{"user", "user"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{
+				folders: `[
+					{"Name": "Movies", "Locations": ["/data/Movies"], "CollectionType": "movies"},
+					{"Name": "Shows", "Locations": ["/data/Shows"], "CollectionType": "tvshows"}
+				]`,
+				views: `{"Items": [{"Id": "view", "Name": "Movies"}, {"Id": "shows", "Name": "Shows"}]}`,
+				items: fmt.Sprintf(`{"Items": [{"Id": "item", "Path": %q}]}`, tc.Folder),
+			}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			target, err := New(Config{
+				URL:            ts.URL,
+				Token:          "token",
+				UserID:         "user",
+				PreciseRefresh: true,
+				LibraryUsers: map[string]string{
+					"Movies":            "owner",
+					"/data/Movies/Kids": "kid",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			if err := target.Scan(context.Background(), autoscan.Scan{Folder: tc.Folder}); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			// the view and the item are both resolved as the user
+			if !reflect.DeepEqual(s.users, tc.Users) {
+				t.Errorf("Users do not match: %v vs %v", s.users, tc.Users)
+			}
+
+			if want := []string{"POST /Items/item/Refresh"}; !reflect.DeepEqual(s.requests, want) {
+				t.Errorf("Requests do not match: %v vs %v", s.requests, want)
+			}
+		})
+	}
+}
+
+type fakeResolver struct {
+	ids     []string
+	err     error
+	folders []string
+}
+
+func (r *fakeResolver) ResolveItems(ctx context.Context, library string, folder string) ([]string, error) {
+	r.folders = append(r.folders, library+": "+folder)
+	return r.ids, r.err
+}
+
+func TestItemResolver(t *testing.T) {
+	type Test struct {
+		Name     string
+		IDs      []string
+		Err      error
+		Requests []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:     "Refreshes the items of the resolver",
+			IDs:      []string{"sidecar", "extras"},
+			Requests: []string{"POST /Items/extras/Refresh", "POST /Items/sidecar/Refresh"},
+		},
+		{
+			Name:     "Falls back to a library scan without items",
+			Requests: []string{"POST /Library/Media/Updated"},
+		},
+		{
+			Name:     "Falls back to a library scan when the resolver fails",
+			Err:      errors.New("sidecar database unavailable"),
+			Requests: []string{"POST /Library/Media/Updated"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			resolver := &fakeResolver{ids: tc.IDs, err: tc.Err}
+			target, err := New(Config{
+				URL:            ts.URL,
+				Token:          "token",
+				UserID:         "user",
+				PreciseRefresh: true,
+				Resolver:       resolver,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			if err := target.Scan(context.Background(), autoscan.Scan{Folder: "/data/Movies/Parasite (2019)"}); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			if want := []string{"Movies: /data/Movies/Parasite (2019)"}; !reflect.DeepEqual(resolver.folders, want) {
+				t.Errorf("Resolved folders do not match: %v vs %v", resolver.folders, want)
+			}
+
+			// the resolver replaces the matching by path
+			if len(s.parents) > 0 {
+				t.Errorf("Items were matched by path: %v", s.parents)
+			}
+
+			requests := append([]string(nil), s.requests...)
+			sort.Strings(requests)
+			if !reflect.DeepEqual(requests, tc.Requests) {
+				t.Errorf("Requests do not match: %v vs %v", requests, tc.Requests)
+			}
+		})
+	}
+}
+
+func TestScanMode(t *testing.T) {
+	type Test struct {
+		Name     string
+		Config   Config
+		Folder   string
+		WantErr  error
+		Requests []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:     "Precise only refreshes the item",
+			Config:   Config{ScanMode: "precise-only"},
+			Folder:   "/data/Movies/Parasite (2019)",
+			Requests: []string{"POST /Items/parasite/Refresh"},
+		},
+		{
+			Name:    "Precise only retries the scan without an item",
+			Config:  Config{ScanMode: "precise-only"},
+			Folder:  "/data/Movies/Interstellar (2014)",
+			WantErr: autoscan.ErrTargetNotReady,
+		},
+		{
+			Name:     "Precise then library falls back to a library scan",
+			Config:   Config{ScanMode: "precise-then-library"},
+			Folder:   "/data/Movies/Interstellar (2014)",
+			Requests: []string{"POST /Library/Media/Updated"},
+		},
+		{
+			Name:     "Library only skips the precise refresh",
+			Config:   Config{ScanMode: "library-only", PreciseRefresh: true},
+			Folder:   "/data/Movies/Parasite (2019)",
+			Requests: []string{"POST /Library/Media/Updated"},
+		},
+		{
+			Name:     "Precise refresh without a scan mode",
+			Config:   Config{PreciseRefresh: true},
+			Folder:   "/data/Movies/Parasite (2019)",
+			Requests: []string{"POST /Items/parasite/Refresh"},
+		},
+		{
+			Name:     "Library scan without a scan mode",
+			Folder:   "/data/Movies/Parasite (2019)",
+			Requests: []string{"POST /Library/Media/Updated"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			tc.Config.URL = ts.URL
+			tc.Config.Token = "token"
+			tc.Config.UserID = "user"
+
+			target, err := New(tc.Config)
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			err = target.Scan(context.Background(), autoscan.Scan{Folder: tc.Folder})
+			if !errors.Is(err, tc.WantErr) {
+				t.Errorf("Errors do not match: %v vs %v", err, tc.WantErr)
+			}
+
+			if !reflect.DeepEqual(s.requests, tc.Requests) {
+				t.Errorf("Requests do not match: %v vs %v", s.requests, tc.Requests)
+			}
+		})
+	}
+
+	t.Run("Invalid scan mode", func(t *testing.T) {
+		ts := httptest.NewServer(&server{})
+		defer ts.Close()
+
+		_, err := New(Config{URL: ts.URL, Token: "token", ScanMode: "precise"})
+		if !errors.Is(err, autoscan.ErrFatal) {
+			t.Errorf("Invalid scan mode was accepted: %v", err)
+		}
+	})
+}
+
+func TestModeByType(t *testing.T) {
+	type Test struct {
+		Name     string
+		Precise  bool
+		Folder   string
+		Requests []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:     "Refreshes the item of a precise type",
+			Folder:   "/data/Movies/Parasite (2019)",
+			Requests: []string{"POST /Items/item/Refresh"},
+		},
+		{
+			Name:     "Scans the library of a library type",
+			Precise:  true,
+			Folder:   "/data/Music/Radiohead",
+			Requests: []string{"POST /Library/Media/Updated"},
+		},
+		{
+			Name:     "Refreshes the item of an unmapped type with precise refresh",
+			Precise:  true,
+			Folder:   "/data/Shows/Chernobyl",
+			Requests: []string{"POST /Items/item/Refresh"},
+		},
+		{
+			Name:     "Scans the library of an unmapped type without precise refresh",
+			Folder:   "/data/Shows/Chernobyl",
+			Requests: []string{"POST /Library/Media/Updated"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{
+				folders: `[
+					{"Name": "Movies", "Locations": ["/data/Movies"], "CollectionType": "movies"},
+					{"Name": "Music", "Locations": ["/data/Music"], "CollectionType": "music"},
+					{"Name": "Shows", "Locations": ["/data/Shows"], "CollectionType": "tvshows"}
+				]`,
+				views: `{"Items": [{"Id": "movies", "Name": "Movies"}, {"Id": "music", "Name": "Music"}, {"Id": "shows", "Name": "Shows"}]}`,
+				items: fmt.Sprintf(`{"Items": [{"Id": "item", "Path": %q}]}`, tc.Folder),
+			}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			target, err := New(Config{
+				URL:            ts.URL,
+				Token:          "token",
+				UserID:         "user",
+				PreciseRefresh: tc.Precise,
+				ModeByType: map[string]string{
+					"Movies": "precise",
+					"music":  "library",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Could not create Jellyfin Target: %v", err)
+			}
+
+			if err := target.Scan(context.Background(), autoscan.Scan{Folder: tc.Folder}); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(s.requests, tc.Requests) {
+				t.Errorf("Requests do not match: %v vs %v", s.requests, tc.Requests)
+			}
+		})
+	}
+
+	t.Run("Invalid mode", func(t *testing.T) {
+		ts := httptest.NewServer(&server{})
+		defer ts.Close()
+
+		_, err := New(Config{URL: ts.URL, Token: "token", ModeByType: map[string]string{"music": "scan"}})
+		if !errors.Is(err, autoscan.ErrFatal) {
+			t.Errorf("Invalid mode was accepted: %v", err)
+		}
+	})
+}
+
+func TestLazyLibraries(t *testing.T) {
+	s := &server{}
+
+	var lock sync.Mutex
+	down, fetches := true, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if down {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		if r.URL.Path == "/Library/VirtualFolders" {
+			fetches++
+		}
+
+		s.ServeHTTP(rw, r)
+	}))
+	defer ts.Close()
+
+	// the server is not reachable while the target is created
+	target, err := New(Config{URL: ts.URL, Token: "token", LazyLibraries: true})
+	if err != nil {
+		t.Fatalf("Could not create Jellyfin Target: %v", err)
+	}
+
+	scan := autoscan.Scan{Folder: "/data/Movies/Parasite (2019)"}
+	if err := target.Scan(context.Background(), scan); !errors.Is(err, autoscan.ErrTargetUnavailable) {
+		t.Fatalf("Scan did not fail while the server is down: %v", err)
+	}
+
+	lock.Lock()
+	down = false
+	lock.Unlock()
+
+	// the libraries are fetched on the first scan after the server is back, and cached afterwards
+	for i := 0; i < 2; i++ {
+		if err := target.Scan(context.Background(), scan); err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+	}
+
+	if fetches != 1 {
+		t.Errorf("Libraries were fetched %d times", fetches)
+	}
+
+	if want := []string{"POST /Library/Media/Updated", "POST /Library/Media/Updated"}; !reflect.DeepEqual(s.requests, want) {
+		t.Errorf("Requests do not match: %v vs %v", s.requests, want)
+	}
+}
+
+func TestMatchedItems(t *testing.T) {
+	at := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return at }
+	defer func() { now = time.Now }()
+
+	t.Run("Forgets matches older than the TTL", func(t *testing.T) {
+		m := &matchedItems{items: make(map[string]matchedItem)}
+		m.set("/data/Movies/Parasite (2019)", "parasite")
+
+		if id := m.get("/data/Movies/Parasite (2019)"); id != "parasite" {
+			t.Errorf("Item IDs do not match: %q vs %q", id, "parasite")
+		}
+
+		at = at.Add(matchedTTL)
+		if id := m.get("/data/Movies/Parasite (2019)"); id != "" {
+			t.Errorf("Expired match was returned: %q", id)
+		}
+
+		m.set("/data/Movies/Interstellar (2014)", "interstellar")
+		if len(m.items) != 1 {
+			t.Errorf("Expired matches were not removed: %d vs %d", len(m.items), 1)
+		}
+	})
+
+	t.Run("Drops the oldest matches beyond the limit", func(t *testing.T) {
+		m := &matchedItems{items: make(map[string]matchedItem)}
+		for i := 0; i <= matchedLimit; i++ {
+			at = at.Add(time.Millisecond)
+			m.set(fmt.Sprintf("/data/Movies/Movie %d", i), strconv.Itoa(i))
+		}
+
+		if len(m.items) != matchedLimit {
+			t.Errorf("Matches do not match the limit: %d vs %d", len(m.items), matchedLimit)
+		}
+
+		if id := m.get("/data/Movies/Movie 0"); id != "" {
+			t.Errorf("Oldest match was not dropped: %q", id)
+		}
+
+		if id := m.get(fmt.Sprintf("/data/Movies/Movie %d", matchedLimit)); id != strconv.Itoa(matchedLimit) {
+			t.Errorf("Latest match was dropped: %q", id)
+		}
+	})
+}
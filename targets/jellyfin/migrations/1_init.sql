@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS jellyfin_item (
+    "url" TEXT NOT NULL,
+    "item_id" TEXT NOT NULL,
+    "last_seen" TEXT NOT NULL,
+    PRIMARY KEY(url, item_id)
+)
@@ -0,0 +1,174 @@
+package kodi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cloudbox/autoscan"
+)
+
+type apiClient struct {
+	client  *http.Client
+	log     zerolog.Logger
+	baseURL string
+	user    string
+	pass    string
+}
+
+func newAPIClient(baseURL string, user string, pass string, log zerolog.Logger) apiClient {
+	return apiClient{
+		client:  &http.Client{},
+		log:     log,
+		baseURL: baseURL,
+		user:    user,
+		pass:    pass,
+	}
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e rpcError) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Message, e.Code)
+}
+
+// call invokes a JSON-RPC method of Kodi and decodes its result into result, when not nil.
+func (c apiClient) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	type Request struct {
+		JSONRPC string      `json:"jsonrpc"`
+		Method  string      `json:"method"`
+		Params  interface{} `json:"params,omitempty"`
+		ID      int         `json:"id"`
+	}
+
+	b, err := json.Marshal(Request{JSONRPC: "2.0", Method: method, Params: params, ID: 1})
+	if err != nil {
+		return fmt.Errorf("failed encoding %s request: %v: %w", method, err, autoscan.ErrFatal)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", autoscan.JoinURL(c.baseURL, "jsonrpc"), bytes.NewBuffer(b))
+	if err != nil {
+		return fmt.Errorf("failed creating %s request: %v: %w", method, err, autoscan.ErrFatal)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if c.user != "" {
+		req.SetBasicAuth(c.user, c.pass)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%v: %w", err, autoscan.ErrTargetUnavailable)
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		c.log.Trace().
+			Stringer("request_url", res.Request.URL).
+			Str("method", method).
+			Int("response_status", res.StatusCode).
+			Msg("Request failed")
+
+		switch res.StatusCode {
+		case 401:
+			return fmt.Errorf("invalid basic auth: %s: %w", res.Status, autoscan.ErrFatal)
+		case 404, 500, 502, 503, 504:
+			return fmt.Errorf("%s: %w", res.Status, autoscan.ErrTargetUnavailable)
+		default:
+			return fmt.Errorf("%s: %w", res.Status, autoscan.ErrFatal)
+		}
+	}
+
+	type Response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+
+	resp := new(Response)
+	if err := json.NewDecoder(res.Body).Decode(resp); err != nil {
+		return fmt.Errorf("failed decoding %s response: %v: %w", method, err, autoscan.ErrFatal)
+	}
+
+	if resp.Error != nil {
+		return fmt.Errorf("%s: %v: %w", method, resp.Error, autoscan.ErrFatal)
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(resp.Result, result); err != nil {
+		return fmt.Errorf("failed decoding %s result: %v: %w", method, err, autoscan.ErrFatal)
+	}
+
+	return nil
+}
+
+func (c apiClient) Available() error {
+	if err := c.call(context.Background(), "JSONRPC.Ping", nil, nil); err != nil {
+		return fmt.Errorf("availability: %w", err)
+	}
+
+	return nil
+}
+
+type library struct {
+	Name string
+	Type string
+	Path string
+}
+
+// Libraries returns the video and music sources of Kodi.
+func (c apiClient) Libraries() ([]library, error) {
+	type Result struct {
+		Sources []struct {
+			File  string `json:"file"`
+			Label string `json:"label"`
+		} `json:"sources"`
+	}
+
+	libraries := make([]library, 0)
+	for _, media := range []string{mediaVideo, mediaMusic} {
+		result := new(Result)
+		params := map[string]string{"media": media}
+		if err := c.call(context.Background(), "Files.GetSources", params, result); err != nil {
+			return nil, fmt.Errorf("libraries: %w", err)
+		}
+
+		for _, source := range result.Sources {
+			libraries = append(libraries, library{
+				Name: source.Label,
+				Type: media,
+				Path: withTrailingSlash(source.File),
+			})
+		}
+	}
+
+	return libraries, nil
+}
+
+func (c apiClient) Scan(ctx context.Context, path string, media string) error {
+	method := "VideoLibrary.Scan"
+	if media == mediaMusic {
+		method = "AudioLibrary.Scan"
+	}
+
+	params := map[string]interface{}{
+		"directory":   withTrailingSlash(path),
+		"showdialogs": false,
+	}
+
+	if err := c.call(ctx, method, params, nil); err != nil {
+		return fmt.Errorf("scan: %w", err)
+	}
+
+	return nil
+}
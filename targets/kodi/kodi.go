@@ -0,0 +1,147 @@
+package kodi
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cloudbox/autoscan"
+)
+
+type Config struct {
+	URL       string             `yaml:"url"`
+	User      string             `yaml:"username"`
+	Pass      string             `yaml:"password"`
+	Library   string             `yaml:"library"`
+	ReadyPath string             `yaml:"ready-path"`
+	Rewrite   []autoscan.Rewrite `yaml:"rewrite"`
+	Verbosity string             `yaml:"verbosity"`
+}
+
+// Kodi keeps separate libraries for video and music.
+const (
+	mediaVideo = "video"
+	mediaMusic = "music"
+)
+
+type target struct {
+	url       string
+	media     string
+	readyPath string
+	libraries []library
+
+	log     zerolog.Logger
+	rewrite autoscan.Rewriter
+	api     apiClient
+}
+
+// New creates a target which scans directories through the JSON-RPC API of Kodi.
+//
+// The library, either video or music, determines which library scans the directories.
+// When no library is configured, it is determined by the source containing the directory.
+func New(c Config) (autoscan.Target, error) {
+	l := autoscan.GetLogger(c.Verbosity).With().
+		Str("target", "kodi").
+		Str("url", c.URL).
+		Logger()
+
+	rewriter, err := autoscan.NewRewriter(c.Rewrite)
+	if err != nil {
+		return nil, err
+	}
+
+	media := strings.ToLower(c.Library)
+	if media != "" && media != mediaVideo && media != mediaMusic {
+		return nil, fmt.Errorf("kodi library must be video or music, not %q: %w", c.Library, autoscan.ErrFatal)
+	}
+
+	api := newAPIClient(c.URL, c.User, c.Pass, l)
+
+	libraries, err := api.Libraries()
+	if err != nil {
+		return nil, err
+	}
+
+	l.Debug().
+		Interface("libraries", libraries).
+		Msg("Retrieved libraries")
+
+	return &target{
+		url:       c.URL,
+		media:     media,
+		readyPath: c.ReadyPath,
+		libraries: libraries,
+
+		log:     l,
+		rewrite: rewriter,
+		api:     api,
+	}, nil
+}
+
+func (t target) String() string {
+	return fmt.Sprintf("kodi: %s", t.url)
+}
+
+func (t target) Available() error {
+	return t.api.Available()
+}
+
+func (t target) Scan(ctx context.Context, scan autoscan.Scan) error {
+	if err := autoscan.CheckReadyPath(t.readyPath); err != nil {
+		return err
+	}
+
+	scanFolder := t.rewrite(scan.Folder)
+
+	media := t.media
+	if media == "" {
+		lib, err := t.getScanLibrary(scanFolder)
+		if err != nil {
+			t.log.Warn().
+				Err(err).
+				Str("id", scan.ID).
+				Msg("No target libraries found")
+
+			return nil
+		}
+
+		media = lib.Type
+	}
+
+	l := t.log.With().
+		Str("id", scan.ID).
+		Str("path", scanFolder).
+		Str("library", media).
+		Logger()
+
+	// send scan request
+	l.Trace().Msg("Sending scan request")
+
+	if err := t.api.Scan(ctx, scanFolder, media); err != nil {
+		return err
+	}
+
+	l.Info().Msg("Scan moved to target")
+	return nil
+}
+
+func (t target) getScanLibrary(folder string) (*library, error) {
+	for _, l := range t.libraries {
+		if strings.HasPrefix(withTrailingSlash(folder), l.Path) {
+			return &l, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%v: failed determining library", folder)
+}
+
+// Kodi expects directories to end with a slash.
+func withTrailingSlash(path string) string {
+	if strings.HasSuffix(path, "/") {
+		return path
+	}
+
+	return path + "/"
+}
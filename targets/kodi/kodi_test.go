@@ -0,0 +1,205 @@
+package kodi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/cloudbox/autoscan"
+)
+
+type call struct {
+	Method string
+	Params map[string]interface{}
+}
+
+type server struct {
+	lock  sync.Mutex
+	calls []call
+}
+
+func (s *server) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if user, pass, _ := r.BasicAuth(); r.URL.Path != "/jsonrpc" || user != "kodi" || pass != "secret" {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	req := new(call)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if req.Method == "Files.GetSources" {
+		b, err := os.ReadFile("testdata/" + req.Params["media"].(string) + "_sources.json")
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		_, _ = rw.Write(b)
+		return
+	}
+
+	s.lock.Lock()
+	s.calls = append(s.calls, *req)
+	s.lock.Unlock()
+
+	switch req.Method {
+	case "JSONRPC.Ping":
+		_, _ = rw.Write([]byte(`{"id": 1, "jsonrpc": "2.0", "result": "pong"}`))
+	case "VideoLibrary.Scan", "AudioLibrary.Scan":
+		_, _ = rw.Write([]byte(`{"id": 1, "jsonrpc": "2.0", "result": "OK"}`))
+	default:
+		_, _ = rw.Write([]byte(`{"id": 1, "jsonrpc": "2.0", "error": {"code": -32601, "message": "Method not found."}}`))
+	}
+}
+
+func TestScan(t *testing.T) {
+	type Given struct {
+		Library string
+		Folder  string
+	}
+
+	type Expected struct {
+		Calls []call
+	}
+
+	type Test struct {
+		Name     string
+		Given    Given
+		Expected Expected
+	}
+
+	var testCases = []Test{
+		{
+			"Scans video sources with the video library",
+			Given{
+				Folder: "/data/Movies/Parasite (2019)",
+			},
+			Expected{
+				Calls: []call{{
+					Method: "VideoLibrary.Scan",
+					Params: map[string]interface{}{"directory": "/data/Movies/Parasite (2019)/", "showdialogs": false},
+				}},
+			},
+		},
+		{
+			"Scans music sources with the audio library",
+			Given{
+				Folder: "/data/Music/Blink-182/Enema of the State",
+			},
+			Expected{
+				Calls: []call{{
+					Method: "AudioLibrary.Scan",
+					Params: map[string]interface{}{"directory": "/data/Music/Blink-182/Enema of the State/", "showdialogs": false},
+				}},
+			},
+		},
+		{
+			"Scans the configured library",
+			Given{
+				Library: "Music",
+				Folder:  "/mnt/Music/Blink-182",
+			},
+			Expected{
+				Calls: []call{{
+					Method: "AudioLibrary.Scan",
+					Params: map[string]interface{}{"directory": "/mnt/Music/Blink-182/", "showdialogs": false},
+				}},
+			},
+		},
+		{
+			"Ignores folders outside of the sources",
+			Given{
+				Folder: "/data/Books/Dune",
+			},
+			Expected{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			target, err := New(Config{
+				URL:     ts.URL,
+				User:    "kodi",
+				Pass:    "secret",
+				Library: tc.Given.Library,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Kodi Target: %v", err)
+			}
+
+			err = target.Scan(context.Background(), autoscan.Scan{Folder: tc.Given.Folder})
+			if err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(s.calls, tc.Expected.Calls) {
+				t.Logf("want: %v", tc.Expected.Calls)
+				t.Logf("got:  %v", s.calls)
+				t.Errorf("Calls do not match")
+			}
+		})
+	}
+}
+
+func TestAvailable(t *testing.T) {
+	s := &server{}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	target, err := New(Config{URL: ts.URL, User: "kodi", Pass: "secret"})
+	if err != nil {
+		t.Fatalf("Could not create Kodi Target: %v", err)
+	}
+
+	if err := target.Available(); err != nil {
+		t.Errorf("Target is not available: %v", err)
+	}
+
+	want := []call{{Method: "JSONRPC.Ping"}}
+	if !reflect.DeepEqual(s.calls, want) {
+		t.Logf("want: %v", want)
+		t.Logf("got:  %v", s.calls)
+		t.Errorf("Calls do not match")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	s := &server{}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	_, err := New(Config{URL: ts.URL, User: "kodi", Pass: "wrong"})
+	if !errors.Is(err, autoscan.ErrFatal) {
+		t.Errorf("Errors do not match: %v vs %v", err, autoscan.ErrFatal)
+	}
+
+	_, err = New(Config{URL: ts.URL, User: "kodi", Pass: "secret", Library: "books"})
+	if !errors.Is(err, autoscan.ErrFatal) {
+		t.Errorf("Errors do not match: %v vs %v", err, autoscan.ErrFatal)
+	}
+
+	api := newAPIClient(ts.URL, "kodi", "secret", autoscan.GetLogger(""))
+	err = api.call(context.Background(), "VideoLibrary.Clean", nil, nil)
+	if !errors.Is(err, autoscan.ErrFatal) {
+		t.Errorf("Errors do not match: %v vs %v", err, autoscan.ErrFatal)
+	}
+
+	ts.Close()
+	err = api.Available()
+	if !errors.Is(err, autoscan.ErrTargetUnavailable) {
+		t.Errorf("Errors do not match: %v vs %v", err, autoscan.ErrTargetUnavailable)
+	}
+}
@@ -0,0 +1,149 @@
+package navidrome
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cloudbox/autoscan"
+)
+
+type apiClient struct {
+	client  *http.Client
+	log     zerolog.Logger
+	baseURL string
+	user    string
+	pass    string
+	token   string
+	salt    string
+}
+
+func newAPIClient(c Config, log zerolog.Logger) apiClient {
+	return apiClient{
+		client:  &http.Client{},
+		log:     log,
+		baseURL: c.URL,
+		user:    c.User,
+		pass:    c.Pass,
+		token:   c.Token,
+		salt:    c.Salt,
+	}
+}
+
+// auth returns the authentication parameters of the Subsonic API.
+// A password is sent as a salted token, a fresh salt is used for every request.
+func (c apiClient) auth() (url.Values, error) {
+	token, salt := c.token, c.salt
+	if c.pass != "" {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+
+		salt = hex.EncodeToString(b)
+		sum := md5.Sum([]byte(c.pass + salt))
+		token = hex.EncodeToString(sum[:])
+	}
+
+	q := url.Values{}
+	q.Add("u", c.user)
+	q.Add("t", token)
+	q.Add("s", salt)
+	q.Add("v", "1.16.1")
+	q.Add("c", "autoscan")
+	q.Add("f", "json")
+	return q, nil
+}
+
+// Subsonic error codes which indicate invalid credentials.
+var authErrors = map[int]bool{
+	40: true, // wrong username or password
+	41: true, // token authentication not supported
+	50: true, // user is not authorized
+}
+
+func (c apiClient) call(ctx context.Context, endpoint string) error {
+	q, err := c.auth()
+	if err != nil {
+		return fmt.Errorf("failed creating %s token: %v: %w", endpoint, err, autoscan.ErrFatal)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", autoscan.JoinURL(c.baseURL, "rest", endpoint), nil)
+	if err != nil {
+		return fmt.Errorf("failed creating %s request: %v: %w", endpoint, err, autoscan.ErrFatal)
+	}
+
+	req.URL.RawQuery = q.Encode()
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%v: %w", err, autoscan.ErrTargetUnavailable)
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		c.log.Trace().
+			Str("endpoint", endpoint).
+			Int("response_status", res.StatusCode).
+			Msg("Request failed")
+
+		switch res.StatusCode {
+		case 401:
+			return fmt.Errorf("invalid navidrome credentials: %s: %w", res.Status, autoscan.ErrFatal)
+		case 404, 500, 502, 503, 504:
+			return fmt.Errorf("%s: %w", res.Status, autoscan.ErrTargetUnavailable)
+		default:
+			return fmt.Errorf("%s: %w", res.Status, autoscan.ErrFatal)
+		}
+	}
+
+	type Response struct {
+		Subsonic struct {
+			Status string `json:"status"`
+			Error  struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		} `json:"subsonic-response"`
+	}
+
+	resp := new(Response)
+	if err := json.NewDecoder(res.Body).Decode(resp); err != nil {
+		return fmt.Errorf("failed decoding %s response: %v: %w", endpoint, err, autoscan.ErrFatal)
+	}
+
+	if resp.Subsonic.Status != "ok" {
+		rpcErr := resp.Subsonic.Error
+		if authErrors[rpcErr.Code] {
+			return fmt.Errorf("invalid navidrome credentials: %s: %w", rpcErr.Message, autoscan.ErrFatal)
+		}
+
+		return fmt.Errorf("%s: %s (%d): %w", endpoint, rpcErr.Message, rpcErr.Code, autoscan.ErrTargetUnavailable)
+	}
+
+	return nil
+}
+
+func (c apiClient) Available() error {
+	if err := c.call(context.Background(), "ping"); err != nil {
+		return fmt.Errorf("availability: %w", err)
+	}
+
+	return nil
+}
+
+func (c apiClient) Scan(ctx context.Context) error {
+	if err := c.call(ctx, "startScan"); err != nil {
+		return fmt.Errorf("scan: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package navidrome
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cloudbox/autoscan"
+)
+
+type Config struct {
+	URL       string             `yaml:"url"`
+	User      string             `yaml:"username"`
+	Pass      string             `yaml:"password"`
+	Token     string             `yaml:"token"`
+	Salt      string             `yaml:"salt"`
+	Window    time.Duration      `yaml:"scan-window"`
+	ReadyPath string             `yaml:"ready-path"`
+	Rewrite   []autoscan.Rewrite `yaml:"rewrite"`
+	Verbosity string             `yaml:"verbosity"`
+}
+
+// defaultWindow is the minimum time between two library scans.
+const defaultWindow = time.Minute
+
+type target struct {
+	url       string
+	readyPath string
+	window    time.Duration
+
+	log     zerolog.Logger
+	rewrite autoscan.Rewriter
+	api     apiClient
+
+	// lock guards the state of the scan window.
+	lock     sync.Mutex
+	lastScan time.Time
+	pending  *time.Timer
+}
+
+// New creates a target which starts a scan of the Navidrome library through the Subsonic API.
+//
+// Navidrome always scans its entire library, so all scans within the scan window
+// result in a single library scan at the end of the window.
+func New(c Config) (autoscan.Target, error) {
+	l := autoscan.GetLogger(c.Verbosity).With().
+		Str("target", "navidrome").
+		Str("url", c.URL).
+		Logger()
+
+	if c.User == "" || (c.Pass == "" && (c.Token == "" || c.Salt == "")) {
+		return nil, fmt.Errorf("navidrome requires a username and either a password or a token and salt: %w", autoscan.ErrFatal)
+	}
+
+	rewriter, err := autoscan.NewRewriter(c.Rewrite)
+	if err != nil {
+		return nil, err
+	}
+
+	window := c.Window
+	if window <= 0 {
+		window = defaultWindow
+	}
+
+	return &target{
+		url:       c.URL,
+		readyPath: c.ReadyPath,
+		window:    window,
+
+		log:     l,
+		rewrite: rewriter,
+		api:     newAPIClient(c, l),
+	}, nil
+}
+
+func (t *target) String() string {
+	return fmt.Sprintf("navidrome: %s", t.url)
+}
+
+func (t *target) Available() error {
+	return t.api.Available()
+}
+
+func (t *target) Scan(ctx context.Context, scan autoscan.Scan) error {
+	if err := autoscan.CheckReadyPath(t.readyPath); err != nil {
+		return err
+	}
+
+	l := t.log.With().
+		Str("id", scan.ID).
+		Str("path", t.rewrite(scan.Folder)).
+		Logger()
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	// a library scan is already planned at the end of the window
+	if t.pending != nil {
+		l.Debug().Msg("Scan merged into planned library scan")
+		return nil
+	}
+
+	wait := t.window - now().Sub(t.lastScan)
+	if wait > 0 {
+		t.pending = time.AfterFunc(wait, t.scanPending)
+
+		l.Debug().
+			Dur("wait", wait).
+			Msg("Library scan planned")
+		return nil
+	}
+
+	l.Trace().Msg("Sending scan request")
+
+	if err := t.api.Scan(ctx); err != nil {
+		return err
+	}
+
+	t.lastScan = now()
+	l.Info().Msg("Scan moved to target")
+	return nil
+}
+
+// scanPending sends the library scan planned at the end of the window.
+// The scans were already acknowledged, so a failure can only be logged.
+func (t *target) scanPending() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.pending = nil
+	t.lastScan = now()
+
+	if err := t.api.Scan(context.Background()); err != nil {
+		t.log.Error().
+			Err(err).
+			Msg("Failed sending planned library scan")
+		return
+	}
+
+	t.log.Info().Msg("Planned library scan moved to target")
+}
+
+var now = time.Now
@@ -0,0 +1,128 @@
+package navidrome
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudbox/autoscan"
+)
+
+type server struct {
+	lock  sync.Mutex
+	calls map[string]int
+}
+
+func (s *server) count(endpoint string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.calls[endpoint]
+}
+
+func (s *server) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	sum := md5.Sum([]byte("secret" + q.Get("s")))
+
+	if q.Get("u") != "navidrome" || q.Get("t") != hex.EncodeToString(sum[:]) {
+		_, _ = rw.Write([]byte(`{"subsonic-response": {"status": "failed", "version": "1.16.1", "error": {"code": 40, "message": "Wrong username or password"}}}`))
+		return
+	}
+
+	s.lock.Lock()
+	s.calls[r.URL.Path]++
+	s.lock.Unlock()
+
+	switch r.URL.Path {
+	case "/rest/ping":
+		_, _ = rw.Write([]byte(`{"subsonic-response": {"status": "ok", "version": "1.16.1", "type": "navidrome", "serverVersion": "0.49.3"}}`))
+	case "/rest/startScan":
+		_, _ = rw.Write([]byte(`{"subsonic-response": {"status": "ok", "version": "1.16.1", "scanStatus": {"scanning": true, "count": 0}}}`))
+	default:
+		rw.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newServer() (*server, *httptest.Server) {
+	s := &server{calls: make(map[string]int)}
+	return s, httptest.NewServer(s)
+}
+
+func TestScan(t *testing.T) {
+	s, ts := newServer()
+	defer ts.Close()
+
+	target, err := New(Config{
+		URL:    ts.URL,
+		User:   "navidrome",
+		Pass:   "secret",
+		Window: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Could not create Navidrome Target: %v", err)
+	}
+
+	// the first scan is sent right away, the others are merged into one at the end of the window
+	for _, folder := range []string{"/music/Blink-182", "/music/Green Day", "/music/The Offspring"} {
+		if err := target.Scan(context.Background(), autoscan.Scan{Folder: folder}); err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+	}
+
+	if n := s.count("/rest/startScan"); n != 1 {
+		t.Errorf("Scans do not match: %d vs %d", n, 1)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	if n := s.count("/rest/startScan"); n != 2 {
+		t.Errorf("Scans do not match: %d vs %d", n, 2)
+	}
+}
+
+func TestAvailable(t *testing.T) {
+	s, ts := newServer()
+	defer ts.Close()
+
+	target, err := New(Config{URL: ts.URL, User: "navidrome", Pass: "secret"})
+	if err != nil {
+		t.Fatalf("Could not create Navidrome Target: %v", err)
+	}
+
+	if err := target.Available(); err != nil {
+		t.Errorf("Target is not available: %v", err)
+	}
+
+	if n := s.count("/rest/ping"); n != 1 {
+		t.Errorf("Pings do not match: %d vs %d", n, 1)
+	}
+
+	ts.Close()
+	if err := target.Available(); !errors.Is(err, autoscan.ErrTargetUnavailable) {
+		t.Errorf("Errors do not match: %v vs %v", err, autoscan.ErrTargetUnavailable)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	_, ts := newServer()
+	defer ts.Close()
+
+	target, err := New(Config{URL: ts.URL, User: "navidrome", Pass: "wrong"})
+	if err != nil {
+		t.Fatalf("Could not create Navidrome Target: %v", err)
+	}
+
+	if err := target.Scan(context.Background(), autoscan.Scan{Folder: "/music/Blink-182"}); !errors.Is(err, autoscan.ErrFatal) {
+		t.Errorf("Errors do not match: %v vs %v", err, autoscan.ErrFatal)
+	}
+
+	if _, err := New(Config{URL: ts.URL, User: "navidrome"}); !errors.Is(err, autoscan.ErrFatal) {
+		t.Errorf("Errors do not match: %v vs %v", err, autoscan.ErrFatal)
+	}
+}
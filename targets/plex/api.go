@@ -1,11 +1,14 @@
 package plex
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
+	"path"
 	"strconv"
+	"strings"
 
 	"github.com/rs/zerolog"
 
@@ -90,6 +93,7 @@ func (c apiClient) Version() (string, error) {
 type library struct {
 	ID   int
 	Name string
+	Type string
 	Path string
 }
 
@@ -112,6 +116,7 @@ func (c apiClient) Libraries() ([]library, error) {
 			Libraries []struct {
 				ID       int    `json:"key,string"`
 				Name     string `json:"title"`
+				Type     string `json:"type"`
 				Sections []struct {
 					Path string `json:"path"`
 				} `json:"Location"`
@@ -138,6 +143,7 @@ func (c apiClient) Libraries() ([]library, error) {
 			libraries = append(libraries, library{
 				Name: lib.Name,
 				ID:   lib.ID,
+				Type: lib.Type,
 				Path: libPath,
 			})
 		}
@@ -146,16 +152,18 @@ func (c apiClient) Libraries() ([]library, error) {
 	return libraries, nil
 }
 
-func (c apiClient) Scan(path string, libraryID int) error {
+func (c apiClient) Scan(ctx context.Context, folder string, libraryID int) error {
 	reqURL := autoscan.JoinURL(c.baseURL, "library", "sections", strconv.Itoa(libraryID), "refresh")
-	req, err := http.NewRequest("GET", reqURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
 	if err != nil {
 		return fmt.Errorf("failed creating scan request: %v: %w", err, autoscan.ErrFatal)
 	}
 
-	q := url.Values{}
-	q.Add("path", path)
-	req.URL.RawQuery = q.Encode()
+	if folder != "" {
+		q := url.Values{}
+		q.Add("path", folder)
+		req.URL.RawQuery = q.Encode()
+	}
 
 	res, err := c.do(req)
 	if err != nil {
@@ -165,3 +173,116 @@ func (c apiClient) Scan(path string, libraryID int) error {
 	res.Body.Close()
 	return nil
 }
+
+// within returns whether p is the folder or is located within the folder.
+func within(p string, folder string) bool {
+	folder = strings.TrimRight(folder, "/")
+	return p == folder || strings.HasPrefix(p, folder+"/")
+}
+
+// Items returns the rating keys of the items of the library which are located within the folder,
+// or of which the folder is part, such as the show of a season folder.
+func (c apiClient) Items(ctx context.Context, folder string, libraryID int) ([]string, error) {
+	reqURL := autoscan.JoinURL(c.baseURL, "library", "sections", strconv.Itoa(libraryID), "all")
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating items request: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	res, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("items: %w", err)
+	}
+
+	defer res.Body.Close()
+
+	type Response struct {
+		MediaContainer struct {
+			Metadata []struct {
+				RatingKey string `json:"ratingKey"`
+				Location  []struct {
+					Path string `json:"path"`
+				} `json:"Location"`
+				Media []struct {
+					Part []struct {
+						File string `json:"file"`
+					} `json:"Part"`
+				} `json:"Media"`
+			} `json:"Metadata"`
+		} `json:"MediaContainer"`
+	}
+
+	resp := new(Response)
+	if err := json.NewDecoder(res.Body).Decode(resp); err != nil {
+		return nil, fmt.Errorf("failed decoding items response: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	keys := make([]string, 0)
+	for _, item := range resp.MediaContainer.Metadata {
+		matches := false
+
+		// shows are located in a folder
+		for _, location := range item.Location {
+			if within(location.Path, folder) || within(folder, location.Path) {
+				matches = true
+			}
+		}
+
+		// movies consist of files
+		for _, media := range item.Media {
+			for _, part := range media.Part {
+				if within(path.Dir(part.File), folder) {
+					matches = true
+				}
+			}
+		}
+
+		if matches {
+			keys = append(keys, item.RatingKey)
+		}
+	}
+
+	return keys, nil
+}
+
+// Refresh requests a metadata refresh of the item.
+func (c apiClient) Refresh(ctx context.Context, ratingKey string) error {
+	reqURL := autoscan.JoinURL(c.baseURL, "library", "metadata", ratingKey, "refresh")
+	req, err := http.NewRequestWithContext(ctx, "PUT", reqURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed creating refresh request: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	res, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("refresh: %w", err)
+	}
+
+	res.Body.Close()
+	return nil
+}
+
+// Analyze requests the media analysis of the item.
+func (c apiClient) Analyze(ctx context.Context, ratingKey string) error {
+	return c.put(ctx, "analyze", autoscan.JoinURL(c.baseURL, "library", "metadata", ratingKey, "analyze"))
+}
+
+// AnalyzeSection requests the media analysis of the entire section.
+func (c apiClient) AnalyzeSection(ctx context.Context, libraryID int) error {
+	return c.put(ctx, "analyze", autoscan.JoinURL(c.baseURL, "library", "sections", strconv.Itoa(libraryID), "analyze"))
+}
+
+func (c apiClient) put(ctx context.Context, name string, reqURL string) error {
+	req, err := http.NewRequestWithContext(ctx, "PUT", reqURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed creating %s request: %v: %w", name, err, autoscan.ErrFatal)
+	}
+
+	res, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	res.Body.Close()
+	return nil
+}
@@ -1,9 +1,12 @@
 package plex
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog"
 
@@ -13,14 +16,34 @@ import (
 type Config struct {
 	URL       string             `yaml:"url"`
 	Token     string             `yaml:"token"`
+	ReadyPath string             `yaml:"ready-path"`
 	Rewrite   []autoscan.Rewrite `yaml:"rewrite"`
 	Verbosity string             `yaml:"verbosity"`
+
+	// PartialScan scopes the scan to the folder instead of the entire section, enabled when not set.
+	PartialScan *bool `yaml:"partial-scan"`
+
+	// RefreshMetadata refreshes the metadata of the items within the folder after scanning it.
+	RefreshMetadata bool `yaml:"refresh-metadata"`
+
+	// Analyze analyzes the media of the items within the folder after scanning it,
+	// or the entire section when the folder does not contain any items yet.
+	Analyze bool `yaml:"analyze"`
+
+	// Tautulli defers scans while media is being played, for at most MaxDefer.
+	Tautulli TautulliConfig `yaml:"tautulli"`
+	MaxDefer time.Duration  `yaml:"max-defer"`
 }
 
 type target struct {
-	url       string
-	token     string
-	libraries []library
+	url         string
+	token       string
+	readyPath   string
+	libraries   []library
+	partialScan bool
+	refresh     bool
+	analyze     bool
+	playback    *autoscan.PlaybackGuard
 
 	log     zerolog.Logger
 	rewrite autoscan.Rewriter
@@ -58,10 +81,31 @@ func New(c Config) (autoscan.Target, error) {
 		Interface("libraries", libraries).
 		Msg("Retrieved libraries")
 
+	partialScan := true
+	if c.PartialScan != nil {
+		partialScan = *c.PartialScan
+	}
+
+	var playback *autoscan.PlaybackGuard
+	if c.Tautulli.URL != "" {
+		t := tautulli{
+			client: &http.Client{},
+			url:    c.Tautulli.URL,
+			apiKey: c.Tautulli.APIKey,
+		}
+
+		playback = autoscan.NewPlaybackGuard(t.Active, c.MaxDefer, l)
+	}
+
 	return &target{
-		url:       c.URL,
-		token:     c.Token,
-		libraries: libraries,
+		url:         c.URL,
+		token:       c.Token,
+		readyPath:   c.ReadyPath,
+		libraries:   libraries,
+		partialScan: partialScan,
+		refresh:     c.RefreshMetadata,
+		analyze:     c.Analyze,
+		playback:    playback,
 
 		log:     l,
 		rewrite: rewriter,
@@ -69,12 +113,49 @@ func New(c Config) (autoscan.Target, error) {
 	}, nil
 }
 
+func (t target) String() string {
+	return fmt.Sprintf("plex: %s", t.url)
+}
+
 func (t target) Available() error {
 	_, err := t.api.Version()
 	return err
 }
 
-func (t target) Scan(scan autoscan.Scan) error {
+// Libraries retrieves the current sections of Plex.
+func (t target) Libraries(ctx context.Context) ([]autoscan.Library, error) {
+	libraries, err := t.api.Libraries()
+	if err != nil {
+		return nil, err
+	}
+
+	// a section with multiple locations is listed once per location.
+	result := make([]autoscan.Library, 0)
+	for _, lib := range libraries {
+		if n := len(result); n > 0 && result[n-1].Name == lib.Name {
+			result[n-1].Paths = append(result[n-1].Paths, lib.Path)
+			continue
+		}
+
+		result = append(result, autoscan.Library{
+			Name:  lib.Name,
+			Type:  lib.Type,
+			Paths: []string{lib.Path},
+		})
+	}
+
+	return result, nil
+}
+
+func (t target) Scan(ctx context.Context, scan autoscan.Scan) error {
+	if err := autoscan.CheckReadyPath(t.readyPath); err != nil {
+		return err
+	}
+
+	if err := t.playback.Check(ctx); err != nil {
+		return err
+	}
+
 	// determine library for this scan
 	scanFolder := t.rewrite(scan.Folder)
 
@@ -82,30 +163,100 @@ func (t target) Scan(scan autoscan.Scan) error {
 	if err != nil {
 		t.log.Warn().
 			Err(err).
+			Str("id", scan.ID).
 			Msg("No target libraries found")
 
 		return nil
 	}
 
+	// an empty path scans the entire section
+	scanPath := scanFolder
+	if !t.partialScan {
+		scanPath = ""
+	}
+
 	// send scan request
 	for _, lib := range libs {
 		l := t.log.With().
+			Str("id", scan.ID).
 			Str("path", scanFolder).
 			Str("library", lib.Name).
 			Logger()
 
 		l.Trace().Msg("Sending scan request")
 
-		if err := t.api.Scan(scanFolder, lib.ID); err != nil {
+		if err := t.api.Scan(ctx, scanPath, lib.ID); err != nil {
 			return err
 		}
 
 		l.Info().Msg("Scan moved to target")
+
+		if t.refresh || t.analyze {
+			t.afterScan(ctx, l, scanFolder, lib.ID)
+		}
 	}
 
 	return nil
 }
 
+// afterScan refreshes and analyzes the items within the folder.
+// Both are best-effort, failures do not fail the scan.
+func (t target) afterScan(ctx context.Context, l zerolog.Logger, folder string, libraryID int) {
+	keys, err := t.api.Items(ctx, folder, libraryID)
+	if err != nil {
+		l.Warn().
+			Err(err).
+			Msg("Failed determining items within folder")
+		return
+	}
+
+	if t.refresh {
+		for _, key := range keys {
+			if err := t.api.Refresh(ctx, key); err != nil {
+				l.Warn().
+					Err(err).
+					Str("item", key).
+					Msg("Failed refreshing metadata")
+				continue
+			}
+
+			l.Debug().
+				Str("item", key).
+				Msg("Metadata refresh requested")
+		}
+	}
+
+	if !t.analyze {
+		return
+	}
+
+	if len(keys) == 0 {
+		if err := t.api.AnalyzeSection(ctx, libraryID); err != nil {
+			l.Warn().
+				Err(err).
+				Msg("Failed analyzing section")
+			return
+		}
+
+		l.Debug().Msg("Section analysis requested")
+		return
+	}
+
+	for _, key := range keys {
+		if err := t.api.Analyze(ctx, key); err != nil {
+			l.Warn().
+				Err(err).
+				Str("item", key).
+				Msg("Failed analyzing item")
+			continue
+		}
+
+		l.Debug().
+			Str("item", key).
+			Msg("Analysis requested")
+	}
+}
+
 func (t target) getScanLibrary(folder string) ([]library, error) {
 	libraries := make([]library, 0)
 
@@ -0,0 +1,275 @@
+package plex
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/cloudbox/autoscan"
+)
+
+type server struct {
+	lock     sync.Mutex
+	requests []string
+}
+
+func (s *server) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Plex-Token") != "token" {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	fixtures := map[string]string{
+		"/":                       "testdata/identity.json",
+		"/library/sections":       "testdata/sections.json",
+		"/library/sections/1/all": "testdata/movies.json",
+		"/library/sections/2/all": "testdata/shows.json",
+		"/library/sections/3/all": "testdata/shows.json",
+	}
+
+	if fixture, ok := fixtures[r.URL.Path]; ok {
+		b, err := os.ReadFile(fixture)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		_, _ = rw.Write(b)
+		return
+	}
+
+	s.lock.Lock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.RequestURI())
+	s.lock.Unlock()
+}
+
+func TestScan(t *testing.T) {
+	type Given struct {
+		PartialScan     *bool
+		RefreshMetadata bool
+		Analyze         bool
+		Folder          string
+	}
+
+	type Expected struct {
+		Requests []string
+	}
+
+	type Test struct {
+		Name     string
+		Given    Given
+		Expected Expected
+	}
+
+	disabled := false
+
+	var testCases = []Test{
+		{
+			"Scans the folder within its section",
+			Given{
+				Folder: "/data/Movies/Parasite (2019)",
+			},
+			Expected{
+				Requests: []string{
+					"GET /library/sections/1/refresh?path=%2Fdata%2FMovies%2FParasite+%282019%29",
+				},
+			},
+		},
+		{
+			"Scans the folder within every matching section",
+			Given{
+				Folder: "/data/TV/Westworld/Season 1",
+			},
+			Expected{
+				Requests: []string{
+					"GET /library/sections/2/refresh?path=%2Fdata%2FTV%2FWestworld%2FSeason+1",
+					"GET /library/sections/3/refresh?path=%2Fdata%2FTV%2FWestworld%2FSeason+1",
+				},
+			},
+		},
+		{
+			"Scans the entire section when partial scans are disabled",
+			Given{
+				PartialScan: &disabled,
+				Folder:      "/data/Movies/Parasite (2019)",
+			},
+			Expected{
+				Requests: []string{
+					"GET /library/sections/1/refresh",
+				},
+			},
+		},
+		{
+			"Refreshes the metadata of the movie after scanning it",
+			Given{
+				RefreshMetadata: true,
+				Folder:          "/data/Movies/Parasite (2019)",
+			},
+			Expected{
+				Requests: []string{
+					"GET /library/sections/1/refresh?path=%2Fdata%2FMovies%2FParasite+%282019%29",
+					"PUT /library/metadata/1001/refresh",
+				},
+			},
+		},
+		{
+			"Refreshes the metadata of the show of a season folder",
+			Given{
+				RefreshMetadata: true,
+				PartialScan:     &disabled,
+				Folder:          "/data/TV/Westworld/Season 1",
+			},
+			Expected{
+				Requests: []string{
+					"GET /library/sections/2/refresh",
+					"PUT /library/metadata/1101/refresh",
+					"GET /library/sections/3/refresh",
+					"PUT /library/metadata/1101/refresh",
+				},
+			},
+		},
+		{
+			"Analyzes the movie after scanning it",
+			Given{
+				Analyze:         true,
+				RefreshMetadata: true,
+				Folder:          "/data/Movies/Parasite (2019)",
+			},
+			Expected{
+				Requests: []string{
+					"GET /library/sections/1/refresh?path=%2Fdata%2FMovies%2FParasite+%282019%29",
+					"PUT /library/metadata/1001/refresh",
+					"PUT /library/metadata/1001/analyze",
+				},
+			},
+		},
+		{
+			"Analyzes the section when the folder has no items yet",
+			Given{
+				Analyze: true,
+				Folder:  "/data/Movies/Dune (2021)",
+			},
+			Expected{
+				Requests: []string{
+					"GET /library/sections/1/refresh?path=%2Fdata%2FMovies%2FDune+%282021%29",
+					"PUT /library/sections/1/analyze",
+				},
+			},
+		},
+		{
+			"Ignores folders outside of the sections",
+			Given{
+				Folder: "/data/Music/Blink-182",
+			},
+			Expected{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			target, err := New(Config{
+				URL:             ts.URL,
+				Token:           "token",
+				PartialScan:     tc.Given.PartialScan,
+				RefreshMetadata: tc.Given.RefreshMetadata,
+				Analyze:         tc.Given.Analyze,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Plex Target: %v", err)
+			}
+
+			err = target.Scan(context.Background(), autoscan.Scan{Folder: tc.Given.Folder})
+			if err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(s.requests, tc.Expected.Requests) {
+				t.Logf("want: %v", tc.Expected.Requests)
+				t.Logf("got:  %v", s.requests)
+				t.Errorf("Requests do not match")
+			}
+		})
+	}
+}
+
+func TestPlayback(t *testing.T) {
+	type Test struct {
+		Name     string
+		Activity string
+		WantErr  error
+		Requests []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:     "Defers scans while playing",
+			Activity: `{"response": {"result": "success", "message": null, "data": {"stream_count": "2", "sessions": [{"state": "paused"}, {"state": "playing"}]}}}`,
+			WantErr:  autoscan.ErrTargetNotReady,
+		},
+		{
+			Name:     "Scans while all streams are paused",
+			Activity: `{"response": {"result": "success", "message": null, "data": {"stream_count": "1", "sessions": [{"state": "paused"}]}}}`,
+			Requests: []string{"GET /library/sections/1/refresh?path=%2Fdata%2FMovies%2FParasite+%282019%29"},
+		},
+		{
+			Name:     "Scans while idle",
+			Activity: `{"response": {"result": "success", "message": null, "data": {"stream_count": "0", "sessions": []}}}`,
+			Requests: []string{"GET /library/sections/1/refresh?path=%2Fdata%2FMovies%2FParasite+%282019%29"},
+		},
+		{
+			Name:     "Scans when the activity is unknown",
+			Activity: `{"response": {"result": "error", "message": "Invalid apikey", "data": {}}}`,
+			Requests: []string{"GET /library/sections/1/refresh?path=%2Fdata%2FMovies%2FParasite+%282019%29"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := &server{}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			activity := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v2" || r.URL.Query().Get("cmd") != "get_activity" || r.URL.Query().Get("apikey") != "key" {
+					rw.WriteHeader(http.StatusBadRequest)
+					return
+				}
+
+				_, _ = rw.Write([]byte(tc.Activity))
+			}))
+			defer activity.Close()
+
+			target, err := New(Config{
+				URL:   ts.URL,
+				Token: "token",
+				Tautulli: TautulliConfig{
+					URL:    activity.URL,
+					APIKey: "key",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Could not create Plex Target: %v", err)
+			}
+
+			err = target.Scan(context.Background(), autoscan.Scan{Folder: "/data/Movies/Parasite (2019)"})
+			if !errors.Is(err, tc.WantErr) {
+				t.Errorf("Errors do not match: %v vs %v", err, tc.WantErr)
+			}
+
+			if !reflect.DeepEqual(s.requests, tc.Requests) {
+				t.Logf("want: %v", tc.Requests)
+				t.Logf("got:  %v", s.requests)
+				t.Errorf("Requests do not match")
+			}
+		})
+	}
+}
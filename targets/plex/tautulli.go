@@ -0,0 +1,83 @@
+package plex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/cloudbox/autoscan"
+)
+
+// TautulliConfig configures the Tautulli instance which monitors the Plex server.
+type TautulliConfig struct {
+	URL    string `yaml:"url"`
+	APIKey string `yaml:"api-key"`
+}
+
+type tautulli struct {
+	client *http.Client
+	url    string
+	apiKey string
+}
+
+// Active returns whether Tautulli reports any stream which is not paused.
+func (t tautulli) Active(ctx context.Context) (bool, error) {
+	reqURL := autoscan.JoinURL(t.url, "api", "v2")
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed creating activity request: %v", err)
+	}
+
+	q := url.Values{}
+	q.Add("apikey", t.apiKey)
+	q.Add("cmd", "get_activity")
+	req.URL.RawQuery = q.Encode()
+
+	res, err := t.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("activity: %v", err)
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("activity: %s", res.Status)
+	}
+
+	type Response struct {
+		Response struct {
+			Result  string `json:"result"`
+			Message string `json:"message"`
+			Data    struct {
+				StreamCount string `json:"stream_count"`
+				Sessions    []struct {
+					State string `json:"state"`
+				} `json:"sessions"`
+			} `json:"data"`
+		} `json:"response"`
+	}
+
+	resp := new(Response)
+	if err := json.NewDecoder(res.Body).Decode(resp); err != nil {
+		return false, fmt.Errorf("failed decoding activity response: %v", err)
+	}
+
+	if resp.Response.Result != "success" {
+		return false, fmt.Errorf("activity: %s", resp.Response.Message)
+	}
+
+	if count, _ := strconv.Atoi(resp.Response.Data.StreamCount); count == 0 {
+		return false, nil
+	}
+
+	for _, session := range resp.Response.Data.Sessions {
+		if session.State != "paused" {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
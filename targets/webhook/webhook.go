@@ -0,0 +1,178 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cloudbox/autoscan"
+)
+
+type Config struct {
+	Name      string             `yaml:"name"`
+	URL       string             `yaml:"url"`
+	Headers   map[string]string  `yaml:"headers"`
+	ReadyPath string             `yaml:"ready-path"`
+	Rewrite   []autoscan.Rewrite `yaml:"rewrite"`
+	Verbosity string             `yaml:"verbosity"`
+}
+
+// Events of the payload.
+const (
+	eventAdd    = "add"
+	eventDelete = "delete"
+)
+
+type payload struct {
+	Target    string    `json:"target"`
+	Folder    string    `json:"folder"`
+	Event     string    `json:"event"`
+	Priority  int       `json:"priority"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type target struct {
+	name      string
+	url       string
+	headers   map[string]string
+	readyPath string
+
+	client  *http.Client
+	log     zerolog.Logger
+	rewrite autoscan.Rewriter
+}
+
+// New creates a target which posts every scan as JSON to the configured URL.
+func New(c Config) (autoscan.Target, error) {
+	l := autoscan.GetLogger(c.Verbosity).With().
+		Str("target", "webhook").
+		Str("url", c.URL).
+		Logger()
+
+	if c.URL == "" {
+		return nil, fmt.Errorf("webhook target requires a url: %w", autoscan.ErrFatal)
+	}
+
+	rewriter, err := autoscan.NewRewriter(c.Rewrite)
+	if err != nil {
+		return nil, err
+	}
+
+	name := c.Name
+	if name == "" {
+		name = "webhook"
+	}
+
+	return &target{
+		name:      name,
+		url:       c.URL,
+		headers:   c.Headers,
+		readyPath: c.ReadyPath,
+
+		client:  &http.Client{},
+		log:     l,
+		rewrite: rewriter,
+	}, nil
+}
+
+func (t target) String() string {
+	return fmt.Sprintf("webhook: %s", t.url)
+}
+
+func (t target) do(req *http.Request) error {
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+
+	res, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%v: %w", err, autoscan.ErrTargetUnavailable)
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+
+	t.log.Trace().
+		Stringer("request_url", res.Request.URL).
+		Int("response_status", res.StatusCode).
+		Msg("Request failed")
+
+	switch res.StatusCode {
+	case 401, 403:
+		return fmt.Errorf("invalid webhook headers: %s: %w", res.Status, autoscan.ErrFatal)
+	default:
+		// any other failure is retried
+		return fmt.Errorf("%s: %w", res.Status, autoscan.ErrTargetUnavailable)
+	}
+}
+
+// Available checks whether the URL can be reached, any response is fine.
+func (t target) Available() error {
+	req, err := http.NewRequest("HEAD", t.url, nil)
+	if err != nil {
+		return fmt.Errorf("failed creating availability request: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	res, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("availability: %v: %w", err, autoscan.ErrTargetUnavailable)
+	}
+
+	res.Body.Close()
+	return nil
+}
+
+func (t target) Scan(ctx context.Context, scan autoscan.Scan) error {
+	if err := autoscan.CheckReadyPath(t.readyPath); err != nil {
+		return err
+	}
+
+	scanFolder := t.rewrite(scan.Folder)
+
+	event := eventAdd
+	if scan.Removed {
+		event = eventDelete
+	}
+
+	b, err := json.Marshal(payload{
+		Target:    t.name,
+		Folder:    scanFolder,
+		Event:     event,
+		Priority:  scan.Priority,
+		Timestamp: scan.Time,
+	})
+	if err != nil {
+		return fmt.Errorf("failed encoding scan request payload: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", t.url, bytes.NewBuffer(b))
+	if err != nil {
+		return fmt.Errorf("failed creating scan request: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	l := t.log.With().
+		Str("id", scan.ID).
+		Str("path", scanFolder).
+		Str("event", event).
+		Logger()
+
+	// send scan request
+	l.Trace().Msg("Sending scan request")
+
+	if err := t.do(req); err != nil {
+		return fmt.Errorf("scan: %w", err)
+	}
+
+	l.Info().Msg("Scan moved to target")
+	return nil
+}
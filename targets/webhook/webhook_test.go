@@ -0,0 +1,164 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cloudbox/autoscan"
+)
+
+func TestScan(t *testing.T) {
+	type Given struct {
+		Scan   autoscan.Scan
+		Status int
+	}
+
+	type Expected struct {
+		Payload payload
+		Err     error
+	}
+
+	type Test struct {
+		Name     string
+		Given    Given
+		Expected Expected
+	}
+
+	scanTime := time.Date(2021, 3, 14, 15, 9, 26, 0, time.UTC)
+
+	var testCases = []Test{
+		{
+			"Posts the fields of the scan",
+			Given{
+				Scan:   autoscan.Scan{Folder: "/mnt/unionfs/Media/Movies/Parasite (2019)", Priority: 5, Time: scanTime},
+				Status: 204,
+			},
+			Expected{
+				Payload: payload{
+					Target:    "scripts",
+					Folder:    "/data/Movies/Parasite (2019)",
+					Event:     "add",
+					Priority:  5,
+					Timestamp: scanTime,
+				},
+			},
+		},
+		{
+			"Posts removed folders as delete events",
+			Given{
+				Scan:   autoscan.Scan{Folder: "/mnt/unionfs/Media/Movies/Parasite (2019)", Time: scanTime, Removed: true},
+				Status: 200,
+			},
+			Expected{
+				Payload: payload{
+					Target:    "scripts",
+					Folder:    "/data/Movies/Parasite (2019)",
+					Event:     "delete",
+					Timestamp: scanTime,
+				},
+			},
+		},
+		{
+			"Retries on server errors",
+			Given{
+				Scan:   autoscan.Scan{Folder: "/mnt/unionfs/Media/Movies/Parasite (2019)", Time: scanTime},
+				Status: 502,
+			},
+			Expected{
+				Payload: payload{
+					Target:    "scripts",
+					Folder:    "/data/Movies/Parasite (2019)",
+					Event:     "add",
+					Timestamp: scanTime,
+				},
+				Err: autoscan.ErrTargetUnavailable,
+			},
+		},
+		{
+			"Returns fatal error when unauthorised",
+			Given{
+				Scan:   autoscan.Scan{Folder: "/mnt/unionfs/Media/Movies/Parasite (2019)", Time: scanTime},
+				Status: 401,
+			},
+			Expected{
+				Payload: payload{
+					Target:    "scripts",
+					Folder:    "/data/Movies/Parasite (2019)",
+					Event:     "add",
+					Timestamp: scanTime,
+				},
+				Err: autoscan.ErrFatal,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			var received payload
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer token" || r.Header.Get("Content-Type") != "application/json" {
+					rw.WriteHeader(http.StatusBadRequest)
+					return
+				}
+
+				if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+					rw.WriteHeader(http.StatusBadRequest)
+					return
+				}
+
+				rw.WriteHeader(tc.Given.Status)
+			}))
+			defer server.Close()
+
+			target, err := New(Config{
+				Name:    "scripts",
+				URL:     server.URL,
+				Headers: map[string]string{"Authorization": "Bearer token"},
+				Rewrite: []autoscan.Rewrite{{
+					From: "^/mnt/unionfs/Media/",
+					To:   "/data/",
+				}},
+			})
+			if err != nil {
+				t.Fatalf("Could not create Webhook Target: %v", err)
+			}
+
+			err = target.Scan(context.Background(), tc.Given.Scan)
+			if !errors.Is(err, tc.Expected.Err) {
+				t.Errorf("Errors do not match: %v vs %v", err, tc.Expected.Err)
+			}
+
+			if !reflect.DeepEqual(received, tc.Expected.Payload) {
+				t.Logf("want: %v", tc.Expected.Payload)
+				t.Logf("got:  %v", received)
+				t.Errorf("Payloads do not match")
+			}
+		})
+	}
+}
+
+func TestAvailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+
+	target, err := New(Config{URL: server.URL})
+	if err != nil {
+		t.Fatalf("Could not create Webhook Target: %v", err)
+	}
+
+	if err := target.Available(); err != nil {
+		t.Errorf("Target is not available: %v", err)
+	}
+
+	server.Close()
+	if err := target.Available(); !errors.Is(err, autoscan.ErrTargetUnavailable) {
+		t.Errorf("Errors do not match: %v vs %v", err, autoscan.ErrTargetUnavailable)
+	}
+}
@@ -17,10 +17,12 @@ type Drive struct {
 }
 
 type Config struct {
-	Drives    []Drive            `yaml:"drives"`
-	Priority  int                `yaml:"priority"`
-	Rewrite   []autoscan.Rewrite `yaml:"rewrite"`
-	Verbosity string             `yaml:"verbosity"`
+	Drives       []Drive            `yaml:"drives"`
+	Priority     int                `yaml:"priority"`
+	Rewrite      []autoscan.Rewrite `yaml:"rewrite"`
+	Verbosity    string             `yaml:"verbosity"`
+	AllowedCIDRs []string           `yaml:"allowed-cidrs"`
+	TrustProxy   bool               `yaml:"trust-proxy"`
 }
 
 type ATrainRewriter = func(drive string, input string) string
@@ -51,12 +53,17 @@ func New(c Config) (autoscan.HTTPTrigger, error) {
 		return driveRewriter(input)
 	}
 
+	allow, err := autoscan.NewAllowlist(c.AllowedCIDRs, c.TrustProxy)
+	if err != nil {
+		return nil, err
+	}
+
 	trigger := func(callback autoscan.ProcessorFunc) http.Handler {
-		return handler{
+		return allow(handler{
 			callback: callback,
 			priority: c.Priority,
 			rewrite:  rewriter,
-		}
+		})
 	}
 
 	return trigger, nil
@@ -115,7 +122,7 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	}
 
 	for _, scan := range scans {
-		rlog.Info().Str("path", scan.Folder).Msg("Scan moved to processor")
+		rlog.Info().Str("id", scan.ID).Str("path", scan.Folder).Msg("Scan moved to processor")
 	}
 
 	rw.WriteHeader(http.StatusOK)
@@ -4,12 +4,12 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"net/http"
 	"path/filepath"
 	"time"
 
 	lowe "github.com/l3uddz/bernard"
 	ds "github.com/l3uddz/bernard/datastore"
-	"github.com/l3uddz/bernard/datastore/sqlite"
 	"github.com/m-rots/stubbs"
 	"github.com/robfig/cron/v3"
 	"github.com/rs/zerolog"
@@ -50,7 +50,7 @@ func New(c Config, db *sql.DB) (autoscan.Trigger, error) {
 		return nil, fmt.Errorf("%v: %w", err, autoscan.ErrFatal)
 	}
 
-	store, err := sqlite.FromDB(db)
+	store, err := openDatastore(db)
 	if err != nil {
 		return nil, fmt.Errorf("%v: %w", err, autoscan.ErrFatal)
 	}
@@ -60,6 +60,13 @@ func New(c Config, db *sql.DB) (autoscan.Trigger, error) {
 		return nil, fmt.Errorf("%v: %w", err, autoscan.ErrFatal)
 	}
 
+	tokens := pageTokens{
+		auth:    auth,
+		baseURL: driveURL,
+		client:  &http.Client{Timeout: 30 * time.Second},
+		wait:    limiter.Wait,
+	}
+
 	bernard := lowe.New(auth, store,
 		lowe.WithPreRequestHook(limiter.Wait),
 		lowe.WithSafeSleep(120*time.Second))
@@ -101,6 +108,7 @@ func New(c Config, db *sql.DB) (autoscan.Trigger, error) {
 			priority:     c.Priority,
 			drives:       drives,
 			bernard:      bernard,
+			tokens:       tokens,
 			store:        &bds{store},
 			limiter:      limiter,
 		}
@@ -130,6 +138,7 @@ type daemon struct {
 	priority     int
 	drives       []drive
 	bernard      *lowe.Bernard
+	tokens       pageTokens
 	store        *bds
 	log          zerolog.Logger
 	limiter      *rateLimiter
@@ -258,6 +267,13 @@ func (d daemon) startAutoSync() error {
 
 			// do partial sync
 			err := d.bernard.PartialSync(drive.ID, dh, ph, ch)
+			if isExpiredPageToken(err) {
+				l.Warn().
+					Err(err).
+					Msg("Page token expired, changes since the last sync may have been missed")
+				return d.resetPageToken(drive.ID, l)
+			}
+
 			if err != nil {
 				return fmt.Errorf("%v: performing partial sync: %w", drive.ID, err)
 			}
@@ -286,6 +302,13 @@ func (d daemon) startAutoSync() error {
 					Int("added", task.added).
 					Int("removed", task.removed).
 					Msg("Scan moved to processor")
+
+				for _, scan := range task.scans {
+					l.Debug().
+						Str("id", scan.ID).
+						Str("path", scan.Folder).
+						Msg("Scan moved to processor")
+				}
 			}
 
 			return nil
@@ -303,6 +326,24 @@ func (d daemon) startAutoSync() error {
 	return nil
 }
 
+// resetPageToken continues the changes feed of the drive from a fresh start page token.
+func (d daemon) resetPageToken(driveID string, l zerolog.Logger) error {
+	token, err := d.tokens.StartPageToken(driveID)
+	if err != nil {
+		return fmt.Errorf("%v: requesting start page token: %w", driveID, err)
+	}
+
+	if err := d.store.SetPageToken(driveID, token); err != nil {
+		return fmt.Errorf("%v: storing start page token: %v: %w", driveID, err, autoscan.ErrFatal)
+	}
+
+	l.Info().
+		Str("page_token", token).
+		Msg("Continuing from a fresh start page token")
+
+	return nil
+}
+
 type scanTask struct {
 	scans   []autoscan.Scan
 	added   int
@@ -2,17 +2,42 @@ package bernard
 
 import (
 	"database/sql"
+	"embed"
 	"errors"
 	"fmt"
 
 	"github.com/l3uddz/bernard/datastore"
 	"github.com/l3uddz/bernard/datastore/sqlite"
+
+	"github.com/cloudbox/autoscan/migrate"
 )
 
 type bds struct {
 	*sqlite.Datastore
 }
 
+var (
+	// copies of the migrations of bernard's sqlite datastore.
+	//go:embed migrations
+	migrations embed.FS
+)
+
+// openDatastore applies the migrations of bernard in order before handing the database to bernard.
+// bernard applies them in map order, so on a fresh database the second migration may run first and fail.
+// Once recorded under the bernard component, bernard itself skips them.
+func openDatastore(db *sql.DB) (*sqlite.Datastore, error) {
+	mg, err := migrate.New(db, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+
+	if err := mg.Migrate(&migrations, "bernard"); err != nil {
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+
+	return sqlite.FromDB(db)
+}
+
 const sqlSelectFile = `SELECT id, name, parent, size, md5, trashed FROM file WHERE drive = $1 AND id = $2 LIMIT 1`
 
 func (d *bds) GetFile(driveID string, fileID string) (*datastore.File, error) {
@@ -72,3 +97,18 @@ func (d *bds) GetDrive(driveID string) (*datastore.Drive, error) {
 
 	return drv, nil
 }
+
+const sqlUpdatePageToken = `UPDATE drive SET pageToken = $1 WHERE id = $2`
+
+func (d *bds) SetPageToken(driveID string, pageToken string) error {
+	res, err := d.DB.Exec(sqlUpdatePageToken, pageToken, driveID)
+	if err != nil {
+		return fmt.Errorf("%v: updating page token: %w", driveID, err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%v: drive not found: %w", driveID, sql.ErrNoRows)
+	}
+
+	return nil
+}
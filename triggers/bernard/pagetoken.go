@@ -0,0 +1,81 @@
+package bernard
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	lowe "github.com/l3uddz/bernard"
+)
+
+const driveURL = "https://www.googleapis.com/drive/v3"
+
+type authenticator interface {
+	AccessToken() (string, int64, error)
+}
+
+// pageTokens retrieves fresh start page tokens from the Drive API.
+type pageTokens struct {
+	auth    authenticator
+	baseURL string
+	client  *http.Client
+	wait    func()
+}
+
+func (p pageTokens) StartPageToken(driveID string) (string, error) {
+	req, err := http.NewRequest("GET", p.baseURL+"/changes/startPageToken", nil)
+	if err != nil {
+		return "", fmt.Errorf("failed creating start page token request: %w", err)
+	}
+
+	q := url.Values{}
+	q.Add("driveId", driveID)
+	q.Add("supportsAllDrives", "true")
+	req.URL.RawQuery = q.Encode()
+
+	token, _, err := p.auth.AccessToken()
+	if err != nil {
+		return "", fmt.Errorf("%v: %w", err, lowe.ErrInvalidCredentials)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	if p.wait != nil {
+		p.wait()
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%v: %w", err, lowe.ErrNetwork)
+	}
+
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+	case 401:
+		return "", lowe.ErrInvalidCredentials
+	default:
+		return "", fmt.Errorf("start page token: %s: %w", res.Status, lowe.ErrNetwork)
+	}
+
+	type Response struct {
+		StartPageToken string `json:"startPageToken"`
+	}
+
+	resp := new(Response)
+	if err := json.NewDecoder(res.Body).Decode(resp); err != nil || resp.StartPageToken == "" {
+		return "", fmt.Errorf("decoding start page token: %v: %w", err, lowe.ErrNetwork)
+	}
+
+	return resp.StartPageToken, nil
+}
+
+// isExpiredPageToken reports whether the changes feed rejected the stored page token.
+// Bernard does not expose the status code, so the error message of the Drive API is matched instead.
+func isExpiredPageToken(err error) bool {
+	return errors.Is(err, lowe.ErrNetwork) && strings.Contains(err.Error(), "Invalid Value")
+}
@@ -0,0 +1,195 @@
+package bernard
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	lowe "github.com/l3uddz/bernard"
+	ds "github.com/l3uddz/bernard/datastore"
+	"github.com/rs/zerolog"
+
+	// sqlite3 driver
+	_ "modernc.org/sqlite"
+)
+
+type staticAuth string
+
+func (a staticAuth) AccessToken() (string, int64, error) {
+	return string(a), 0, nil
+}
+
+func openStore(t *testing.T, path string) *bds {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	store, err := openDatastore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &bds{store}
+}
+
+func TestOpenDatastore(t *testing.T) {
+	// bernard's own map order fails on about one in seven fresh databases.
+	for i := 0; i < 100; i++ {
+		path := filepath.Join(t.TempDir(), "autoscan.db")
+		openStore(t, path)
+
+		// a database migrated before is reopened as is.
+		openStore(t, path)
+	}
+}
+
+func TestPageTokenPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "autoscan.db")
+
+	store := openStore(t, path)
+	if _, err := store.PageToken("drive"); !errors.Is(err, ds.ErrFullSync) {
+		t.Fatalf("Unknown drive should require a full sync: %v", err)
+	}
+
+	if err := store.FullSync(ds.Drive{ID: "drive", Name: "Media", PageToken: "100"}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.SetPageToken("drive", "200"); err != nil {
+		t.Fatal(err)
+	}
+
+	// reopen the datastore as if autoscan restarted
+	token, err := openStore(t, path).PageToken("drive")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token != "200" {
+		t.Errorf("Page tokens do not match: %s vs %s", token, "200")
+	}
+
+	if err := store.SetPageToken("unknown", "300"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Errors do not match: %v vs %v", err, sql.ErrNoRows)
+	}
+}
+
+func TestIsExpiredPageToken(t *testing.T) {
+	type Test struct {
+		Name string
+		Err  error
+		Want bool
+	}
+
+	var testCases = []Test{
+		{
+			Name: "Invalid page token",
+			Err:  fmt.Errorf("Invalid Value: %w", lowe.ErrNetwork),
+			Want: true,
+		},
+		{
+			Name: "Other network errors",
+			Err:  fmt.Errorf("Backend Error: %w", lowe.ErrNetwork),
+		},
+		{
+			Name: "Invalid credentials",
+			Err:  lowe.ErrInvalidCredentials,
+		},
+		{
+			Name: "No error",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			if got := isExpiredPageToken(tc.Err); got != tc.Want {
+				t.Errorf("Expired page token does not match: %v vs %v", got, tc.Want)
+			}
+		})
+	}
+}
+
+func TestResetPageToken(t *testing.T) {
+	type Test struct {
+		Name       string
+		StatusCode int
+		Body       string
+		WantToken  string
+		WantErr    error
+	}
+
+	var testCases = []Test{
+		{
+			Name:       "Stores the fresh start page token",
+			StatusCode: 200,
+			Body:       `{"kind": "drive#startPageToken", "startPageToken": "500"}`,
+			WantToken:  "500",
+		},
+		{
+			Name:       "Keeps the stored page token on failure",
+			StatusCode: 503,
+			WantToken:  "100",
+			WantErr:    lowe.ErrNetwork,
+		},
+		{
+			Name:       "Invalid credentials",
+			StatusCode: 401,
+			WantToken:  "100",
+			WantErr:    lowe.ErrInvalidCredentials,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/changes/startPageToken" || r.URL.Query().Get("driveId") != "drive" {
+					t.Errorf("Unexpected request: %s", r.URL)
+				}
+
+				if r.Header.Get("Authorization") != "Bearer token" {
+					t.Errorf("Unexpected authorization header: %s", r.Header.Get("Authorization"))
+				}
+
+				rw.WriteHeader(tc.StatusCode)
+				_, _ = rw.Write([]byte(tc.Body))
+			}))
+			defer server.Close()
+
+			store := openStore(t, filepath.Join(t.TempDir(), "autoscan.db"))
+			if err := store.FullSync(ds.Drive{ID: "drive", Name: "Media", PageToken: "100"}, nil, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			d := daemon{
+				store: store,
+				tokens: pageTokens{
+					auth:    staticAuth("token"),
+					baseURL: server.URL,
+					client:  server.Client(),
+				},
+			}
+
+			err := d.resetPageToken("drive", zerolog.Nop())
+			if !errors.Is(err, tc.WantErr) {
+				t.Errorf("Errors do not match: %v vs %v", err, tc.WantErr)
+			}
+
+			token, err := store.PageToken("drive")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if token != tc.WantToken {
+				t.Errorf("Page tokens do not match: %s vs %s", token, tc.WantToken)
+			}
+		})
+	}
+}
@@ -1,11 +1,13 @@
 package inotify
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -20,6 +22,7 @@ type Config struct {
 	Rewrite   []autoscan.Rewrite `yaml:"rewrite"`
 	Include   []string           `yaml:"include"`
 	Exclude   []string           `yaml:"exclude"`
+	Debounce  time.Duration      `yaml:"debounce"`
 	Paths     []struct {
 		Path    string             `yaml:"path"`
 		Rewrite []autoscan.Rewrite `yaml:"rewrite"`
@@ -32,10 +35,14 @@ type daemon struct {
 	callback autoscan.ProcessorFunc
 	paths    []path
 	watcher  *fsnotify.Watcher
+	watched  map[string]bool
 	queue    *queue
 	log      zerolog.Logger
 }
 
+// defaultDebounce is the time a directory must go quiet before it is scanned.
+const defaultDebounce = 10 * time.Second
+
 type path struct {
 	Path     string
 	Rewriter autoscan.Rewriter
@@ -68,12 +75,18 @@ func New(c Config) (autoscan.Trigger, error) {
 		})
 	}
 
+	debounce := c.Debounce
+	if debounce <= 0 {
+		debounce = defaultDebounce
+	}
+
 	trigger := func(callback autoscan.ProcessorFunc) {
 		d := daemon{
 			log:      l,
 			callback: callback,
 			paths:    paths,
-			queue:    newQueue(callback, l, c.Priority),
+			watched:  make(map[string]bool),
+			queue:    newQueue(callback, l, c.Priority, debounce),
 		}
 
 		// start job(s)
@@ -121,10 +134,19 @@ func (d *daemon) walkFunc(path string, fi os.FileInfo, err error) error {
 		return nil
 	}
 
+	if d.watched[path] {
+		return nil
+	}
+
 	if err := d.watcher.Add(path); err != nil {
+		if errors.Is(err, syscall.ENOSPC) {
+			return fmt.Errorf("watch directory: %v: inotify watch limit reached, raise fs.inotify.max_user_watches: %w", path, err)
+		}
+
 		return fmt.Errorf("watch directory: %v: %w", path, err)
 	}
 
+	d.watched[path] = true
 	d.log.Trace().
 		Str("path", path).
 		Msg("Watching directory")
@@ -132,6 +154,23 @@ func (d *daemon) walkFunc(path string, fi os.FileInfo, err error) error {
 	return nil
 }
 
+// unwatch stops watching a removed directory and all of its subdirectories.
+func (d *daemon) unwatch(dir string) {
+	for path := range d.watched {
+		if path != dir && !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			continue
+		}
+
+		// the watch of a deleted directory is already removed by the kernel
+		_ = d.watcher.Remove(path)
+		delete(d.watched, path)
+
+		d.log.Trace().
+			Str("path", path).
+			Msg("Stopped watching directory")
+	}
+}
+
 func (d *daemon) getPathObject(path string) (*path, error) {
 	for _, p := range d.paths {
 		if strings.HasPrefix(path, p.Path) {
@@ -149,167 +188,180 @@ func (d *daemon) worker() {
 	// process events
 	for {
 		select {
-		case event := <-d.watcher.Events:
-			// new filesystem event
-			d.log.Trace().
-				Interface("event", event).
-				Msg("Filesystem event")
-
-			switch {
-			case event.Op&fsnotify.Create == fsnotify.Create:
-				// create
-				fi, err := os.Stat(event.Name)
-				if err != nil {
-					d.log.Error().
-						Err(err).
-						Str("path", event.Name).
-						Msg("Failed retrieving filesystem info")
-					continue
-				}
-
-				// watch new directories
-				if fi.IsDir() {
-					if err := filepath.Walk(event.Name, d.walkFunc); err != nil {
-						d.log.Error().
-							Err(err).
-							Str("path", event.Name).
-							Msg("Failed watching new directory")
-					}
-
-					continue
-				}
-
-			case event.Op&fsnotify.Rename == fsnotify.Rename, event.Op&fsnotify.Remove == fsnotify.Remove:
-				// renamed / removed
-			default:
-				// ignore this event
-				continue
+		case event, ok := <-d.watcher.Events:
+			if !ok {
+				// watcher closed
+				return
+			}
+
+			d.handle(event)
+
+		case err, ok := <-d.watcher.Errors:
+			if !ok {
+				// watcher closed
+				return
 			}
 
-			// get path object
-			p, err := d.getPathObject(event.Name)
-			if err != nil {
+			d.log.Error().
+				Err(err).
+				Msg("Failed receiving filesystem events")
+		}
+	}
+}
+
+func (d *daemon) handle(event fsnotify.Event) {
+	// new filesystem event
+	d.log.Trace().
+		Interface("event", event).
+		Msg("Filesystem event")
+
+	isDir := false
+
+	switch {
+	case event.Op&fsnotify.Create == fsnotify.Create:
+		// create
+		fi, err := os.Stat(event.Name)
+		if err != nil {
+			d.log.Error().
+				Err(err).
+				Str("path", event.Name).
+				Msg("Failed retrieving filesystem info")
+			return
+		}
+
+		// watch new directories
+		if fi.IsDir() {
+			if err := filepath.Walk(event.Name, d.walkFunc); err != nil {
 				d.log.Error().
 					Err(err).
 					Str("path", event.Name).
-					Msg("Failed determining path object")
-				continue
+					Msg("Failed watching new directory")
 			}
 
-			// rewrite
-			rewritten := p.Rewriter(event.Name)
+			isDir = true
+		}
 
-			// filter
-			if !p.Allowed(rewritten) {
-				continue
-			}
+	case event.Op&fsnotify.Write == fsnotify.Write:
+		// written
+	case event.Op&fsnotify.Rename == fsnotify.Rename, event.Op&fsnotify.Remove == fsnotify.Remove:
+		// renamed / removed, the destination of a move is reported as create
+		d.unwatch(filepath.Clean(event.Name))
+	default:
+		// ignore this event
+		return
+	}
 
-			// get directory where path has an extension
-			if filepath.Ext(rewritten) != "" {
-				// there was most likely a file extension, use the directory
-				rewritten = filepath.Dir(rewritten)
-			}
+	// get path object
+	p, err := d.getPathObject(event.Name)
+	if err != nil {
+		d.log.Error().
+			Err(err).
+			Str("path", event.Name).
+			Msg("Failed determining path object")
+		return
+	}
 
-			// move to queue
-			d.queue.inputs <- rewritten
+	// rewrite
+	rewritten := p.Rewriter(event.Name)
 
-		case err := <-d.watcher.Errors:
-			d.log.Error().
-				Err(err).
-				Msg("Failed receiving filesystem events")
-		}
+	// filter
+	if !p.Allowed(rewritten) {
+		return
+	}
+
+	// scan created directories, otherwise the directory containing the path
+	file := ""
+	if !isDir {
+		file = rewritten
+		rewritten = filepath.Dir(rewritten)
 	}
+
+	// move to queue
+	d.queue.add(rewritten, file)
 }
 
+// queue debounces scans per directory.
+// A directory is moved to the processor once no events were received within the window.
 type queue struct {
 	callback autoscan.ProcessorFunc
 	log      zerolog.Logger
 	priority int
-	inputs   chan string
-	scans    map[string]time.Time
+	window   time.Duration
+	pending  map[string]*pending
 	lock     *sync.Mutex
 }
 
-func newQueue(cb autoscan.ProcessorFunc, log zerolog.Logger, priority int) *queue {
-	q := &queue{
+// pending is a debounced directory, file is empty unless a single file changed.
+type pending struct {
+	timer *time.Timer
+	file  string
+}
+
+func newQueue(cb autoscan.ProcessorFunc, log zerolog.Logger, priority int, window time.Duration) *queue {
+	return &queue{
 		callback: cb,
 		log:      log,
 		priority: priority,
-		inputs:   make(chan string),
-		scans:    make(map[string]time.Time),
+		window:   window,
+		pending:  make(map[string]*pending),
 		lock:     &sync.Mutex{},
 	}
-
-	go q.worker()
-
-	return q
 }
 
-func (q *queue) add(path string) {
+func (q *queue) add(path string, file string) {
+	path = filepath.Clean(path)
+
 	// acquire lock
 	q.lock.Lock()
 	defer q.lock.Unlock()
 
-	// queue scan task
-	q.scans[path] = time.Now().Add(10 * time.Second)
-}
+	// postpone the scan while the directory is busy
+	if p, ok := q.pending[path]; ok && p.timer.Stop() {
+		if p.file != file {
+			p.file = ""
+		}
 
-func (q *queue) worker() {
-	for {
-		select {
-		case path, ok := <-q.inputs:
-			if !ok {
-				// channel closed
-				return
-			}
+		p.timer.Reset(q.window)
+		return
+	}
 
-			// add path to queue
-			q.add(path)
+	p := &pending{file: file}
+	p.timer = time.AfterFunc(q.window, func() {
+		q.process(path, p)
+	})
 
-		default:
-			// process queue
-			q.process()
-		}
-	}
+	q.pending[path] = p
 }
 
-func (q *queue) process() {
+func (q *queue) process(path string, p *pending) {
 	// acquire lock
 	q.lock.Lock()
-	defer q.lock.Unlock()
-
-	// sleep if no scans queued
-	if len(q.scans) == 0 {
-		time.Sleep(100 * time.Millisecond)
-		return
+	if q.pending[path] == p {
+		delete(q.pending, path)
 	}
+	file := p.file
+	q.lock.Unlock()
 
-	// move scans to processor
-	for p, t := range q.scans {
-		// time has not elapsed
-		if time.Now().Before(t) {
-			continue
-		}
-
-		// move to processor
-		err := q.callback(autoscan.Scan{
-			Folder:   filepath.Clean(p),
-			Priority: q.priority,
-			Time:     time.Now(),
-		})
+	// move to processor, passed on as a slice to log the ID the processor assigns.
+	scans := []autoscan.Scan{{
+		Folder:   path,
+		Priority: q.priority,
+		Time:     time.Now(),
+		File:     file,
+	}}
 
-		if err != nil {
-			q.log.Error().
-				Err(err).
-				Str("path", p).
-				Msg("Failed moving scan to processor")
-		} else {
-			q.log.Info().
-				Str("path", p).
-				Msg("Scan moved to processor")
-		}
+	err := q.callback(scans...)
 
-		// remove queued scan
-		delete(q.scans, p)
+	if err != nil {
+		q.log.Error().
+			Err(err).
+			Str("path", path).
+			Msg("Failed moving scan to processor")
+		return
 	}
+
+	q.log.Info().
+		Str("id", scans[0].ID).
+		Str("path", path).
+		Msg("Scan moved to processor")
 }
@@ -0,0 +1,318 @@
+package inotify
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog"
+
+	"github.com/cloudbox/autoscan"
+)
+
+// recorder collects the folders moved to the processor.
+type recorder struct {
+	lock    sync.Mutex
+	folders []string
+	files   []string
+}
+
+func (r *recorder) callback(scans ...autoscan.Scan) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, scan := range scans {
+		r.folders = append(r.folders, scan.Folder)
+		r.files = append(r.files, scan.File)
+	}
+
+	return nil
+}
+
+func (r *recorder) Folders() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	folders := append([]string{}, r.folders...)
+	sort.Strings(folders)
+	return folders
+}
+
+func newTestDaemon(t *testing.T, root string, window time.Duration) (*daemon, *recorder) {
+	t.Helper()
+
+	rewriter, err := autoscan.NewRewriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filterer, err := autoscan.NewFilterer(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = watcher.Close() })
+
+	rec := &recorder{}
+	d := &daemon{
+		log:      zerolog.Nop(),
+		callback: rec.callback,
+		paths:    []path{{Path: root, Rewriter: rewriter, Allowed: filterer}},
+		watcher:  watcher,
+		watched:  make(map[string]bool),
+		queue:    newQueue(rec.callback, zerolog.Nop(), 0, window),
+	}
+
+	return d, rec
+}
+
+func TestDebounce(t *testing.T) {
+	type Test struct {
+		Name   string
+		Events func(root string) []fsnotify.Event
+		Want   func(root string) []string
+	}
+
+	var testCases = []Test{
+		{
+			Name: "Burst of writes results in a single scan",
+			Events: func(root string) []fsnotify.Event {
+				var events []fsnotify.Event
+				for i := 0; i < 50; i++ {
+					events = append(events, fsnotify.Event{
+						Name: filepath.Join(root, "Movies", "Interstellar (2014)", "Interstellar.mkv"),
+						Op:   fsnotify.Write,
+					})
+				}
+				return events
+			},
+			Want: func(root string) []string {
+				return []string{filepath.Join(root, "Movies", "Interstellar (2014)")}
+			},
+		},
+		{
+			Name: "Events are debounced per directory",
+			Events: func(root string) []fsnotify.Event {
+				return []fsnotify.Event{
+					{Name: filepath.Join(root, "Movies", "Interstellar (2014)", "Interstellar.mkv"), Op: fsnotify.Create},
+					{Name: filepath.Join(root, "Movies", "Parasite (2019)", "Parasite.mkv"), Op: fsnotify.Write},
+					{Name: filepath.Join(root, "Movies", "Interstellar (2014)", "Interstellar.mkv"), Op: fsnotify.Write},
+					{Name: filepath.Join(root, "Movies", "Parasite (2019)", "Parasite.mkv"), Op: fsnotify.Write},
+				}
+			},
+			Want: func(root string) []string {
+				return []string{
+					filepath.Join(root, "Movies", "Interstellar (2014)"),
+					filepath.Join(root, "Movies", "Parasite (2019)"),
+				}
+			},
+		},
+		{
+			Name: "Moves scan both the source and the destination directory",
+			Events: func(root string) []fsnotify.Event {
+				return []fsnotify.Event{
+					{Name: filepath.Join(root, "Downloads", "Parasite.mkv"), Op: fsnotify.Rename},
+					{Name: filepath.Join(root, "Movies", "Parasite (2019)", "Parasite.mkv"), Op: fsnotify.Create},
+				}
+			},
+			Want: func(root string) []string {
+				return []string{
+					filepath.Join(root, "Downloads"),
+					filepath.Join(root, "Movies", "Parasite (2019)"),
+				}
+			},
+		},
+		{
+			Name: "Created directories are scanned themselves",
+			Events: func(root string) []fsnotify.Event {
+				return []fsnotify.Event{
+					{Name: filepath.Join(root, "Movies", "Parasite (2019)"), Op: fsnotify.Create},
+					{Name: filepath.Join(root, "Movies", "Parasite (2019)", "Parasite.mkv"), Op: fsnotify.Create},
+				}
+			},
+			Want: func(root string) []string {
+				return []string{filepath.Join(root, "Movies", "Parasite (2019)")}
+			},
+		},
+		{
+			Name: "Ignores chmod events",
+			Events: func(root string) []fsnotify.Event {
+				return []fsnotify.Event{
+					{Name: filepath.Join(root, "Movies", "Parasite (2019)", "Parasite.mkv"), Op: fsnotify.Chmod},
+				}
+			},
+			Want: func(root string) []string {
+				return []string{}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			root := t.TempDir()
+			for _, file := range []string{
+				filepath.Join("Downloads", "Parasite.mkv"),
+				filepath.Join("Movies", "Interstellar (2014)", "Interstellar.mkv"),
+				filepath.Join("Movies", "Parasite (2019)", "Parasite.mkv"),
+			} {
+				if err := os.MkdirAll(filepath.Join(root, filepath.Dir(file)), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(root, file), nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			d, rec := newTestDaemon(t, root, 50*time.Millisecond)
+			for _, event := range tc.Events(root) {
+				d.handle(event)
+			}
+
+			time.Sleep(200 * time.Millisecond)
+
+			want := tc.Want(root)
+			if got := rec.Folders(); !reflect.DeepEqual(want, got) {
+				t.Logf("want: %v", want)
+				t.Logf("got:  %v", got)
+				t.Errorf("Scanned folders do not match")
+			}
+		})
+	}
+}
+
+func TestQueueWindow(t *testing.T) {
+	rec := &recorder{}
+	q := newQueue(rec.callback, zerolog.Nop(), 0, 100*time.Millisecond)
+
+	// keep the directory busy for longer than the window
+	for i := 0; i < 5; i++ {
+		q.add("/mnt/unionfs/Media/Movies/Parasite (2019)", "")
+		time.Sleep(40 * time.Millisecond)
+	}
+
+	if got := rec.Folders(); len(got) != 0 {
+		t.Fatalf("Scan was moved to the processor while the directory was busy: %v", got)
+	}
+
+	time.Sleep(250 * time.Millisecond)
+
+	want := []string{"/mnt/unionfs/Media/Movies/Parasite (2019)"}
+	if got := rec.Folders(); !reflect.DeepEqual(want, got) {
+		t.Logf("want: %v", want)
+		t.Logf("got:  %v", got)
+		t.Errorf("Scanned folders do not match")
+	}
+}
+
+func TestQueueFile(t *testing.T) {
+	type Test struct {
+		Name  string
+		Files []string
+		Want  string
+	}
+
+	folder := "/mnt/unionfs/Media/Movies/Parasite (2019)"
+	var testCases = []Test{
+		{
+			Name:  "Scan of a single changed file includes the file",
+			Files: []string{folder + "/Parasite.srt", folder + "/Parasite.srt"},
+			Want:  folder + "/Parasite.srt",
+		},
+		{
+			Name:  "Scan of several changed files does not include a file",
+			Files: []string{folder + "/Parasite.srt", folder + "/Parasite.mkv"},
+			Want:  "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			rec := &recorder{}
+			q := newQueue(rec.callback, zerolog.Nop(), 0, 50*time.Millisecond)
+			for _, file := range tc.Files {
+				q.add(folder, file)
+			}
+
+			time.Sleep(200 * time.Millisecond)
+
+			rec.lock.Lock()
+			defer rec.lock.Unlock()
+
+			if want := []string{tc.Want}; !reflect.DeepEqual(rec.files, want) {
+				t.Errorf("Files do not match: %q vs %q", rec.files, want)
+			}
+		})
+	}
+}
+
+func TestWatchNewDirectories(t *testing.T) {
+	root := t.TempDir()
+
+	d, rec := newTestDaemon(t, root, 50*time.Millisecond)
+	if err := filepath.Walk(root, d.walkFunc); err != nil {
+		t.Fatal(err)
+	}
+
+	go d.worker()
+
+	// create a nested directory after startup
+	season := filepath.Join(root, "Westworld", "Season 1")
+	if err := os.MkdirAll(season, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// wait for the watch and the scans of the created directories
+	time.Sleep(300 * time.Millisecond)
+	rec.lock.Lock()
+	rec.folders = nil
+	rec.lock.Unlock()
+
+	if err := os.WriteFile(filepath.Join(season, "S01E01.mkv"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	want := []string{season}
+	if got := rec.Folders(); !reflect.DeepEqual(want, got) {
+		t.Logf("want: %v", want)
+		t.Logf("got:  %v", got)
+		t.Errorf("Events of the nested directory were not captured")
+	}
+}
+
+func TestUnwatchRemovedDirectories(t *testing.T) {
+	root := t.TempDir()
+
+	show := filepath.Join(root, "Westworld")
+	if err := os.MkdirAll(filepath.Join(show, "Season 1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	d, _ := newTestDaemon(t, root, time.Hour)
+	if err := filepath.Walk(root, d.walkFunc); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.RemoveAll(show); err != nil {
+		t.Fatal(err)
+	}
+
+	d.handle(fsnotify.Event{Name: show, Op: fsnotify.Remove})
+
+	want := map[string]bool{root: true}
+	if !reflect.DeepEqual(want, d.watched) {
+		t.Logf("want: %v", want)
+		t.Logf("got:  %v", d.watched)
+		t.Errorf("Watches were not cleaned up")
+	}
+}
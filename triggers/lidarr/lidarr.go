@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"path"
+	"regexp"
 	"strings"
 	"time"
 
@@ -13,10 +14,15 @@ import (
 )
 
 type Config struct {
-	Name      string             `yaml:"name"`
-	Priority  int                `yaml:"priority"`
-	Rewrite   []autoscan.Rewrite `yaml:"rewrite"`
-	Verbosity string             `yaml:"verbosity"`
+	Name         string             `yaml:"name"`
+	Priority     int                `yaml:"priority"`
+	Rewrite      []autoscan.Rewrite `yaml:"rewrite"`
+	Verbosity    string             `yaml:"verbosity"`
+	AllowedCIDRs []string           `yaml:"allowed-cidrs"`
+	TrustProxy   bool               `yaml:"trust-proxy"`
+
+	// Events limits the handled event types, all supported events are handled when empty.
+	Events []string `yaml:"events"`
 }
 
 // New creates an autoscan-compatible HTTP Trigger for Lidarr webhooks.
@@ -26,12 +32,18 @@ func New(c Config) (autoscan.HTTPTrigger, error) {
 		return nil, err
 	}
 
+	allow, err := autoscan.NewAllowlist(c.AllowedCIDRs, c.TrustProxy)
+	if err != nil {
+		return nil, err
+	}
+
 	trigger := func(callback autoscan.ProcessorFunc) http.Handler {
-		return handler{
+		return allow(handler{
 			callback: callback,
+			events:   autoscan.NewEventFilter(c.Events),
 			priority: c.Priority,
 			rewrite:  rewriter,
-		}
+		})
 	}
 
 	return trigger, nil
@@ -41,6 +53,7 @@ type handler struct {
 	priority int
 	rewrite  autoscan.Rewriter
 	callback autoscan.ProcessorFunc
+	events   autoscan.EventFilter
 }
 
 type lidarrEvent struct {
@@ -50,6 +63,33 @@ type lidarrEvent struct {
 	Files []struct {
 		Path string
 	} `json:"trackFiles"`
+
+	Artist struct {
+		Path string
+	} `json:"artist"`
+}
+
+// discFolder matches the per-disc subfolders of multi-disc albums, e.g. "CD 01" or "Disc 2".
+var discFolder = regexp.MustCompile(`(?i)^(cd|dis[ck])\s*\d+$`)
+
+// albumFolder returns the album folder of a track, collapsing disc subfolders to the album root.
+func albumFolder(trackPath string) string {
+	folderPath := path.Dir(trackPath)
+	if discFolder.MatchString(path.Base(folderPath)) {
+		return path.Dir(folderPath)
+	}
+
+	return folderPath
+}
+
+func isImportEvent(eventType string) bool {
+	for _, t := range []string{"Download", "AlbumImport", "TrackImport"} {
+		if strings.EqualFold(eventType, t) {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
@@ -72,17 +112,38 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !strings.EqualFold(event.Type, "Download") || len(event.Files) == 0 {
+	if !h.events(event.Type) {
+		l.Debug().Str("event", event.Type).Msg("Event type not allowed, dropping event")
+		rw.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if !isImportEvent(event.Type) || (len(event.Files) == 0 && event.Artist.Path == "") {
 		l.Error().Msg("Required fields are missing")
 		rw.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
+	folders := make([]string, 0)
+	for _, f := range event.Files {
+		folders = append(folders, albumFolder(f.Path))
+	}
+
+	// fallback to the artist folder when no track files were provided
+	if len(folders) == 0 {
+		folders = append(folders, event.Artist.Path)
+	}
+
+	scanEvent := autoscan.EventAdd
+	if event.Upgrade {
+		scanEvent = autoscan.EventUpgrade
+	}
+
 	unique := make(map[string]bool)
 	scans := make([]autoscan.Scan, 0)
 
-	for _, f := range event.Files {
-		folderPath := path.Dir(h.rewrite(f.Path))
+	for _, folder := range folders {
+		folderPath := h.rewrite(folder)
 		if _, ok := unique[folderPath]; ok {
 			continue
 		}
@@ -93,6 +154,7 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 			Folder:   folderPath,
 			Priority: h.priority,
 			Time:     now(),
+			Event:    scanEvent,
 		})
 	}
 
@@ -105,6 +167,7 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 
 	rw.WriteHeader(http.StatusOK)
 	l.Info().
+		Str("id", scans[0].ID).
 		Str("path", scans[0].Folder).
 		Str("event", event.Type).
 		Msg("Scan moved to processor")
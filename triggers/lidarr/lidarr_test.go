@@ -38,6 +38,12 @@ func TestHandler(t *testing.T) {
 		}},
 	}
 
+	eventsConfig := standardConfig
+	eventsConfig.Events = []string{"download"}
+
+	filteredConfig := standardConfig
+	filteredConfig.Events = []string{"AlbumImport"}
+
 	currentTime := time.Now()
 	now = func() time.Time {
 		return currentTime
@@ -56,28 +62,72 @@ func TestHandler(t *testing.T) {
 					Folder:   "/mnt/unionfs/Media/Music/Marshmello/Joytime III (2019)",
 					Priority: 5,
 					Time:     currentTime,
+					Event:    autoscan.EventAdd,
 				}},
 			},
 		},
 		{
-			"Multiple folders",
+			"Multi-disc albums collapse to the album folder",
 			Given{
 				Config:  standardConfig,
 				Fixture: "testdata/blink-182.json",
 			},
 			Expected{
 				StatusCode: 200,
-				Scans: []autoscan.Scan{
-					{
-						Folder:   "/mnt/unionfs/Media/Music/blink‐182/California (2016)/CD 01",
-						Priority: 5,
-						Time:     currentTime,
-					},
-					{
-						Folder:   "/mnt/unionfs/Media/Music/blink‐182/California (2016)/CD 02",
-						Priority: 5,
-						Time:     currentTime,
-					}},
+				Scans: []autoscan.Scan{{
+					Folder:   "/mnt/unionfs/Media/Music/blink‐182/California (2016)",
+					Priority: 5,
+					Time:     currentTime,
+					Event:    autoscan.EventAdd,
+				}},
+			},
+		},
+		{
+			"Album import",
+			Given{
+				Config:  standardConfig,
+				Fixture: "testdata/album_import.json",
+			},
+			Expected{
+				StatusCode: 200,
+				Scans: []autoscan.Scan{{
+					Folder:   "/mnt/unionfs/Media/Music/Daft Punk/Discovery (2001)",
+					Priority: 5,
+					Time:     currentTime,
+					Event:    autoscan.EventAdd,
+				}},
+			},
+		},
+		{
+			"Track import",
+			Given{
+				Config:  standardConfig,
+				Fixture: "testdata/track_import.json",
+			},
+			Expected{
+				StatusCode: 200,
+				Scans: []autoscan.Scan{{
+					Folder:   "/mnt/unionfs/Media/Music/Daft Punk/Random Access Memories (2013)",
+					Priority: 5,
+					Time:     currentTime,
+					Event:    autoscan.EventUpgrade,
+				}},
+			},
+		},
+		{
+			"Falls back to the artist folder",
+			Given{
+				Config:  standardConfig,
+				Fixture: "testdata/artist_only.json",
+			},
+			Expected{
+				StatusCode: 200,
+				Scans: []autoscan.Scan{{
+					Folder:   "/mnt/unionfs/Media/Music/Daft Punk",
+					Priority: 5,
+					Time:     currentTime,
+					Event:    autoscan.EventAdd,
+				}},
 			},
 		},
 		{
@@ -100,6 +150,32 @@ func TestHandler(t *testing.T) {
 				StatusCode: 200,
 			},
 		},
+		{
+			"Handles event types within the allowed events",
+			Given{
+				Config:  eventsConfig,
+				Fixture: "testdata/marshmello.json",
+			},
+			Expected{
+				StatusCode: 200,
+				Scans: []autoscan.Scan{{
+					Folder:   "/mnt/unionfs/Media/Music/Marshmello/Joytime III (2019)",
+					Priority: 5,
+					Time:     currentTime,
+					Event:    autoscan.EventAdd,
+				}},
+			},
+		},
+		{
+			"Drops event types outside of the allowed events",
+			Given{
+				Config:  filteredConfig,
+				Fixture: "testdata/marshmello.json",
+			},
+			Expected{
+				StatusCode: 200,
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -0,0 +1,158 @@
+package manual
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"path"
+
+	"github.com/rs/zerolog/hlog"
+
+	"github.com/cloudbox/autoscan"
+)
+
+type batchRequest struct {
+	Dirs  []string    `json:"dirs"`
+	Scans []batchScan `json:"scans"`
+}
+
+// batchScan carries the fields of a scan forwarded by another instance of autoscan.
+type batchScan struct {
+	Folder         string   `json:"folder"`
+	Priority       int      `json:"priority"`
+	Removed        bool     `json:"removed"`
+	ItemID         string   `json:"item_id"`
+	Event          string   `json:"event"`
+	File           string   `json:"file"`
+	CollectionName string   `json:"collection_name"`
+	LibraryHint    string   `json:"library_hint"`
+	ItemIDs        []string `json:"item_ids"`
+}
+
+type batchResult struct {
+	Dir    string `json:"dir"`
+	Path   string `json:"path,omitempty"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type batchResponse struct {
+	Results []batchResult `json:"results"`
+}
+
+func isJSON(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+// serveBatch enqueues every directory of a JSON body and reports the outcome per directory.
+func (h handler) serveBatch(rw http.ResponseWriter, r *http.Request) {
+	rlog := hlog.FromRequest(r)
+
+	body := new(batchRequest)
+	if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+		rlog.Error().Err(err).Msg("Failed decoding request")
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	items := body.Scans
+	for _, dir := range body.Dirs {
+		items = append(items, batchScan{Folder: dir})
+	}
+
+	if len(items) == 0 {
+		rlog.Error().Msg("Manual webhook should receive at least one directory")
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	rlog.Trace().Interface("scans", items).Msg("Received directories")
+
+	results := make([]batchResult, len(items))
+	unique := make(map[string]bool)
+	scans := make([]autoscan.Scan, 0)
+
+	// indices of the results which are enqueued with the scans
+	enqueued := make([]int, 0)
+
+	for i, item := range items {
+		dir := item.Folder
+		results[i].Dir = dir
+
+		if !path.IsAbs(dir) {
+			results[i].Status = http.StatusBadRequest
+			results[i].Error = "directory must be an absolute path"
+			continue
+		}
+
+		// Rewrite the path based on the provided rewriter.
+		folderPath := h.rewrite(path.Clean(dir))
+		results[i].Path = folderPath
+		enqueued = append(enqueued, i)
+
+		if unique[folderPath] {
+			continue
+		}
+
+		// forwarded scans keep their priority when it exceeds the priority of the trigger
+		priority := h.priority
+		if item.Priority > priority {
+			priority = item.Priority
+		}
+
+		file := ""
+		if item.File != "" {
+			file = h.rewrite(path.Clean(item.File))
+		}
+
+		unique[folderPath] = true
+		scans = append(scans, autoscan.Scan{
+			Folder:   folderPath,
+			Priority: priority,
+			Time:     now(),
+			Removed:  item.Removed,
+			ItemID:   item.ItemID,
+			Event:    item.Event,
+			File:     file,
+
+			CollectionName: item.CollectionName,
+			LibraryHint:    item.LibraryHint,
+			ItemIDs:        item.ItemIDs,
+		})
+	}
+
+	if len(scans) > 0 {
+		if err := h.callback(scans...); err != nil {
+			rlog.Error().Err(err).Msg("Processor could not process scans")
+			for _, i := range enqueued {
+				results[i].Status = http.StatusInternalServerError
+				results[i].Error = err.Error()
+			}
+		} else {
+			for _, i := range enqueued {
+				results[i].Status = http.StatusOK
+			}
+
+			for _, scan := range scans {
+				rlog.Info().
+					Str("id", scan.ID).
+					Str("path", scan.Folder).
+					Msg("Scan moved to processor")
+			}
+		}
+	}
+
+	// report partial success when the results are mixed
+	status := results[0].Status
+	for _, result := range results {
+		if result.Status != status {
+			status = http.StatusMultiStatus
+			break
+		}
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	_ = json.NewEncoder(rw).Encode(batchResponse{Results: results})
+}
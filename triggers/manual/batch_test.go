@@ -0,0 +1,212 @@
+package manual
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudbox/autoscan"
+)
+
+func TestBatch(t *testing.T) {
+	type Given struct {
+		Body        string
+		CallbackErr error
+	}
+
+	type Expected struct {
+		Scans      []autoscan.Scan
+		Results    []batchResult
+		StatusCode int
+	}
+
+	type Test struct {
+		Name     string
+		Given    Given
+		Expected Expected
+	}
+
+	standardConfig := Config{
+		Priority: 5,
+		Rewrite: []autoscan.Rewrite{{
+			From: "/Movies/*",
+			To:   "/mnt/unionfs/Media/Movies/$1",
+		}},
+	}
+
+	currentTime := time.Now()
+	now = func() time.Time {
+		return currentTime
+	}
+
+	var testCases = []Test{
+		{
+			"Enqueues every directory once",
+			Given{
+				Body: `{"dirs": ["/Movies/Interstellar (2014)", "/Movies/Parasite (2019)", "/Movies/Interstellar (2014)/"]}`,
+			},
+			Expected{
+				StatusCode: 200,
+				Scans: []autoscan.Scan{
+					{
+						Folder:   "/mnt/unionfs/Media/Movies/Interstellar (2014)",
+						Priority: 5,
+						Time:     currentTime,
+					},
+					{
+						Folder:   "/mnt/unionfs/Media/Movies/Parasite (2019)",
+						Priority: 5,
+						Time:     currentTime,
+					},
+				},
+				Results: []batchResult{
+					{Dir: "/Movies/Interstellar (2014)", Path: "/mnt/unionfs/Media/Movies/Interstellar (2014)", Status: 200},
+					{Dir: "/Movies/Parasite (2019)", Path: "/mnt/unionfs/Media/Movies/Parasite (2019)", Status: 200},
+					{Dir: "/Movies/Interstellar (2014)/", Path: "/mnt/unionfs/Media/Movies/Interstellar (2014)", Status: 200},
+				},
+			},
+		},
+		{
+			"Keeps the fields of forwarded scans",
+			Given{
+				Body: `{"scans": [{"folder": "/Movies/Interstellar (2014)", "priority": 8, "removed": true}, {"folder": "/Movies/Parasite (2019)", "priority": 2, "item_id": "9fa3b8c2"}]}`,
+			},
+			Expected{
+				StatusCode: 200,
+				Scans: []autoscan.Scan{
+					{
+						Folder:   "/mnt/unionfs/Media/Movies/Interstellar (2014)",
+						Priority: 8,
+						Time:     currentTime,
+						Removed:  true,
+					},
+					{
+						Folder:   "/mnt/unionfs/Media/Movies/Parasite (2019)",
+						Priority: 5,
+						Time:     currentTime,
+						ItemID:   "9fa3b8c2",
+					},
+				},
+				Results: []batchResult{
+					{Dir: "/Movies/Interstellar (2014)", Path: "/mnt/unionfs/Media/Movies/Interstellar (2014)", Status: 200},
+					{Dir: "/Movies/Parasite (2019)", Path: "/mnt/unionfs/Media/Movies/Parasite (2019)", Status: 200},
+				},
+			},
+		},
+		{
+			"Returns partial success for mixed paths",
+			Given{
+				Body: `{"dirs": ["/Movies/Interstellar (2014)", "Parasite (2019)", ""]}`,
+			},
+			Expected{
+				StatusCode: 207,
+				Scans: []autoscan.Scan{
+					{
+						Folder:   "/mnt/unionfs/Media/Movies/Interstellar (2014)",
+						Priority: 5,
+						Time:     currentTime,
+					},
+				},
+				Results: []batchResult{
+					{Dir: "/Movies/Interstellar (2014)", Path: "/mnt/unionfs/Media/Movies/Interstellar (2014)", Status: 200},
+					{Dir: "Parasite (2019)", Status: 400, Error: "directory must be an absolute path"},
+					{Dir: "", Status: 400, Error: "directory must be an absolute path"},
+				},
+			},
+		},
+		{
+			"Returns bad request when all paths are invalid",
+			Given{
+				Body: `{"dirs": ["Parasite (2019)"]}`,
+			},
+			Expected{
+				StatusCode: 400,
+				Results: []batchResult{
+					{Dir: "Parasite (2019)", Status: 400, Error: "directory must be an absolute path"},
+				},
+			},
+		},
+		{
+			"Returns internal server error when the processor fails",
+			Given{
+				Body:        `{"dirs": ["/Movies/Interstellar (2014)"]}`,
+				CallbackErr: errors.New("database is locked"),
+			},
+			Expected{
+				StatusCode: 500,
+				Scans: []autoscan.Scan{
+					{
+						Folder:   "/mnt/unionfs/Media/Movies/Interstellar (2014)",
+						Priority: 5,
+						Time:     currentTime,
+					},
+				},
+				Results: []batchResult{
+					{Dir: "/Movies/Interstellar (2014)", Path: "/mnt/unionfs/Media/Movies/Interstellar (2014)", Status: 500, Error: "database is locked"},
+				},
+			},
+		},
+		{
+			"Returns bad request on an empty batch",
+			Given{
+				Body: `{"dirs": []}`,
+			},
+			Expected{
+				StatusCode: 400,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			callback := func(scans ...autoscan.Scan) error {
+				if !reflect.DeepEqual(tc.Expected.Scans, scans) {
+					t.Logf("want: %v", tc.Expected.Scans)
+					t.Logf("got:  %v", scans)
+					t.Errorf("Scans do not equal")
+					return errors.New("Scans do not equal")
+				}
+
+				return tc.Given.CallbackErr
+			}
+
+			trigger, err := New(standardConfig)
+			if err != nil {
+				t.Fatalf("Could not create Manual Trigger: %v", err)
+			}
+
+			server := httptest.NewServer(trigger(callback))
+			defer server.Close()
+
+			res, err := http.Post(server.URL, "application/json", strings.NewReader(tc.Given.Body))
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+
+			defer res.Body.Close()
+			if res.StatusCode != tc.Expected.StatusCode {
+				t.Errorf("Status codes do not match: %d vs %d", res.StatusCode, tc.Expected.StatusCode)
+			}
+
+			if tc.Expected.Results == nil {
+				return
+			}
+
+			response := new(batchResponse)
+			if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+				t.Fatalf("Could not decode response: %v", err)
+			}
+
+			if !reflect.DeepEqual(tc.Expected.Results, response.Results) {
+				t.Logf("want: %v", tc.Expected.Results)
+				t.Logf("got:  %v", response.Results)
+				t.Errorf("Results do not equal")
+			}
+		})
+	}
+}
@@ -2,8 +2,13 @@ package manual
 
 import (
 	_ "embed"
+	"errors"
+	"io/fs"
 	"net/http"
+	"os"
 	"path"
+	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/rs/zerolog/hlog"
@@ -12,11 +17,17 @@ import (
 )
 
 type Config struct {
-	Rewrite   []autoscan.Rewrite `yaml:"rewrite"`
-	Priority  int                `yaml:"priority"`
-	Verbosity string             `yaml:"verbosity"`
+	Rewrite      []autoscan.Rewrite `yaml:"rewrite"`
+	Priority     int                `yaml:"priority"`
+	Verbosity    string             `yaml:"verbosity"`
+	AllowedCIDRs []string           `yaml:"allowed-cidrs"`
+	TrustProxy   bool               `yaml:"trust-proxy"`
+	MaxScans     int                `yaml:"max-scans"`
 }
 
+// defaultMaxScans caps the number of scans a single recursive request can enqueue.
+const defaultMaxScans = 1000
+
 var (
 	//go:embed "template.html"
 	template []byte
@@ -29,12 +40,23 @@ func New(c Config) (autoscan.HTTPTrigger, error) {
 		return nil, err
 	}
 
+	maxScans := c.MaxScans
+	if maxScans <= 0 {
+		maxScans = defaultMaxScans
+	}
+
+	allow, err := autoscan.NewAllowlist(c.AllowedCIDRs, c.TrustProxy)
+	if err != nil {
+		return nil, err
+	}
+
 	trigger := func(callback autoscan.ProcessorFunc) http.Handler {
-		return handler{
+		return allow(handler{
 			callback: callback,
 			priority: c.Priority,
 			rewrite:  rewriter,
-		}
+			maxScans: maxScans,
+		})
 	}
 
 	return trigger, nil
@@ -44,6 +66,7 @@ type handler struct {
 	priority int
 	rewrite  autoscan.Rewriter
 	callback autoscan.ProcessorFunc
+	maxScans int
 }
 
 func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
@@ -63,6 +86,11 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if isJSON(r) {
+		h.serveBatch(rw, r)
+		return
+	}
+
 	if len(directories) == 0 {
 		rlog.Error().Msg("Manual webhook should receive at least one directory")
 		rw.WriteHeader(http.StatusBadRequest)
@@ -71,12 +99,43 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 
 	rlog.Trace().Interface("dirs", directories).Msg("Received directories")
 
-	scans := make([]autoscan.Scan, 0)
+	recursive, _ := strconv.ParseBool(r.FormValue("recursive"))
+	maxDepth, _ := strconv.Atoi(r.FormValue("depth"))
+
+	folders := make([]string, 0)
 
 	for _, dir := range directories {
 		// Rewrite the path based on the provided rewriter.
 		folderPath := h.rewrite(path.Clean(dir))
 
+		if !recursive {
+			folders = append(folders, folderPath)
+			continue
+		}
+
+		// Walk the local directory tree and enqueue its leaf folders instead.
+		truncated, err := leafFolders(folderPath, maxDepth, h.maxScans, &folders)
+		if err != nil {
+			rlog.Error().Err(err).Str("path", folderPath).Msg("Failed walking directory")
+			if errors.Is(err, fs.ErrNotExist) {
+				rw.WriteHeader(http.StatusBadRequest)
+			} else {
+				rw.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if truncated {
+			rlog.Warn().
+				Str("path", folderPath).
+				Int("limit", h.maxScans).
+				Msg("Too many folders within directory, truncated scans")
+			break
+		}
+	}
+
+	scans := make([]autoscan.Scan, 0, len(folders))
+	for _, folderPath := range folders {
 		scans = append(scans, autoscan.Scan{
 			Folder:   folderPath,
 			Priority: h.priority,
@@ -94,9 +153,49 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	rw.WriteHeader(http.StatusOK)
 	for _, scan := range scans {
 		rlog.Info().
+			Str("id", scan.ID).
 			Str("path", scan.Folder).
 			Msg("Scan moved to processor")
 	}
 }
 
+// leafFolders appends the folders within dir without any subdirectories to folders.
+// Folders at maxDepth are treated as leaves, a maxDepth of zero or less walks the entire tree.
+// Returns true when the limit of folders was reached before the walk completed.
+func leafFolders(dir string, maxDepth int, limit int, folders *[]string) (bool, error) {
+	return walkLeaves(dir, 0, maxDepth, limit, folders)
+}
+
+func walkLeaves(dir string, depth int, maxDepth int, limit int, folders *[]string) (bool, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false, err
+	}
+
+	subdirs := make([]string, 0)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			subdirs = append(subdirs, filepath.Join(dir, entry.Name()))
+		}
+	}
+
+	if len(subdirs) == 0 || (maxDepth > 0 && depth >= maxDepth) {
+		if len(*folders) >= limit {
+			return true, nil
+		}
+
+		*folders = append(*folders, dir)
+		return false, nil
+	}
+
+	for _, subdir := range subdirs {
+		truncated, err := walkLeaves(subdir, depth+1, maxDepth, limit, folders)
+		if err != nil || truncated {
+			return truncated, err
+		}
+	}
+
+	return false, nil
+}
+
 var now = time.Now
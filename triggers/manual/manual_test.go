@@ -5,6 +5,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 	"time"
@@ -124,3 +126,171 @@ func TestHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestRecursive(t *testing.T) {
+	type Given struct {
+		Config Config
+		Query  url.Values
+	}
+
+	type Expected struct {
+		Folders    []string
+		StatusCode int
+	}
+
+	type Test struct {
+		Name     string
+		Given    Given
+		Expected Expected
+	}
+
+	root := t.TempDir()
+	for _, dir := range []string{
+		"Interstellar (2014)",
+		"Parasite (2019)/Extras",
+		"Parasite (2019)/Featurettes",
+	} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "Interstellar (2014)", "Interstellar.mkv"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	standardConfig := Config{
+		Priority: 5,
+		Rewrite: []autoscan.Rewrite{{
+			From: "^/Movies",
+			To:   root,
+		}},
+	}
+
+	currentTime := time.Now()
+	now = func() time.Time {
+		return currentTime
+	}
+
+	var testCases = []Test{
+		{
+			"Enqueues every leaf folder",
+			Given{
+				Config: standardConfig,
+				Query: url.Values{
+					"dir":       []string{"/Movies"},
+					"recursive": []string{"true"},
+				},
+			},
+			Expected{
+				StatusCode: 200,
+				Folders: []string{
+					filepath.Join(root, "Interstellar (2014)"),
+					filepath.Join(root, "Parasite (2019)", "Extras"),
+					filepath.Join(root, "Parasite (2019)", "Featurettes"),
+				},
+			},
+		},
+		{
+			"Stops at the maximum depth",
+			Given{
+				Config: standardConfig,
+				Query: url.Values{
+					"dir":       []string{"/Movies"},
+					"recursive": []string{"true"},
+					"depth":     []string{"1"},
+				},
+			},
+			Expected{
+				StatusCode: 200,
+				Folders: []string{
+					filepath.Join(root, "Interstellar (2014)"),
+					filepath.Join(root, "Parasite (2019)"),
+				},
+			},
+		},
+		{
+			"Truncates at the maximum number of scans",
+			Given{
+				Config: Config{
+					Priority: standardConfig.Priority,
+					Rewrite:  standardConfig.Rewrite,
+					MaxScans: 2,
+				},
+				Query: url.Values{
+					"dir":       []string{"/Movies"},
+					"recursive": []string{"true"},
+				},
+			},
+			Expected{
+				StatusCode: 200,
+				Folders: []string{
+					filepath.Join(root, "Interstellar (2014)"),
+					filepath.Join(root, "Parasite (2019)", "Extras"),
+				},
+			},
+		},
+		{
+			"Returns bad request when the directory does not exist",
+			Given{
+				Config: standardConfig,
+				Query: url.Values{
+					"dir":       []string{"/Movies/Missing (2020)"},
+					"recursive": []string{"true"},
+				},
+			},
+			Expected{
+				StatusCode: 400,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			var expected []autoscan.Scan
+			for _, folder := range tc.Expected.Folders {
+				expected = append(expected, autoscan.Scan{
+					Folder:   folder,
+					Priority: 5,
+					Time:     currentTime,
+				})
+			}
+
+			callback := func(scans ...autoscan.Scan) error {
+				if !reflect.DeepEqual(expected, scans) {
+					t.Logf("want: %v", expected)
+					t.Logf("got:  %v", scans)
+					t.Errorf("Scans do not equal")
+					return errors.New("Scans do not equal")
+				}
+
+				return nil
+			}
+
+			trigger, err := New(tc.Given.Config)
+			if err != nil {
+				t.Fatalf("Could not create Manual Trigger: %v", err)
+			}
+
+			server := httptest.NewServer(trigger(callback))
+			defer server.Close()
+
+			req, err := http.NewRequest("POST", server.URL, nil)
+			if err != nil {
+				t.Fatalf("Failed creating request: %v", err)
+			}
+
+			req.URL.RawQuery = tc.Given.Query.Encode()
+
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+
+			defer res.Body.Close()
+			if res.StatusCode != tc.Expected.StatusCode {
+				t.Errorf("Status codes do not match: %d vs %d", res.StatusCode, tc.Expected.StatusCode)
+			}
+		})
+	}
+}
@@ -13,10 +13,15 @@ import (
 )
 
 type Config struct {
-	Name      string             `yaml:"name"`
-	Priority  int                `yaml:"priority"`
-	Rewrite   []autoscan.Rewrite `yaml:"rewrite"`
-	Verbosity string             `yaml:"verbosity"`
+	Name         string             `yaml:"name"`
+	Priority     int                `yaml:"priority"`
+	Rewrite      []autoscan.Rewrite `yaml:"rewrite"`
+	Verbosity    string             `yaml:"verbosity"`
+	AllowedCIDRs []string           `yaml:"allowed-cidrs"`
+	TrustProxy   bool               `yaml:"trust-proxy"`
+
+	// Events limits the handled event types, all supported events are handled when empty.
+	Events []string `yaml:"events"`
 }
 
 // New creates an autoscan-compatible HTTP Trigger for Radarr webhooks.
@@ -26,12 +31,18 @@ func New(c Config) (autoscan.HTTPTrigger, error) {
 		return nil, err
 	}
 
+	allow, err := autoscan.NewAllowlist(c.AllowedCIDRs, c.TrustProxy)
+	if err != nil {
+		return nil, err
+	}
+
 	trigger := func(callback autoscan.ProcessorFunc) http.Handler {
-		return handler{
+		return allow(handler{
 			callback: callback,
+			events:   autoscan.NewEventFilter(c.Events),
 			priority: c.Priority,
 			rewrite:  rewriter,
-		}
+		})
 	}
 
 	return trigger, nil
@@ -41,10 +52,15 @@ type handler struct {
 	priority int
 	rewrite  autoscan.Rewriter
 	callback autoscan.ProcessorFunc
+	events   autoscan.EventFilter
 }
 
 type radarrEvent struct {
-	Type string `json:"eventType"`
+	Type    string `json:"eventType"`
+	Upgrade bool   `json:"isUpgrade"`
+
+	// the MovieFileDelete event is also sent when a file is upgraded.
+	DeleteReason string `json:"deleteReason"`
 
 	File struct {
 		RelativePath string
@@ -75,7 +91,16 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !h.events(event.Type) {
+		rlog.Debug().Str("event", event.Type).Msg("Event type not allowed, dropping event")
+		rw.WriteHeader(http.StatusOK)
+		return
+	}
+
 	var folderPath string
+	var filePath string
+	var removed bool
+	var scanEvent string
 
 	if strings.EqualFold(event.Type, "Download") || strings.EqualFold(event.Type, "MovieFileDelete") {
 		if event.File.RelativePath == "" || event.Movie.FolderPath == "" {
@@ -84,7 +109,18 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		folderPath = path.Dir(path.Join(event.Movie.FolderPath, event.File.RelativePath))
+		filePath = path.Join(event.Movie.FolderPath, event.File.RelativePath)
+		folderPath = path.Dir(filePath)
+		removed = strings.EqualFold(event.Type, "MovieFileDelete") && !strings.EqualFold(event.DeleteReason, "upgrade")
+
+		switch {
+		case removed:
+			scanEvent = autoscan.EventDelete
+		case event.Upgrade || strings.EqualFold(event.Type, "MovieFileDelete"):
+			scanEvent = autoscan.EventUpgrade
+		default:
+			scanEvent = autoscan.EventAdd
+		}
 	}
 
 	if strings.EqualFold(event.Type, "MovieDelete") || strings.EqualFold(event.Type, "Rename") {
@@ -95,15 +131,28 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		}
 
 		folderPath = event.Movie.FolderPath
+		removed = strings.EqualFold(event.Type, "MovieDelete")
+
+		scanEvent = autoscan.EventRename
+		if removed {
+			scanEvent = autoscan.EventDelete
+		}
 	}
 
-	scan := autoscan.Scan{
+	// passed on as a slice, to log the ID the processor assigns.
+	scans := []autoscan.Scan{{
 		Folder:   h.rewrite(folderPath),
 		Priority: h.priority,
 		Time:     now(),
+		Removed:  removed,
+		Event:    scanEvent,
+	}}
+
+	if filePath != "" {
+		scans[0].File = h.rewrite(filePath)
 	}
 
-	err = h.callback(scan)
+	err = h.callback(scans...)
 	if err != nil {
 		rlog.Error().Err(err).Msg("Processor could not process scan")
 		rw.WriteHeader(http.StatusInternalServerError)
@@ -111,8 +160,10 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	}
 
 	rlog.Info().
+		Str("id", scans[0].ID).
 		Str("path", folderPath).
 		Str("event", event.Type).
+		Bool("removed", scans[0].Removed).
 		Msg("Scan moved to processor")
 
 	rw.WriteHeader(http.StatusOK)
@@ -38,6 +38,12 @@ func TestHandler(t *testing.T) {
 		}},
 	}
 
+	eventsConfig := standardConfig
+	eventsConfig.Events = []string{"download"}
+
+	filteredConfig := standardConfig
+	filteredConfig.Events = []string{"Rename"}
+
 	currentTime := time.Now()
 	now = func() time.Time {
 		return currentTime
@@ -57,6 +63,8 @@ func TestHandler(t *testing.T) {
 						Folder:   "/mnt/unionfs/Media/Movies/Interstellar (2014)",
 						Priority: 5,
 						Time:     currentTime,
+						Event:    autoscan.EventAdd,
+						File:     "/mnt/unionfs/Media/Movies/Interstellar (2014)/Interstellar.2014.UHD.BluRay.2160p.REMUX.mkv",
 					},
 				},
 			},
@@ -74,6 +82,28 @@ func TestHandler(t *testing.T) {
 						Folder:   "/mnt/unionfs/Media/Movies/Tenet (2020)",
 						Priority: 5,
 						Time:     currentTime,
+						Removed:  true,
+						Event:    autoscan.EventDelete,
+						File:     "/mnt/unionfs/Media/Movies/Tenet (2020)/Tenet.2020.mkv",
+					},
+				},
+			},
+		},
+		{
+			"MovieFileDelete Event on upgrade is not a removal",
+			Given{
+				Config:  standardConfig,
+				Fixture: "testdata/movie_file_upgrade.json",
+			},
+			Expected{
+				StatusCode: 200,
+				Scans: []autoscan.Scan{
+					{
+						Folder:   "/mnt/unionfs/Media/Movies/Tenet (2020)",
+						Priority: 5,
+						Time:     currentTime,
+						Event:    autoscan.EventUpgrade,
+						File:     "/mnt/unionfs/Media/Movies/Tenet (2020)/Tenet.2020.mkv",
 					},
 				},
 			},
@@ -91,6 +121,8 @@ func TestHandler(t *testing.T) {
 						Folder:   "/mnt/unionfs/Media/Movies/Wonder Woman 1984 (2020)",
 						Priority: 5,
 						Time:     currentTime,
+						Removed:  true,
+						Event:    autoscan.EventDelete,
 					},
 				},
 			},
@@ -108,6 +140,7 @@ func TestHandler(t *testing.T) {
 						Folder:   "/mnt/unionfs/Media/Movies/Deadpool (2016)",
 						Priority: 5,
 						Time:     currentTime,
+						Event:    autoscan.EventRename,
 					},
 				},
 			},
@@ -132,6 +165,35 @@ func TestHandler(t *testing.T) {
 				StatusCode: 200,
 			},
 		},
+		{
+			"Handles event types within the allowed events",
+			Given{
+				Config:  eventsConfig,
+				Fixture: "testdata/interstellar.json",
+			},
+			Expected{
+				StatusCode: 200,
+				Scans: []autoscan.Scan{
+					{
+						Folder:   "/mnt/unionfs/Media/Movies/Interstellar (2014)",
+						Priority: 5,
+						Time:     currentTime,
+						Event:    autoscan.EventAdd,
+						File:     "/mnt/unionfs/Media/Movies/Interstellar (2014)/Interstellar.2014.UHD.BluRay.2160p.REMUX.mkv",
+					},
+				},
+			},
+		},
+		{
+			"Drops event types outside of the allowed events",
+			Given{
+				Config:  filteredConfig,
+				Fixture: "testdata/interstellar.json",
+			},
+			Expected{
+				StatusCode: 200,
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -0,0 +1,106 @@
+package rclone
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cloudbox/autoscan"
+)
+
+// rc is a client for the remote control API of rclone.
+type rc struct {
+	url      string
+	username string
+	password string
+	client   *http.Client
+}
+
+type rcItem struct {
+	Path    string    `json:"Path"`
+	Size    int64     `json:"Size"`
+	ModTime time.Time `json:"ModTime"`
+	IsDir   bool      `json:"IsDir"`
+}
+
+func (c rc) call(method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("encoding params: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/%s", strings.TrimRight(c.url, "/"), method), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed creating %s request: %v: %w", method, err, autoscan.ErrFatal)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if c.username != "" || c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %v: %w", method, err, autoscan.ErrTargetUnavailable)
+	}
+
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		// 200 indicates success
+	case 401, 403:
+		return fmt.Errorf("%s: invalid credentials: %s: %w", method, res.Status, autoscan.ErrFatal)
+	default:
+		return fmt.Errorf("%s: %s: %w", method, res.Status, autoscan.ErrTargetUnavailable)
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(result); err != nil {
+		return fmt.Errorf("decoding %s response: %v: %w", method, err, autoscan.ErrTargetUnavailable)
+	}
+
+	return nil
+}
+
+// List returns all the files within dir of the remote, including those in subdirectories.
+func (c rc) List(fs string, dir string) ([]rcItem, error) {
+	type Opt struct {
+		Recurse   bool `json:"recurse"`
+		FilesOnly bool `json:"filesOnly"`
+	}
+
+	type Params struct {
+		Fs     string `json:"fs"`
+		Remote string `json:"remote"`
+		Opt    Opt    `json:"opt"`
+	}
+
+	type Response struct {
+		List []rcItem `json:"list"`
+	}
+
+	resp := new(Response)
+	params := Params{Fs: fs, Remote: dir, Opt: Opt{Recurse: true, FilesOnly: true}}
+	if err := c.call("operations/list", params, resp); err != nil {
+		return nil, err
+	}
+
+	return resp.List, nil
+}
+
+// Refresh asks the VFS of the mount to re-read the given directory.
+func (c rc) Refresh(fs string, dir string) error {
+	params := map[string]string{"dir": dir}
+	if fs != "" {
+		params["fs"] = fs
+	}
+
+	return c.call("vfs/refresh", params, nil)
+}
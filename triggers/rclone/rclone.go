@@ -0,0 +1,221 @@
+package rclone
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cloudbox/autoscan"
+)
+
+type Config struct {
+	URL       string             `yaml:"url"`
+	Username  string             `yaml:"username"`
+	Password  string             `yaml:"password"`
+	Remote    string             `yaml:"remote"`
+	Paths     []string           `yaml:"paths"`
+	Interval  time.Duration      `yaml:"interval"`
+	Refresh   bool               `yaml:"refresh"`
+	Priority  int                `yaml:"priority"`
+	Verbosity string             `yaml:"verbosity"`
+	Rewrite   []autoscan.Rewrite `yaml:"rewrite"`
+	Include   []string           `yaml:"include"`
+	Exclude   []string           `yaml:"exclude"`
+}
+
+const (
+	defaultURL      = "http://localhost:5572"
+	defaultInterval = time.Minute
+)
+
+// New creates an autoscan-compatible Trigger which polls the remote control API of rclone for changed files.
+func New(c Config) (autoscan.Trigger, error) {
+	l := autoscan.GetLogger(c.Verbosity).With().
+		Str("trigger", "rclone").
+		Str("remote", c.Remote).
+		Logger()
+
+	if c.Remote == "" {
+		return nil, fmt.Errorf("remote is required: %w", autoscan.ErrFatal)
+	}
+
+	rewriter, err := autoscan.NewRewriter(c.Rewrite)
+	if err != nil {
+		return nil, err
+	}
+
+	filterer, err := autoscan.NewFilterer(c.Include, c.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	url := c.URL
+	if url == "" {
+		url = defaultURL
+	}
+
+	interval := c.Interval
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+
+	paths := c.Paths
+	if len(paths) == 0 {
+		paths = []string{""}
+	}
+
+	trigger := func(callback autoscan.ProcessorFunc) {
+		d := &daemon{
+			rc: rc{
+				url:      url,
+				username: c.Username,
+				password: c.Password,
+				client:   &http.Client{Timeout: 5 * time.Minute},
+			},
+			remote:   c.Remote,
+			paths:    paths,
+			refresh:  c.Refresh,
+			priority: c.Priority,
+			rewrite:  rewriter,
+			allowed:  filterer,
+			callback: callback,
+			log:      l,
+		}
+
+		go d.worker(interval)
+	}
+
+	return trigger, nil
+}
+
+type daemon struct {
+	rc       rc
+	remote   string
+	paths    []string
+	refresh  bool
+	priority int
+	rewrite  autoscan.Rewriter
+	allowed  autoscan.Filterer
+	callback autoscan.ProcessorFunc
+	log      zerolog.Logger
+
+	// files holds the size and modification time of each known file, nil before the first poll.
+	files map[string]rcItem
+}
+
+func (d *daemon) worker(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.poll(); err != nil {
+			d.log.Error().
+				Err(err).
+				Msg("Failed polling rclone")
+		}
+
+		<-ticker.C
+	}
+}
+
+// poll compares the files of the remote with the previous poll and moves the directories of changed files to the processor.
+// The first poll only records the current state of the remote.
+func (d *daemon) poll() error {
+	files := make(map[string]rcItem)
+	for _, p := range d.paths {
+		items, err := d.rc.List(d.remote, p)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			if !item.IsDir {
+				files[item.Path] = item
+			}
+		}
+	}
+
+	previous := d.files
+	if previous == nil {
+		d.files = files
+		d.log.Debug().
+			Int("files", len(files)).
+			Msg("Retrieved initial state of remote")
+		return nil
+	}
+
+	changed := make(map[string]bool)
+	for p, item := range files {
+		old, ok := previous[p]
+		if ok && old.Size == item.Size && old.ModTime.Equal(item.ModTime) {
+			continue
+		}
+
+		changed[path.Dir(p)] = true
+	}
+
+	// removed files
+	for p := range previous {
+		if _, ok := files[p]; !ok {
+			changed[path.Dir(p)] = true
+		}
+	}
+
+	dirs := make([]string, 0, len(changed))
+	for dir := range changed {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	scans := make([]autoscan.Scan, 0)
+	for _, dir := range dirs {
+		if dir == "." {
+			dir = ""
+		}
+
+		// rewrite the remote path to the local mount
+		folderPath := d.rewrite("/" + dir)
+		if !d.allowed(folderPath) {
+			continue
+		}
+
+		if d.refresh {
+			if err := d.rc.Refresh(d.remote, dir); err != nil {
+				d.log.Warn().
+					Err(err).
+					Str("path", dir).
+					Msg("Failed refreshing VFS directory")
+			}
+		}
+
+		scans = append(scans, autoscan.Scan{
+			Folder:   path.Clean(folderPath),
+			Priority: d.priority,
+			Time:     now(),
+		})
+	}
+
+	if len(scans) > 0 {
+		// keep the previous state on failure, so the changes are retried with the next poll
+		if err := d.callback(scans...); err != nil {
+			return fmt.Errorf("moving scans to processor: %w", err)
+		}
+	}
+
+	d.files = files
+
+	for _, scan := range scans {
+		d.log.Info().
+			Str("id", scan.ID).
+			Str("path", scan.Folder).
+			Msg("Scan moved to processor")
+	}
+
+	return nil
+}
+
+var now = time.Now
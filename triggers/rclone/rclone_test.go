@@ -0,0 +1,226 @@
+package rclone
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cloudbox/autoscan"
+)
+
+func TestPoll(t *testing.T) {
+	type Given struct {
+		Fixtures    []string
+		Refresh     bool
+		CallbackErr error
+	}
+
+	type Expected struct {
+		Scans     []autoscan.Scan
+		Refreshed []string
+	}
+
+	type Test struct {
+		Name     string
+		Given    Given
+		Expected Expected
+	}
+
+	currentTime := time.Now()
+	now = func() time.Time {
+		return currentTime
+	}
+
+	var testCases = []Test{
+		{
+			"Initial poll does not emit scans",
+			Given{
+				Fixtures: []string{"testdata/list_initial.json"},
+			},
+			Expected{},
+		},
+		{
+			"Unchanged remote does not emit scans",
+			Given{
+				Fixtures: []string{"testdata/list_initial.json", "testdata/list_initial.json"},
+			},
+			Expected{},
+		},
+		{
+			"Scans the directories of new, changed and removed files",
+			Given{
+				Fixtures: []string{"testdata/list_initial.json", "testdata/list_changed.json"},
+				Refresh:  true,
+			},
+			Expected{
+				Scans: []autoscan.Scan{
+					{
+						Folder:   "/mnt/unionfs/Media/Movies/Dune (2021)",
+						Priority: 5,
+						Time:     currentTime,
+					},
+					{
+						Folder:   "/mnt/unionfs/Media/Movies/Parasite (2019)",
+						Priority: 5,
+						Time:     currentTime,
+					},
+					{
+						Folder:   "/mnt/unionfs/Media/Movies/Tenet (2020)",
+						Priority: 5,
+						Time:     currentTime,
+					},
+				},
+				Refreshed: []string{
+					"Media/Movies/Dune (2021)",
+					"Media/Movies/Parasite (2019)",
+					"Media/Movies/Tenet (2020)",
+				},
+			},
+		},
+		{
+			"Retries changes when the processor fails",
+			Given{
+				Fixtures:    []string{"testdata/list_initial.json", "testdata/list_changed.json", "testdata/list_changed.json"},
+				CallbackErr: errors.New("database is locked"),
+			},
+			Expected{
+				Scans: []autoscan.Scan{
+					{
+						Folder:   "/mnt/unionfs/Media/Movies/Dune (2021)",
+						Priority: 5,
+						Time:     currentTime,
+					},
+					{
+						Folder:   "/mnt/unionfs/Media/Movies/Parasite (2019)",
+						Priority: 5,
+						Time:     currentTime,
+					},
+					{
+						Folder:   "/mnt/unionfs/Media/Movies/Tenet (2020)",
+						Priority: 5,
+						Time:     currentTime,
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			var (
+				polls     int
+				refreshed []string
+			)
+
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				if user, pass, ok := r.BasicAuth(); !ok || user != "rclone" || pass != "secret" {
+					rw.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+
+				switch r.URL.Path {
+				case "/operations/list":
+					fixture, err := os.ReadFile(tc.Given.Fixtures[polls])
+					if err != nil {
+						t.Errorf("Could not open the fixture: %s", tc.Given.Fixtures[polls])
+						rw.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+
+					polls++
+					_, _ = rw.Write(fixture)
+
+				case "/vfs/refresh":
+					params := make(map[string]string)
+					if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+						t.Errorf("Could not decode refresh params: %v", err)
+					}
+
+					refreshed = append(refreshed, params["dir"])
+					_, _ = rw.Write([]byte(`{}`))
+
+				default:
+					rw.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer server.Close()
+
+			var scans []autoscan.Scan
+			callback := func(s ...autoscan.Scan) error {
+				scans = append([]autoscan.Scan{}, s...)
+				return tc.Given.CallbackErr
+			}
+
+			rewriter, err := autoscan.NewRewriter([]autoscan.Rewrite{{
+				From: "^/Media/",
+				To:   "/mnt/unionfs/Media/",
+			}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			filterer, err := autoscan.NewFilterer(nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			d := &daemon{
+				rc: rc{
+					url:      server.URL,
+					username: "rclone",
+					password: "secret",
+					client:   server.Client(),
+				},
+				remote:   "gdrive:",
+				paths:    []string{"Media"},
+				refresh:  tc.Given.Refresh,
+				priority: 5,
+				rewrite:  rewriter,
+				allowed:  filterer,
+				callback: callback,
+				log:      zerolog.Nop(),
+			}
+
+			for range tc.Given.Fixtures {
+				err = d.poll()
+			}
+
+			if !errors.Is(err, tc.Given.CallbackErr) {
+				t.Errorf("Errors do not match: %v vs %v", err, tc.Given.CallbackErr)
+			}
+
+			if !reflect.DeepEqual(tc.Expected.Scans, scans) {
+				t.Logf("want: %v", tc.Expected.Scans)
+				t.Logf("got:  %v", scans)
+				t.Errorf("Scans do not equal")
+			}
+
+			if !reflect.DeepEqual(tc.Expected.Refreshed, refreshed) {
+				t.Logf("want: %v", tc.Expected.Refreshed)
+				t.Logf("got:  %v", refreshed)
+				t.Errorf("Refreshed directories do not equal")
+			}
+		})
+	}
+}
+
+func TestInvalidCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	client := rc{url: server.URL, client: server.Client()}
+
+	_, err := client.List("gdrive:", "")
+	if !errors.Is(err, autoscan.ErrFatal) {
+		t.Errorf("Errors do not match: %v vs %v", err, autoscan.ErrFatal)
+	}
+}
@@ -13,10 +13,15 @@ import (
 )
 
 type Config struct {
-	Name      string             `yaml:"name"`
-	Priority  int                `yaml:"priority"`
-	Rewrite   []autoscan.Rewrite `yaml:"rewrite"`
-	Verbosity string             `yaml:"verbosity"`
+	Name         string             `yaml:"name"`
+	Priority     int                `yaml:"priority"`
+	Rewrite      []autoscan.Rewrite `yaml:"rewrite"`
+	Verbosity    string             `yaml:"verbosity"`
+	AllowedCIDRs []string           `yaml:"allowed-cidrs"`
+	TrustProxy   bool               `yaml:"trust-proxy"`
+
+	// Events limits the handled event types, all supported events are handled when empty.
+	Events []string `yaml:"events"`
 }
 
 // New creates an autoscan-compatible HTTP Trigger for Readarr webhooks.
@@ -26,12 +31,18 @@ func New(c Config) (autoscan.HTTPTrigger, error) {
 		return nil, err
 	}
 
+	allow, err := autoscan.NewAllowlist(c.AllowedCIDRs, c.TrustProxy)
+	if err != nil {
+		return nil, err
+	}
+
 	trigger := func(callback autoscan.ProcessorFunc) http.Handler {
-		return handler{
+		return allow(handler{
 			callback: callback,
+			events:   autoscan.NewEventFilter(c.Events),
 			priority: c.Priority,
 			rewrite:  rewriter,
-		}
+		})
 	}
 
 	return trigger, nil
@@ -41,6 +52,7 @@ type handler struct {
 	priority int
 	rewrite  autoscan.Rewriter
 	callback autoscan.ProcessorFunc
+	events   autoscan.EventFilter
 }
 
 type readarrEvent struct {
@@ -50,6 +62,18 @@ type readarrEvent struct {
 	Files []struct {
 		Path string
 	} `json:"bookFiles"`
+
+	Book struct {
+		Path string
+	} `json:"book"`
+
+	Author struct {
+		Path string
+	} `json:"author"`
+}
+
+func isImportEvent(eventType string) bool {
+	return strings.EqualFold(eventType, "Download") || strings.EqualFold(eventType, "BookImport")
 }
 
 func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
@@ -72,18 +96,50 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	//Only handle test and download. Everything else is ignored.
-	if !strings.EqualFold(event.Type, "Download") || len(event.Files) == 0 {
+	if !h.events(event.Type) {
+		l.Debug().Str("event", event.Type).Msg("Event type not allowed, dropping event")
+		rw.WriteHeader(http.StatusOK)
+		return
+	}
+
+	//Only handle test and imports. Everything else is ignored.
+	if !isImportEvent(event.Type) {
 		l.Error().Msg("Required fields are missing")
 		rw.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
+	folders := make([]string, 0)
+	for _, f := range event.Files {
+		folders = append(folders, path.Dir(f.Path))
+	}
+
+	// fallback to the book folder, otherwise the author folder
+	if len(folders) == 0 {
+		switch {
+		case event.Book.Path != "":
+			folders = append(folders, event.Book.Path)
+		case event.Author.Path != "":
+			folders = append(folders, event.Author.Path)
+		}
+	}
+
+	if len(folders) == 0 {
+		l.Error().Msg("Required fields are missing")
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	scanEvent := autoscan.EventAdd
+	if event.Upgrade {
+		scanEvent = autoscan.EventUpgrade
+	}
+
 	unique := make(map[string]bool)
 	scans := make([]autoscan.Scan, 0)
 
-	for _, f := range event.Files {
-		folderPath := path.Dir(h.rewrite(f.Path))
+	for _, folder := range folders {
+		folderPath := h.rewrite(folder)
 		if _, ok := unique[folderPath]; ok {
 			continue
 		}
@@ -94,6 +150,7 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 			Folder:   folderPath,
 			Priority: h.priority,
 			Time:     now(),
+			Event:    scanEvent,
 		})
 	}
 
@@ -106,6 +163,7 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 
 	rw.WriteHeader(http.StatusOK)
 	l.Info().
+		Str("id", scans[0].ID).
 		Str("path", scans[0].Folder).
 		Str("event", event.Type).
 		Msg("Scan moved to processor")
@@ -38,6 +38,12 @@ func TestHandler(t *testing.T) {
 		}},
 	}
 
+	eventsConfig := standardConfig
+	eventsConfig.Events = []string{"download"}
+
+	filteredConfig := standardConfig
+	filteredConfig.Events = []string{"BookImport"}
+
 	currentTime := time.Now()
 	now = func() time.Time {
 		return currentTime
@@ -56,6 +62,55 @@ func TestHandler(t *testing.T) {
 					Folder:   "/mnt/unionfs/Media/Books/Brandon Sanderson/The Way of Kings (2010)",
 					Priority: 5,
 					Time:     currentTime,
+					Event:    autoscan.EventAdd,
+				}},
+			},
+		},
+		{
+			"Book import",
+			Given{
+				Config:  standardConfig,
+				Fixture: "testdata/book_import.json",
+			},
+			Expected{
+				StatusCode: 200,
+				Scans: []autoscan.Scan{{
+					Folder:   "/mnt/unionfs/Media/Books/Brandon Sanderson/Words of Radiance (2014)",
+					Priority: 5,
+					Time:     currentTime,
+					Event:    autoscan.EventAdd,
+				}},
+			},
+		},
+		{
+			"Book import without files scans the book folder",
+			Given{
+				Config:  standardConfig,
+				Fixture: "testdata/book_folder.json",
+			},
+			Expected{
+				StatusCode: 200,
+				Scans: []autoscan.Scan{{
+					Folder:   "/mnt/unionfs/Media/Books/Brandon Sanderson/Oathbringer (2017)",
+					Priority: 5,
+					Time:     currentTime,
+					Event:    autoscan.EventAdd,
+				}},
+			},
+		},
+		{
+			"Book import falls back to the author folder",
+			Given{
+				Config:  standardConfig,
+				Fixture: "testdata/author_folder.json",
+			},
+			Expected{
+				StatusCode: 200,
+				Scans: []autoscan.Scan{{
+					Folder:   "/mnt/unionfs/Media/Books/Brandon Sanderson",
+					Priority: 5,
+					Time:     currentTime,
+					Event:    autoscan.EventAdd,
 				}},
 			},
 		},
@@ -79,6 +134,32 @@ func TestHandler(t *testing.T) {
 				StatusCode: 200,
 			},
 		},
+		{
+			"Handles event types within the allowed events",
+			Given{
+				Config:  eventsConfig,
+				Fixture: "testdata/sanderson.json",
+			},
+			Expected{
+				StatusCode: 200,
+				Scans: []autoscan.Scan{{
+					Folder:   "/mnt/unionfs/Media/Books/Brandon Sanderson/The Way of Kings (2010)",
+					Priority: 5,
+					Time:     currentTime,
+					Event:    autoscan.EventAdd,
+				}},
+			},
+		},
+		{
+			"Drops event types outside of the allowed events",
+			Given{
+				Config:  filteredConfig,
+				Fixture: "testdata/sanderson.json",
+			},
+			Expected{
+				StatusCode: 200,
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -1,8 +1,10 @@
 package sonarr
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
+	"os"
 	"path"
 	"strings"
 	"time"
@@ -13,12 +15,27 @@ import (
 )
 
 type Config struct {
-	Name      string             `yaml:"name"`
-	Priority  int                `yaml:"priority"`
-	Rewrite   []autoscan.Rewrite `yaml:"rewrite"`
-	Verbosity string             `yaml:"verbosity"`
+	Name         string             `yaml:"name"`
+	Priority     int                `yaml:"priority"`
+	Rewrite      []autoscan.Rewrite `yaml:"rewrite"`
+	Verbosity    string             `yaml:"verbosity"`
+	AllowedCIDRs []string           `yaml:"allowed-cidrs"`
+	TrustProxy   bool               `yaml:"trust-proxy"`
+
+	// Events limits the handled event types, all supported events are handled when empty.
+	Events []string `yaml:"events"`
+
+	// VerifyExists waits for imported files to appear on the file system before scanning their folder.
+	VerifyExists   bool          `yaml:"verify-exists"`
+	VerifyRetries  int           `yaml:"verify-retries"`
+	VerifyInterval time.Duration `yaml:"verify-interval"`
 }
 
+const (
+	defaultVerifyRetries  = 3
+	defaultVerifyInterval = 5 * time.Second
+)
+
 // New creates an autoscan-compatible HTTP Trigger for Sonarr webhooks.
 func New(c Config) (autoscan.HTTPTrigger, error) {
 	rewriter, err := autoscan.NewRewriter(c.Rewrite)
@@ -26,12 +43,31 @@ func New(c Config) (autoscan.HTTPTrigger, error) {
 		return nil, err
 	}
 
+	allow, err := autoscan.NewAllowlist(c.AllowedCIDRs, c.TrustProxy)
+	if err != nil {
+		return nil, err
+	}
+
+	retries := c.VerifyRetries
+	if retries <= 0 {
+		retries = defaultVerifyRetries
+	}
+
+	interval := c.VerifyInterval
+	if interval <= 0 {
+		interval = defaultVerifyInterval
+	}
+
 	trigger := func(callback autoscan.ProcessorFunc) http.Handler {
-		return handler{
-			callback: callback,
-			priority: c.Priority,
-			rewrite:  rewriter,
-		}
+		return allow(handler{
+			callback:       callback,
+			events:         autoscan.NewEventFilter(c.Events),
+			priority:       c.Priority,
+			rewrite:        rewriter,
+			verifyExists:   c.VerifyExists,
+			verifyRetries:  retries,
+			verifyInterval: interval,
+		})
 	}
 
 	return trigger, nil
@@ -41,23 +77,76 @@ type handler struct {
 	priority int
 	rewrite  autoscan.Rewriter
 	callback autoscan.ProcessorFunc
+	events   autoscan.EventFilter
+
+	verifyExists   bool
+	verifyRetries  int
+	verifyInterval time.Duration
+}
+
+// missingFiles checks whether the imported files of all folders exist, retrying while any of them is missing,
+// and returns the folders which still miss files, with their files, once the retries ran out.
+// All folders share the retries, so a season pack waits at most VerifyRetries times VerifyInterval.
+func (h handler) missingFiles(ctx context.Context, imported map[string][]string) map[string][]string {
+	pending := make(map[string][]string, len(imported))
+	for folder, files := range imported {
+		pending[folder] = files
+	}
+
+	for attempt := 0; ; attempt++ {
+		for folder, files := range pending {
+			if allExist(files) {
+				delete(pending, folder)
+			}
+		}
+
+		if len(pending) == 0 || attempt >= h.verifyRetries {
+			return pending
+		}
+
+		select {
+		case <-ctx.Done():
+			return pending
+		case <-time.After(h.verifyInterval):
+		}
+	}
+}
+
+func allExist(files []string) bool {
+	for _, f := range files {
+		if _, err := os.Stat(f); err != nil {
+			return false
+		}
+	}
+
+	return true
 }
 
 type sonarrEvent struct {
-	Type string `json:"eventType"`
+	Type    string `json:"eventType"`
+	Upgrade bool   `json:"isUpgrade"`
+
+	// the EpisodeFileDelete event is also sent when a file is upgraded.
+	DeleteReason string `json:"deleteReason"`
 
 	File struct {
 		RelativePath string
 	} `json:"episodeFile"`
 
+	// season packs may list multiple episode files.
+	Files []struct {
+		RelativePath string
+	} `json:"episodeFiles"`
+
 	Series struct {
 		Path string
 	} `json:"series"`
 
 	RenamedFiles []struct {
 		// use PreviousPath as the Series.Path might have changed.
-		PreviousPath string
-		RelativePath string
+		PreviousPath         string
+		PreviousRelativePath string
+		RelativePath         string
 	} `json:"renamedEpisodeFiles"`
 }
 
@@ -81,20 +170,75 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !h.events(event.Type) {
+		rlog.Debug().Str("event", event.Type).Msg("Event type not allowed, dropping event")
+		rw.WriteHeader(http.StatusOK)
+		return
+	}
+
 	var paths []string
+	var removed bool
+	var scanEvent string
+
+	// imported files per folder, used to verify the files exist.
+	imported := make(map[string][]string)
+
+	// changed files per folder, the scan of a folder with a single changed file passes it on.
+	changed := make(map[string][]string)
 
 	// a Download event is either an upgrade or a new file.
 	// the EpisodeFileDelete event shares the same request format as Download.
 	if strings.EqualFold(event.Type, "Download") || strings.EqualFold(event.Type, "EpisodeFileDelete") {
-		if event.File.RelativePath == "" || event.Series.Path == "" {
+		relativePaths := make([]string, 0)
+		if event.File.RelativePath != "" {
+			relativePaths = append(relativePaths, event.File.RelativePath)
+		}
+
+		for _, f := range event.Files {
+			if f.RelativePath != "" {
+				relativePaths = append(relativePaths, f.RelativePath)
+			}
+		}
+
+		if len(relativePaths) == 0 || event.Series.Path == "" {
 			rlog.Error().Msg("Required fields are missing")
 			rw.WriteHeader(http.StatusBadRequest)
 			return
 		}
 
-		// Use path.Dir to get the directory in which the file is located
-		folderPath := path.Dir(path.Join(event.Series.Path, event.File.RelativePath))
-		paths = append(paths, folderPath)
+		removed = strings.EqualFold(event.Type, "EpisodeFileDelete") && !strings.EqualFold(event.DeleteReason, "upgrade")
+
+		switch {
+		case removed:
+			scanEvent = autoscan.EventDelete
+		case event.Upgrade || strings.EqualFold(event.Type, "EpisodeFileDelete"):
+			scanEvent = autoscan.EventUpgrade
+		default:
+			scanEvent = autoscan.EventAdd
+		}
+
+		// Keep track of which paths and files we have already added.
+		encountered := make(map[string]bool)
+		encounteredFiles := make(map[string]bool)
+
+		for _, relativePath := range relativePaths {
+			// Use path.Dir to get the directory in which the file is located
+			filePath := path.Join(event.Series.Path, relativePath)
+			folderPath := path.Dir(filePath)
+			if strings.EqualFold(event.Type, "Download") {
+				imported[folderPath] = append(imported[folderPath], h.rewrite(filePath))
+			}
+
+			if !encounteredFiles[filePath] {
+				encounteredFiles[filePath] = true
+				changed[folderPath] = append(changed[folderPath], h.rewrite(filePath))
+			}
+
+			if _, ok := encountered[folderPath]; !ok {
+				encountered[folderPath] = true
+				paths = append(paths, folderPath)
+			}
+		}
 	}
 
 	// An entire show has been deleted
@@ -107,6 +251,8 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 
 		// Scan the folder of the show
 		paths = append(paths, event.Series.Path)
+		removed = true
+		scanEvent = autoscan.EventDelete
 	}
 
 	if strings.EqualFold(event.Type, "Rename") {
@@ -116,20 +262,35 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		scanEvent = autoscan.EventRename
+
 		// Keep track of which paths we have already added to paths.
 		encountered := make(map[string]bool)
 
 		for _, renamedFile := range event.RenamedFiles {
-			previousPath := path.Dir(renamedFile.PreviousPath)
-			currentPath := path.Dir(path.Join(event.Series.Path, renamedFile.RelativePath))
+			if renamedFile.RelativePath == "" {
+				rlog.Error().Msg("Required fields are missing")
+				rw.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			// older Sonarr versions only provide the previous relative path.
+			previousFile := renamedFile.PreviousPath
+			if previousFile == "" && renamedFile.PreviousRelativePath != "" {
+				previousFile = path.Join(event.Series.Path, renamedFile.PreviousRelativePath)
+			}
 
 			// if previousPath not in paths, then add it.
-			if _, ok := encountered[previousPath]; !ok {
-				encountered[previousPath] = true
-				paths = append(paths, previousPath)
+			if previousFile != "" {
+				previousPath := path.Dir(previousFile)
+				if _, ok := encountered[previousPath]; !ok {
+					encountered[previousPath] = true
+					paths = append(paths, previousPath)
+				}
 			}
 
 			// if currentPath not in paths, then add it.
+			currentPath := path.Dir(path.Join(event.Series.Path, renamedFile.RelativePath))
 			if _, ok := encountered[currentPath]; !ok {
 				encountered[currentPath] = true
 				paths = append(paths, currentPath)
@@ -137,20 +298,44 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	var missing map[string][]string
+	if h.verifyExists {
+		missing = h.missingFiles(r.Context(), imported)
+	}
+
 	var scans []autoscan.Scan
 
-	for _, folderPath := range paths {
-		folderPath := h.rewrite(folderPath)
+	for _, p := range paths {
+		folderPath := h.rewrite(p)
+
+		if files, ok := missing[p]; ok {
+			rlog.Warn().
+				Str("path", folderPath).
+				Strs("files", files).
+				Msg("Imported files do not exist, dropping scan")
+			continue
+		}
 
 		scan := autoscan.Scan{
 			Folder:   folderPath,
 			Priority: h.priority,
 			Time:     now(),
+			Removed:  removed,
+			Event:    scanEvent,
+		}
+
+		if files := changed[p]; len(files) == 1 {
+			scan.File = files[0]
 		}
 
 		scans = append(scans, scan)
 	}
 
+	if len(scans) == 0 {
+		rw.WriteHeader(http.StatusOK)
+		return
+	}
+
 	err = h.callback(scans...)
 	if err != nil {
 		rlog.Error().Err(err).Msg("Processor could not process scans")
@@ -160,8 +345,10 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 
 	for _, scan := range scans {
 		rlog.Info().
+			Str("id", scan.ID).
 			Str("path", scan.Folder).
 			Str("event", event.Type).
+			Bool("removed", scan.Removed).
 			Msg("Scan moved to processor")
 	}
 
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 	"time"
@@ -38,6 +39,12 @@ func TestHandler(t *testing.T) {
 		}},
 	}
 
+	eventsConfig := standardConfig
+	eventsConfig.Events = []string{"download"}
+
+	filteredConfig := standardConfig
+	filteredConfig.Events = []string{"Rename"}
+
 	currentTime := time.Now()
 	now = func() time.Time {
 		return currentTime
@@ -55,8 +62,35 @@ func TestHandler(t *testing.T) {
 				Scans: []autoscan.Scan{
 					{
 						Folder:   "/mnt/unionfs/Media/TV/Westworld/Season 1",
+						File:     "/mnt/unionfs/Media/TV/Westworld/Season 1/Westworld.S01E01.mkv",
+						Priority: 5,
+						Time:     currentTime,
+						Event:    autoscan.EventAdd,
+					},
+				},
+			},
+		},
+		{
+			"Scans each distinct folder of a multi-file Download event",
+			Given{
+				Config:  standardConfig,
+				Fixture: "testdata/season_pack.json",
+			},
+			Expected{
+				StatusCode: 200,
+				Scans: []autoscan.Scan{
+					{
+						Folder:   "/mnt/unionfs/Media/TV/Westworld/Season 1",
+						Priority: 5,
+						Time:     currentTime,
+						Event:    autoscan.EventAdd,
+					},
+					{
+						Folder:   "/mnt/unionfs/Media/TV/Westworld/Season 2",
+						File:     "/mnt/unionfs/Media/TV/Westworld/Season 2/Westworld.S02E01.mkv",
 						Priority: 5,
 						Time:     currentTime,
+						Event:    autoscan.EventAdd,
 					},
 				},
 			},
@@ -72,8 +106,30 @@ func TestHandler(t *testing.T) {
 				Scans: []autoscan.Scan{
 					{
 						Folder:   "/mnt/unionfs/Media/TV/Westworld/Season 2",
+						File:     "/mnt/unionfs/Media/TV/Westworld/Season 2/Westworld.S02E01.mkv",
 						Priority: 5,
 						Time:     currentTime,
+						Removed:  true,
+						Event:    autoscan.EventDelete,
+					},
+				},
+			},
+		},
+		{
+			"EpisodeFileDelete event on upgrade is not a removal",
+			Given{
+				Config:  standardConfig,
+				Fixture: "testdata/episode_file_upgrade.json",
+			},
+			Expected{
+				StatusCode: 200,
+				Scans: []autoscan.Scan{
+					{
+						Folder:   "/mnt/unionfs/Media/TV/Westworld/Season 2",
+						File:     "/mnt/unionfs/Media/TV/Westworld/Season 2/Westworld.S02E01.mkv",
+						Priority: 5,
+						Time:     currentTime,
+						Event:    autoscan.EventUpgrade,
 					},
 				},
 			},
@@ -91,21 +147,55 @@ func TestHandler(t *testing.T) {
 						Folder:   "/mnt/unionfs/Media/TV/Westworld/Season 1",
 						Priority: 5,
 						Time:     currentTime,
+						Event:    autoscan.EventRename,
 					},
 					{
 						Folder:   "/mnt/unionfs/Media/TV/Westworld [imdb:tt0475784]/Season 1",
 						Priority: 5,
 						Time:     currentTime,
+						Event:    autoscan.EventRename,
 					},
 					{
 						Folder:   "/mnt/unionfs/Media/TV/Westworld/Season 2",
 						Priority: 5,
 						Time:     currentTime,
+						Event:    autoscan.EventRename,
 					},
 					{
 						Folder:   "/mnt/unionfs/Media/TV/Westworld [imdb:tt0475784]/Season 2",
 						Priority: 5,
 						Time:     currentTime,
+						Event:    autoscan.EventRename,
+					},
+				},
+			},
+		},
+		{
+			"Falls back to the previous relative path on the Rename event",
+			Given{
+				Config:  standardConfig,
+				Fixture: "testdata/rename_relative.json",
+			},
+			Expected{
+				StatusCode: 200,
+				Scans: []autoscan.Scan{
+					{
+						Folder:   "/mnt/unionfs/Media/TV/Westworld/Season 1",
+						Priority: 5,
+						Time:     currentTime,
+						Event:    autoscan.EventRename,
+					},
+					{
+						Folder:   "/mnt/unionfs/Media/TV/Westworld/Specials",
+						Priority: 5,
+						Time:     currentTime,
+						Event:    autoscan.EventRename,
+					},
+					{
+						Folder:   "/mnt/unionfs/Media/TV/Westworld/Season 2",
+						Priority: 5,
+						Time:     currentTime,
+						Event:    autoscan.EventRename,
 					},
 				},
 			},
@@ -123,6 +213,8 @@ func TestHandler(t *testing.T) {
 						Folder:   "/mnt/unionfs/Media/TV/Westworld",
 						Priority: 5,
 						Time:     currentTime,
+						Removed:  true,
+						Event:    autoscan.EventDelete,
 					},
 				},
 			},
@@ -147,6 +239,35 @@ func TestHandler(t *testing.T) {
 				StatusCode: 200,
 			},
 		},
+		{
+			"Handles event types within the allowed events",
+			Given{
+				Config:  eventsConfig,
+				Fixture: "testdata/westworld.json",
+			},
+			Expected{
+				StatusCode: 200,
+				Scans: []autoscan.Scan{
+					{
+						Folder:   "/mnt/unionfs/Media/TV/Westworld/Season 1",
+						File:     "/mnt/unionfs/Media/TV/Westworld/Season 1/Westworld.S01E01.mkv",
+						Priority: 5,
+						Time:     currentTime,
+						Event:    autoscan.EventAdd,
+					},
+				},
+			},
+		},
+		{
+			"Drops event types outside of the allowed events",
+			Given{
+				Config:  filteredConfig,
+				Fixture: "testdata/westworld.json",
+			},
+			Expected{
+				StatusCode: 200,
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -187,3 +308,206 @@ func TestHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestVerifyExists(t *testing.T) {
+	type Given struct {
+		Files   []string
+		Delayed []string
+	}
+
+	type Expected struct {
+		Folders []string
+		Files   map[string]string
+	}
+
+	type Test struct {
+		Name     string
+		Given    Given
+		Expected Expected
+	}
+
+	season1 := []string{
+		"Westworld/Season 1/Westworld.S01E01.mkv",
+		"Westworld/Season 1/Westworld.S01E02.mkv",
+		"Westworld/Season 1/Westworld.S01E03.mkv",
+	}
+
+	var testCases = []Test{
+		{
+			"Scans folders of which all files exist",
+			Given{
+				Files: append(season1, "Westworld/Season 2/Westworld.S02E01.mkv"),
+			},
+			Expected{
+				Folders: []string{"Westworld/Season 1", "Westworld/Season 2"},
+				Files: map[string]string{
+					"Westworld/Season 2": "Westworld/Season 2/Westworld.S02E01.mkv",
+				},
+			},
+		},
+		{
+			"Drops folders with missing files",
+			Given{
+				Files: season1,
+			},
+			Expected{
+				Folders: []string{"Westworld/Season 1"},
+			},
+		},
+		{
+			"Waits for files to appear",
+			Given{
+				Files:   season1,
+				Delayed: []string{"Westworld/Season 2/Westworld.S02E01.mkv"},
+			},
+			Expected{
+				Folders: []string{"Westworld/Season 1", "Westworld/Season 2"},
+				Files: map[string]string{
+					"Westworld/Season 2": "Westworld/Season 2/Westworld.S02E01.mkv",
+				},
+			},
+		},
+	}
+
+	currentTime := time.Now()
+	now = func() time.Time {
+		return currentTime
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			root := t.TempDir()
+			create := func(files []string) {
+				for _, f := range files {
+					if err := os.MkdirAll(filepath.Join(root, filepath.Dir(f)), 0755); err != nil {
+						t.Error(err)
+					}
+					if err := os.WriteFile(filepath.Join(root, f), nil, 0644); err != nil {
+						t.Error(err)
+					}
+				}
+			}
+
+			create(tc.Given.Files)
+
+			// the delayed files are created while the trigger waits for them,
+			// the subtest waits for them before its TempDir is removed.
+			delayed := append([]string(nil), tc.Given.Delayed...)
+			created := make(chan struct{})
+			timer := time.AfterFunc(30*time.Millisecond, func() {
+				defer close(created)
+				create(delayed)
+			})
+			defer func() {
+				if !timer.Stop() {
+					<-created
+				}
+			}()
+
+			var expected []autoscan.Scan
+			for _, folder := range tc.Expected.Folders {
+				scan := autoscan.Scan{
+					Folder:   filepath.Join(root, folder),
+					Priority: 5,
+					Time:     currentTime,
+					Event:    autoscan.EventAdd,
+				}
+				if file, ok := tc.Expected.Files[folder]; ok {
+					scan.File = filepath.Join(root, file)
+				}
+
+				expected = append(expected, scan)
+			}
+
+			callback := func(scans ...autoscan.Scan) error {
+				if !reflect.DeepEqual(expected, scans) {
+					t.Logf("want: %v", expected)
+					t.Logf("got:  %v", scans)
+					t.Errorf("Scans do not equal")
+					return errors.New("Scans do not equal")
+				}
+
+				return nil
+			}
+
+			trigger, err := New(Config{
+				Name:     "sonarr",
+				Priority: 5,
+				Rewrite: []autoscan.Rewrite{{
+					From: "^/TV/",
+					To:   root + "/",
+				}},
+				VerifyExists:   true,
+				VerifyRetries:  5,
+				VerifyInterval: 20 * time.Millisecond,
+			})
+			if err != nil {
+				t.Fatalf("Could not create Sonarr Trigger: %v", err)
+			}
+
+			server := httptest.NewServer(trigger(callback))
+			defer server.Close()
+
+			request, err := os.Open("testdata/season_pack.json")
+			if err != nil {
+				t.Fatalf("Could not open the fixture: %s", "testdata/season_pack.json")
+			}
+
+			res, err := http.Post(server.URL, "application/json", request)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+
+			defer res.Body.Close()
+			if res.StatusCode != 200 {
+				t.Errorf("Status codes do not match: %d vs %d", res.StatusCode, 200)
+			}
+		})
+	}
+}
+
+func TestVerifyExistsSharesRetries(t *testing.T) {
+	// the files of both seasons of the pack never appear.
+	root := t.TempDir()
+
+	trigger, err := New(Config{
+		Name:     "sonarr",
+		Priority: 5,
+		Rewrite: []autoscan.Rewrite{{
+			From: "^/TV/",
+			To:   root + "/",
+		}},
+		VerifyExists:   true,
+		VerifyRetries:  10,
+		VerifyInterval: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Could not create Sonarr Trigger: %v", err)
+	}
+
+	callback := func(scans ...autoscan.Scan) error {
+		t.Errorf("Scans of missing files were not dropped: %v", scans)
+		return nil
+	}
+
+	server := httptest.NewServer(trigger(callback))
+	defer server.Close()
+
+	request, err := os.Open("testdata/season_pack.json")
+	if err != nil {
+		t.Fatalf("Could not open the fixture: %s", "testdata/season_pack.json")
+	}
+
+	start := time.Now()
+	res, err := http.Post(server.URL, "application/json", request)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	// one folder after the other would wait twice the 200ms of the retries.
+	if elapsed := time.Since(start); elapsed >= 350*time.Millisecond {
+		t.Errorf("Folders were not verified within the same retries: %v", elapsed)
+	}
+}
@@ -0,0 +1,67 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+)
+
+// maxMemory limits the part of a multipart body which is kept in memory.
+const maxMemory = 10 << 20
+
+var errUnsupportedMediaType = errors.New("unsupported media type")
+
+// decodePayload decodes a JSON, form-encoded or multipart body.
+// Form bodies carrying a JSON document in their payload field, such as the webhooks of Plex, are decoded as that document.
+// Other form bodies are decoded as an object of their fields.
+func decodePayload(r *http.Request) (interface{}, error) {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/json"
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, errUnsupportedMediaType)
+	}
+
+	switch mediaType {
+	case "application/json":
+		var payload interface{}
+		err := json.NewDecoder(r.Body).Decode(&payload)
+		return payload, err
+
+	case "application/x-www-form-urlencoded":
+		if err := r.ParseForm(); err != nil {
+			return nil, err
+		}
+
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(maxMemory); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("%s: %w", mediaType, errUnsupportedMediaType)
+	}
+
+	if p := r.PostForm.Get("payload"); p != "" {
+		var payload interface{}
+		err := json.Unmarshal([]byte(p), &payload)
+		return payload, err
+	}
+
+	payload := make(map[string]interface{})
+	for key, values := range r.PostForm {
+		if len(values) == 1 {
+			payload[key] = values[0]
+			continue
+		}
+
+		payload[key] = values
+	}
+
+	return payload, nil
+}
@@ -0,0 +1,245 @@
+package webhook
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/rs/zerolog/hlog"
+
+	"github.com/cloudbox/autoscan"
+)
+
+type Config struct {
+	Name         string             `yaml:"name"`
+	Priority     int                `yaml:"priority"`
+	Rewrite      []autoscan.Rewrite `yaml:"rewrite"`
+	Verbosity    string             `yaml:"verbosity"`
+	AllowedCIDRs []string           `yaml:"allowed-cidrs"`
+	TrustProxy   bool               `yaml:"trust-proxy"`
+	Path         string             `yaml:"path"`
+	PathKey      string             `yaml:"path-key"`
+	RelativeKey  string             `yaml:"relative-key"`
+	Filter       string             `yaml:"filter"`
+}
+
+var funcs = template.FuncMap{
+	"join": path.Join,
+	"dir":  path.Dir,
+}
+
+// parse validates a template of the config, the payload fields must be present when the template is executed.
+func parse(name string, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%s template: %v: %w", name, err, autoscan.ErrFatal)
+	}
+
+	return tmpl, nil
+}
+
+// New creates an autoscan-compatible HTTP Trigger for generic JSON and form webhooks.
+//
+// The path template determines the folders to scan, one per line.
+// Alternatively, the path key names the field of a flat payload holding the folder,
+// the optional relative key names the field holding a path relative to that folder.
+// The optional filter template must render to true for an event to be scanned.
+func New(c Config) (autoscan.HTTPTrigger, error) {
+	rewriter, err := autoscan.NewRewriter(c.Rewrite)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case c.Path == "" && c.PathKey == "":
+		return nil, fmt.Errorf("%s: path template or path key is required: %w", c.Name, autoscan.ErrFatal)
+	case c.Path != "" && c.PathKey != "":
+		return nil, fmt.Errorf("%s: path template and path key are mutually exclusive: %w", c.Name, autoscan.ErrFatal)
+	case c.RelativeKey != "" && c.PathKey == "":
+		return nil, fmt.Errorf("%s: relative key requires a path key: %w", c.Name, autoscan.ErrFatal)
+	}
+
+	var pathTmpl *template.Template
+	if c.Path != "" {
+		pathTmpl, err = parse("path", c.Path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var filterTmpl *template.Template
+	if c.Filter != "" {
+		filterTmpl, err = parse("filter", c.Filter)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	allow, err := autoscan.NewAllowlist(c.AllowedCIDRs, c.TrustProxy)
+	if err != nil {
+		return nil, err
+	}
+
+	trigger := func(callback autoscan.ProcessorFunc) http.Handler {
+		return allow(handler{
+			callback:    callback,
+			priority:    c.Priority,
+			rewrite:     rewriter,
+			path:        pathTmpl,
+			pathKey:     c.PathKey,
+			relativeKey: c.RelativeKey,
+			filter:      filterTmpl,
+		})
+	}
+
+	return trigger, nil
+}
+
+type handler struct {
+	priority int
+	rewrite  autoscan.Rewriter
+	callback autoscan.ProcessorFunc
+	path     *template.Template
+	filter   *template.Template
+
+	pathKey     string
+	relativeKey string
+}
+
+func execute(tmpl *template.Template, payload interface{}) (string, error) {
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, payload); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// lookup returns the string field of a flat payload.
+func lookup(payload interface{}, key string) (string, error) {
+	fields, ok := payload.(map[string]interface{})
+	if !ok {
+		return "", errors.New("payload is not an object")
+	}
+
+	value, ok := fields[key].(string)
+	if !ok {
+		return "", fmt.Errorf("field %q is missing or not a string", key)
+	}
+
+	return value, nil
+}
+
+// folders returns the folders to scan of a payload, one per line.
+func (h handler) folders(payload interface{}) (string, error) {
+	if h.path != nil {
+		return execute(h.path, payload)
+	}
+
+	folder, err := lookup(payload, h.pathKey)
+	if err != nil {
+		return "", err
+	}
+
+	if h.relativeKey == "" {
+		return folder, nil
+	}
+
+	relative, err := lookup(payload, h.relativeKey)
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(folder, relative), nil
+}
+
+func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	var err error
+	l := hlog.FromRequest(r)
+
+	payload, err := decodePayload(r)
+	switch {
+	case errors.Is(err, errUnsupportedMediaType):
+		l.Error().Err(err).Msg("Unsupported content type")
+		rw.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	case err != nil:
+		l.Error().Err(err).Msg("Failed decoding request")
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	l.Trace().Interface("payload", payload).Msg("Received body")
+
+	if h.filter != nil {
+		allowed, err := execute(h.filter, payload)
+		if err != nil {
+			l.Error().Err(err).Msg("Failed evaluating filter")
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if allowed != "true" {
+			l.Debug().Msg("Event ignored by filter")
+			rw.WriteHeader(http.StatusOK)
+			return
+		}
+	}
+
+	rendered, err := h.folders(payload)
+	if err != nil {
+		l.Error().Err(err).Msg("Required fields are missing")
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	unique := make(map[string]bool)
+	scans := make([]autoscan.Scan, 0)
+
+	for _, line := range strings.Split(rendered, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		folderPath := h.rewrite(path.Clean(line))
+		if unique[folderPath] {
+			continue
+		}
+
+		unique[folderPath] = true
+		scans = append(scans, autoscan.Scan{
+			Folder:   folderPath,
+			Priority: h.priority,
+			Time:     now(),
+		})
+	}
+
+	if len(scans) == 0 {
+		l.Error().Msg("Required fields are missing")
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = h.callback(scans...)
+	if err != nil {
+		l.Error().Err(err).Msg("Processor could not process scans")
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	for _, scan := range scans {
+		l.Info().
+			Str("id", scan.ID).
+			Str("path", scan.Folder).
+			Msg("Scan moved to processor")
+	}
+}
+
+var now = time.Now
@@ -0,0 +1,465 @@
+package webhook
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudbox/autoscan"
+)
+
+func TestHandler(t *testing.T) {
+	type Given struct {
+		Config  Config
+		Fixture string
+	}
+
+	type Expected struct {
+		Scans      []autoscan.Scan
+		StatusCode int
+	}
+
+	type Test struct {
+		Name     string
+		Given    Given
+		Expected Expected
+	}
+
+	rewrite := []autoscan.Rewrite{{
+		From: "^/Media/",
+		To:   "/mnt/unionfs/Media/",
+	}}
+
+	flatConfig := Config{
+		Name:     "webhook",
+		Priority: 5,
+		Rewrite:  rewrite,
+		Path:     "{{ .folder }}",
+		Filter:   `{{ eq .type "import" }}`,
+	}
+
+	currentTime := time.Now()
+	now = func() time.Time {
+		return currentTime
+	}
+
+	var testCases = []Test{
+		{
+			"Scan has all the correct fields",
+			Given{
+				Config:  flatConfig,
+				Fixture: "testdata/flat.json",
+			},
+			Expected{
+				StatusCode: 200,
+				Scans: []autoscan.Scan{{
+					Folder:   "/mnt/unionfs/Media/Movies/Parasite (2019)",
+					Priority: 5,
+					Time:     currentTime,
+				}},
+			},
+		},
+		{
+			"Joins a base path and a relative path from nested fields",
+			Given{
+				Config: Config{
+					Name:     "tdarr",
+					Priority: 5,
+					Rewrite:  rewrite,
+					Path:     "{{ dir (join .file.library.root .file.relativePath) }}",
+				},
+				Fixture: "testdata/tdarr.json",
+			},
+			Expected{
+				StatusCode: 200,
+				Scans: []autoscan.Scan{{
+					Folder:   "/mnt/unionfs/Media/Movies/Interstellar (2014)",
+					Priority: 5,
+					Time:     currentTime,
+				}},
+			},
+		},
+		{
+			"Each line is a separate folder",
+			Given{
+				Config: Config{
+					Name:     "webhook",
+					Priority: 5,
+					Rewrite:  rewrite,
+					Path:     "{{ range .items }}{{ .folder }}\n{{ end }}",
+				},
+				Fixture: "testdata/multiple.json",
+			},
+			Expected{
+				StatusCode: 200,
+				Scans: []autoscan.Scan{
+					{
+						Folder:   "/mnt/unionfs/Media/Movies/Parasite (2019)",
+						Priority: 5,
+						Time:     currentTime,
+					},
+					{
+						Folder:   "/mnt/unionfs/Media/Movies/Tenet (2020)",
+						Priority: 5,
+						Time:     currentTime,
+					},
+				},
+			},
+		},
+		{
+			"Scans the folder of the path key",
+			Given{
+				Config: Config{
+					Name:     "webhook",
+					Priority: 5,
+					Rewrite:  rewrite,
+					PathKey:  "folder",
+				},
+				Fixture: "testdata/flat.json",
+			},
+			Expected{
+				StatusCode: 200,
+				Scans: []autoscan.Scan{{
+					Folder:   "/mnt/unionfs/Media/Movies/Parasite (2019)",
+					Priority: 5,
+					Time:     currentTime,
+				}},
+			},
+		},
+		{
+			"Appends the relative key to the path key",
+			Given{
+				Config: Config{
+					Name:        "webhook",
+					Priority:    5,
+					Rewrite:     rewrite,
+					PathKey:     "dir",
+					RelativeKey: "relative",
+				},
+				Fixture: "testdata/relative.json",
+			},
+			Expected{
+				StatusCode: 200,
+				Scans: []autoscan.Scan{{
+					Folder:   "/mnt/unionfs/Media/TV/Westworld/Season 1",
+					Priority: 5,
+					Time:     currentTime,
+				}},
+			},
+		},
+		{
+			"Returns bad request when the path key is missing",
+			Given{
+				Config: Config{
+					Name:    "webhook",
+					Rewrite: rewrite,
+					PathKey: "path",
+				},
+				Fixture: "testdata/flat.json",
+			},
+			Expected{
+				StatusCode: 400,
+			},
+		},
+		{
+			"Returns bad request when the relative key is missing",
+			Given{
+				Config: Config{
+					Name:        "webhook",
+					Rewrite:     rewrite,
+					PathKey:     "folder",
+					RelativeKey: "relative",
+				},
+				Fixture: "testdata/flat.json",
+			},
+			Expected{
+				StatusCode: 400,
+			},
+		},
+		{
+			"Returns 200 on filtered events without emitting a scan",
+			Given{
+				Config:  flatConfig,
+				Fixture: "testdata/ignored.json",
+			},
+			Expected{
+				StatusCode: 200,
+			},
+		},
+		{
+			"Returns bad request when the fields are missing",
+			Given{
+				Config:  flatConfig,
+				Fixture: "testdata/tdarr.json",
+			},
+			Expected{
+				StatusCode: 400,
+			},
+		},
+		{
+			"Returns bad request on invalid JSON",
+			Given{
+				Config:  flatConfig,
+				Fixture: "testdata/invalid.json",
+			},
+			Expected{
+				StatusCode: 400,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			callback := func(scans ...autoscan.Scan) error {
+				if !reflect.DeepEqual(tc.Expected.Scans, scans) {
+					t.Logf("want: %v", tc.Expected.Scans)
+					t.Logf("got:  %v", scans)
+					t.Errorf("Scans do not equal")
+					return errors.New("Scans do not equal")
+				}
+
+				return nil
+			}
+
+			trigger, err := New(tc.Given.Config)
+			if err != nil {
+				t.Fatalf("Could not create Webhook Trigger: %v", err)
+			}
+
+			server := httptest.NewServer(trigger(callback))
+			defer server.Close()
+
+			request, err := os.Open(tc.Given.Fixture)
+			if err != nil {
+				t.Fatalf("Could not open the fixture: %s", tc.Given.Fixture)
+			}
+
+			res, err := http.Post(server.URL, "application/json", request)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+
+			defer res.Body.Close()
+			if res.StatusCode != tc.Expected.StatusCode {
+				t.Errorf("Status codes do not match: %d vs %d", res.StatusCode, tc.Expected.StatusCode)
+			}
+		})
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	type Test struct {
+		Name   string
+		Config Config
+	}
+
+	var testCases = []Test{
+		{
+			Name:   "Missing path template",
+			Config: Config{Name: "webhook"},
+		},
+		{
+			Name:   "Both path template and path key",
+			Config: Config{Name: "webhook", Path: "{{ .folder }}", PathKey: "folder"},
+		},
+		{
+			Name:   "Relative key without path key",
+			Config: Config{Name: "webhook", RelativeKey: "relative"},
+		},
+		{
+			Name:   "Invalid path template",
+			Config: Config{Name: "webhook", Path: "{{ .folder "},
+		},
+		{
+			Name:   "Invalid filter template",
+			Config: Config{Name: "webhook", Path: "{{ .folder }}", Filter: "{{ unknown .type }}"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			_, err := New(tc.Config)
+			if !errors.Is(err, autoscan.ErrFatal) {
+				t.Errorf("Errors do not match: %v vs %v", err, autoscan.ErrFatal)
+			}
+		})
+	}
+}
+
+func multipartBody(t *testing.T, payload string) (string, *bytes.Buffer) {
+	t.Helper()
+
+	body := new(bytes.Buffer)
+	w := multipart.NewWriter(body)
+
+	if err := w.WriteField("payload", payload); err != nil {
+		t.Fatal(err)
+	}
+
+	// Plex also attaches a thumbnail to its webhooks
+	thumb, err := w.CreateFormFile("thumb", "thumb.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := thumb.Write([]byte("jpeg")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return w.FormDataContentType(), body
+}
+
+func TestContentTypes(t *testing.T) {
+	type Given struct {
+		ContentType string
+		Body        io.Reader
+	}
+
+	type Expected struct {
+		Scans      []autoscan.Scan
+		StatusCode int
+	}
+
+	type Test struct {
+		Name     string
+		Given    Given
+		Expected Expected
+	}
+
+	config := Config{
+		Name:     "webhook",
+		Priority: 5,
+		Rewrite: []autoscan.Rewrite{{
+			From: "^/Media/",
+			To:   "/mnt/unionfs/Media/",
+		}},
+		Path:   "{{ .folder }}",
+		Filter: `{{ eq .type "import" }}`,
+	}
+
+	currentTime := time.Now()
+	now = func() time.Time {
+		return currentTime
+	}
+
+	multipartType, multipartPayload := multipartBody(t, `{"type": "import", "folder": "/Media/Movies/Tenet (2020)"}`)
+
+	var testCases = []Test{
+		{
+			"Form fields",
+			Given{
+				ContentType: "application/x-www-form-urlencoded",
+				Body: strings.NewReader(url.Values{
+					"type":   []string{"import"},
+					"folder": []string{"/Media/Movies/Parasite (2019)"},
+				}.Encode()),
+			},
+			Expected{
+				StatusCode: 200,
+				Scans: []autoscan.Scan{{
+					Folder:   "/mnt/unionfs/Media/Movies/Parasite (2019)",
+					Priority: 5,
+					Time:     currentTime,
+				}},
+			},
+		},
+		{
+			"Form payload field",
+			Given{
+				ContentType: "application/x-www-form-urlencoded",
+				Body: strings.NewReader(url.Values{
+					"payload": []string{`{"type": "import", "folder": "/Media/Movies/Dune (2021)"}`},
+				}.Encode()),
+			},
+			Expected{
+				StatusCode: 200,
+				Scans: []autoscan.Scan{{
+					Folder:   "/mnt/unionfs/Media/Movies/Dune (2021)",
+					Priority: 5,
+					Time:     currentTime,
+				}},
+			},
+		},
+		{
+			"Multipart payload field",
+			Given{
+				ContentType: multipartType,
+				Body:        multipartPayload,
+			},
+			Expected{
+				StatusCode: 200,
+				Scans: []autoscan.Scan{{
+					Folder:   "/mnt/unionfs/Media/Movies/Tenet (2020)",
+					Priority: 5,
+					Time:     currentTime,
+				}},
+			},
+		},
+		{
+			"Returns bad request on an invalid payload field",
+			Given{
+				ContentType: "application/x-www-form-urlencoded",
+				Body:        strings.NewReader(url.Values{"payload": []string{`{"type": `}}.Encode()),
+			},
+			Expected{
+				StatusCode: 400,
+			},
+		},
+		{
+			"Returns unsupported media type on other content types",
+			Given{
+				ContentType: "text/plain",
+				Body:        strings.NewReader("/Media/Movies/Parasite (2019)"),
+			},
+			Expected{
+				StatusCode: 415,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			callback := func(scans ...autoscan.Scan) error {
+				if !reflect.DeepEqual(tc.Expected.Scans, scans) {
+					t.Logf("want: %v", tc.Expected.Scans)
+					t.Logf("got:  %v", scans)
+					t.Errorf("Scans do not equal")
+					return errors.New("Scans do not equal")
+				}
+
+				return nil
+			}
+
+			trigger, err := New(config)
+			if err != nil {
+				t.Fatalf("Could not create Webhook Trigger: %v", err)
+			}
+
+			server := httptest.NewServer(trigger(callback))
+			defer server.Close()
+
+			res, err := http.Post(server.URL, tc.Given.ContentType, tc.Given.Body)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+
+			defer res.Body.Close()
+			if res.StatusCode != tc.Expected.StatusCode {
+				t.Errorf("Status codes do not match: %d vs %d", res.StatusCode, tc.Expected.StatusCode)
+			}
+		})
+	}
+}
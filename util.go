@@ -3,6 +3,7 @@ package autoscan
 import (
 	"fmt"
 	"net/url"
+	"os"
 	"path"
 	"strings"
 )
@@ -23,3 +24,17 @@ func DSN(path string, q url.Values) string {
 
 	return u.String()
 }
+
+// CheckReadyPath returns ErrTargetNotReady when the given path
+// does not exist. An empty path is always ready.
+func CheckReadyPath(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("%s: %w", path, ErrTargetNotReady)
+	}
+
+	return nil
+}
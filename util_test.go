@@ -1,7 +1,9 @@
 package autoscan
 
 import (
+	"errors"
 	"net/url"
+	"path/filepath"
 	"testing"
 )
 
@@ -57,3 +59,37 @@ func TestDSN(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckReadyPath(t *testing.T) {
+	dir := t.TempDir()
+
+	type Test struct {
+		Name    string
+		Path    string
+		WantErr error
+	}
+
+	var testCases = []Test{
+		{
+			Name: "Empty path is always ready",
+		},
+		{
+			Name: "Existing directory",
+			Path: dir,
+		},
+		{
+			Name:    "Missing path",
+			Path:    filepath.Join(dir, "missing"),
+			WantErr: ErrTargetNotReady,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			err := CheckReadyPath(tc.Path)
+			if !errors.Is(err, tc.WantErr) {
+				t.Errorf("Errors do not match: %v vs %v", err, tc.WantErr)
+			}
+		})
+	}
+}